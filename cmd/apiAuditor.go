@@ -11,7 +11,44 @@ var apiAuditorCmd = &cobra.Command{
 	Use:   "apiAuditor",
 	Short: "A realtime view of how much you are spending on 3rd party AI services",
 	Long: `Services currently supported:
-- OpenAI (Completions API only)
+- OpenAI (chat completions, embeddings, images, audio, moderations, and batch output files)
+- Anthropic (messages)
+
+Prices are compiled in, use --pricing-file to add models or override prices. The pricing file is
+reloaded when it changes, or when the proxy receives SIGHUP.
+
+Use --ledger-file to keep a record of every transaction that survives restarts. The grand total
+starts from the month-to-date cost in the ledger.
+
+Memory use doesn't grow with the number of requests. Each model keeps lifetime totals, a rolling
+window of counts, tokens, cost and latency (see --stats-window), and optionally the last few raw
+requests (see --stats-samples). The stats are logged when the proxy stops.
+
+Use --output-format json to write one JSON object per request, with snake_case keys, a timestamp,
+the request tags and the cache status, for log pipelines. Templates can use these placeholders:
+{timestamp}, {url}, {model}, {inputCost}, {cachedInputCost}, {outputCost}, {reasoningCost},
+{totalReqCost}, {grandTotal}, {cost}, {currency}, {tags}, {cacheStatus}, and {pricedModel}, which
+is only set when the price of another model was used, e.g., the base model of a fine-tuned model.
+
+Prices are in USD. Use --currency with an --exchange-rates file to print the costs in another
+currency, and --locale to format them, e.g., --currency EUR --locale de-DE. The ledger keeps the
+original USD cost, and the converted cost.
+
+With --estimate-cost, each response has an X-Llm_proxy-Estimated-Cost header, with the cost
+estimated before the request was sent, from the prompt tokens and the requested maximum output
+tokens. OpenAI prompts are counted with the compiled in tokenizers, other prompts are estimated from
+their length. Responses without usage data are priced from the same estimates.
+
+The same estimates are checked before each request is sent. With --budget, a request that would
+take the grand total over the budget is answered with a 429 insufficient_quota error. With
+--ledger-file the grand total is the month-to-date cost, so the budget is monthly. With
+--tokens-per-minute, a request that would go over the limit in the last minute is answered with a
+429 rate_limit_exceeded error, and a Retry-After header. The requested maximum output tokens are
+counted, the same as the OpenAI rate limits.
+
+Cached input tokens, reasoning tokens, and batch requests are billed at their own rates, when the
+pricing data has them. Batch costs are counted when the batch output file is downloaded through the
+proxy.
 
 Disclaimer:
 This tool is not affiliated with any of these APIs.
@@ -26,4 +63,61 @@ All information & calculations are an approximation, and should not be used for
 func init() {
 	rootCmd.AddCommand(apiAuditorCmd)
 	apiAuditorCmd.SuggestFor = api_auditor_suggestions
+
+	apiAuditorCmd.Flags().StringVar(
+		&cfg.Audit.PricingFile, "pricing-file", cfg.Audit.PricingFile,
+		"JSON pricing file, or directory of JSON files, that overrides or adds to the built-in prices",
+	)
+	apiAuditorCmd.Flags().DurationVar(
+		&cfg.Audit.PricingReloadInterval, "pricing-reload-interval", cfg.Audit.PricingReloadInterval,
+		"How often to check the pricing file for changes (0 only reloads on SIGHUP)",
+	)
+	apiAuditorCmd.Flags().BoolVar(
+		&cfg.Audit.PriceByResponseModel, "price-by-response-model", cfg.Audit.PriceByResponseModel,
+		"Price requests by the model reported in the response (e.g., a dated snapshot), instead of the requested model",
+	)
+	apiAuditorCmd.Flags().StringVar(
+		&cfg.Audit.LedgerFile, "ledger-file", cfg.Audit.LedgerFile,
+		"Record every audited transaction in this file, and restore the month-to-date total from it at startup",
+	)
+	apiAuditorCmd.Flags().DurationVar(
+		&cfg.Audit.StatsWindow, "stats-window", cfg.Audit.StatsWindow,
+		"Length of the rolling window for the per-model request, token, cost, and latency stats",
+	)
+	apiAuditorCmd.Flags().IntVar(
+		&cfg.Audit.StatsSamples, "stats-samples", cfg.Audit.StatsSamples,
+		"Number of raw requests and responses to keep in memory for each model (0 keeps none)",
+	)
+	apiAuditorCmd.Flags().StringVar(
+		&cfg.Audit.OutputFormat, "output-format", cfg.Audit.OutputFormat,
+		"Output format for each priced request: full, compact, json (one object per line), or a template, e.g., \"{timestamp} {model} {totalReqCost}\"",
+	)
+	apiAuditorCmd.Flags().StringVar(
+		&cfg.Audit.OutputFile, "output-file", cfg.Audit.OutputFile,
+		"Append the output to this file, instead of printing it to stdout",
+	)
+	apiAuditorCmd.Flags().StringVar(
+		&cfg.Audit.Locale, "locale", cfg.Audit.Locale,
+		"Locale for the printed costs, e.g., en-US, de-DE, or en-GB",
+	)
+	apiAuditorCmd.Flags().StringVar(
+		&cfg.Audit.Currency, "currency", cfg.Audit.Currency,
+		"Convert the printed costs to this currency, e.g., EUR (requires --exchange-rates)",
+	)
+	apiAuditorCmd.Flags().StringVar(
+		&cfg.Audit.ExchangeRatesFile, "exchange-rates", cfg.Audit.ExchangeRatesFile,
+		`JSON exchange rate file, e.g., {"base": "USD", "rates": {"EUR": "0.92", "GBP": "0.79"}}`,
+	)
+	apiAuditorCmd.Flags().BoolVar(
+		&cfg.Audit.EstimateCost, "estimate-cost", cfg.Audit.EstimateCost,
+		"Add the estimated cost of each request to the response headers, before it's sent upstream",
+	)
+	apiAuditorCmd.Flags().StringVar(
+		&cfg.Audit.Budget, "budget", cfg.Audit.Budget,
+		"Reject requests with a 429 error when their estimated cost would take the grand total over this amount, in the --currency or USD",
+	)
+	apiAuditorCmd.Flags().IntVar(
+		&cfg.Audit.TokensPerMinute, "tokens-per-minute", cfg.Audit.TokensPerMinute,
+		"Reject requests with a 429 error when their estimated tokens would go over this limit in the last minute (0 is unlimited)",
+	)
 }
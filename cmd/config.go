@@ -18,6 +18,10 @@ var dir_logger_suggestions = []string{
 	"logger", "log", "dirlog", "dir-logger",
 }
 
+var mock_suggestions = []string{
+	"mocks", "mock-server", "fake", "fixtures",
+}
+
 var simple_suggestions = []string{
 	"proxy", "simple-proxy", "simpleproxy",
 }
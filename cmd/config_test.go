@@ -21,6 +21,10 @@ func TestNoDuplicateSuggestions(t *testing.T) {
 			name:        "dir_logger_suggestions",
 			suggestions: dir_logger_suggestions,
 		},
+		{
+			name:        "mock_suggestions",
+			suggestions: mock_suggestions,
+		},
 		{
 			name:        "simple_suggestions",
 			suggestions: simple_suggestions,
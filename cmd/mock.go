@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/proxati/llm_proxy/config"
+	"github.com/proxati/llm_proxy/proxy"
+)
+
+// mockCmd represents the mock command
+var mockCmd = &cobra.Command{
+	Use:   "mock",
+	Short: "Answer LLM API requests locally from fixtures, without sending anything upstream",
+	Long: `This command creates a proxy server that never contacts the upstream server. Each request is
+answered by the first fixture that matches it, from a directory of JSON files sorted by name. This is
+useful for unit tests and CI, because no network access, API key, or cache priming is needed.
+
+Each fixture file has a single fixture, or a list of fixtures:
+
+  {
+    "name": "weather",
+    "match": {
+      "url": "https://api.openai.com/v1/chat/*",
+      "body_subset": {"model": "gpt-4o-mini"},
+      "last_user_message": "(?i)weather"
+    },
+    "response": {"status": 200, "body": {"id": "chatcmpl-1", "object": "chat.completion", "choices": []}}
+  }
+
+The match fields are optional, and every field that is set must match:
+  url                a glob pattern for the URL without the query string, "*" matches anything
+  body               the request body is the same JSON value
+  body_subset        every field in this JSON object has the same value in the request body
+  last_user_message  a regex for the text of the last user message
+
+Use "stream" instead of "body" in the response for a list of server-sent events, which are sent
+with a final "data: [DONE]" event.
+
+Requests that don't match a fixture get a generated response for chat completions (streamed when
+the request has "stream": true), and embeddings, with realistic usage. Other requests get a 404
+error. The X-Llm_proxy-Mock response header has the name of the fixture, or "generated".`,
+	Example: `  llm_proxy mock --fixtures ./testdata/fixtures
+  llm_proxy mock --gateway-listen 127.0.0.1:8081  # base_url=http://127.0.0.1:8081/openai/v1`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg.AppMode = config.MockMode
+		return proxy.Run(cfg)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mockCmd)
+	mockCmd.SuggestFor = mock_suggestions
+
+	mockCmd.Flags().StringVar(
+		&cfg.Mock.FixturesDir, "fixtures", cfg.Mock.FixturesDir,
+		"Directory of JSON fixture files",
+	)
+	mockCmd.Flags().BoolVar(
+		&cfg.Mock.Generate, "generate", cfg.Mock.Generate,
+		"Generate chat completion and embedding responses for requests that don't match a fixture (false returns a 404)",
+	)
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/proxati/llm_proxy/replay"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// replayOptions are the flags for the replay command, which doesn't run the proxy
+var replayOptions = struct {
+	Upstream    string
+	Model       string
+	Headers     []string
+	Concurrency int
+	Rate        float64
+	Timeout     time.Duration
+	OutputDir   string
+	Format      string
+}{
+	Concurrency: 4,
+	Timeout:     5 * time.Minute,
+	Format:      string(replay.FormatTable),
+}
+
+// parseReplayHeaders parses the "Name: value" header flags
+func parseReplayHeaders(values []string) (http.Header, error) {
+	header := make(http.Header)
+	for _, value := range values {
+		name, headerValue, found := strings.Cut(value, ":")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid --header %q, must be \"Name: value\"", value)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(headerValue))
+	}
+	return header, nil
+}
+
+// replayCmd represents the replay command
+var replayCmd = &cobra.Command{
+	Use:   "replay <log dir or file>...",
+	Short: "Send captured requests again, to a new upstream or model, and diff the responses",
+	Long: `Read the JSON logs written by dir_logger, or JSON lines files with one log record on each line,
+and send each request again. The new responses are saved in the dir_logger format, with the same
+file names as the originals, and a diff report compares each response with the original: the
+similarity of the generated text, token usage, latency, cost, and finish reason.
+
+Use --upstream to send the requests to another server, e.g., a staging deployment or an
+OpenAI-compatible server, and --model to replace the model in each request body. This is how a
+model upgrade can be checked before switching.
+
+The request headers are copied from the logs, but the API keys are filtered from the logs by
+default, so they are set again with --header. The --header values are not saved with the new
+responses. The response cache only stores hashed request bodies, so it can't be replayed, use
+the dir_logger output instead.
+`,
+	Example: `  llm_proxy replay /tmp/llm_proxy --model gpt-4o-mini --header "Authorization: Bearer $OPENAI_API_KEY"
+  llm_proxy replay /tmp/llm_proxy --upstream http://localhost:11434 --rate 2 --format json`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := replay.ParseFormat(replayOptions.Format)
+		if err != nil {
+			return err
+		}
+		header, err := parseReplayHeaders(replayOptions.Headers)
+		if err != nil {
+			return err
+		}
+		opts := replay.Options{
+			Model:       replayOptions.Model,
+			Header:      header,
+			Concurrency: replayOptions.Concurrency,
+			Rate:        replayOptions.Rate,
+			Timeout:     replayOptions.Timeout,
+		}
+		if replayOptions.Upstream != "" {
+			opts.Upstream, err = url.Parse(replayOptions.Upstream)
+			if err != nil || opts.Upstream.Scheme == "" || opts.Upstream.Host == "" {
+				return fmt.Errorf("invalid --upstream %q, must be a URL like https://api.openai.com", replayOptions.Upstream)
+			}
+		}
+
+		cases, err := replay.Load(args)
+		if err != nil {
+			return err
+		}
+		if len(cases) == 0 {
+			return fmt.Errorf("no request logs found in: %v", args)
+		}
+
+		outputDir := replayOptions.OutputDir
+		if outputDir == "" {
+			// next to the originals, in a directory that isn't read as logs
+			source := args[0]
+			if info, err := os.Stat(source); err == nil && !info.IsDir() {
+				source = filepath.Dir(source)
+			}
+			outputDir = filepath.Join(source, "replay")
+		}
+
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+		client := &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerifyTLS},
+			},
+		}
+
+		log.Infof("Replaying %d requests, saving the responses to: %s", len(cases), outputDir)
+		results := replay.Run(ctx, client, cases, opts)
+		if err := replay.Save(outputDir, results); err != nil {
+			return err
+		}
+
+		diffs := replay.Compare(schema.NewCostCounterDefaults(), results)
+		return replay.Write(cmd.OutOrStdout(), format, diffs, replay.Summarize(diffs))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().StringVar(
+		&replayOptions.Upstream, "upstream", replayOptions.Upstream,
+		"Send the requests to this base URL instead of the original host, e.g., https://staging.example.com/v1",
+	)
+	replayCmd.Flags().StringVar(
+		&replayOptions.Model, "model", replayOptions.Model,
+		"Replace the model in each request body",
+	)
+	replayCmd.Flags().StringArrayVarP(
+		&replayOptions.Headers, "header", "H", replayOptions.Headers,
+		"Add a header to each request, e.g., \"Authorization: Bearer sk-...\" (can be repeated)",
+	)
+	replayCmd.Flags().IntVar(
+		&replayOptions.Concurrency, "concurrency", replayOptions.Concurrency,
+		"Number of requests sent at the same time",
+	)
+	replayCmd.Flags().Float64Var(
+		&replayOptions.Rate, "rate", replayOptions.Rate,
+		"Maximum requests started per second (0 is unlimited)",
+	)
+	replayCmd.Flags().DurationVar(
+		&replayOptions.Timeout, "timeout", replayOptions.Timeout,
+		"Timeout for each request, including the response body",
+	)
+	replayCmd.Flags().StringVarP(
+		&replayOptions.OutputDir, "output", "o", replayOptions.OutputDir,
+		"Directory for the new responses (default: a replay directory next to the first source)",
+	)
+	replayCmd.Flags().StringVar(
+		&replayOptions.Format, "format", replayOptions.Format,
+		fmt.Sprintf("Diff report format, one of: %v", replay.FormatOptions),
+	)
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/proxati/llm_proxy/report"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// reportOptions are the flags for the report command, which doesn't run the proxy
+var reportOptions = struct {
+	LogDir        string
+	LedgerFile    string
+	GroupBy       string
+	Format        string
+	Since         string
+	Until         string
+	Locale        string
+	Currency      string
+	ExchangeRates string
+}{
+	GroupBy: string(report.GroupByDay),
+	Format:  string(report.FormatTable),
+	Locale:  "en-US",
+}
+
+// parseReportDate parses a date, or a timestamp, for the report time range
+func parseReportDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarize spend, tokens, and latency from dir_logger output or a cost ledger",
+	Long: `Read the JSON logs written by dir_logger, or the cost ledger written by apiAuditor, and print the
+spend, request count, tokens, cache-hit savings and latency percentiles for each group.
+
+Logs are priced with the built-in pricing data. Requests served from the response cache are
+counted as savings, instead of spend. The ledger doesn't record latency, or cache hits.
+
+Use --currency to report in another currency. Ledger entries that were converted to that currency
+by apiAuditor keep the exchange rate from when they were recorded, other costs are converted with
+the --exchange-rates file.
+`,
+	Example: `  llm_proxy report --logs /tmp/llm_proxy --group-by model
+  llm_proxy report --ledger ~/llm_proxy/ledger.db --group-by tag --since 2024-10-01 --format csv`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if reportOptions.LogDir == "" && reportOptions.LedgerFile == "" {
+			return fmt.Errorf("one of --logs or --ledger is required")
+		}
+		groupBy, err := report.ParseGroupBy(reportOptions.GroupBy)
+		if err != nil {
+			return err
+		}
+		format, err := report.ParseFormat(reportOptions.Format)
+		if err != nil {
+			return err
+		}
+		since, err := parseReportDate(reportOptions.Since)
+		if err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+		until, err := parseReportDate(reportOptions.Until)
+		if err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+
+		records := make([]report.Record, 0)
+		if reportOptions.LogDir != "" {
+			logRecords, err := report.LoadLogs(reportOptions.LogDir, since, until)
+			if err != nil {
+				return err
+			}
+			records = append(records, logRecords...)
+		}
+		if reportOptions.LedgerFile != "" {
+			ledgerRecords, err := report.LoadLedger(reportOptions.LedgerFile, since, until)
+			if err != nil {
+				return err
+			}
+			records = append(records, ledgerRecords...)
+		}
+
+		if reportOptions.Currency != "" {
+			var rates *schema.ExchangeRates
+			if reportOptions.ExchangeRates != "" {
+				if rates, err = schema.LoadExchangeRates(reportOptions.ExchangeRates); err != nil {
+					return err
+				}
+			}
+			if err := report.ConvertRecords(records, rates, reportOptions.Currency); err != nil {
+				return err
+			}
+		}
+
+		rows, total := report.Aggregate(records, groupBy)
+		return report.Write(cmd.OutOrStdout(), format, groupBy, rows, total, reportOptions.Locale)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+
+	reportCmd.Flags().StringVar(
+		&reportOptions.LogDir, "logs", reportOptions.LogDir,
+		"Directory of JSON logs written by dir_logger",
+	)
+	reportCmd.Flags().StringVar(
+		&reportOptions.LedgerFile, "ledger", reportOptions.LedgerFile,
+		"Cost ledger file written by apiAuditor --ledger-file",
+	)
+	reportCmd.Flags().StringVar(
+		&reportOptions.GroupBy, "group-by", reportOptions.GroupBy,
+		fmt.Sprintf("Group the report by one of: %v", report.GroupByOptions),
+	)
+	reportCmd.Flags().StringVar(
+		&reportOptions.Format, "format", reportOptions.Format,
+		fmt.Sprintf("Output format, one of: %v", report.FormatOptions),
+	)
+	reportCmd.Flags().StringVar(
+		&reportOptions.Since, "since", reportOptions.Since,
+		"Only include requests at or after this date (YYYY-MM-DD, local time) or RFC 3339 timestamp",
+	)
+	reportCmd.Flags().StringVar(
+		&reportOptions.Until, "until", reportOptions.Until,
+		"Only include requests before this date (YYYY-MM-DD, local time) or RFC 3339 timestamp",
+	)
+	reportCmd.Flags().StringVar(
+		&reportOptions.Locale, "locale", reportOptions.Locale,
+		"Locale for the costs in the table output, e.g., en-US, de-DE, or en-GB",
+	)
+	reportCmd.Flags().StringVar(
+		&reportOptions.Currency, "currency", reportOptions.Currency,
+		"Convert the costs to this currency, e.g., EUR",
+	)
+	reportCmd.Flags().StringVar(
+		&reportOptions.ExchangeRates, "exchange-rates", reportOptions.ExchangeRates,
+		"JSON exchange rate file for --currency, ledger entries already converted to that currency are used as-is",
+	)
+}
@@ -56,4 +56,77 @@ func init() {
 		&cfg.NoHttpUpgrader, "no-http-upgrader", "", cfg.NoHttpUpgrader,
 		"Disable the automatic http->https request upgrader",
 	)
+	rootCmd.PersistentFlags().IntVar(
+		&cfg.Retry.MaxAttempts, "retry-max-attempts", cfg.Retry.MaxAttempts,
+		"Retry upstream 429 and 5xx errors, up to this many total attempts per request (0 disables retries). "+
+			"Connection errors on the first attempt are returned as a 502 and not retried",
+	)
+	rootCmd.PersistentFlags().BoolVar(
+		&cfg.Retry.RetryMedia, "retry-media", cfg.Retry.RetryMedia,
+		"Also retry the image generation and audio endpoints, a failed attempt may still be billed",
+	)
+	rootCmd.PersistentFlags().DurationVar(
+		&cfg.Retry.MaxTime, "retry-max-time", cfg.Retry.MaxTime,
+		"Upper limit on the time spent retrying a single request",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.GatewayListen, "gateway-listen", cfg.GatewayListen,
+		"Address for the reverse proxy gateway, e.g., 127.0.0.1:8081 (clients use base_url=http://127.0.0.1:8081/openai/v1)",
+	)
+	rootCmd.PersistentFlags().StringToStringVar(
+		&cfg.GatewayRoutes, "gateway-route", cfg.GatewayRoutes,
+		"Gateway path prefix to upstream base URL, e.g., /openai=https://api.openai.com (replaces the defaults)",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.BackendsFile, "backends-file", cfg.BackendsFile,
+		"JSON file with logical models and backends, for load balancing and failover",
+	)
+	rootCmd.PersistentFlags().StringSliceVar(
+		&cfg.AnthropicModels, "anthropic-models", cfg.AnthropicModels,
+		"Translate OpenAI chat completions requests for these model patterns (e.g., claude-*) to the Anthropic API, using $ANTHROPIC_API_KEY when set",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.LocalRoutesFile, "local-routes-file", cfg.LocalRoutesFile,
+		"JSON file with rules that send matching models or tags to local OpenAI-compatible servers, e.g., Ollama or vLLM",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.RewriteFile, "rewrite-file", cfg.RewriteFile,
+		"JSON file with rules that rewrite request bodies, e.g., model overrides and parameter limits",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.PolicyFile, "policy-file", cfg.PolicyFile,
+		"JSON file with egress allow/deny rules, checked before requests are sent upstream",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.PolicyAuditLog, "policy-audit-log", cfg.PolicyAuditLog,
+		"File where requests denied by the egress policy are recorded, in JSON lines format",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.GuardrailsFile, "guardrails-file", cfg.GuardrailsFile,
+		"JSON file with rules to block, redact, or tag text in prompts and responses (bodies that can't be checked are blocked, unless the file sets fail_open)",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.Chaos.RulesFile, "chaos-file", cfg.Chaos.RulesFile,
+		"JSON file with faults to inject into requests and responses (latency, rate limits, errors, broken streams)",
+	)
+	rootCmd.PersistentFlags().Int64Var(
+		&cfg.Chaos.Seed, "chaos-seed", cfg.Chaos.Seed,
+		"Random seed for the injected faults, to repeat a run (overrides the seed in the chaos file)",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.Shadow.URL, "shadow-url", cfg.Shadow.URL,
+		"Mirror chat completion requests to this base URL, e.g., http://localhost:11434/v1, using $SHADOW_API_KEY when set",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.Shadow.Model, "shadow-model", cfg.Shadow.Model,
+		"Mirror chat completion requests with this model, the client still gets the original response",
+	)
+	rootCmd.PersistentFlags().Float64Var(
+		&cfg.Shadow.Share, "shadow-share", cfg.Shadow.Share,
+		"Share of the chat completion requests that are mirrored, from 0 to 1",
+	)
+	rootCmd.PersistentFlags().DurationVar(
+		&cfg.Shadow.Timeout, "shadow-timeout", cfg.Shadow.Timeout,
+		"Timeout for each mirrored request",
+	)
 }
@@ -7,4 +7,5 @@ const (
 	DirLoggerMode
 	CacheMode
 	APIAuditMode
+	MockMode
 )
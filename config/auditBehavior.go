@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+// auditBehavior is the configuration for the API auditor mode
+type auditBehavior struct {
+	PricingFile           string        // JSON file, or directory of JSON files, with prices that override the embedded tables
+	PricingReloadInterval time.Duration // how often the pricing file is checked for changes, 0 only reloads on SIGHUP
+	PriceByResponseModel  bool          // price by the model reported in the response, instead of the requested model
+	LedgerFile            string        // bolt database where every audited transaction is recorded, empty to disable
+	StatsWindow           time.Duration // length of the rolling window for the per-model stats
+	StatsSamples          int           // raw requests and responses kept per model, for debugging
+	OutputFormat          string        // full, compact, json, or an output template
+	OutputFile            string        // file for the audit output, empty for stdout
+	Locale                string        // locale for the formatted costs, e.g., "en-US"
+	Currency              string        // currency for the formatted costs, empty to use the price currency
+	ExchangeRatesFile     string        // JSON file with the exchange rates, required when Currency is set
+	EstimateCost          bool          // add the cost estimated before each request is sent to the response headers
+	Budget                string        // spending limit for the grand total, in Currency or USD, empty for no budget
+	TokensPerMinute       int           // limit for the estimated tokens of the requests sent each minute, 0 is unlimited
+}
@@ -0,0 +1,7 @@
+package config
+
+// chaosBehavior stores input args config for the fault injection addon
+type chaosBehavior struct {
+	RulesFile string // JSON file with the faults to inject, and their probabilities
+	Seed      int64  // Random seed for reproducible runs, 0 uses the seed from the rules file
+}
@@ -1,12 +1,22 @@
 package config
 
+import "time"
+
 // Config is the main config mega-struct
 type Config struct {
 	AppMode AppMode
 	*httpBehavior
 	*terminalLogger
 	*trafficLogger
-	Cache *cacheBehavior
+	Cache  *cacheBehavior
+	Retry  *retryBehavior
+	Audit  *auditBehavior
+	Mock   *mockBehavior
+	Chaos  *chaosBehavior
+	Shadow *shadowBehavior
+	*upstreamBehavior
+	*policyBehavior
+	*gatewayBehavior
 }
 
 func (cfg *Config) getTerminalLogger() *terminalLogger {
@@ -51,5 +61,42 @@ func NewDefaultConfig() *Config {
 			Dir: "/tmp/llm_proxy",
 			TTL: 0,
 		},
+		Retry: &retryBehavior{
+			MaxAttempts:    0,
+			MaxTime:        60 * time.Second,
+			InitialBackoff: 500 * time.Millisecond,
+			MaxBackoff:     20 * time.Second,
+		},
+		Audit: &auditBehavior{
+			PricingFile:           "",
+			PricingReloadInterval: 10 * time.Second,
+			StatsWindow:           time.Hour,
+			OutputFormat:          "full",
+			Locale:                "en-US",
+			EstimateCost:          true,
+		},
+		Mock: &mockBehavior{
+			FixturesDir: "",
+			Generate:    true,
+		},
+		Chaos: &chaosBehavior{
+			RulesFile: "",
+			Seed:      0,
+		},
+		Shadow: &shadowBehavior{
+			URL:     "",
+			Model:   "",
+			Share:   1,
+			Timeout: 5 * time.Minute,
+		},
+		upstreamBehavior: &upstreamBehavior{},
+		policyBehavior:   &policyBehavior{},
+		gatewayBehavior: &gatewayBehavior{
+			GatewayListen: "",
+			GatewayRoutes: map[string]string{
+				"/openai":    "https://api.openai.com",
+				"/anthropic": "https://api.anthropic.com",
+			},
+		},
 	}
 }
@@ -19,3 +19,29 @@ func TestNewDefaultConfig(t *testing.T) {
 	cfg := NewDefaultConfig()
 	assert.IsType(t, &Config{}, cfg)
 }
+
+func TestConfig_RetryEnabled(t *testing.T) {
+	cfg := NewDefaultConfig()
+	assert.False(t, cfg.RetryEnabled())
+
+	cfg.Retry.MaxAttempts = 1
+	assert.False(t, cfg.RetryEnabled())
+
+	cfg.Retry.MaxAttempts = 3
+	assert.True(t, cfg.RetryEnabled())
+
+	cfg.Retry = nil
+	assert.False(t, cfg.RetryEnabled())
+}
+
+func TestConfig_GatewayEnabled(t *testing.T) {
+	cfg := NewDefaultConfig()
+	assert.False(t, cfg.GatewayEnabled())
+	assert.Equal(t, "https://api.openai.com", cfg.GatewayRoutes["/openai"])
+
+	cfg.GatewayListen = "127.0.0.1:8081"
+	assert.True(t, cfg.GatewayEnabled())
+
+	cfg.gatewayBehavior = nil
+	assert.False(t, cfg.GatewayEnabled())
+}
@@ -0,0 +1,13 @@
+package config
+
+// gatewayBehavior is the configuration for the reverse proxy gateway, which accepts plain http
+// requests (e.g., from an SDK with a custom base_url) without the proxy or CA settings on the client
+type gatewayBehavior struct {
+	GatewayListen string            // Address for the gateway listener, the gateway is disabled when empty
+	GatewayRoutes map[string]string // Path prefix to upstream base URL, e.g., "/openai" -> "https://api.openai.com"
+}
+
+// GatewayEnabled returns true when the gateway listener should be started
+func (cfg *Config) GatewayEnabled() bool {
+	return cfg.gatewayBehavior != nil && cfg.GatewayListen != ""
+}
@@ -0,0 +1,7 @@
+package config
+
+// mockBehavior stores input args config for the mock mode
+type mockBehavior struct {
+	FixturesDir string // Directory of JSON fixture files, empty to only generate responses
+	Generate    bool   // Generate responses for requests that don't match a fixture
+}
@@ -0,0 +1,8 @@
+package config
+
+// policyBehavior is the configuration for the addons that inspect and block requests
+type policyBehavior struct {
+	PolicyFile     string // JSON file with egress allow/deny rules
+	PolicyAuditLog string // JSON lines file where every denied request is recorded
+	GuardrailsFile string // JSON file with block/redact/tag rules for prompt and response text
+}
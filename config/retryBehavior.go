@@ -0,0 +1,17 @@
+package config
+
+import "time"
+
+// retryBehavior stores input args config for the upstream retry addon
+type retryBehavior struct {
+	MaxAttempts    int           // Total upstream attempts per request, including the first (0 or 1 disables retries)
+	MaxTime        time.Duration // Upper limit on the time spent retrying a single request
+	InitialBackoff time.Duration // Delay before the first retry, doubled after each attempt
+	MaxBackoff     time.Duration // Upper limit for a single backoff delay
+	RetryMedia     bool          // Also retry the image generation and audio endpoints
+}
+
+// RetryEnabled returns true when the retry addon should be loaded
+func (cfg *Config) RetryEnabled() bool {
+	return cfg.Retry != nil && cfg.Retry.MaxAttempts > 1
+}
@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+// shadowBehavior stores input args config for mirroring requests to a candidate backend or model
+type shadowBehavior struct {
+	URL     string        // Base URL of the candidate backend, empty to use the original host
+	Model   string        // Candidate model, empty to keep the original model
+	Share   float64       // Share of the chat completion requests that are mirrored, 0 to 1
+	Timeout time.Duration // Timeout for each shadow request
+}
+
+// Enabled returns true when a candidate backend or model is set
+func (s *shadowBehavior) Enabled() bool {
+	return s.URL != "" || s.Model != ""
+}
@@ -0,0 +1,15 @@
+package config
+
+// upstreamBehavior is the configuration for choosing which upstream server receives a request,
+// and what is sent to it
+type upstreamBehavior struct {
+	BackendsFile string // JSON file with logical models, and the weighted backends that serve them
+	RewriteFile  string // JSON file with rules that modify request bodies before they are sent
+
+	// JSON file with rules that send matching requests to local OpenAI-compatible servers
+	LocalRoutesFile string
+
+	// Model name patterns (e.g., "claude-*") for chat completions requests that are translated
+	// to the Anthropic messages API
+	AnthropicModels []string
+}
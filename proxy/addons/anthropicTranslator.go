@@ -0,0 +1,224 @@
+package addons
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/proxy/addons/glob"
+	"github.com/proxati/llm_proxy/proxy/addons/translate"
+	"github.com/proxati/llm_proxy/schema"
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+const defaultAnthropicURL = "https://api.anthropic.com"
+
+// request headers that are only meaningful to the OpenAI API
+var openAIOnlyHeaders = []string{"Authorization", "Openai-Organization", "Openai-Project", "Openai-Beta"}
+
+// translatedFlow is the state kept between the request and the response of a translated flow
+type translatedFlow struct {
+	snapshot *requestSnapshot
+	info     *translate.RequestInfo
+}
+
+// AnthropicTranslatorAddon sends OpenAI chat completions requests for matching models to the
+// Anthropic messages API, and converts the responses back to the OpenAI format.
+//
+// The addon has two parts: the Request event must run after the cache addon, so the cache key is
+// the client's OpenAI request, and the Response event (from ResponseAddon) must run before the
+// cache and logging addons, so they only see the OpenAI format response.
+type AnthropicTranslatorAddon struct {
+	px.BaseAddon
+	models  []string // glob patterns, e.g., "claude-*"
+	apiKey  string   // used instead of the client's API key when set
+	baseURL *url.URL
+	routed  *FlowRoutes
+	flows   sync.Map // key: flow ID, value: *translatedFlow
+	closed  atomic.Bool
+	wg      sync.WaitGroup
+}
+
+// matchesModel returns true if the model should be translated
+func (a *AnthropicTranslatorAddon) matchesModel(model string) bool {
+	for _, pattern := range a.models {
+		if glob.Match(pattern, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// setAnthropicHeaders replaces the OpenAI authentication headers
+func (a *AnthropicTranslatorAddon) setAnthropicHeaders(header http.Header) {
+	apiKey := a.apiKey
+	if apiKey == "" {
+		apiKey = strings.TrimSpace(strings.TrimPrefix(header.Get("Authorization"), "Bearer "))
+	}
+	for _, name := range openAIOnlyHeaders {
+		header.Del(name)
+	}
+	header.Set("X-Api-Key", apiKey)
+	header.Set("Anthropic-Version", translate.AnthropicVersion)
+	header.Set("Content-Type", "application/json")
+	header.Del("Content-Encoding") // the translated body is sent uncompressed
+}
+
+func (a *AnthropicTranslatorAddon) Request(f *px.Flow) {
+	if a.closed.Load() {
+		log.Warn("AnthropicTranslator is being closed, not translating request")
+		return
+	}
+	if f.Request == nil || f.Request.URL == nil || f.Request.Method != "POST" ||
+		!strings.HasSuffix(f.Request.URL.Path, "/chat/completions") {
+		return
+	}
+
+	body, err := decodeRequestJSON(f.Request)
+	if err != nil || !a.matchesModel(requestModel(body)) {
+		return
+	}
+	if !a.routed.claim(f.Id, a.String()) {
+		log.Debugf("not translating request already routed by %s: %s", a.routed.routedBy(f.Id), f.Request.URL)
+		return
+	}
+
+	decodedBody, err := utils.DecodeBody(f.Request.Body, f.Request.Header.Get("Content-Encoding"))
+	if err != nil {
+		return
+	}
+	translated, info, err := translate.OpenAIToAnthropicRequest(decodedBody)
+	if err != nil {
+		log.Warnf("unable to translate request to the messages API: %v", err)
+		f.Response = newErrorResponse(http.StatusBadRequest, "invalid_request_error", "translation_failed", err.Error())
+		return
+	}
+
+	state := &translatedFlow{snapshot: newRequestSnapshot(f.Request), info: info}
+	upstream := *a.baseURL
+	upstream.Path = strings.TrimSuffix(upstream.Path, "/") + translate.AnthropicMessagesPath
+
+	f.Request.URL = &upstream
+	a.setAnthropicHeaders(f.Request.Header)
+	f.Request.Body = translated
+	if f.Request.Header.Get("Content-Length") != "" {
+		f.Request.Header.Set("Content-Length", strconv.Itoa(len(translated)))
+	}
+	log.Debugf("translating chat completions request for model %s to: %s", info.Model, f.Request.URL)
+	a.routed.record(f.Id, a.String(), schema.Route{Upstream: f.Request.URL.String()})
+	a.flows.Store(f.Id, state)
+
+	a.wg.Add(1) // for blocking this addon during shutdown in .Close()
+	go func() {
+		defer a.wg.Done()
+		<-f.Done()
+		a.flows.Delete(f.Id) // normally removed in the Response event, unless the upstream connection failed
+		a.routed.release(f.Id)
+	}()
+}
+
+// translateResponse converts the Anthropic response back to the OpenAI format
+func (a *AnthropicTranslatorAddon) translateResponse(f *px.Flow) {
+	value, found := a.flows.LoadAndDelete(f.Id)
+	if !found {
+		return
+	}
+	state := value.(*translatedFlow)
+
+	// put back the original request, so the cache and logs match what the client sent
+	defer state.snapshot.restore(f.Request)
+	if f.Response == nil {
+		return
+	}
+
+	contentEncoding := f.Response.Header.Get("Content-Encoding")
+	decodedBody, err := utils.DecodeBody(f.Response.Body, contentEncoding)
+	if err != nil {
+		log.Errorf("error decoding messages API response: %v", err)
+		return
+	}
+
+	var translated []byte
+	contentType := "application/json"
+	switch {
+	case f.Response.StatusCode >= http.StatusBadRequest:
+		translated, err = translate.AnthropicToOpenAIError(decodedBody)
+	case state.info.Stream && (utils.IsSSE(f.Response.Header.Get("Content-Type")) || utils.LooksLikeSSE(string(decodedBody))):
+		translated = []byte(translate.AnthropicToOpenAIStream(string(decodedBody), state.info.IncludeUsage))
+		contentType = "text/event-stream; charset=utf-8"
+	default:
+		translated, err = translate.AnthropicToOpenAIResponse(decodedBody)
+	}
+	if err != nil {
+		log.Errorf("error translating messages API response: %v", err)
+		replaceResponse(f, newErrorResponse(http.StatusBadGateway, "api_error", "translation_failed", err.Error()))
+		return
+	}
+
+	encodedBody, err := encodeBody(translated, contentEncoding)
+	if err != nil {
+		log.Errorf("error encoding translated response: %v", err)
+		return
+	}
+	f.Response.Body = encodedBody
+	f.Response.Header.Set("Content-Type", contentType)
+	f.Response.Header.Set("Content-Length", strconv.Itoa(len(encodedBody)))
+
+	// Anthropic specific response headers, e.g., anthropic-ratelimit-*, are kept as-is
+}
+
+// ResponseAddon returns the part of this addon that handles the Response event, which must be
+// added to the proxy before the cache and logging addons
+func (a *AnthropicTranslatorAddon) ResponseAddon() px.Addon {
+	return &anthropicResponseTranslator{translator: a}
+}
+
+func (a *AnthropicTranslatorAddon) String() string {
+	return "AnthropicTranslatorAddon"
+}
+
+func (a *AnthropicTranslatorAddon) Close() error {
+	if !a.closed.Swap(true) {
+		log.Debug("Waiting for AnthropicTranslator shutdown...")
+		a.wg.Wait()
+	}
+	return nil
+}
+
+// anthropicResponseTranslator is the Response event handler for AnthropicTranslatorAddon
+type anthropicResponseTranslator struct {
+	px.BaseAddon
+	translator *AnthropicTranslatorAddon
+}
+
+func (r *anthropicResponseTranslator) Response(f *px.Flow) {
+	r.translator.translateResponse(f)
+}
+
+// NewAnthropicTranslatorAddon creates a new addon that translates chat completions requests for
+// the models matching the glob patterns. When apiKey is empty, the client's API key is used.
+func NewAnthropicTranslatorAddon(models []string, apiKey string, routed *FlowRoutes) (*AnthropicTranslatorAddon, error) {
+	if err := glob.Validate(models...); err != nil {
+		return nil, err
+	}
+
+	baseURL, err := url.Parse(defaultAnthropicURL)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &AnthropicTranslatorAddon{
+		models:  models,
+		apiKey:  apiKey,
+		baseURL: baseURL,
+		routed:  routed,
+	}
+	a.closed.Store(false) // initialize as open
+	return a, nil
+}
@@ -0,0 +1,209 @@
+package addons
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+func newTranslatorTestFlow(t *testing.T, body string) *px.Flow {
+	t.Helper()
+	u, err := url.Parse("https://api.openai.com/v1/chat/completions")
+	require.NoError(t, err)
+	return &px.Flow{
+		Id: uuid.NewV4(),
+		Request: &px.Request{
+			Method: "POST",
+			URL:    u,
+			Header: http.Header{
+				"Authorization":       []string{"Bearer sk-ant-client"},
+				"Openai-Organization": []string{"org-1"},
+				"Content-Type":        []string{"application/json"},
+				"Content-Length":      []string{"1"},
+			},
+			Body: []byte(body),
+		},
+	}
+}
+
+func TestAnthropicTranslatorAddon(t *testing.T) {
+	translator, err := NewAnthropicTranslatorAddon([]string{"claude-*"}, "", NewFlowRoutes())
+	require.NoError(t, err)
+	assert.Equal(t, "AnthropicTranslatorAddon", translator.String())
+	responseAddon := translator.ResponseAddon()
+
+	t.Run("non-matching model", func(t *testing.T) {
+		body := `{"model": "gpt-4o", "messages": [{"role": "user", "content": "hi"}]}`
+		flow := newTranslatorTestFlow(t, body)
+		translator.Request(flow)
+		assert.Equal(t, "api.openai.com", flow.Request.URL.Host)
+		assert.Equal(t, body, string(flow.Request.Body))
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		flow := newTranslatorTestFlow(t, `{"model": "claude-3-5-sonnet-latest", "messages": [{"role": "function", "content": "hi"}]}`)
+		translator.Request(flow)
+		require.NotNil(t, flow.Response)
+		assert.Equal(t, http.StatusBadRequest, flow.Response.StatusCode)
+	})
+
+	t.Run("translated request and response", func(t *testing.T) {
+		body := `{"model": "claude-3-5-sonnet-latest", "messages": [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "hi"}]}`
+		flow := newTranslatorTestFlow(t, body)
+		translator.Request(flow)
+
+		require.Nil(t, flow.Response)
+		assert.Equal(t, "https://api.anthropic.com/v1/messages", flow.Request.URL.String())
+		assert.Equal(t, "sk-ant-client", flow.Request.Header.Get("X-Api-Key"))
+		assert.Equal(t, "2023-06-01", flow.Request.Header.Get("Anthropic-Version"))
+		assert.Empty(t, flow.Request.Header.Get("Authorization"))
+		assert.Empty(t, flow.Request.Header.Get("Openai-Organization"))
+		assert.Equal(t, strconv.Itoa(len(flow.Request.Body)), flow.Request.Header.Get("Content-Length"))
+		assert.JSONEq(t, `{
+			"model": "claude-3-5-sonnet-latest", "system": "Be brief.", "max_tokens": 4096,
+			"messages": [{"role": "user", "content": [{"type": "text", "text": "hi"}]}]
+		}`, string(flow.Request.Body))
+
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body: []byte(`{"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-3-5-sonnet-20241022",
+				"content": [{"type": "text", "text": "Hello!"}], "stop_reason": "end_turn",
+				"usage": {"input_tokens": 12, "output_tokens": 3}}`),
+		}
+		responseAddon.Response(flow)
+
+		// the original request is restored for the cache and logging addons
+		assert.Equal(t, "https://api.openai.com/v1/chat/completions", flow.Request.URL.String())
+		assert.Equal(t, body, string(flow.Request.Body))
+		assert.Equal(t, "Bearer sk-ant-client", flow.Request.Header.Get("Authorization"))
+
+		assert.Equal(t, http.StatusOK, flow.Response.StatusCode)
+		assert.Equal(t, "https://api.anthropic.com/v1/messages", translator.routed.route(flow.Id).Upstream)
+		assert.Empty(t, flow.Response.Header.Get("X-Llm_proxy-Upstream"))
+		resp := map[string]any{}
+		require.NoError(t, json.Unmarshal(flow.Response.Body, &resp))
+		assert.Equal(t, "chat.completion", resp["object"])
+		assert.Equal(t, map[string]any{"prompt_tokens": 12.0, "completion_tokens": 3.0, "total_tokens": 15.0}, resp["usage"])
+
+		_, found := translator.flows.Load(flow.Id)
+		assert.False(t, found)
+	})
+
+	t.Run("streamed gzip response", func(t *testing.T) {
+		flow := newTranslatorTestFlow(t, `{"model": "claude-3-5-haiku-latest", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`)
+		translator.Request(flow)
+
+		stream := "event: message_start\n" +
+			`data: {"type": "message_start", "message": {"id": "msg_2", "model": "claude-3-5-haiku-20241022", "usage": {"input_tokens": 5}}}` + "\n\n" +
+			"event: content_block_delta\n" +
+			`data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Hi"}}` + "\n\n"
+		encoded, err := encodeBody([]byte(stream), "gzip")
+		require.NoError(t, err)
+
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}, "Content-Encoding": []string{"gzip"}},
+			Body:       encoded,
+		}
+		responseAddon.Response(flow)
+
+		decoded, err := utils.DecodeBody(flow.Response.Body, "gzip")
+		require.NoError(t, err)
+		assert.Contains(t, string(decoded), `"delta":{"content":"Hi"}`)
+		assert.Contains(t, string(decoded), "data: [DONE]")
+		assert.True(t, utils.IsSSE(flow.Response.Header.Get("Content-Type")))
+	})
+
+	t.Run("error response", func(t *testing.T) {
+		flow := newTranslatorTestFlow(t, `{"model": "claude-3-5-haiku-latest", "messages": [{"role": "user", "content": "hi"}]}`)
+		translator.Request(flow)
+
+		flow.Response = &px.Response{
+			StatusCode: http.StatusUnauthorized,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       []byte(`{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`),
+		}
+		responseAddon.Response(flow)
+		assert.Equal(t, http.StatusUnauthorized, flow.Response.StatusCode)
+		assert.JSONEq(t,
+			`{"error": {"message": "invalid x-api-key", "type": "authentication_error", "code": "authentication_error"}}`,
+			string(flow.Response.Body),
+		)
+	})
+
+	t.Run("configured api key", func(t *testing.T) {
+		keyed, err := NewAnthropicTranslatorAddon([]string{"claude-*"}, "sk-ant-server", NewFlowRoutes())
+		require.NoError(t, err)
+		flow := newTranslatorTestFlow(t, `{"model": "claude-3-5-haiku-latest", "messages": [{"role": "user", "content": "hi"}]}`)
+		keyed.Request(flow)
+		assert.Equal(t, "sk-ant-server", flow.Request.Header.Get("X-Api-Key"))
+	})
+
+	_, err = NewAnthropicTranslatorAddon([]string{"claude-["}, "", NewFlowRoutes())
+	assert.Error(t, err)
+}
+
+func TestAnthropicTranslatorAddon_HTTPS(t *testing.T) {
+	openAIHits := new(atomic.Int32)
+	openAI := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		openAIHits.Add(1)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	t.Cleanup(openAI.Close)
+
+	received := make(chan *http.Request, 1)
+	anthropic := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		received <- r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-3-5-haiku-20241022",
+			"content": [{"type": "text", "text": "Hello!"}], "stop_reason": "end_turn",
+			"usage": {"input_tokens": 12, "output_tokens": 3}}`))
+	}))
+	t.Cleanup(anthropic.Close)
+
+	routed := NewFlowRoutes()
+	translator, err := NewAnthropicTranslatorAddon([]string{"claude-*"}, "", routed)
+	require.NoError(t, err)
+	translator.baseURL, err = url.Parse(anthropic.URL)
+	require.NoError(t, err)
+	sender := NewRoutedSenderAddon(routed, []px.Addon{translator.ResponseAddon()}, true)
+
+	flow := newTranslatorTestFlow(t, `{"model": "claude-3-5-haiku-latest", "messages": [{"role": "user", "content": "hi"}]}`)
+	flow.Request.URL, err = url.Parse(openAI.URL + "/v1/chat/completions")
+	require.NoError(t, err)
+	flow.Request.Header.Del("Content-Length")
+
+	translator.Request(flow)
+	require.Nil(t, flow.Response)
+	sender.Request(flow)
+
+	// sent to the messages API, not the host that the client connected to
+	assert.Equal(t, int32(0), openAIHits.Load())
+	require.Len(t, received, 1)
+	req := <-received
+	assert.Equal(t, "/v1/messages", req.URL.Path)
+	assert.Equal(t, "sk-ant-client", req.Header.Get("X-Api-Key"))
+	assert.Empty(t, req.Header.Get("Authorization"))
+
+	// the response events were run, so the response is translated and the request restored
+	require.NotNil(t, flow.Response)
+	assert.Equal(t, http.StatusOK, flow.Response.StatusCode)
+	resp := map[string]any{}
+	require.NoError(t, json.Unmarshal(flow.Response.Body, &resp))
+	assert.Equal(t, "chat.completion", resp["object"])
+	assert.Equal(t, openAI.URL+"/v1/chat/completions", flow.Request.URL.String())
+}
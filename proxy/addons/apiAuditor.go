@@ -1,48 +1,89 @@
 package addons
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 
 	px "github.com/kardianos/mitmproxy/proxy"
+	"github.com/proxati/llm_proxy/proxy/addons/ledger"
+	"github.com/proxati/llm_proxy/proxy/addons/megadumper/writers"
 	"github.com/proxati/llm_proxy/schema"
+	"github.com/proxati/llm_proxy/schema/providers"
 	log "github.com/sirupsen/logrus"
 )
 
-// domains supported by this auditor
-var auditURLs = map[string]interface{}{
-	"api.openai.com": nil,
-}
+// Output formats for the auditor, any other format is used as an AuditOutput.OutputStringFormatter
+// template
+const (
+	AuditFormatFull    = "full"
+	AuditFormatCompact = "compact"
+	AuditFormatJSON    = "json" // one JSON object per line
+)
+
+// EstimatedCostHeader is added to a response with the cost of the request estimated before it was
+// sent, from the prompt tokens and the maximum output tokens requested by the client, e.g.,
+// "0.0042 USD"
+const EstimatedCostHeader = "X-Llm_proxy-Estimated-Cost"
 
 // APIAuditorAddon log connection and flow
 type APIAuditorAddon struct {
 	px.BaseAddon
-	costCounter *schema.CostCounter
-	closed      atomic.Bool
-	wg          sync.WaitGroup
+	costCounter  *schema.CostCounter
+	ledger       *ledger.Ledger   // nil when the ledger is disabled
+	outputFormat string           // AuditFormatJSON, or a template for OutputStringFormatter
+	estimateCost bool             // set EstimatedCostHeader on responses
+	limits       *preflightLimits // budget and tokens per minute, checked before a request is sent
+	estimates    sync.Map         // key: flow ID, value: EstimatedCostHeader value
+	routed       *FlowRoutes      // where the routing addons sent each flow, may be nil
+	routes       sync.Map         // key: flow ID, value: schema.Route, kept until the flow is accounted
+	outputFile   *writers.ToLines // nil when writing to stdout
+	stdout       io.Writer
+	stdoutMutex  sync.Mutex
+	pricingPath  string
+	pricingHash  string // fingerprint of the pricing files when they were last loaded
+	stopWatcher  chan struct{}
+	closed       atomic.Bool
+	wg           sync.WaitGroup
 }
 
-func (aud *APIAuditorAddon) Response(f *px.Flow) {
+// Requestheaders starts the accounting for a request, the cost is counted when the flow is done so
+// the latency from the request headers to the end of the response is counted in the stats
+func (aud *APIAuditorAddon) Requestheaders(f *px.Flow) {
 	if aud.closed.Load() {
 		log.Warn("APIAuditor is being closed, not processing request")
 		return
 	}
-	if f.Response == nil {
-		log.Debugf("skipping accounting for nil response: %s", f.Request.URL)
-		return
-	}
+
+	start := time.Now()
 
 	aud.wg.Add(1) // for blocking this addon during shutdown in .Close()
 	go func() {
 		defer aud.wg.Done()
 		<-f.Done()
+		latency := time.Since(start)
+		aud.estimates.Delete(f.Id) // normally removed in the Responseheaders event, unless there was no response
+		route := schema.Route{}
+		if value, found := aud.routes.LoadAndDelete(f.Id); found {
+			route = value.(schema.Route)
+		}
+
+		if f.Response == nil {
+			log.Debugf("skipping accounting for nil response: %s", f.Request.URL)
+			return
+		}
 
-		// only account when the request domain is supported
-		reqHostname := f.Request.URL.Hostname()
-		_, shouldAudit := auditURLs[reqHostname]
-		if !shouldAudit {
-			log.Debugf("skipping accounting for unsupported API: %s", reqHostname)
+		// only account when a provider is registered for the request URL, after any rewrites
+		if providers.Lookup(f.Request.URL) == nil {
+			log.Debugf("skipping accounting for unsupported API: %s", f.Request.URL)
 			return
 		}
 
@@ -67,28 +108,379 @@ func (aud *APIAuditorAddon) Response(f *px.Flow) {
 			return
 		}
 
-		// account the cost, TODO: returns what?
-		auditOutput, err := aud.costCounter.Add(*tObjReq, *tObjResp)
+		// add the cost to the grand total, the output has the priced usage and the formatted costs
+		auditOutput, err := aud.costCounter.AddRouted(*tObjReq, *tObjResp, latency, route)
+		if errors.Is(err, schema.ErrUnknownModel) {
+			// printed with the costs, so it's not missed when the logs are quiet. JSON output is
+			// only for priced requests, the unknown model is already logged as a warning.
+			if aud.outputFormat != AuditFormatJSON {
+				aud.writeLine([]byte(fmt.Sprintf("URL: %s %v, cost NOT counted", f.Request.URL, err)))
+			}
+			return
+		}
+		if errors.Is(err, providers.ErrNotBillable) {
+			log.Debugf("skipping accounting for %s: %s", f.Request.URL, err)
+			return
+		}
 		if err != nil {
 			log.Errorf("error accounting response: %s", err)
+			return
 		}
-		fmt.Println(auditOutput)
+		auditOutput.Timestamp = time.Now()
+		auditOutput.Tags = requestTags(f.Request)
+		auditOutput.CacheStatus = f.Response.Header.Get(CacheStatusHeader)
+		aud.writeOutput(auditOutput)
+		aud.recordEntry(f, auditOutput)
 	}()
 }
 
+// Request estimates the cost of the request before it's sent, after any rewrites, and answers it
+// with a 429 error when it would go over the budget or the tokens per minute limit
+func (aud *APIAuditorAddon) Request(f *px.Flow) {
+	if !aud.estimateCost && !aud.limits.enabled() {
+		return
+	}
+	if aud.closed.Load() || f.Response != nil || providers.Lookup(f.Request.URL) == nil {
+		return
+	}
+
+	tObjReq, err := schema.NewProxyRequestFromMITMRequest(f.Request, []string{})
+	if err != nil {
+		log.Errorf("error creating TrafficObject from request: %s", f.Request.URL)
+		return
+	}
+	estimate, err := aud.costCounter.Estimate(*tObjReq)
+	if err != nil {
+		log.Debugf("not estimating the cost of %s: %v", f.Request.URL, err)
+		return
+	}
+	log.Debugf("estimated %s (%s): %d input tokens, %d maximum output tokens, cost %s",
+		f.Request.URL, estimate.Model, estimate.Usage.InputTokens, estimate.Usage.OutputTokens, estimate.Cost)
+
+	if resp := aud.limits.check(estimate, aud.costCounter.GrandTotal()); resp != nil {
+		log.Warnf("not sending request to %s (%s): %s", f.Request.URL, estimate.Model, resp.Body)
+		f.Response = resp
+		return
+	}
+	if aud.estimateCost && estimate.Priced() {
+		aud.estimates.Store(f.Id, estimate.Header())
+	}
+}
+
+// Responseheaders adds the estimated cost to the response, before a streamed body is sent, and
+// keeps the route of the flow, which is released by the routing addon when the flow is done
+func (aud *APIAuditorAddon) Responseheaders(f *px.Flow) {
+	if estimate, found := aud.estimates.LoadAndDelete(f.Id); found {
+		f.Response.Header.Set(EstimatedCostHeader, estimate.(string))
+	}
+	if route := aud.routed.route(f.Id); route.Upstream != "" {
+		aud.routes.Store(f.Id, route)
+	}
+}
+
+// PriceRoutesFrom sets the routing record, so the flows that the routing addons sent elsewhere are
+// priced by the upstream that served them
+func (aud *APIAuditorAddon) PriceRoutesFrom(routed *FlowRoutes) {
+	aud.routed = routed
+}
+
+// writeOutput prints a priced transaction in the configured format
+func (aud *APIAuditorAddon) writeOutput(auditOutput *schema.AuditOutput) {
+	if aud.outputFormat != AuditFormatJSON {
+		aud.writeLine([]byte(auditOutput.OutputStringFormatter(aud.outputFormat)))
+		return
+	}
+
+	line, err := json.Marshal(auditOutput)
+	if err != nil {
+		log.Errorf("error encoding audit output: %v", err)
+		return
+	}
+	aud.writeLine(line)
+}
+
+// writeLine writes a single line to the output file, or to stdout
+func (aud *APIAuditorAddon) writeLine(line []byte) {
+	if aud.outputFile != nil {
+		if _, err := aud.outputFile.Write("", line); err != nil {
+			log.Errorf("error writing audit output: %v", err)
+		}
+		return
+	}
+
+	aud.stdoutMutex.Lock()
+	defer aud.stdoutMutex.Unlock()
+	fmt.Fprintln(aud.stdout, string(line))
+}
+
+// auditFormatString returns the template for a named text format, AuditFormatJSON and templates are
+// returned unchanged
+func auditFormatString(format string) string {
+	switch format {
+	case "", AuditFormatFull:
+		return schema.OutputFormatFull
+	case AuditFormatCompact:
+		return schema.OutputFormatCompact
+	}
+	return format
+}
+
+// recordEntry appends a transaction to the ledger, when it's enabled
+func (aud *APIAuditorAddon) recordEntry(f *px.Flow, auditOutput *schema.AuditOutput) {
+	if aud.ledger == nil {
+		return
+	}
+
+	entry := ledger.Entry{
+		Timestamp:         time.Now(),
+		URL:               auditOutput.URL,
+		Model:             auditOutput.Model,
+		InputTokens:       auditOutput.InputTokens,
+		CachedTokens:      auditOutput.CachedTokens,
+		OutputTokens:      auditOutput.OutputTokens,
+		ReasoningTokens:   auditOutput.ReasoningTokens,
+		Cost:              auditOutput.Cost,
+		Currency:          auditOutput.Currency,
+		ConvertedCost:     auditOutput.ConvertedCost,
+		ConvertedCurrency: auditOutput.ConvertedCurrency,
+		Client:            schema.NewConnectionStatusContainerWithDuration(f, 0).ClientAddress,
+		Tags:              requestTags(f.Request),
+		Batch:             auditOutput.Batch,
+		Estimated:         auditOutput.Estimated,
+	}
+	if err := aud.ledger.Append(entry); err != nil {
+		log.Errorf("error writing to the cost ledger: %v", err)
+	}
+}
+
+// restoreTotals adds the month-to-date cost from the ledger to the grand total, which is then reset
+// at the start of each month
+func (aud *APIAuditorAddon) restoreTotals() error {
+	aud.costCounter.SetMonthlyGrandTotal()
+	totals, err := aud.ledger.Totals(ledger.StartOfMonth(time.Now()), time.Time{})
+	if err != nil {
+		return fmt.Errorf("error reading the cost ledger: %w", err)
+	}
+	for _, total := range totals {
+		if err := aud.costCounter.RestoreGrandTotal(total); err != nil {
+			return err
+		}
+		log.Infof("Restored month-to-date cost from the ledger: %s", total.Round())
+	}
+	return nil
+}
+
+// loadPricing loads the pricing file, and replaces the prices used by the cost counter
+func (aud *APIAuditorAddon) loadPricing() error {
+	// taken before reading, so a change made during the load is reloaded on the next check
+	aud.pricingHash = pricingFingerprint(aud.pricingPath)
+
+	endpoints, err := providers.LoadPricing(aud.pricingPath)
+	if err != nil {
+		return err
+	}
+	if err := aud.costCounter.SetPricingOverrides(endpoints); err != nil {
+		return fmt.Errorf("error loading pricing file %s: %w", aud.pricingPath, err)
+	}
+	log.Infof("Loaded %d pricing endpoints from: %s", len(endpoints), aud.pricingPath)
+	return nil
+}
+
+// pricingFingerprint returns a string that changes when any of the pricing files are changed,
+// added or removed
+func pricingFingerprint(path string) string {
+	files, err := providers.PricingFiles(path)
+	if err != nil {
+		return ""
+	}
+
+	parts := make([]string, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", file, info.Size(), info.ModTime().UnixNano()))
+	}
+	return strings.Join(parts, "|")
+}
+
+// watchPricing reloads the pricing file on SIGHUP, and when the file changes. A reload that fails
+// keeps the current prices.
+func (aud *APIAuditorAddon) watchPricing(sighup chan os.Signal, interval time.Duration) {
+	defer aud.wg.Done()
+	defer signal.Stop(sighup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-aud.stopWatcher:
+			return
+		case <-sighup:
+			log.Info("Received SIGHUP, reloading pricing file")
+		case <-tick:
+			if pricingFingerprint(aud.pricingPath) == aud.pricingHash {
+				continue
+			}
+			log.Infof("Pricing file changed, reloading: %s", aud.pricingPath)
+		}
+
+		if err := aud.loadPricing(); err != nil {
+			log.Errorf("Failed to reload pricing, keeping the current prices: %v", err)
+		}
+	}
+}
+
+// setCurrency loads the exchange rates, and sets the currency for the formatted costs
+func (aud *APIAuditorAddon) setCurrency(currencyCode, exchangeRatesPath string) error {
+	var rates *schema.ExchangeRates
+	if exchangeRatesPath != "" {
+		var err error
+		if rates, err = schema.LoadExchangeRates(exchangeRatesPath); err != nil {
+			return err
+		}
+	}
+	return aud.costCounter.SetTargetCurrency(currencyCode, rates)
+}
+
+// Stats returns the per-model stats counted by this auditor
+func (aud *APIAuditorAddon) Stats() []schema.StatsSnapshot {
+	return aud.costCounter.Stats()
+}
+
+// logStats prints the lifetime stats for each model
+func (aud *APIAuditorAddon) logStats() {
+	for _, stats := range aud.Stats() {
+		total := stats.Total
+		log.Infof(
+			"%s %s: %d requests, %d input tokens, %d cached tokens, %d output tokens, %d reasoning tokens, cost %s",
+			total.URL, total.Model, total.Requests, total.InputTokens, total.CachedTokens,
+			total.OutputTokens, total.ReasoningTokens, total.Cost.Round(),
+		)
+	}
+}
+
 func (aud *APIAuditorAddon) Close() error {
 	if !aud.closed.Swap(true) {
 		log.Debug("Waiting for APIAuditor shutdown...")
+		if aud.stopWatcher != nil {
+			close(aud.stopWatcher)
+		}
 		aud.wg.Wait()
+		aud.logStats()
+
+		var errs []error
+		if aud.outputFile != nil {
+			errs = append(errs, aud.outputFile.Close())
+		}
+		if aud.ledger != nil {
+			errs = append(errs, aud.ledger.Close())
+		}
+		return errors.Join(errs...)
 	}
 
 	return nil
 }
 
-func NewAPIAuditor() *APIAuditorAddon {
+// APIAuditorOptions configures the auditor addon, the zero value only prices the requests with the
+// embedded prices and prints them to stdout
+type APIAuditorOptions struct {
+	PricingPath          string        // JSON pricing file or directory, empty to only use the embedded prices
+	ReloadInterval       time.Duration // how often to check the pricing file for changes
+	PriceByResponseModel bool          // price by the model in the response, instead of the requested model
+	LedgerPath           string        // bolt database file for the cost ledger, empty to disable it
+	StatsWindow          time.Duration // length of the rolling window for the per-model stats
+	StatsSamples         int           // raw requests and responses kept per model, 0 keeps none
+	OutputFormat         string        // AuditFormatFull, AuditFormatCompact, AuditFormatJSON, or a template
+	OutputPath           string        // JSON lines or text file for the output, empty for stdout
+	Locale               string        // locale for the formatted costs, e.g., "en-US" or "fr-FR"
+	CurrencyCode         string        // currency for the formatted costs, empty to use the price currency
+	ExchangeRatesPath    string        // JSON exchange rate file, required when CurrencyCode is set
+	EstimateCost         bool          // set the EstimatedCostHeader on responses
+	Budget               string        // spending limit for the grand total, in CurrencyCode or USD, empty for no budget
+	TokensPerMinute      int           // limit for the estimated input and maximum output tokens, 0 is unlimited
+}
+
+// NewAPIAuditor creates the auditor addon. When PricingPath is set, the prices in that file (or
+// directory) are used instead of the embedded prices, and reloaded when they change. When
+// LedgerPath is set, every transaction is recorded in that file, and the grand total starts from
+// the month-to-date cost recorded there. Each priced transaction is written to OutputPath, or to
+// stdout, in OutputFormat. When CurrencyCode is set, the printed costs are converted with the
+// exchange rates, and the ledger keeps both the original and the converted cost. When
+// EstimateCost is set, the cost estimated before each request is sent is added to the response
+// headers. A request is answered with a 429 error, without being sent, when its estimated cost
+// would take the grand total over the Budget, or its estimated tokens would go over the
+// TokensPerMinute limit.
+func NewAPIAuditor(opts APIAuditorOptions) (*APIAuditorAddon, error) {
+	if opts.Locale == "" {
+		opts.Locale = "en-US"
+	}
+	budgetCurrency := opts.CurrencyCode
+	if budgetCurrency == "" {
+		budgetCurrency = "USD"
+	}
+	limits, err := newPreflightLimits(opts.Budget, budgetCurrency, opts.TokensPerMinute)
+	if err != nil {
+		return nil, err
+	}
 	aud := &APIAuditorAddon{
-		costCounter: schema.NewCostCounterDefaults(),
+		costCounter:  schema.NewCostCounter(opts.Locale),
+		pricingPath:  opts.PricingPath,
+		outputFormat: auditFormatString(opts.OutputFormat),
+		estimateCost: opts.EstimateCost,
+		limits:       limits,
+		stdout:       os.Stdout,
+	}
+	aud.costCounter.SetPriceByResponseModel(opts.PriceByResponseModel)
+	aud.costCounter.SetStatsOptions(opts.StatsWindow, opts.StatsSamples)
+	if err := aud.setCurrency(opts.CurrencyCode, opts.ExchangeRatesPath); err != nil {
+		return nil, err
 	}
 	aud.closed.Store(false) // initialize as open
-	return aud
+
+	if opts.PricingPath != "" {
+		if err := aud.loadPricing(); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.LedgerPath != "" {
+		l, err := ledger.Open(opts.LedgerPath)
+		if err != nil {
+			return nil, err
+		}
+		aud.ledger = l
+		if err := aud.restoreTotals(); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	if opts.OutputPath != "" {
+		outputFile, err := writers.NewToLines(opts.OutputPath)
+		if err != nil {
+			if aud.ledger != nil {
+				aud.ledger.Close()
+			}
+			return nil, err
+		}
+		aud.outputFile = outputFile
+	}
+
+	if opts.PricingPath != "" {
+		// registered before returning, because SIGHUP stops the process when nothing is listening
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+
+		aud.stopWatcher = make(chan struct{})
+		aud.wg.Add(1)
+		go aud.watchPricing(sighup, opts.ReloadInterval)
+	}
+	return aud, nil
 }
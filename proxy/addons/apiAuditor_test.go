@@ -0,0 +1,389 @@
+package addons
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bojanz/currency"
+	px "github.com/kardianos/mitmproxy/proxy"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/proxy/addons/ledger"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+const auditorTestPricing = `[{
+	"url": "https://api.openai.com/v1/chat/completions",
+	"products": [{"name": "my-model", "inputTokenCost": "%s", "outputTokenCost": "0", "currency": "USD"}]
+}]`
+
+func auditTestCost(t *testing.T, aud *APIAuditorAddon) (string, error) {
+	t.Helper()
+	reqURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+	out, err := aud.costCounter.Add(
+		schema.ProxyRequest{URL: reqURL, Body: `{"model": "my-model"}`},
+		schema.ProxyResponse{Body: `{"usage": {"prompt_tokens": 1}}`},
+	)
+	if err != nil {
+		return "", err
+	}
+	return out.TotalReqCost, nil
+}
+
+func TestNewAPIAuditor(t *testing.T) {
+	t.Run("without pricing file", func(t *testing.T) {
+		aud, err := NewAPIAuditor(APIAuditorOptions{})
+		require.NoError(t, err)
+		defer aud.Close()
+
+		_, err = auditTestCost(t, aud)
+		assert.ErrorIs(t, err, schema.ErrUnknownModel)
+	})
+
+	t.Run("missing pricing file", func(t *testing.T) {
+		aud, err := NewAPIAuditor(APIAuditorOptions{PricingPath: filepath.Join(t.TempDir(), "missing.json")})
+		assert.Error(t, err)
+		assert.Nil(t, aud)
+	})
+
+	t.Run("invalid pricing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "pricing.json")
+		require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(auditorTestPricing, "invalid")), 0o644))
+		aud, err := NewAPIAuditor(APIAuditorOptions{PricingPath: path})
+		assert.Error(t, err)
+		assert.Nil(t, aud)
+	})
+}
+
+func TestAPIAuditorPricingReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	writePricing := func(cost string, modTime time.Time) {
+		require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(auditorTestPricing, cost)), 0o644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	start := time.Now().Add(-time.Hour)
+	writePricing("1", start)
+
+	aud, err := NewAPIAuditor(APIAuditorOptions{PricingPath: path, ReloadInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer aud.Close()
+
+	cost, err := auditTestCost(t, aud)
+	require.NoError(t, err)
+	assert.Equal(t, "$1.00", cost)
+
+	// a changed file is reloaded
+	writePricing("2", start.Add(time.Minute))
+	assert.Eventually(t, func() bool {
+		cost, err := auditTestCost(t, aud)
+		return err == nil && cost == "$2.00"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// an invalid file keeps the current prices
+	writePricing("invalid", start.Add(2*time.Minute))
+	time.Sleep(100 * time.Millisecond)
+	cost, err = auditTestCost(t, aud)
+	require.NoError(t, err)
+	assert.Equal(t, "$2.00", cost)
+
+	require.NoError(t, aud.Close())
+	assert.True(t, aud.closed.Load())
+}
+
+func TestAPIAuditorLedger(t *testing.T) {
+	dir := t.TempDir()
+	pricingPath := filepath.Join(dir, "pricing.json")
+	require.NoError(t, os.WriteFile(pricingPath, []byte(fmt.Sprintf(auditorTestPricing, "1")), 0o644))
+	ledgerPath := filepath.Join(dir, "ledger.db")
+
+	reqURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+	flow := &px.Flow{Request: &px.Request{
+		URL:    reqURL,
+		Header: http.Header{RequestTagsHeader: []string{"team-a, nightly"}},
+	}}
+
+	aud, err := NewAPIAuditor(APIAuditorOptions{PricingPath: pricingPath, LedgerPath: ledgerPath})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		out, err := aud.costCounter.Add(
+			schema.ProxyRequest{URL: reqURL, Body: `{"model": "my-model"}`},
+			schema.ProxyResponse{Body: `{"usage": {"prompt_tokens": 1}}`},
+		)
+		require.NoError(t, err)
+		aud.recordEntry(flow, out)
+	}
+	require.NoError(t, aud.Close())
+
+	// the grand total continues from the ledger after a restart
+	aud, err = NewAPIAuditor(APIAuditorOptions{PricingPath: pricingPath, LedgerPath: ledgerPath})
+	require.NoError(t, err)
+	out, err := aud.costCounter.Add(
+		schema.ProxyRequest{URL: reqURL, Body: `{"model": "my-model"}`},
+		schema.ProxyResponse{Body: `{"usage": {"prompt_tokens": 1}}`},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "$3.00", out.GrandTotal)
+	require.NoError(t, aud.Close())
+
+	l, err := ledger.Open(ledgerPath)
+	require.NoError(t, err)
+	defer l.Close()
+	entries := make([]ledger.Entry, 0)
+	require.NoError(t, l.Range(time.Time{}, time.Time{}, func(entry ledger.Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	require.Len(t, entries, 2)
+	assert.Equal(t, "my-model", entries[0].Model)
+	assert.Equal(t, "USD", entries[0].Currency)
+	assert.Equal(t, 1, entries[0].InputTokens)
+	assert.Equal(t, []string{"team-a", "nightly"}, entries[0].Tags)
+	assert.Equal(t, schema.UnknownAddr, entries[0].Client)
+}
+
+func TestAPIAuditorStats(t *testing.T) {
+	pricingPath := filepath.Join(t.TempDir(), "pricing.json")
+	require.NoError(t, os.WriteFile(pricingPath, []byte(fmt.Sprintf(auditorTestPricing, "1")), 0o644))
+
+	aud, err := NewAPIAuditor(APIAuditorOptions{PricingPath: pricingPath, StatsWindow: time.Minute, StatsSamples: 2})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := auditTestCost(t, aud)
+		require.NoError(t, err)
+	}
+
+	stats := aud.Stats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "my-model", stats[0].Total.Model)
+	assert.Equal(t, 3, stats[0].Total.Requests)
+	assert.Equal(t, 3, stats[0].Window.Requests)
+	assert.Len(t, stats[0].Samples, 2, "only the last samples are kept")
+	require.NoError(t, aud.Close())
+}
+
+func TestAPIAuditorOutput(t *testing.T) {
+	output := &schema.AuditOutput{
+		Timestamp:    time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC),
+		Model:        "my-model",
+		TotalReqCost: "$1.00",
+		GrandTotal:   "$2.00",
+		Tags:         []string{"team-a"},
+		CacheStatus:  "MISS",
+	}
+
+	testCases := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{name: "default", format: "", expected: "URL:  Model: my-model inputCost:  outputCost  = Request Cost: $1.00 Grand Total: $2.00\n"},
+		{name: "compact", format: AuditFormatCompact, expected: "Request Cost: $1.00 Grand Total: $2.00\n"},
+		{name: "template", format: "{model} {tags} {cacheStatus}", expected: "my-model team-a MISS\n"},
+		{name: "json", format: AuditFormatJSON, expected: `"timestamp":"2024-10-01T12:00:00Z"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			aud, err := NewAPIAuditor(APIAuditorOptions{OutputFormat: tc.format})
+			require.NoError(t, err)
+			defer aud.Close()
+
+			buf := &strings.Builder{}
+			aud.stdout = buf
+			aud.writeOutput(output)
+			assert.Contains(t, buf.String(), tc.expected)
+		})
+	}
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+		aud, err := NewAPIAuditor(APIAuditorOptions{OutputFormat: AuditFormatJSON, OutputPath: path})
+		require.NoError(t, err)
+		aud.writeOutput(output)
+		aud.writeOutput(output)
+		require.NoError(t, aud.Close())
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		require.Len(t, lines, 2)
+		decoded := schema.AuditOutput{}
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &decoded))
+		assert.Equal(t, output.Model, decoded.Model)
+		assert.Equal(t, output.Tags, decoded.Tags)
+	})
+}
+
+func TestAPIAuditorCurrency(t *testing.T) {
+	dir := t.TempDir()
+	pricingPath := filepath.Join(dir, "pricing.json")
+	require.NoError(t, os.WriteFile(pricingPath, []byte(fmt.Sprintf(auditorTestPricing, "1")), 0o644))
+	ratesPath := filepath.Join(dir, "rates.json")
+	require.NoError(t, os.WriteFile(ratesPath, []byte(`{"base": "USD", "rates": {"GBP": "0.8"}}`), 0o644))
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := NewAPIAuditor(APIAuditorOptions{PricingPath: pricingPath, CurrencyCode: "GBP"})
+		assert.Error(t, err, "exchange rates are required")
+		_, err = NewAPIAuditor(APIAuditorOptions{PricingPath: pricingPath, CurrencyCode: "GBP", ExchangeRatesPath: filepath.Join(dir, "missing.json")})
+		assert.Error(t, err)
+	})
+
+	ledgerPath := filepath.Join(dir, "ledger.db")
+	aud, err := NewAPIAuditor(APIAuditorOptions{PricingPath: pricingPath, LedgerPath: ledgerPath, Locale: "en-GB", CurrencyCode: "GBP", ExchangeRatesPath: ratesPath})
+	require.NoError(t, err)
+	cost, err := auditTestCost(t, aud)
+	require.NoError(t, err)
+	assert.Equal(t, "£0.80", cost)
+
+	reqURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+	out, err := aud.costCounter.Add(
+		schema.ProxyRequest{URL: reqURL, Body: `{"model": "my-model"}`},
+		schema.ProxyResponse{Body: `{"usage": {"prompt_tokens": 1}}`},
+	)
+	require.NoError(t, err)
+	aud.recordEntry(&px.Flow{Request: &px.Request{URL: reqURL, Header: http.Header{}}}, out)
+	require.NoError(t, aud.Close())
+
+	l, err := ledger.OpenReadOnly(ledgerPath)
+	require.NoError(t, err)
+	defer l.Close()
+	require.NoError(t, l.Range(time.Time{}, time.Time{}, func(entry ledger.Entry) error {
+		assert.Equal(t, "USD", entry.Currency, "the original cost is kept")
+		assert.Equal(t, "GBP", entry.ConvertedCurrency)
+		assert.NotEmpty(t, entry.ConvertedCost)
+		return nil
+	}))
+}
+
+func TestAPIAuditorEstimatedCost(t *testing.T) {
+	pricingPath := filepath.Join(t.TempDir(), "pricing.json")
+	require.NoError(t, os.WriteFile(pricingPath, []byte(fmt.Sprintf(auditorTestPricing, "1")), 0o644))
+
+	newFlow := func(rawURL, body string) *px.Flow {
+		reqURL, _ := url.Parse(rawURL)
+		return &px.Flow{Id: uuid.NewV4(), Request: &px.Request{
+			Method: http.MethodPost,
+			URL:    reqURL,
+			Header: http.Header{},
+			Body:   []byte(body),
+		}}
+	}
+	// 10 input tokens, priced at 10 USD
+	const reqBody = `{"model": "my-model", "messages": [{"role": "user", "content": "Hello there"}]}`
+	const chatURL = "https://api.openai.com/v1/chat/completions"
+
+	t.Run("enabled", func(t *testing.T) {
+		aud, err := NewAPIAuditor(APIAuditorOptions{PricingPath: pricingPath, EstimateCost: true})
+		require.NoError(t, err)
+		defer aud.Close()
+
+		f := newFlow(chatURL, reqBody)
+		aud.Request(f)
+		require.Nil(t, f.Response)
+		assert.Empty(t, f.Request.Header.Get(EstimatedCostHeader), "not sent upstream")
+		f.Response = &px.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+		aud.Responseheaders(f)
+		assert.Equal(t, "10 USD", f.Response.Header.Get(EstimatedCostHeader))
+		assert.Empty(t, aud.Stats(), "estimates are not counted")
+		_, found := aud.estimates.Load(f.Id)
+		assert.False(t, found)
+
+		f = newFlow(chatURL, `{"model": "unknown-model"}`)
+		aud.Request(f)
+		_, found = aud.estimates.Load(f.Id)
+		assert.False(t, found, "no price for the model")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		aud, err := NewAPIAuditor(APIAuditorOptions{PricingPath: pricingPath})
+		require.NoError(t, err)
+		defer aud.Close()
+
+		f := newFlow(chatURL, reqBody)
+		aud.Request(f)
+		f.Response = &px.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+		aud.Responseheaders(f)
+		assert.Empty(t, f.Response.Header.Get(EstimatedCostHeader))
+	})
+
+	t.Run("budget", func(t *testing.T) {
+		aud, err := NewAPIAuditor(APIAuditorOptions{PricingPath: pricingPath, Budget: "25"})
+		require.NoError(t, err)
+		defer aud.Close()
+
+		f := newFlow(chatURL, reqBody)
+		aud.Request(f)
+		assert.Nil(t, f.Response, "10 USD of the 25 USD budget")
+
+		spent, err := currency.NewAmount("20", "USD")
+		require.NoError(t, err)
+		require.NoError(t, aud.costCounter.RestoreGrandTotal(spent))
+
+		f = newFlow(chatURL, reqBody)
+		aud.Request(f)
+		require.NotNil(t, f.Response)
+		assert.Equal(t, http.StatusTooManyRequests, f.Response.StatusCode)
+		assert.Contains(t, string(f.Response.Body), `"code":"budget_exceeded"`)
+		assert.Contains(t, string(f.Response.Body), "remaining budget of 5.00 USD")
+
+		f = newFlow(chatURL, `{"model": "unknown-model", "messages": []}`)
+		aud.Request(f)
+		assert.Nil(t, f.Response, "requests that can't be priced aren't checked against the budget")
+	})
+
+	t.Run("tokens per minute", func(t *testing.T) {
+		aud, err := NewAPIAuditor(APIAuditorOptions{PricingPath: pricingPath, TokensPerMinute: 25})
+		require.NoError(t, err)
+		defer aud.Close()
+
+		for i := 0; i < 2; i++ {
+			f := newFlow(chatURL, reqBody)
+			aud.Request(f)
+			assert.Nil(t, f.Response, "request %d", i)
+		}
+
+		f := newFlow(chatURL, reqBody)
+		aud.Request(f)
+		require.NotNil(t, f.Response)
+		assert.Equal(t, http.StatusTooManyRequests, f.Response.StatusCode)
+		assert.Contains(t, string(f.Response.Body), `"code":"rate_limit_exceeded"`)
+		assert.Equal(t, "60", f.Response.Header.Get("Retry-After"))
+	})
+}
+
+func TestAPIAuditorRoutes(t *testing.T) {
+	aud, err := NewAPIAuditor(APIAuditorOptions{})
+	require.NoError(t, err)
+	defer aud.Close()
+	routed := NewFlowRoutes()
+	aud.PriceRoutesFrom(routed)
+
+	reqURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+	rate, err := schema.ParseInternalRate("0 0 USD")
+	require.NoError(t, err)
+	route := schema.Route{Upstream: "http://localhost:11434/v1/chat/completions", Rate: &rate}
+
+	f := &px.Flow{Id: uuid.NewV4(), Request: &px.Request{URL: reqURL, Header: http.Header{}}}
+	routed.record(f.Id, "LocalRouteAddon", route)
+	f.Response = &px.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	aud.Responseheaders(f)
+	routed.release(f.Id)
+	value, found := aud.routes.Load(f.Id)
+	require.True(t, found, "kept after the routing addon released the flow")
+	assert.Equal(t, route, value.(schema.Route))
+
+	// a header set by the upstream isn't a route
+	f = &px.Flow{Id: uuid.NewV4(), Request: &px.Request{URL: reqURL, Header: http.Header{}}}
+	f.Response = &px.Response{StatusCode: http.StatusOK, Header: http.Header{"X-Llm_proxy-Upstream": []string{"http://localhost/v1"}}}
+	aud.Responseheaders(f)
+	_, found = aud.routes.Load(f.Id)
+	assert.False(t, found)
+}
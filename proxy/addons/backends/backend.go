@@ -0,0 +1,86 @@
+package backends
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend is an upstream server with a circuit breaker, which is opened after too many
+// consecutive failures, and half-opened (allowing a trial request) after the cooldown.
+type Backend struct {
+	BackendConfig
+	baseURL          *url.URL
+	failureThreshold int
+	cooldown         time.Duration
+	failures         int
+	openUntil        time.Time
+	mutex            sync.Mutex
+}
+
+func newBackend(cfg BackendConfig, failureThreshold int, cooldown time.Duration) (*Backend, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend url %s: %w", cfg.URL, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("backend url must include a scheme and host: %s", cfg.URL)
+	}
+
+	return &Backend{
+		BackendConfig:    cfg,
+		baseURL:          u,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+	}, nil
+}
+
+// Healthy returns false while the circuit breaker is open
+func (b *Backend) Healthy(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return !now.Before(b.openUntil)
+}
+
+// RecordSuccess closes the circuit breaker
+func (b *Backend) RecordSuccess() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// RecordFailure counts a failure, and opens the circuit breaker when the threshold is reached
+func (b *Backend) RecordFailure(now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures++
+	if b.failures >= b.failureThreshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
+
+// TargetURL builds the upstream URL for a client request path, by replacing the "/v1" prefix
+// of the client's path with the backend's base URL
+func (b *Backend) TargetURL(clientURL *url.URL) *url.URL {
+	target := *b.baseURL
+	suffix := strings.TrimPrefix(clientURL.Path, "/v1")
+	target.Path = strings.TrimSuffix(b.baseURL.Path, "/") + suffix
+
+	query := clientURL.Query()
+	for key, value := range b.Query {
+		query.Set(key, value)
+	}
+	target.RawQuery = query.Encode()
+	return &target
+}
+
+// AuthHeaderValue returns the value for the backend's auth header
+func (b *Backend) AuthHeaderValue() string {
+	if strings.EqualFold(b.AuthHeader, defaultAuthHeader) {
+		return "Bearer " + b.APIKey
+	}
+	return b.APIKey
+}
@@ -0,0 +1,129 @@
+package backends
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultCooldown         = 30 * time.Second
+	defaultTimeout          = 120 * time.Second
+	defaultAuthHeader       = "Authorization"
+)
+
+// Duration is a time.Duration that unmarshals from a JSON string, e.g., "30s"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string, e.g. \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// BackendConfig is a single upstream that can serve a logical model
+type BackendConfig struct {
+	Name       string            `json:"name"`                  // Used in the logs
+	URL        string            `json:"url"`                   // Base URL, e.g., "https://api.openai.com/v1"
+	APIKey     string            `json:"api_key,omitempty"`     // Replaces the client's API key, when set
+	AuthHeader string            `json:"auth_header,omitempty"` // Header for the API key, "api-key" for Azure OpenAI
+	Model      string            `json:"model,omitempty"`       // Replaces the requested model, when set
+	Query      map[string]string `json:"query,omitempty"`       // Extra query params, e.g., {"api-version": "2024-06-01"}
+	Weight     int               `json:"weight,omitempty"`      // Relative share of the traffic, defaults to 1
+}
+
+// ModelConfig is a logical model name that is served by one or more backends
+type ModelConfig struct {
+	Name     string          `json:"name"`
+	Backends []BackendConfig `json:"backends"`
+}
+
+// Config backs the JSON file used to configure the load balancer
+type Config struct {
+	Models           []ModelConfig `json:"models"`
+	FailureThreshold int           `json:"failure_threshold,omitempty"` // consecutive failures before a backend is skipped
+	Cooldown         Duration      `json:"cooldown,omitempty"`          // how long a failed backend is skipped
+	Timeout          Duration      `json:"timeout,omitempty"`           // per-attempt timeout, including the first attempt
+}
+
+// validate checks the config for errors, and sets default values
+func (c *Config) validate() error {
+	if len(c.Models) == 0 {
+		return errors.New("no models defined")
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = defaultFailureThreshold
+	}
+	if c.Cooldown.Duration <= 0 {
+		c.Cooldown.Duration = defaultCooldown
+	}
+	if c.Timeout.Duration <= 0 {
+		c.Timeout.Duration = defaultTimeout
+	}
+
+	seen := make(map[string]struct{})
+	for i := range c.Models {
+		m := &c.Models[i]
+		if m.Name == "" {
+			return fmt.Errorf("model %d is missing a name", i)
+		}
+		if _, found := seen[m.Name]; found {
+			return fmt.Errorf("duplicate model name: %s", m.Name)
+		}
+		seen[m.Name] = struct{}{}
+
+		if len(m.Backends) == 0 {
+			return fmt.Errorf("model %s has no backends", m.Name)
+		}
+		for j := range m.Backends {
+			b := &m.Backends[j]
+			if b.URL == "" {
+				return fmt.Errorf("backend %d for model %s is missing a url", j, m.Name)
+			}
+			if b.Name == "" {
+				b.Name = b.URL
+			}
+			if b.Weight <= 0 {
+				b.Weight = 1
+			}
+			if b.AuthHeader == "" {
+				b.AuthHeader = defaultAuthHeader
+			}
+		}
+	}
+	return nil
+}
+
+// LoadConfig reads and validates a load balancer config JSON file
+func LoadConfig(filePath string) (*Config, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backends file: %w", err)
+	}
+
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse backends file: %w", err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid backends file %s: %w", filePath, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,116 @@
+package backends
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Pool holds the backends for each logical model, and picks the order in which they are tried
+type Pool struct {
+	models  map[string][]*Backend
+	timeout time.Duration
+	rand    *rand.Rand
+	mutex   sync.Mutex
+}
+
+// NewPool creates a new Pool from a validated Config
+func NewPool(cfg *Config) (*Pool, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	p := &Pool{
+		models:  make(map[string][]*Backend),
+		timeout: cfg.Timeout.Duration,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	for _, m := range cfg.Models {
+		for _, bCfg := range m.Backends {
+			b, err := newBackend(bCfg, cfg.FailureThreshold, cfg.Cooldown.Duration)
+			if err != nil {
+				return nil, fmt.Errorf("model %s: %w", m.Name, err)
+			}
+			p.models[m.Name] = append(p.models[m.Name], b)
+		}
+	}
+	return p, nil
+}
+
+// NewPoolFromFile loads a JSON config file and creates a new Pool
+func NewPoolFromFile(filePath string) (*Pool, error) {
+	cfg, err := LoadConfig(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return NewPool(cfg)
+}
+
+// Timeout returns the per-attempt timeout for failover requests
+func (p *Pool) Timeout() time.Duration {
+	return p.timeout
+}
+
+// HasModel returns true if the model name is configured in this pool
+func (p *Pool) HasModel(model string) bool {
+	_, found := p.models[model]
+	return found
+}
+
+// weightedPick removes and returns a backend from the slice, chosen randomly by weight
+func (p *Pool) weightedPick(candidates []*Backend) (*Backend, []*Backend) {
+	total := 0
+	for _, b := range candidates {
+		total += b.Weight
+	}
+
+	p.mutex.Lock()
+	n := p.rand.Intn(total)
+	p.mutex.Unlock()
+
+	for i, b := range candidates {
+		n -= b.Weight
+		if n < 0 {
+			remaining := append(append([]*Backend{}, candidates[:i]...), candidates[i+1:]...)
+			return b, remaining
+		}
+	}
+	// unreachable, weights are always positive
+	return candidates[0], candidates[1:]
+}
+
+// Candidates returns the backends for a model in the order they should be tried. The first
+// backend is chosen randomly by weight from the healthy backends, followed by the other healthy
+// backends (heaviest first), and finally the unhealthy backends as a last resort.
+func (p *Pool) Candidates(model string, now time.Time) []*Backend {
+	backends, found := p.models[model]
+	if !found {
+		return nil
+	}
+
+	healthy := make([]*Backend, 0, len(backends))
+	unhealthy := make([]*Backend, 0)
+	for _, b := range backends {
+		if b.Healthy(now) {
+			healthy = append(healthy, b)
+		} else {
+			unhealthy = append(unhealthy, b)
+		}
+	}
+
+	ordered := make([]*Backend, 0, len(backends))
+	if len(healthy) > 0 {
+		var first *Backend
+		first, healthy = p.weightedPick(healthy)
+		ordered = append(ordered, first)
+
+		sort.SliceStable(healthy, func(i, j int) bool {
+			return healthy[i].Weight > healthy[j].Weight
+		})
+		ordered = append(ordered, healthy...)
+	}
+	return append(ordered, unhealthy...)
+}
@@ -0,0 +1,132 @@
+package backends
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigJSON = `{
+	"models": [
+		{
+			"name": "gpt-4o",
+			"backends": [
+				{"name": "openai-1", "url": "https://api.openai.com/v1", "api_key": "sk-1", "weight": 3},
+				{"name": "azure", "url": "https://example.openai.azure.com/openai/deployments/gpt4o", "api_key": "az-key", "auth_header": "api-key", "query": {"api-version": "2024-06-01"}},
+				{"url": "http://localhost:8000/v1", "model": "llama3"}
+			]
+		}
+	],
+	"failure_threshold": 2,
+	"cooldown": "1m"
+}`
+
+func writeTestConfig(t *testing.T, data string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "backends.json")
+	require.NoError(t, os.WriteFile(filePath, []byte(data), 0644))
+	return filePath
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(writeTestConfig(t, testConfigJSON))
+	require.NoError(t, err)
+	require.Len(t, cfg.Models, 1)
+
+	assert.Equal(t, 2, cfg.FailureThreshold)
+	assert.Equal(t, time.Minute, cfg.Cooldown.Duration)
+	assert.Equal(t, defaultTimeout, cfg.Timeout.Duration)
+
+	local := cfg.Models[0].Backends[2]
+	assert.Equal(t, "http://localhost:8000/v1", local.Name, "name defaults to the url")
+	assert.Equal(t, 1, local.Weight)
+	assert.Equal(t, defaultAuthHeader, local.AuthHeader)
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"invalid json", `{`},
+		{"no models", `{"models": []}`},
+		{"missing model name", `{"models": [{"backends": [{"url": "http://localhost"}]}]}`},
+		{"no backends", `{"models": [{"name": "gpt-4o"}]}`},
+		{"missing url", `{"models": [{"name": "gpt-4o", "backends": [{"name": "a"}]}]}`},
+		{"invalid duration", `{"models": [{"name": "gpt-4o", "backends": [{"url": "http://a"}]}], "cooldown": "soon"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeTestConfig(t, tt.data))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestBackend_TargetURL(t *testing.T) {
+	pool, err := NewPoolFromFile(writeTestConfig(t, testConfigJSON))
+	require.NoError(t, err)
+	backends := pool.models["gpt-4o"]
+
+	clientURL, _ := url.Parse("http://api.openai.com/v1/chat/completions")
+	assert.Equal(t, "https://api.openai.com/v1/chat/completions", backends[0].TargetURL(clientURL).String())
+	assert.Equal(t,
+		"https://example.openai.azure.com/openai/deployments/gpt4o/chat/completions?api-version=2024-06-01",
+		backends[1].TargetURL(clientURL).String(),
+	)
+	assert.Equal(t, "Bearer sk-1", backends[0].AuthHeaderValue())
+	assert.Equal(t, "az-key", backends[1].AuthHeaderValue())
+}
+
+func TestBackend_CircuitBreaker(t *testing.T) {
+	b, err := newBackend(BackendConfig{Name: "a", URL: "http://localhost"}, 2, time.Minute)
+	require.NoError(t, err)
+	now := time.Now()
+
+	assert.True(t, b.Healthy(now))
+	b.RecordFailure(now)
+	assert.True(t, b.Healthy(now), "below the failure threshold")
+	b.RecordFailure(now)
+	assert.False(t, b.Healthy(now), "breaker is open")
+	assert.True(t, b.Healthy(now.Add(time.Minute)), "half-open after the cooldown")
+
+	b.RecordSuccess()
+	assert.True(t, b.Healthy(now))
+}
+
+func TestPool_Candidates(t *testing.T) {
+	pool, err := NewPoolFromFile(writeTestConfig(t, testConfigJSON))
+	require.NoError(t, err)
+	now := time.Now()
+
+	assert.True(t, pool.HasModel("gpt-4o"))
+	assert.False(t, pool.HasModel("gpt-3.5-turbo"))
+	assert.Nil(t, pool.Candidates("gpt-3.5-turbo", now))
+
+	// the weighted choice should favor the heaviest backend
+	firstCounts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		candidates := pool.Candidates("gpt-4o", now)
+		require.Len(t, candidates, 3)
+		firstCounts[candidates[0].Name]++
+	}
+	assert.Greater(t, firstCounts["openai-1"], firstCounts["azure"])
+
+	// open the breaker for the heaviest backend, it should be tried last
+	openai := pool.models["gpt-4o"][0]
+	openai.RecordFailure(now)
+	openai.RecordFailure(now)
+	for i := 0; i < 100; i++ {
+		candidates := pool.Candidates("gpt-4o", now)
+		require.Len(t, candidates, 3)
+		assert.Equal(t, "openai-1", candidates[2].Name)
+	}
+}
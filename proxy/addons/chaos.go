@@ -0,0 +1,255 @@
+package addons
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/proxy/addons/chaos"
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+// ChaosHeader lists the faults that were injected into a response, e.g., "latency=1.2s" or
+// "rate_limit". Responses with this header are never cached.
+const ChaosHeader = "X-Llm_proxy-Chaos"
+
+// ChaosAddon injects faults into requests and responses, with the probabilities from a rules
+// file. Faults that replace the response (latency, rate limits, server errors, and connection
+// resets) are injected before the request is sent upstream, the other faults change the response
+// in the ResponseAddon, after the other addons have seen the original response.
+type ChaosAddon struct {
+	px.BaseAddon
+	rules   *chaos.RuleSet
+	rand    *rand.Rand
+	randMu  sync.Mutex
+	pending sync.Map // key: *px.Flow, value: *chaos.Fault, response faults for flows in progress
+	stop    chan struct{}
+	closed  atomic.Bool
+	wg      sync.WaitGroup
+}
+
+// roll selects the faults for a request, the random source isn't safe for concurrent use
+func (c *ChaosAddon) roll(req chaos.Request) chaos.Decision {
+	c.randMu.Lock()
+	defer c.randMu.Unlock()
+	return c.rules.Roll(req, c.rand)
+}
+
+func (c *ChaosAddon) Request(f *px.Flow) {
+	if f.Response != nil || c.closed.Load() {
+		return
+	}
+
+	req := chaos.Request{Host: f.Request.URL.Hostname(), Path: f.Request.URL.Path}
+	if body, err := decodeRequestJSON(f.Request); err == nil {
+		req.Model = requestModel(body)
+	}
+	decision := c.roll(req)
+
+	if decision.Delay > 0 {
+		log.Debugf("chaos rule %s: adding %s latency to %s", decision.Rule, decision.Delay, f.Request.URL)
+		select {
+		case <-time.After(decision.Delay):
+		case <-c.stop:
+		}
+		// abusing the request header as a context storage, copied to the response below
+		f.Request.Header.Add(ChaosHeader, fmt.Sprintf("%s=%s", chaos.Latency, decision.Delay.Round(time.Millisecond)))
+	}
+
+	fault := decision.Fault
+	if fault == nil {
+		return
+	}
+	log.Debugf("chaos rule %s: injecting %s into %s", decision.Rule, fault.Type, f.Request.URL)
+	f.Request.Header.Add(ChaosHeader, string(fault.Type))
+
+	switch fault.Type {
+	case chaos.RateLimit:
+		retryAfter := int(math.Ceil(fault.RetryAfter.Seconds()))
+		f.Response = newErrorResponse(
+			http.StatusTooManyRequests, "requests", "rate_limit_exceeded",
+			fmt.Sprintf("Rate limit reached, please try again in %ds (injected by llm_proxy chaos rule %s)", retryAfter, decision.Rule),
+		)
+		f.Response.Header.Set("Retry-After", strconv.Itoa(retryAfter))
+	case chaos.ServerError:
+		f.Response = newErrorResponse(
+			fault.Status, "server_error", "",
+			fmt.Sprintf("%s (injected by llm_proxy chaos rule %s)", http.StatusText(fault.Status), decision.Rule),
+		)
+	case chaos.Reset:
+		resetClientConn(f)
+		f.Response = &px.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}}
+	default:
+		c.pending.Store(f, fault)
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			select {
+			case <-f.Done():
+			case <-c.stop:
+			}
+			c.pending.Delete(f)
+		}()
+		return
+	}
+	c.copyHeader(f)
+}
+
+func (c *ChaosAddon) Response(f *px.Flow) {
+	if f.Response != nil {
+		c.copyHeader(f)
+	}
+}
+
+// copyHeader copies the injected faults from the request to the response header
+func (c *ChaosAddon) copyHeader(f *px.Flow) {
+	for _, value := range f.Request.Header.Values(ChaosHeader) {
+		f.Response.Header.Add(ChaosHeader, value)
+	}
+}
+
+// resetClientConn closes the client connection without the normal shutdown, so the client gets
+// a connection reset
+func resetClientConn(f *px.Flow) {
+	if f.ConnContext == nil || f.ConnContext.ClientConn == nil || f.ConnContext.ClientConn.Conn == nil {
+		return
+	}
+	clientConn := f.ConnContext.ClientConn.Conn
+	if tcpConn, ok := clientConn.Conn.(*net.TCPConn); ok {
+		// send RST instead of FIN
+		tcpConn.SetLinger(0)
+	}
+	clientConn.Close()
+}
+
+// sleepReader returns EOF after a delay, or when the addon is closed
+type sleepReader struct {
+	delay time.Duration
+	stop  chan struct{}
+	done  bool
+}
+
+func (r *sleepReader) Read(p []byte) (int, error) {
+	if !r.done {
+		r.done = true
+		select {
+		case <-time.After(r.delay):
+		case <-r.stop:
+		}
+	}
+	return 0, io.EOF
+}
+
+// applyResponseFault changes the response body for a fault selected by the Request hook
+func (c *ChaosAddon) applyResponseFault(f *px.Flow) {
+	value, found := c.pending.LoadAndDelete(f)
+	if !found || f.Response == nil {
+		return
+	}
+	fault := value.(*chaos.Fault)
+
+	decodedBody, err := utils.DecodeBody(f.Response.Body, f.Response.Header.Get("Content-Encoding"))
+	if err != nil {
+		log.Debugf("chaos skipping response body that can't be decoded: %v", err)
+		return
+	}
+	body := string(decodedBody)
+	isStream := utils.IsSSE(f.Response.Header.Get("Content-Type")) || utils.LooksLikeSSE(body)
+
+	// the changed body is sent without the content encoding
+	f.Response.Header.Del("Content-Encoding")
+
+	switch fault.Type {
+	case chaos.TruncateStream:
+		body = chaos.Truncate(body, isStream, fault.AfterEvents)
+	case chaos.MalformedJSON:
+		body = chaos.Malform(body, isStream, fault.AfterEvents)
+	case chaos.ContentFilter:
+		body = chaos.FilterContent(body, isStream)
+	case chaos.StallStream:
+		first, rest := chaos.SplitStream(body, fault.AfterEvents)
+		if !isStream {
+			first, rest = "", body
+		}
+		f.Response.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		f.Response.Body = nil
+		f.Response.BodyReader = io.MultiReader(
+			strings.NewReader(first),
+			&sleepReader{delay: fault.Delay.Duration, stop: c.stop},
+			strings.NewReader(rest),
+		)
+		return
+	}
+	f.Response.Body = []byte(body)
+	f.Response.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+// ResponseAddon returns the addon that changes the response for the selected response faults. It's
+// added after the other addons, so they see the original upstream response.
+func (c *ChaosAddon) ResponseAddon() *ChaosResponseAddon {
+	return &ChaosResponseAddon{chaos: c}
+}
+
+func (c *ChaosAddon) String() string {
+	return "ChaosAddon"
+}
+
+func (c *ChaosAddon) Close() error {
+	if !c.closed.Swap(true) {
+		close(c.stop)
+		c.wg.Wait()
+	}
+	return nil
+}
+
+// ChaosResponseAddon applies the response faults selected by the ChaosAddon
+type ChaosResponseAddon struct {
+	px.BaseAddon
+	chaos *ChaosAddon
+}
+
+func (c *ChaosResponseAddon) Response(f *px.Flow) {
+	c.chaos.applyResponseFault(f)
+}
+
+func (c *ChaosResponseAddon) String() string {
+	return "ChaosResponseAddon"
+}
+
+func (c *ChaosResponseAddon) Close() error {
+	return nil
+}
+
+// NewChaosAddon creates a new fault injection addon from a JSON rules file. The seed from the
+// command line overrides the seed in the file, and when neither is set a random seed is used. The
+// seed is logged, so a run can be repeated.
+func NewChaosAddon(rulesFile string, seed int64) (*ChaosAddon, error) {
+	rules, err := chaos.NewRuleSetFromFile(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	if seed == 0 {
+		seed = rules.Seed
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Infof("Loaded %d chaos rules, with seed: %d", len(rules.Rules), seed)
+
+	return &ChaosAddon{
+		rules: rules,
+		rand:  rand.New(rand.NewSource(seed)),
+		stop:  make(chan struct{}),
+	}, nil
+}
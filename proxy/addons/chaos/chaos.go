@@ -0,0 +1,243 @@
+// Package chaos selects faults to inject into LLM API traffic, from a JSON rules file, for testing
+// how clients handle upstream problems.
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/proxati/llm_proxy/proxy/addons/glob"
+)
+
+// FaultType is the kind of problem that is injected
+type FaultType string
+
+const (
+	Latency        FaultType = "latency"         // delays the request, in addition to any other fault
+	RateLimit      FaultType = "rate_limit"      // 429 with a Retry-After header, the request isn't sent
+	ServerError    FaultType = "server_error"    // 500, 502, 503, 504 or 529, the request isn't sent
+	Reset          FaultType = "reset"           // the client connection is reset, the request isn't sent
+	TruncateStream FaultType = "truncate_stream" // the response ends after some events, without [DONE]
+	StallStream    FaultType = "stall_stream"    // the response pauses after some events
+	MalformedJSON  FaultType = "malformed_json"  // the response JSON is cut in half
+	ContentFilter  FaultType = "content_filter"  // the finish reason is replaced with content_filter
+)
+
+const (
+	defaultRetryAfter = time.Second
+	defaultStall      = 30 * time.Second
+)
+
+// serverErrorCodes are the status codes allowed for ServerError faults
+var serverErrorCodes = map[int]struct{}{
+	http.StatusInternalServerError: {},
+	http.StatusBadGateway:          {},
+	http.StatusServiceUnavailable:  {},
+	http.StatusGatewayTimeout:      {},
+	529:                            {}, // "overloaded", not an official status code
+}
+
+// Duration is a time.Duration that unmarshals from a JSON string, e.g., "30s"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string, e.g. \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Fault is a single problem, and the probability that it is injected into a matching request
+type Fault struct {
+	Type        FaultType `json:"type"`
+	Probability float64   `json:"probability"`            // 0 to 1
+	Delay       Duration  `json:"delay,omitempty"`        // Latency and StallStream
+	Jitter      Duration  `json:"jitter,omitempty"`       // Latency, a random amount up to this is added to the delay
+	RetryAfter  Duration  `json:"retry_after,omitempty"`  // RateLimit, rounded up to whole seconds
+	Status      int       `json:"status,omitempty"`       // ServerError, defaults to 500
+	AfterEvents int       `json:"after_events,omitempty"` // TruncateStream and StallStream, events sent before the fault
+}
+
+func (f *Fault) validate() error {
+	if f.Probability < 0 || f.Probability > 1 {
+		return fmt.Errorf("%s: probability must be between 0 and 1", f.Type)
+	}
+
+	switch f.Type {
+	case Latency:
+		if f.Delay.Duration <= 0 && f.Jitter.Duration <= 0 {
+			return fmt.Errorf("%s: delay or jitter is required", f.Type)
+		}
+	case RateLimit:
+		if f.RetryAfter.Duration <= 0 {
+			f.RetryAfter.Duration = defaultRetryAfter
+		}
+	case ServerError:
+		if f.Status == 0 {
+			f.Status = http.StatusInternalServerError
+		}
+		if _, ok := serverErrorCodes[f.Status]; !ok {
+			return fmt.Errorf("%s: unsupported status %d", f.Type, f.Status)
+		}
+	case StallStream:
+		if f.Delay.Duration <= 0 {
+			f.Delay.Duration = defaultStall
+		}
+	case Reset, TruncateStream, MalformedJSON, ContentFilter:
+	default:
+		return fmt.Errorf("unknown fault type: %q", f.Type)
+	}
+	if f.AfterEvents < 0 {
+		return fmt.Errorf("%s: after_events can't be negative", f.Type)
+	}
+	return nil
+}
+
+// ResponseFault returns true for faults that change the upstream response, instead of replacing it
+func (f *Fault) ResponseFault() bool {
+	switch f.Type {
+	case TruncateStream, StallStream, MalformedJSON, ContentFilter:
+		return true
+	default:
+		return false
+	}
+}
+
+// Request holds the request fields that are checked by the rule matchers
+type Request struct {
+	Host  string
+	Path  string
+	Model string
+}
+
+// Match selects the requests that get a rule's faults, by the patterns from the glob package. An
+// empty field matches every request.
+type Match struct {
+	Hosts  []string `json:"hosts,omitempty"`
+	Paths  []string `json:"paths,omitempty"`
+	Models []string `json:"models,omitempty"`
+}
+
+func (m *Match) validate() error {
+	return glob.Validate(slices.Concat(m.Hosts, m.Paths, m.Models)...)
+}
+
+func (m *Match) matches(req Request) bool {
+	return glob.MatchAny(m.Hosts, strings.ToLower(req.Host)) &&
+		glob.MatchAny(m.Paths, req.Path) &&
+		glob.MatchAny(m.Models, req.Model)
+}
+
+// Rule is the faults for the requests that match it
+type Rule struct {
+	Name   string  `json:"name"`
+	Match  Match   `json:"match"`
+	Faults []Fault `json:"faults"`
+}
+
+func (r *Rule) validate() error {
+	if err := r.Match.validate(); err != nil {
+		return err
+	}
+	if len(r.Faults) == 0 {
+		return fmt.Errorf("no faults defined")
+	}
+	for i := range r.Faults {
+		if err := r.Faults[i].validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decision is the result of rolling the dice for a request. Delay is added before the request is
+// handled, and Fault is nil when no other fault was selected.
+type Decision struct {
+	Rule  string
+	Delay time.Duration
+	Fault *Fault
+}
+
+// RuleSet is an ordered list of rules, the first rule that matches a request is used
+type RuleSet struct {
+	Seed  int64  `json:"seed,omitempty"` // 0 uses a random seed
+	Rules []Rule `json:"rules"`
+}
+
+func (rs *RuleSet) validate() error {
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i)
+		}
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Roll selects the faults for a request. Every latency fault is checked, and the other faults are
+// checked in order, until one is selected. The same seed, and the same sequence of requests, gives
+// the same decisions.
+func (rs *RuleSet) Roll(req Request, rng *rand.Rand) Decision {
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		if !r.Match.matches(req) {
+			continue
+		}
+
+		decision := Decision{Rule: r.Name}
+		for j := range r.Faults {
+			fault := &r.Faults[j]
+			if fault.Type != Latency && decision.Fault != nil {
+				continue
+			}
+			if rng.Float64() >= fault.Probability {
+				continue
+			}
+			if fault.Type == Latency {
+				decision.Delay += fault.Delay.Duration
+				if fault.Jitter.Duration > 0 {
+					decision.Delay += time.Duration(rng.Int63n(int64(fault.Jitter.Duration)))
+				}
+				continue
+			}
+			decision.Fault = fault
+		}
+		return decision
+	}
+	return Decision{}
+}
+
+// NewRuleSetFromFile reads and validates a chaos rules JSON file
+func NewRuleSetFromFile(filePath string) (*RuleSet, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chaos rules file: %w", err)
+	}
+
+	rs := &RuleSet{}
+	if err := json.Unmarshal(data, rs); err != nil {
+		return nil, fmt.Errorf("failed to parse chaos rules file: %w", err)
+	}
+
+	if err := rs.validate(); err != nil {
+		return nil, fmt.Errorf("invalid chaos rules file %s: %w", filePath, err)
+	}
+	return rs, nil
+}
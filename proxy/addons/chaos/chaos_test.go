@@ -0,0 +1,166 @@
+package chaos
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRules(t *testing.T, content string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "chaos.json")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	return filePath
+}
+
+func TestNewRuleSetFromFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{
+			name:    "valid",
+			content: `{"seed": 42, "rules": [{"match": {"models": ["gpt-4*"]}, "faults": [{"type": "rate_limit", "probability": 0.1, "retry_after": "5s"}]}]}`,
+		},
+		{
+			name:        "unknown fault",
+			content:     `{"rules": [{"faults": [{"type": "meteor", "probability": 1}]}]}`,
+			expectedErr: `rule rule-0: unknown fault type: "meteor"`,
+		},
+		{
+			name:        "probability out of range",
+			content:     `{"rules": [{"faults": [{"type": "reset", "probability": 1.5}]}]}`,
+			expectedErr: "probability must be between 0 and 1",
+		},
+		{
+			name:        "unsupported status",
+			content:     `{"rules": [{"faults": [{"type": "server_error", "probability": 1, "status": 404}]}]}`,
+			expectedErr: "unsupported status 404",
+		},
+		{
+			name:        "latency without a delay",
+			content:     `{"rules": [{"faults": [{"type": "latency", "probability": 1}]}]}`,
+			expectedErr: "delay or jitter is required",
+		},
+		{
+			name:        "invalid duration",
+			content:     `{"rules": [{"faults": [{"type": "latency", "probability": 1, "delay": 5}]}]}`,
+			expectedErr: "failed to parse chaos rules file",
+		},
+		{
+			name:        "no faults",
+			content:     `{"rules": [{"name": "empty"}]}`,
+			expectedErr: "rule empty: no faults defined",
+		},
+		{
+			name:        "invalid pattern",
+			content:     `{"rules": [{"match": {"hosts": ["["]}, "faults": [{"type": "reset", "probability": 1}]}]}`,
+			expectedErr: "invalid pattern",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rs, err := NewRuleSetFromFile(writeRules(t, tc.content))
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int64(42), rs.Seed)
+			assert.Equal(t, "rule-0", rs.Rules[0].Name)
+		})
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		rs, err := NewRuleSetFromFile(writeRules(t, `{"rules": [{"faults": [
+			{"type": "rate_limit", "probability": 1},
+			{"type": "server_error", "probability": 1},
+			{"type": "stall_stream", "probability": 1}
+		]}]}`))
+		require.NoError(t, err)
+		faults := rs.Rules[0].Faults
+		assert.Equal(t, defaultRetryAfter, faults[0].RetryAfter.Duration)
+		assert.Equal(t, 500, faults[1].Status)
+		assert.Equal(t, defaultStall, faults[2].Delay.Duration)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := NewRuleSetFromFile(filepath.Join(t.TempDir(), "missing.json"))
+		assert.ErrorContains(t, err, "failed to read chaos rules file")
+	})
+}
+
+func TestRoll(t *testing.T) {
+	rs, err := NewRuleSetFromFile(writeRules(t, `{"rules": [
+		{"name": "never", "match": {"hosts": ["api.anthropic.com"]}, "faults": [{"type": "reset", "probability": 0}]},
+		{"name": "always", "match": {"models": ["gpt-4o"]}, "faults": [
+			{"type": "latency", "probability": 1, "delay": "1s"},
+			{"type": "server_error", "probability": 1, "status": 503},
+			{"type": "latency", "probability": 1, "delay": "2s"},
+			{"type": "rate_limit", "probability": 1}
+		]},
+		{"name": "sometimes", "faults": [
+			{"type": "latency", "probability": 0.5, "delay": "10ms", "jitter": "100ms"},
+			{"type": "truncate_stream", "probability": 0.3}
+		]}
+	]}`))
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+
+	t.Run("first matching rule is used", func(t *testing.T) {
+		decision := rs.Roll(Request{Host: "API.anthropic.com", Model: "gpt-4o"}, rng)
+		assert.Equal(t, "never", decision.Rule)
+		assert.Zero(t, decision.Delay)
+		assert.Nil(t, decision.Fault)
+	})
+
+	t.Run("latency is additive, the first other fault wins", func(t *testing.T) {
+		decision := rs.Roll(Request{Host: "api.openai.com", Model: "gpt-4o"}, rng)
+		assert.Equal(t, "always", decision.Rule)
+		assert.Equal(t, 3*time.Second, decision.Delay)
+		require.NotNil(t, decision.Fault)
+		assert.Equal(t, ServerError, decision.Fault.Type)
+		assert.Equal(t, 503, decision.Fault.Status)
+	})
+
+	t.Run("the same seed gives the same decisions", func(t *testing.T) {
+		roll := func(seed int64) []Decision {
+			rng := rand.New(rand.NewSource(seed))
+			decisions := make([]Decision, 0, 50)
+			for range 50 {
+				decisions = append(decisions, rs.Roll(Request{Host: "api.openai.com", Model: "gpt-3.5-turbo"}, rng))
+			}
+			return decisions
+		}
+		first := roll(7)
+		assert.Equal(t, first, roll(7))
+		assert.NotEqual(t, first, roll(8))
+
+		faults := 0
+		for _, decision := range first {
+			assert.Equal(t, "sometimes", decision.Rule)
+			if decision.Delay > 0 {
+				assert.GreaterOrEqual(t, decision.Delay, 10*time.Millisecond)
+				assert.Less(t, decision.Delay, 110*time.Millisecond)
+			}
+			if decision.Fault != nil {
+				faults++
+			}
+		}
+		assert.Greater(t, faults, 0)
+		assert.Less(t, faults, 50)
+	})
+
+	t.Run("no matching rule", func(t *testing.T) {
+		empty := &RuleSet{}
+		assert.Equal(t, Decision{}, empty.Roll(Request{Host: "api.openai.com"}, rng))
+	})
+}
@@ -0,0 +1,148 @@
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+const (
+	contentFilterReason = "content_filter" // OpenAI finish_reason
+	refusalReason       = "refusal"        // Anthropic stop_reason
+	doneData            = "[DONE]"
+)
+
+// eventSeparator is the blank line after each server-sent event
+var eventSeparator = regexp.MustCompile(`\r?\n\r?\n`)
+
+// splitEvents splits a text/event-stream body into events, each one with its separator
+func splitEvents(body string) []string {
+	events := make([]string, 0)
+	start := 0
+	for _, loc := range eventSeparator.FindAllStringIndex(body, -1) {
+		events = append(events, body[start:loc[1]])
+		start = loc[1]
+	}
+	if start < len(body) {
+		events = append(events, body[start:])
+	}
+	return events
+}
+
+// eventData returns the data of a single event, with the field names removed
+func eventData(event string) string {
+	lines := make([]string, 0, 1)
+	for _, line := range strings.Split(strings.TrimRight(event, "\r\n"), "\n") {
+		if data, found := strings.CutPrefix(strings.TrimRight(line, "\r"), "data:"); found {
+			lines = append(lines, strings.TrimPrefix(data, " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SplitStream returns the first events of a stream, and the rest of the body. The [DONE] event
+// is never in the first part.
+func SplitStream(body string, afterEvents int) (string, string) {
+	events := splitEvents(body)
+	n := 0
+	for n < len(events) && n < afterEvents && eventData(events[n]) != doneData {
+		n++
+	}
+	return strings.Join(events[:n], ""), strings.Join(events[n:], "")
+}
+
+// Truncate returns the first events of a stream, without the final [DONE] event. JSON bodies are
+// cut in half.
+func Truncate(body string, isStream bool, afterEvents int) string {
+	if !isStream {
+		return body[:len(body)/2]
+	}
+	first, _ := SplitStream(body, afterEvents)
+	return first
+}
+
+// Malform cuts a JSON body in half. For a stream, the JSON in the first data event after
+// afterEvents is cut in half, and the rest of the stream is unchanged.
+func Malform(body string, isStream bool, afterEvents int) string {
+	if !isStream {
+		return body[:len(body)/2]
+	}
+
+	events := splitEvents(body)
+	for i := afterEvents; i < len(events); i++ {
+		data := eventData(events[i])
+		if data == "" || data == doneData {
+			continue
+		}
+		events[i] = "data: " + data[:len(data)/2] + "\n\n"
+		break
+	}
+	return strings.Join(events, "")
+}
+
+// setStopReason replaces the finish reasons in a chat completion, or a chat completion chunk, and
+// the stop reason in an Anthropic message, or message_delta event. Returns false when the JSON
+// doesn't have one.
+func setStopReason(data string) (string, bool) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	body := make(map[string]any)
+	if err := decoder.Decode(&body); err != nil {
+		return data, false
+	}
+
+	changed := false
+	choices, _ := body["choices"].([]any)
+	for _, choice := range choices {
+		if choiceMap, ok := choice.(map[string]any); ok && choiceMap["finish_reason"] != nil {
+			choiceMap["finish_reason"] = contentFilterReason
+			changed = true
+		}
+	}
+	if _, found := body["stop_reason"]; found && body["type"] == "message" {
+		body["stop_reason"] = refusalReason
+		changed = true
+	}
+	if delta, ok := body["delta"].(map[string]any); ok && delta["stop_reason"] != nil {
+		delta["stop_reason"] = refusalReason
+		changed = true
+	}
+	if !changed {
+		return data, false
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(body); err != nil {
+		return data, false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// FilterContent replaces the finish reason with content_filter (refusal for Anthropic), as if
+// the provider's content filter stopped the response
+func FilterContent(body string, isStream bool) string {
+	if !isStream {
+		newBody, _ := setStopReason(body)
+		return newBody
+	}
+
+	events := splitEvents(body)
+	for i, event := range events {
+		data := eventData(event)
+		if data == "" || data == doneData {
+			continue
+		}
+		if newData, changed := setStopReason(data); changed {
+			// keep the event name, for the Anthropic event stream
+			prefix := ""
+			if name, found := strings.CutPrefix(strings.SplitN(event, "\n", 2)[0], "event:"); found {
+				prefix = "event:" + name + "\n"
+			}
+			events[i] = prefix + "data: " + newData + "\n\n"
+		}
+	}
+	return strings.Join(events, "")
+}
@@ -0,0 +1,94 @@
+package chaos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStream = "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"},\"finish_reason\":null}]}\n\n" +
+	"data: {\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":null}]}\n\n" +
+	"data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n" +
+	"data: [DONE]\n\n"
+
+func TestSplitStream(t *testing.T) {
+	first, rest := SplitStream(testStream, 2)
+	assert.Equal(t, testStream, first+rest)
+	assert.Equal(t, 2, len(splitEvents(first)))
+	assert.Contains(t, rest, `"finish_reason":"stop"`)
+
+	first, rest = SplitStream(testStream, 10)
+	assert.NotContains(t, first, "[DONE]", "[DONE] is never in the first part")
+	assert.Equal(t, "data: [DONE]\n\n", rest)
+
+	first, rest = SplitStream(testStream, 0)
+	assert.Empty(t, first)
+	assert.Equal(t, testStream, rest)
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, `{"id": "`, Truncate(`{"id": "abcdef"}`, false, 0))
+
+	truncated := Truncate(testStream, true, 1)
+	assert.Equal(t, "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"},\"finish_reason\":null}]}\n\n", truncated)
+	assert.NotContains(t, Truncate(testStream, true, 10), "[DONE]")
+}
+
+func TestMalform(t *testing.T) {
+	assert.Equal(t, `{"id": "`, Malform(`{"id": "abcdef"}`, false, 0))
+
+	malformed := Malform(testStream, true, 1)
+	events := splitEvents(malformed)
+	assert.Len(t, events, 4)
+	assert.Equal(t, splitEvents(testStream)[0], events[0])
+	assert.Equal(t, "data: {\"choices\":[{\"delta\":{\"content\n\n", events[1])
+	assert.Equal(t, "data: [DONE]\n\n", events[3])
+}
+
+func TestFilterContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		isStream bool
+		expected string
+	}{
+		{
+			name:     "chat completion",
+			body:     `{"id":"chatcmpl-1","choices":[{"index":0,"finish_reason":"stop"}]}`,
+			expected: `{"choices":[{"finish_reason":"content_filter","index":0}],"id":"chatcmpl-1"}`,
+		},
+		{
+			name:     "anthropic message",
+			body:     `{"type":"message","stop_reason":"end_turn"}`,
+			expected: `{"stop_reason":"refusal","type":"message"}`,
+		},
+		{
+			name:     "no finish reason",
+			body:     `{"data":[{"embedding":[0.1]}]}`,
+			expected: `{"data":[{"embedding":[0.1]}]}`,
+		},
+		{
+			name:     "chat completion stream",
+			body:     testStream,
+			isStream: true,
+			expected: "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"},\"finish_reason\":null}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":null}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"content_filter\"}]}\n\n" +
+				"data: [DONE]\n\n",
+		},
+		{
+			name: "anthropic stream",
+			body: "event: content_block_delta\ndata: {\"type\":\"content_block_delta\"}\n\n" +
+				"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"}}\n\n",
+			isStream: true,
+			expected: "event: content_block_delta\ndata: {\"type\":\"content_block_delta\"}\n\n" +
+				"event: message_delta\ndata: {\"delta\":{\"stop_reason\":\"refusal\"},\"type\":\"message_delta\"}\n\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, FilterContent(tc.body, tc.isStream))
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package addons
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChaosAddon(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "chaos.json")
+	require.NoError(t, os.WriteFile(rulesFile, []byte(`{"rules": [
+		{"match": {"models": ["rate-limited"]}, "faults": [{"type": "rate_limit", "probability": 1, "retry_after": "1500ms"}]},
+		{"match": {"models": ["overloaded"]}, "faults": [{"type": "server_error", "probability": 1, "status": 503}]},
+		{"match": {"models": ["slow"]}, "faults": [{"type": "latency", "probability": 1, "delay": "10ms"}]},
+		{"match": {"models": ["filtered"]}, "faults": [{"type": "content_filter", "probability": 1}]},
+		{"match": {"models": ["truncated"]}, "faults": [{"type": "truncate_stream", "probability": 1, "after_events": 1}]},
+		{"match": {"models": ["stalled"]}, "faults": [{"type": "stall_stream", "probability": 1, "delay": "10ms", "after_events": 1}]}
+	]}`), 0644))
+
+	newFlow := func(model string) *px.Flow {
+		reqURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+		return &px.Flow{Request: &px.Request{
+			Method: http.MethodPost,
+			URL:    reqURL,
+			Header: http.Header{},
+			Body:   []byte(`{"model": "` + model + `", "messages": []}`),
+		}}
+	}
+	upstreamStream := "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"},\"finish_reason\":null}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n" +
+		"data: [DONE]\n\n"
+	newUpstreamResponse := func() *px.Response {
+		return &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       []byte(upstreamStream),
+		}
+	}
+
+	c, err := NewChaosAddon(rulesFile, 1)
+	require.NoError(t, err)
+	defer c.Close()
+	responseAddon := c.ResponseAddon()
+
+	t.Run("rate limit", func(t *testing.T) {
+		f := newFlow("rate-limited")
+		c.Request(f)
+		require.NotNil(t, f.Response)
+		assert.Equal(t, http.StatusTooManyRequests, f.Response.StatusCode)
+		assert.Equal(t, "2", f.Response.Header.Get("Retry-After"))
+		assert.Equal(t, "rate_limit", f.Response.Header.Get(ChaosHeader))
+		assert.Contains(t, string(f.Response.Body), `"code":"rate_limit_exceeded"`)
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		f := newFlow("overloaded")
+		c.Request(f)
+		require.NotNil(t, f.Response)
+		assert.Equal(t, http.StatusServiceUnavailable, f.Response.StatusCode)
+		assert.Equal(t, "server_error", f.Response.Header.Get(ChaosHeader))
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		f := newFlow("slow")
+		c.Request(f)
+		assert.Nil(t, f.Response, "the request is still sent upstream")
+		f.Response = newUpstreamResponse()
+		c.Response(f)
+		responseAddon.Response(f)
+		assert.Equal(t, "latency=10ms", f.Response.Header.Get(ChaosHeader))
+		assert.Equal(t, upstreamStream, string(f.Response.Body))
+	})
+
+	t.Run("content filter", func(t *testing.T) {
+		f := newFlow("filtered")
+		c.Request(f)
+		require.Nil(t, f.Response)
+		f.Response = newUpstreamResponse()
+		c.Response(f)
+		assert.Equal(t, "content_filter", f.Response.Header.Get(ChaosHeader), "the header is set before the other addons")
+		assert.Equal(t, upstreamStream, string(f.Response.Body), "the body is changed by the response addon")
+		responseAddon.Response(f)
+		assert.Contains(t, string(f.Response.Body), `"finish_reason":"content_filter"`)
+	})
+
+	t.Run("truncated stream", func(t *testing.T) {
+		f := newFlow("truncated")
+		c.Request(f)
+		f.Response = newUpstreamResponse()
+		responseAddon.Response(f)
+		assert.Equal(t, "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"},\"finish_reason\":null}]}\n\n", string(f.Response.Body))
+		assert.Equal(t, strconv.Itoa(len(f.Response.Body)), f.Response.Header.Get("Content-Length"))
+	})
+
+	t.Run("stalled stream", func(t *testing.T) {
+		f := newFlow("stalled")
+		c.Request(f)
+		f.Response = newUpstreamResponse()
+		responseAddon.Response(f)
+		assert.Nil(t, f.Response.Body)
+		require.NotNil(t, f.Response.BodyReader)
+		body := new(strings.Builder)
+		_, err := io.Copy(body, f.Response.BodyReader)
+		require.NoError(t, err)
+		assert.Equal(t, upstreamStream, body.String(), "the whole stream is sent, after the pause")
+	})
+
+	t.Run("mock responses", func(t *testing.T) {
+		m, err := NewMockAddon("", true)
+		require.NoError(t, err)
+		m.AddResponseModifier(c.Response)
+		m.AddResponseModifier(responseAddon.Response)
+
+		f := newFlow("filtered")
+		c.Request(f)
+		m.Request(f)
+		require.NotNil(t, f.Response)
+		assert.Equal(t, "content_filter", f.Response.Header.Get(ChaosHeader))
+		assert.Contains(t, string(f.Response.Body), `"finish_reason":"content_filter"`)
+	})
+
+	t.Run("no matching rule", func(t *testing.T) {
+		f := newFlow("gpt-4o")
+		c.Request(f)
+		assert.Nil(t, f.Response)
+		assert.Empty(t, f.Request.Header.Get(ChaosHeader))
+	})
+
+	t.Run("invalid rules", func(t *testing.T) {
+		_, err := NewChaosAddon(filepath.Join(t.TempDir(), "missing.json"), 0)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,176 @@
+package addons
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/proxy/addons/megadumper/writers"
+	"github.com/proxati/llm_proxy/proxy/addons/policy"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// PolicyStatusHeader is added to responses for requests that were denied by the egress policy
+const PolicyStatusHeader = "X-Llm_proxy-Policy"
+
+// policyAuditEntry is a single line in the egress policy audit log
+type policyAuditEntry struct {
+	Timestamp     time.Time `json:"timestamp"`
+	ProxyID       string    `json:"proxy_id"`
+	ClientAddress string    `json:"client_address"`
+	Method        string    `json:"method"`
+	URL           string    `json:"url"`
+	Model         string    `json:"model,omitempty"`
+	Rule          string    `json:"rule"`
+	Reason        string    `json:"reason"`
+}
+
+// EgressPolicyAddon allows or denies requests before they are sent upstream, based on the
+// destination host, path, method, and the requested model. The routing addons can send a request
+// to a different upstream, so the policy is checked again after them by RecheckAddon.
+type EgressPolicyAddon struct {
+	px.BaseAddon
+	policy    *policy.Policy
+	auditLog  *writers.ToLines
+	closeOnce sync.Once
+}
+
+// Check evaluates the request against the policy, and returns the error response for a denied
+// request, or nil when it's allowed
+func (e *EgressPolicyAddon) Check(f *px.Flow) *px.Response {
+	if f.Request == nil || f.Request.URL == nil {
+		return nil
+	}
+
+	req := policy.Request{
+		Host:   f.Request.URL.Hostname(),
+		Path:   f.Request.URL.Path,
+		Method: f.Request.Method,
+	}
+	var decision policy.Decision
+	if e.policy.NeedsModel(req) {
+		body, err := decodeRequestJSON(f.Request)
+		switch {
+		case err == nil:
+			req.Model = requestModel(body)
+			decision = e.policy.Evaluate(req)
+		case len(f.Request.Body) == 0:
+			// nothing to read, e.g., listing the models
+			decision = e.policy.Evaluate(req)
+		default:
+			decision = policy.DenyUncheckedModel(err)
+		}
+	} else {
+		decision = e.policy.Evaluate(req)
+	}
+
+	if decision.Allowed() {
+		log.Debugf("egress policy rule %s allowed: %s %s", decision.Rule, f.Request.Method, f.Request.URL)
+		return nil
+	}
+
+	e.audit(f, req, decision)
+
+	resp := newErrorResponse(http.StatusForbidden, "policy_violation", "egress_denied", decision.Reason)
+	resp.Header.Set(PolicyStatusHeader, "denied; rule="+decision.Rule)
+	return resp
+}
+
+func (e *EgressPolicyAddon) Request(f *px.Flow) {
+	// other pending addons will be skipped after setting f.Response and returning from this method
+	if resp := e.Check(f); resp != nil {
+		f.Response = resp
+	}
+}
+
+// RecheckAddon returns an addon that checks the policy again for the flows sent elsewhere by a
+// routing addon, which must be added to the proxy after the routing addons, so the upstream that
+// the request is actually sent to is checked
+func (e *EgressPolicyAddon) RecheckAddon(routed *FlowRoutes) px.Addon {
+	return &egressPolicyRecheck{policy: e, routed: routed}
+}
+
+// audit writes the denial to the terminal log and, when configured, the audit log file
+func (e *EgressPolicyAddon) audit(f *px.Flow, req policy.Request, decision policy.Decision) {
+	connStats := schema.NewConnectionStatusContainerWithDuration(f, 0)
+	entry := policyAuditEntry{
+		Timestamp:     time.Now(),
+		ProxyID:       connStats.ProxyID,
+		ClientAddress: connStats.ClientAddress,
+		Method:        req.Method,
+		URL:           connStats.URL,
+		Model:         req.Model,
+		Rule:          decision.Rule,
+		Reason:        decision.Reason,
+	}
+
+	log.WithFields(log.Fields{
+		"client": entry.ClientAddress,
+		"rule":   entry.Rule,
+		"model":  entry.Model,
+	}).Warnf("egress policy denied: %s %s", entry.Method, entry.URL)
+
+	if e.auditLog == nil {
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("error encoding policy audit entry: %v", err)
+		return
+	}
+	if _, err := e.auditLog.Write(entry.ProxyID, line); err != nil {
+		log.Errorf("error writing policy audit entry: %v", err)
+	}
+}
+
+func (e *EgressPolicyAddon) String() string {
+	return "EgressPolicyAddon"
+}
+
+func (e *EgressPolicyAddon) Close() (err error) {
+	e.closeOnce.Do(func() {
+		if e.auditLog != nil {
+			err = e.auditLog.Close()
+		}
+	})
+	return
+}
+
+// egressPolicyRecheck is the Request event handler for EgressPolicyAddon, after the routing addons
+type egressPolicyRecheck struct {
+	px.BaseAddon
+	policy *EgressPolicyAddon
+	routed *FlowRoutes
+}
+
+func (r *egressPolicyRecheck) Request(f *px.Flow) {
+	if f.Response != nil || r.routed.routedBy(f.Id) == "" {
+		// already answered, e.g., from the cache, or sent to the upstream that was checked
+		return
+	}
+	r.policy.Request(f)
+}
+
+// NewEgressPolicyAddon loads the policy file, and opens the audit log file when auditLogFile is set
+func NewEgressPolicyAddon(policyFile, auditLogFile string) (*EgressPolicyAddon, error) {
+	p, err := policy.NewPolicyFromFile(policyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &EgressPolicyAddon{policy: p}
+	if auditLogFile != "" {
+		e.auditLog, err = writers.NewToLines(auditLogFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Debugf("Loaded egress policy with %d rules, default action: %s", len(p.Rules), p.Default)
+	return e, nil
+}
@@ -0,0 +1,161 @@
+package addons
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEgressPolicyAddon_Request(t *testing.T) {
+	tmpDir := t.TempDir()
+	policyFile := filepath.Join(tmpDir, "policy.json")
+	auditFile := filepath.Join(tmpDir, "audit.jsonl")
+	require.NoError(t, os.WriteFile(policyFile, []byte(`{
+		"default": "deny",
+		"rules": [
+			{"name": "no-gpt-4", "action": "deny", "hosts": ["api.openai.com"], "paths": ["/v1/chat/*"], "models": ["gpt-4"]},
+			{"name": "openai", "action": "allow", "hosts": ["api.openai.com"]}
+		]
+	}`), 0644))
+
+	addon, err := NewEgressPolicyAddon(policyFile, auditFile)
+	require.NoError(t, err)
+	assert.Equal(t, "EgressPolicyAddon", addon.String())
+
+	newFlow := func(rawURL, body string) *px.Flow {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		return &px.Flow{
+			Id: uuid.NewV4(),
+			Request: &px.Request{
+				Method: "POST",
+				URL:    u,
+				Header: http.Header{},
+				Body:   []byte(body),
+			},
+		}
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		flow := newFlow("https://api.openai.com/v1/chat/completions", `{"model": "gpt-4o"}`)
+		addon.Request(flow)
+		assert.Nil(t, flow.Response)
+	})
+
+	t.Run("denied by model", func(t *testing.T) {
+		flow := newFlow("https://api.openai.com/v1/chat/completions", `{"model": "gpt-4"}`)
+		addon.Request(flow)
+		require.NotNil(t, flow.Response)
+		assert.Equal(t, http.StatusForbidden, flow.Response.StatusCode)
+		assert.Equal(t, "denied; rule=no-gpt-4", flow.Response.Header.Get(PolicyStatusHeader))
+
+		errBody := apiError{}
+		require.NoError(t, json.Unmarshal(flow.Response.Body, &errBody))
+		assert.Equal(t, "egress_denied", errBody.Error.Code)
+		assert.Contains(t, errBody.Error.Message, "no-gpt-4")
+	})
+
+	t.Run("denied by default", func(t *testing.T) {
+		flow := newFlow("https://example.com/upload", `not json`)
+		addon.Request(flow)
+		require.NotNil(t, flow.Response)
+		assert.Equal(t, http.StatusForbidden, flow.Response.StatusCode)
+	})
+
+	require.NoError(t, addon.Close())
+	require.NoError(t, addon.Close(), "closing twice is safe")
+
+	auditLog, err := os.ReadFile(auditFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(auditLog)), "\n")
+	require.Len(t, lines, 2)
+
+	entry := policyAuditEntry{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "no-gpt-4", entry.Rule)
+	assert.Equal(t, "gpt-4", entry.Model)
+	assert.Equal(t, "https://api.openai.com/v1/chat/completions", entry.URL)
+	assert.NotEmpty(t, entry.ProxyID)
+}
+
+func TestEgressPolicyAddon_UncheckedAndRouted(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(policyFile, []byte(`{
+		"default": "deny",
+		"rules": [
+			{"name": "no-gpt-4", "action": "deny", "hosts": ["api.openai.com"], "paths": ["/v1/chat/*"], "models": ["gpt-4"]},
+			{"name": "openai", "action": "allow", "hosts": ["api.openai.com"]}
+		]
+	}`), 0644))
+
+	addon, err := NewEgressPolicyAddon(policyFile, "")
+	require.NoError(t, err)
+	t.Cleanup(func() { addon.Close() })
+
+	newFlow := func(method, rawURL, body string) *px.Flow {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		return &px.Flow{
+			Id:      uuid.NewV4(),
+			Request: &px.Request{Method: method, URL: u, Header: http.Header{}, Body: []byte(body)},
+		}
+	}
+
+	t.Run("body without a readable model", func(t *testing.T) {
+		flow := newFlow("POST", "https://api.openai.com/v1/chat/completions", `model=gpt-4`)
+		addon.Request(flow)
+		require.NotNil(t, flow.Response)
+		assert.Equal(t, http.StatusForbidden, flow.Response.StatusCode)
+		assert.Equal(t, "denied; rule=unchecked-model", flow.Response.Header.Get(PolicyStatusHeader))
+	})
+
+	t.Run("body without a readable model, not matching a model rule", func(t *testing.T) {
+		flow := newFlow("POST", "https://api.openai.com/v1/files", `purpose=batch`)
+		addon.Request(flow)
+		assert.Nil(t, flow.Response)
+
+		flow = newFlow("POST", "https://example.com/v1/chat/completions", `model=gpt-4`)
+		addon.Request(flow)
+		require.NotNil(t, flow.Response)
+		assert.Equal(t, "denied; rule=default", flow.Response.Header.Get(PolicyStatusHeader))
+	})
+
+	t.Run("request without a body", func(t *testing.T) {
+		flow := newFlow("GET", "https://api.openai.com/v1/models", "")
+		addon.Request(flow)
+		assert.Nil(t, flow.Response)
+	})
+
+	t.Run("routed request is checked again", func(t *testing.T) {
+		routed := NewFlowRoutes()
+		recheck := addon.RecheckAddon(routed)
+
+		flow := newFlow("POST", "https://api.openai.com/v1/chat/completions", `{"model": "gpt-4o"}`)
+		addon.Request(flow)
+		require.Nil(t, flow.Response)
+
+		// not routed, so the request wasn't changed after the first check
+		flow.Request.URL.Host = "example.com"
+		recheck.Request(flow)
+		assert.Nil(t, flow.Response)
+
+		require.True(t, routed.claim(flow.Id, "LocalRouteAddon"))
+		recheck.Request(flow)
+		require.NotNil(t, flow.Response)
+		assert.Equal(t, "denied; rule=default", flow.Response.Header.Get(PolicyStatusHeader))
+	})
+}
+
+func TestNewEgressPolicyAddon_Error(t *testing.T) {
+	_, err := NewEgressPolicyAddon(filepath.Join(t.TempDir(), "missing.json"), "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package addons
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+)
+
+// apiError is an error response body in the same format as the OpenAI API, so client
+// libraries can parse errors generated by this proxy
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+// newErrorResponse creates a JSON error response, for addons that answer a request without
+// sending it upstream
+func newErrorResponse(statusCode int, errType, code, message string) *px.Response {
+	body, err := json.Marshal(apiError{
+		Error: apiErrorDetail{Message: message, Type: errType, Code: code},
+	})
+	if err != nil {
+		body = []byte(message)
+	}
+
+	return &px.Response{
+		StatusCode: statusCode,
+		Header: http.Header{
+			"Content-Type":   []string{"application/json"},
+			"Content-Length": []string{strconv.Itoa(len(body))},
+		},
+		Body: body,
+	}
+}
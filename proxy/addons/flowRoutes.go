@@ -0,0 +1,83 @@
+package addons
+
+import (
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// flowRoute is the routing addon that sent a flow elsewhere, and where it was sent
+type flowRoute struct {
+	addon   string
+	route   schema.Route
+	timeout time.Duration // for the upstream response, 0 for no limit
+}
+
+// FlowRoutes records the flows that a routing addon sent to a different upstream, so the routing
+// addons added after it leave those flows alone, and the auditor and logs know where each flow was
+// sent. It's kept per flow, instead of in a response header that the upstream could also set. One
+// instance is shared by all routing addons.
+type FlowRoutes struct {
+	flows sync.Map // key: flow ID, value: *flowRoute
+}
+
+// claim records that the addon routes the flow, or returns false when another addon already did
+func (r *FlowRoutes) claim(id uuid.UUID, addon string) bool {
+	owner, loaded := r.flows.LoadOrStore(id, &flowRoute{addon: addon})
+	return !loaded || owner.(*flowRoute).addon == addon
+}
+
+// record sets where the flow was sent, after the addon claimed it
+func (r *FlowRoutes) record(id uuid.UUID, addon string, route schema.Route) {
+	r.flows.Store(id, &flowRoute{addon: addon, route: route, timeout: r.timeout(id)})
+}
+
+// limit sets how long the upstream may take to respond to the flow, after the addon claimed it
+func (r *FlowRoutes) limit(id uuid.UUID, addon string, timeout time.Duration) {
+	r.flows.Store(id, &flowRoute{addon: addon, route: r.route(id), timeout: timeout})
+}
+
+// timeout returns how long the upstream may take to respond to the flow, 0 for no limit
+func (r *FlowRoutes) timeout(id uuid.UUID) time.Duration {
+	owner, found := r.flows.Load(id)
+	if !found {
+		return 0
+	}
+	return owner.(*flowRoute).timeout
+}
+
+// routedBy returns the name of the addon that routed the flow, or "" when it wasn't routed
+func (r *FlowRoutes) routedBy(id uuid.UUID) string {
+	owner, found := r.flows.Load(id)
+	if !found {
+		return ""
+	}
+	return owner.(*flowRoute).addon
+}
+
+// route returns where the flow was sent, the zero Route when it wasn't routed. The routes are
+// released when the flow is done, so the addons that need it after that read it in a response
+// event.
+func (r *FlowRoutes) route(id uuid.UUID) schema.Route {
+	if r == nil {
+		return schema.Route{}
+	}
+	owner, found := r.flows.Load(id)
+	if !found {
+		return schema.Route{}
+	}
+	return owner.(*flowRoute).route
+}
+
+// release removes the flow, after it's done or when the addon didn't route it after all
+func (r *FlowRoutes) release(id uuid.UUID) {
+	r.flows.Delete(id)
+}
+
+// NewFlowRoutes creates the routing record shared by the routing addons
+func NewFlowRoutes() *FlowRoutes {
+	return &FlowRoutes{}
+}
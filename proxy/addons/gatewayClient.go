@@ -0,0 +1,48 @@
+package addons
+
+import (
+	"crypto/subtle"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// GatewayTokenHeader is set by the gateway on the requests it sends through the proxy, with the
+// token shared by the gateway and this proxy, so the proxy can tell them apart from other clients
+const GatewayTokenHeader = "X-Llm_proxy-Gateway-Token"
+
+// GatewayClientAddon keeps the gateway client's address, from the schema.ClientAddressHeader, only
+// on the requests sent by the gateway, which have the gateway's token. The header is removed from
+// all other requests, so clients can't set their own address in the logs and reports. The token is
+// always removed, so it isn't logged. It must be the first addon added to the proxy.
+type GatewayClientAddon struct {
+	px.BaseAddon
+	token string
+}
+
+func (g *GatewayClientAddon) Request(f *px.Flow) {
+	if f.Request == nil {
+		return
+	}
+	token := f.Request.Header.Get(GatewayTokenHeader)
+	f.Request.Header.Del(GatewayTokenHeader)
+
+	if g.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) != 1 {
+		f.Request.Header.Del(schema.ClientAddressHeader)
+	}
+}
+
+func (g *GatewayClientAddon) String() string {
+	return "GatewayClientAddon"
+}
+
+func (g *GatewayClientAddon) Close() error {
+	return nil
+}
+
+// NewGatewayClientAddon creates the addon that only trusts the client address sent by the gateway
+// with this token
+func NewGatewayClientAddon(token string) *GatewayClientAddon {
+	return &GatewayClientAddon{token: token}
+}
@@ -0,0 +1,51 @@
+package addons
+
+import (
+	"net/http"
+	"testing"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+func TestGatewayClientAddon(t *testing.T) {
+	addon := NewGatewayClientAddon("secret")
+	assert.Equal(t, "GatewayClientAddon", addon.String())
+
+	newFlow := func(token string) *px.Flow {
+		header := http.Header{schema.ClientAddressHeader: []string{"10.1.2.3"}}
+		if token != "" {
+			header.Set(GatewayTokenHeader, token)
+		}
+		return &px.Flow{Id: uuid.NewV4(), Request: &px.Request{Method: "POST", Header: header}}
+	}
+
+	t.Run("from the gateway", func(t *testing.T) {
+		flow := newFlow("secret")
+		addon.Request(flow)
+		assert.Equal(t, "10.1.2.3", flow.Request.Header.Get(schema.ClientAddressHeader))
+		assert.Empty(t, flow.Request.Header.Values(GatewayTokenHeader))
+	})
+
+	t.Run("wrong token", func(t *testing.T) {
+		flow := newFlow("guess")
+		addon.Request(flow)
+		assert.Empty(t, flow.Request.Header.Values(schema.ClientAddressHeader))
+		assert.Empty(t, flow.Request.Header.Values(GatewayTokenHeader))
+	})
+
+	t.Run("without a token", func(t *testing.T) {
+		flow := newFlow("")
+		addon.Request(flow)
+		assert.Empty(t, flow.Request.Header.Values(schema.ClientAddressHeader))
+	})
+
+	t.Run("without a configured token", func(t *testing.T) {
+		flow := newFlow("")
+		NewGatewayClientAddon("").Request(flow)
+		assert.Empty(t, flow.Request.Header.Values(schema.ClientAddressHeader))
+	})
+}
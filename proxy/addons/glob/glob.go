@@ -0,0 +1,167 @@
+// Package glob matches the host, path, model, and tag patterns in the rule files. The syntax is
+// the same as path.Match, but "/" isn't a separator, so "*" matches any characters, e.g., both
+// "*" and "meta-llama/*" match the model "meta-llama/Llama-3.1-8B".
+//
+// Pattern syntax:
+//
+//	'*'         matches any sequence of characters
+//	'?'         matches any single character
+//	'[' range ']' matches a single character in the range, '^' after '[' negates it
+//	'\\' c      matches the character c
+package glob
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrBadPattern is returned by Validate for malformed patterns
+var ErrBadPattern = errors.New("syntax error in pattern")
+
+// Validate returns an error for the first malformed pattern
+func Validate(patterns ...string) error {
+	for _, pattern := range patterns {
+		for i := 0; i < len(pattern); {
+			if pattern[i] == '*' {
+				i++
+				continue
+			}
+			_, width := matchRune(pattern[i:], 0)
+			if width == 0 {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, ErrBadPattern)
+			}
+			i += width
+		}
+	}
+	return nil
+}
+
+// Match returns true if the whole value matches the pattern. Malformed patterns never match, so
+// they should be checked with Validate when they are loaded.
+func Match(pattern, value string) bool {
+	p, v := 0, 0
+	// after a star, the positions to go back to when the rest of the pattern doesn't match
+	starPattern, starValue := -1, 0
+
+	for v < len(value) {
+		if p < len(pattern) {
+			if pattern[p] == '*' {
+				p++
+				starPattern, starValue = p, v
+				continue
+			}
+			r, size := utf8.DecodeRuneInString(value[v:])
+			if matched, width := matchRune(pattern[p:], r); matched {
+				p += width
+				v += size
+				continue
+			}
+		}
+		if starPattern < 0 {
+			return false
+		}
+		// the star matches one more character
+		_, size := utf8.DecodeRuneInString(value[starValue:])
+		starValue += size
+		p, v = starPattern, starValue
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// MatchAny returns true if the patterns list is empty, or if any pattern matches the value
+func MatchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if Match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTags returns true if the patterns list is empty, or if any pattern matches one of the tags
+func MatchTags(patterns []string, tags []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		if MatchAny(patterns, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRune matches the first element of the pattern, which isn't a star, with a character. It
+// returns the length of the element in the pattern, which is 0 when the pattern is malformed.
+func matchRune(pattern string, r rune) (bool, int) {
+	switch pattern[0] {
+	case '?':
+		return true, 1
+	case '[':
+		return matchRange(pattern, r)
+	case '\\':
+		if len(pattern) < 2 {
+			return false, 0
+		}
+		c, width := utf8.DecodeRuneInString(pattern[1:])
+		return c == r, 1 + width
+	default:
+		c, width := utf8.DecodeRuneInString(pattern)
+		return c == r, width
+	}
+}
+
+// matchRange matches a range at the start of the pattern, e.g., "[a-z]" or "[^0-9]"
+func matchRange(pattern string, r rune) (bool, int) {
+	i := 1
+	negated := i < len(pattern) && pattern[i] == '^'
+	if negated {
+		i++
+	}
+
+	matched := false
+	for n := 0; ; n++ {
+		if i < len(pattern) && pattern[i] == ']' && n > 0 {
+			return matched != negated, i + 1
+		}
+		lo, width := rangeChar(pattern[i:])
+		if width == 0 {
+			return false, 0
+		}
+		i += width
+		hi := lo
+		if i < len(pattern) && pattern[i] == '-' {
+			hi, width = rangeChar(pattern[i+1:])
+			if width == 0 {
+				return false, 0
+			}
+			i += 1 + width
+		}
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+}
+
+// rangeChar returns a character in a range and its length, which is 0 when it's malformed
+func rangeChar(pattern string) (rune, int) {
+	if len(pattern) == 0 || pattern[0] == '-' || pattern[0] == ']' {
+		return 0, 0
+	}
+	if pattern[0] == '\\' {
+		if len(pattern) < 2 {
+			return 0, 0
+		}
+		c, width := utf8.DecodeRuneInString(pattern[1:])
+		return c, 1 + width
+	}
+	return utf8.DecodeRuneInString(pattern)
+}
@@ -0,0 +1,82 @@
+package glob
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		value    string
+		expected bool
+	}{
+		{pattern: "*", value: "meta-llama/Llama-3.1-8B", expected: true},
+		{pattern: "meta-llama/*", value: "meta-llama/Llama-3.1-8B", expected: true},
+		{pattern: "*llama*", value: "meta-llama/Llama-3.1-8B", expected: true},
+		{pattern: "*/Llama-3.?-8B", value: "meta-llama/Llama-3.1-8B", expected: true},
+		{pattern: "/v1/*", value: "/v1/chat/completions", expected: true},
+		{pattern: "*.openai.com", value: "api.openai.com", expected: true},
+		{pattern: "*.openai.com", value: "openai.com", expected: false},
+		{pattern: "gpt-4*", value: "gpt-4o-mini", expected: true},
+		{pattern: "gpt-4", value: "gpt-4o", expected: false},
+		{pattern: "gpt-4?", value: "gpt-4o", expected: true},
+		{pattern: "gpt-[34]*", value: "gpt-3.5-turbo", expected: true},
+		{pattern: "gpt-[^34]*", value: "gpt-3.5-turbo", expected: false},
+		{pattern: "o[1-4]*", value: "o3-mini", expected: true},
+		{pattern: `what\?`, value: "what?", expected: true},
+		{pattern: `what\?`, value: "whats", expected: false},
+		{pattern: "a*b*c", value: "axxbyybzc", expected: true},
+		{pattern: "a*b*c", value: "axxbyybz", expected: false},
+		{pattern: "**", value: "", expected: true},
+		{pattern: "", value: "", expected: true},
+		{pattern: "", value: "a", expected: false},
+		{pattern: "é?", value: "éé", expected: true},
+		{pattern: "[", value: "[", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Match(tt.pattern, tt.value))
+		})
+	}
+}
+
+func TestMatch_SameAsPathWithoutSlashes(t *testing.T) {
+	patterns := []string{"*", "a*", "*c", "a?c", "[a-c]*", "[^a]*", `\*`, "ab[cd]", "*b*"}
+	values := []string{"", "a", "abc", "abd", "*", "bcd", "cab", "ab"}
+	for _, pattern := range patterns {
+		for _, value := range values {
+			expected, err := path.Match(pattern, value)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, Match(pattern, value), "pattern %q, value %q", pattern, value)
+		}
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	assert.True(t, MatchAny(nil, "anything"))
+	assert.True(t, MatchAny([]string{"gpt-*", "claude-*"}, "claude-3-5-sonnet"))
+	assert.False(t, MatchAny([]string{"gpt-*"}, "claude-3-5-sonnet"))
+}
+
+func TestMatchTags(t *testing.T) {
+	assert.True(t, MatchTags(nil, nil))
+	assert.True(t, MatchTags([]string{"team-*"}, []string{"batch", "team-search"}))
+	assert.False(t, MatchTags([]string{"team-*"}, []string{"batch"}))
+	assert.False(t, MatchTags([]string{"team-*"}, nil))
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate("*", "gpt-[34]*", `a\*`, "[^a-z]", "meta-llama/*"))
+	assert.NoError(t, Validate())
+
+	for _, pattern := range []string{"[", "[]", "[a-", "[a", `a\`, "[-a]", "[^]"} {
+		err := Validate("ok", pattern)
+		assert.ErrorIs(t, err, ErrBadPattern, pattern)
+		_, pathErr := path.Match(pattern, "")
+		assert.Error(t, pathErr, "path.Match also rejects %q", pattern)
+	}
+}
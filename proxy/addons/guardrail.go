@@ -0,0 +1,384 @@
+package addons
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/proxy/addons/guardrails"
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+// GuardrailStatusHeader lists the guardrail rules that matched a request or response
+const GuardrailStatusHeader = "X-Llm_proxy-Guardrail"
+
+// GuardrailAddon checks the chat message text in requests and responses against a set of rules,
+// and blocks, redacts, or tags the matches. The request's status is kept per flow until the
+// response, where both statuses are added to the status header.
+type GuardrailAddon struct {
+	px.BaseAddon
+	rules    *guardrails.RuleSet
+	statuses sync.Map // key: flow ID, value: string, the status of the request
+	closed   atomic.Bool
+	wg       sync.WaitGroup
+}
+
+// decodeJSONMap parses a JSON object, keeping numbers as json.Number
+func decodeJSONMap(data []byte) (map[string]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	body := make(map[string]any)
+	if err := decoder.Decode(&body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// guardrailHeaderValue formats the matching rule names for the status header
+func guardrailHeaderValue(status string, direction guardrails.Direction, tags []string) string {
+	if len(tags) == 0 {
+		return fmt.Sprintf("%s; direction=%s", status, direction)
+	}
+	return fmt.Sprintf("%s; direction=%s; rules=%s", status, direction, strings.Join(tags, ","))
+}
+
+// binaryContentType returns true for bodies without any text to check, e.g., generated audio
+func binaryContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return strings.HasPrefix(mediaType, "audio/") ||
+		strings.HasPrefix(mediaType, "image/") ||
+		strings.HasPrefix(mediaType, "video/") ||
+		mediaType == "application/octet-stream"
+}
+
+// textContentType returns true for plain text bodies, e.g., audio transcriptions in the text, srt,
+// or vtt formats
+func textContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/x-subrip"
+}
+
+// failClosed returns true when a body that can't be checked must be blocked
+func (g *GuardrailAddon) failClosed(contentType string) bool {
+	return !g.rules.FailOpen && !binaryContentType(contentType)
+}
+
+// checkRequestJSON checks the chat message text in a JSON request body, and returns the function
+// that redacts the matches
+func (g *GuardrailAddon) checkRequestJSON(req *px.Request) (guardrails.Result, func() error, error) {
+	body, err := decodeRequestJSON(req)
+	if err != nil {
+		return guardrails.Result{}, nil, err
+	}
+
+	texts := guardrails.CollectText(body, guardrails.WalkRequestText)
+	result := g.rules.Check(guardrails.Request, strings.Join(texts, "\n"))
+	return result, func() error {
+		guardrails.WalkRequestText(body, result.RedactText)
+		return encodeRequestJSON(req, body)
+	}, nil
+}
+
+// checkRequestForm checks the text fields in a multipart form request body, e.g., the prompt of an
+// audio transcription, and returns the function that redacts the matches. Uploaded files are
+// skipped, they don't have any text to check.
+func (g *GuardrailAddon) checkRequestForm(req *px.Request, boundary string) (guardrails.Result, func() error, error) {
+	parts, err := decodeRequestForm(req, boundary)
+	if err != nil {
+		return guardrails.Result{}, nil, err
+	}
+
+	texts := make([]string, 0)
+	for _, part := range parts {
+		if !part.isFile {
+			texts = append(texts, string(part.value))
+		}
+	}
+	result := g.rules.Check(guardrails.Request, strings.Join(texts, "\n"))
+	return result, func() error {
+		for i := range parts {
+			if !parts[i].isFile {
+				parts[i].value = []byte(result.RedactText(string(parts[i].value)))
+			}
+		}
+		return encodeRequestForm(req, parts, boundary)
+	}, nil
+}
+
+func (g *GuardrailAddon) Request(f *px.Flow) {
+	if f.Request == nil || len(f.Request.Body) == 0 || !g.rules.HasRules(guardrails.Request) {
+		// nothing to check, e.g., listing the models
+		return
+	}
+
+	var result guardrails.Result
+	var redact func() error
+	var err error
+	contentType := f.Request.Header.Get("Content-Type")
+	if mediaType, params, _ := mime.ParseMediaType(contentType); mediaType == "multipart/form-data" {
+		result, redact, err = g.checkRequestForm(f.Request, params["boundary"])
+	} else {
+		result, redact, err = g.checkRequestJSON(f.Request)
+	}
+	if err != nil {
+		if !g.failClosed(contentType) {
+			log.Debugf("guardrails skipping request body that can't be checked: %v", err)
+			return
+		}
+		log.Warnf("guardrails blocked request that can't be checked: %s: %v", f.Request.URL, err)
+		f.Response = newErrorResponse(
+			http.StatusForbidden, "guardrail_violation", "request_unchecked",
+			fmt.Sprintf("request blocked, the guardrails can't check the body: %v", err),
+		)
+		f.Response.Header.Set(GuardrailStatusHeader, guardrailHeaderValue("unchecked", guardrails.Request, nil))
+		return
+	}
+	if len(result.Tags) == 0 {
+		return
+	}
+
+	if result.Blocked() {
+		log.Warnf("guardrail rule %s blocked request: %s", result.BlockedBy, f.Request.URL)
+		f.Response = newErrorResponse(
+			http.StatusForbidden, "guardrail_violation", "request_blocked",
+			fmt.Sprintf("request blocked by guardrail rule: %s", result.BlockedBy),
+		)
+		f.Response.Header.Set(GuardrailStatusHeader, guardrailHeaderValue("blocked", guardrails.Request, result.Tags))
+		return
+	}
+
+	log.Warnf("guardrail rules matched request (%s): %s", strings.Join(result.Tags, ","), f.Request.URL)
+	if len(result.Redact) > 0 {
+		if err := redact(); err != nil {
+			// don't send the unredacted request upstream
+			log.Errorf("error redacting request, blocking it: %v", err)
+			f.Response = newErrorResponse(http.StatusInternalServerError, "guardrail_error", "redaction_failed", err.Error())
+			return
+		}
+	}
+
+	if g.closed.Load() {
+		return
+	}
+	// added to the response below
+	g.statuses.Store(f.Id, guardrailHeaderValue("matched", guardrails.Request, result.Tags))
+
+	g.wg.Add(1) // for blocking this addon during shutdown in .Close()
+	go func() {
+		defer g.wg.Done()
+		<-f.Done()
+		g.statuses.Delete(f.Id) // normally removed in the Response event, unless there was no response
+	}()
+}
+
+// blockUnchecked replaces a response body that can't be checked, unless the rules are fail open.
+// Error responses are passed on, they don't have any generated text.
+func (g *GuardrailAddon) blockUnchecked(f *px.Flow, err error) {
+	if f.Response.StatusCode >= http.StatusBadRequest || !g.failClosed(f.Response.Header.Get("Content-Type")) {
+		log.Debugf("guardrails skipping response body that can't be checked: %v", err)
+		return
+	}
+	log.Warnf("guardrails blocked response that can't be checked: %s: %v", f.Request.URL, err)
+	replaceResponse(f, newErrorResponse(
+		http.StatusForbidden, "guardrail_violation", "response_unchecked",
+		fmt.Sprintf("response blocked, the guardrails can't check the body: %v", err),
+	))
+	f.Response.Header.Add(GuardrailStatusHeader, guardrailHeaderValue("unchecked", guardrails.Response, nil))
+}
+
+func (g *GuardrailAddon) Response(f *px.Flow) {
+	if f.Response == nil {
+		return
+	}
+
+	// the status is only set by this addon, not by the upstream
+	f.Response.Header.Del(GuardrailStatusHeader)
+	if requestStatus, found := g.statuses.LoadAndDelete(f.Id); found {
+		f.Response.Header.Add(GuardrailStatusHeader, requestStatus.(string))
+	}
+
+	if !g.rules.HasRules(guardrails.Response) || len(f.Response.Body) == 0 {
+		return
+	}
+
+	contentEncoding := f.Response.Header.Get("Content-Encoding")
+	decodedBody, err := utils.DecodeBody(f.Response.Body, contentEncoding)
+	if err != nil {
+		g.blockUnchecked(f, err)
+		return
+	}
+
+	body := string(decodedBody)
+	contentType := f.Response.Header.Get("Content-Type")
+	isStream := utils.IsSSE(contentType) || utils.LooksLikeSSE(body)
+	isText := !isStream && textContentType(contentType)
+
+	var result guardrails.Result
+	switch {
+	case isStream:
+		result, err = g.checkStream(body)
+	case isText:
+		result = g.rules.Check(guardrails.Response, body)
+	default:
+		result, err = g.checkJSON(body)
+	}
+	if err != nil {
+		g.blockUnchecked(f, err)
+		return
+	}
+	if len(result.Tags) == 0 {
+		return
+	}
+
+	if result.Blocked() {
+		log.Warnf("guardrail rule %s blocked response: %s", result.BlockedBy, f.Request.URL)
+		replaceResponse(f, newErrorResponse(
+			http.StatusForbidden, "guardrail_violation", "response_blocked",
+			fmt.Sprintf("response blocked by guardrail rule: %s", result.BlockedBy),
+		))
+		f.Response.Header.Add(GuardrailStatusHeader, guardrailHeaderValue("blocked", guardrails.Response, result.Tags))
+		return
+	}
+
+	log.Warnf("guardrail rules matched response (%s): %s", strings.Join(result.Tags, ","), f.Request.URL)
+	f.Response.Header.Add(GuardrailStatusHeader, guardrailHeaderValue("matched", guardrails.Response, result.Tags))
+
+	if len(result.Redact) == 0 {
+		return
+	}
+	var newBody string
+	switch {
+	case isStream:
+		newBody, err = redactStream(body, result)
+	case isText:
+		newBody = result.RedactText(body)
+	default:
+		newBody, err = redactJSON(body, result)
+	}
+	var encodedBody []byte
+	if err == nil {
+		encodedBody, err = encodeBody([]byte(newBody), contentEncoding)
+	}
+	if err != nil {
+		// don't send the unredacted response to the client
+		log.Errorf("error redacting response, blocking it: %v", err)
+		replaceResponse(f, newErrorResponse(http.StatusInternalServerError, "guardrail_error", "redaction_failed", err.Error()))
+		return
+	}
+	f.Response.Body = encodedBody
+	f.Response.Header.Set("Content-Length", strconv.Itoa(len(encodedBody)))
+}
+
+// checkJSON checks the text in a JSON response body
+func (g *GuardrailAddon) checkJSON(body string) (guardrails.Result, error) {
+	bodyMap, err := decodeJSONMap([]byte(body))
+	if err != nil {
+		return guardrails.Result{}, fmt.Errorf("response body isn't JSON: %w", err)
+	}
+
+	texts := guardrails.CollectText(bodyMap, guardrails.WalkResponseText)
+	return g.rules.Check(guardrails.Response, strings.Join(texts, "\n")), nil
+}
+
+// redactJSON returns the JSON response body with the matches redacted
+func redactJSON(body string, result guardrails.Result) (string, error) {
+	bodyMap, err := decodeJSONMap([]byte(body))
+	if err != nil {
+		return "", err
+	}
+	guardrails.WalkResponseText(bodyMap, result.RedactText)
+	redacted, err := json.Marshal(bodyMap)
+	if err != nil {
+		return "", err
+	}
+	return string(redacted), nil
+}
+
+// checkStream checks the combined text from all chunks of a streamed response, so matches that
+// span several chunks are found
+func (g *GuardrailAddon) checkStream(body string) (guardrails.Result, error) {
+	texts := make([]string, 0)
+	for _, event := range utils.ParseSSE(body) {
+		if event.Data == "" || event.Data == utils.SSEDone {
+			continue
+		}
+		chunk, err := decodeJSONMap([]byte(event.Data))
+		if err != nil {
+			return guardrails.Result{}, fmt.Errorf("stream event isn't JSON: %w", err)
+		}
+		texts = append(texts, guardrails.CollectText(chunk, guardrails.WalkResponseText)...)
+	}
+	return g.rules.Check(guardrails.Response, strings.Join(texts, "")), nil
+}
+
+// redactStream returns the streamed response body with the matches redacted. The text of all
+// chunks is redacted together, so a match that spans several chunks is replaced in the chunk where
+// it starts, and removed from the chunks it continues into.
+func redactStream(body string, result guardrails.Result) (string, error) {
+	texts := make([]string, 0)
+	utils.MapSSEData(body, func(data string) string {
+		if chunk, err := decodeJSONMap([]byte(data)); err == nil {
+			texts = append(texts, guardrails.CollectText(chunk, guardrails.WalkResponseText)...)
+		}
+		return data
+	})
+	redacted := result.RedactSegments(texts)
+
+	var redactErr error
+	next := 0
+	newBody := utils.MapSSEData(body, func(data string) string {
+		chunk, err := decodeJSONMap([]byte(data))
+		if err != nil {
+			return data
+		}
+		changed := false
+		guardrails.WalkResponseText(chunk, func(text string) string {
+			newText := redacted[next]
+			next++
+			changed = changed || newText != text
+			return newText
+		})
+		if !changed {
+			return data
+		}
+		newData, err := json.Marshal(chunk)
+		if err != nil {
+			redactErr = err
+			return data
+		}
+		return string(newData)
+	})
+	return newBody, redactErr
+}
+
+func (g *GuardrailAddon) String() string {
+	return "GuardrailAddon"
+}
+
+func (g *GuardrailAddon) Close() error {
+	if !g.closed.Swap(true) {
+		log.Debug("Waiting for GuardrailAddon shutdown...")
+		g.wg.Wait()
+	}
+	return nil
+}
+
+// NewGuardrailAddon creates a new guardrail addon from a JSON rules file
+func NewGuardrailAddon(rulesFile string) (*GuardrailAddon, error) {
+	rules, err := guardrails.NewRuleSetFromFile(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Loaded %d guardrail rules", len(rules.Rules))
+	return &GuardrailAddon{rules: rules}, nil
+}
@@ -0,0 +1,361 @@
+package addons
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/proxy/addons/guardrails"
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+func newGuardrailTestAddon(t *testing.T) *GuardrailAddon {
+	t.Helper()
+	rulesFile := filepath.Join(t.TempDir(), "guardrails.json")
+	require.NoError(t, os.WriteFile(rulesFile, []byte(`{"rules": [
+		{"name": "secrets", "direction": "request", "type": "keyword", "patterns": ["password"], "action": "block"},
+		{"name": "ssn", "type": "regex", "patterns": ["\\d{3}-\\d{2}-\\d{4}"], "action": "redact"},
+		{"name": "competitors", "type": "denylist", "patterns": ["acme corp"], "action": "tag"},
+		{"name": "forbidden-output", "direction": "response", "type": "keyword", "patterns": ["launch codes"], "action": "block"}
+	]}`), 0644))
+
+	addon, err := NewGuardrailAddon(rulesFile)
+	require.NoError(t, err)
+	assert.Equal(t, "GuardrailAddon", addon.String())
+	return addon
+}
+
+func newGuardrailTestFlow(t *testing.T, prompt string) *px.Flow {
+	t.Helper()
+	u, err := url.Parse("https://api.openai.com/v1/chat/completions")
+	require.NoError(t, err)
+
+	body, err := json.Marshal(map[string]any{
+		"model":    "gpt-4o",
+		"messages": []any{map[string]any{"role": "user", "content": prompt}},
+	})
+	require.NoError(t, err)
+
+	return &px.Flow{
+		Id: uuid.NewV4(),
+		Request: &px.Request{
+			Method: "POST",
+			URL:    u,
+			Header: http.Header{"Content-Type": []string{"application/json"}},
+			Body:   body,
+		},
+	}
+}
+
+func TestGuardrailAddon_Request(t *testing.T) {
+	addon := newGuardrailTestAddon(t)
+
+	t.Run("no match", func(t *testing.T) {
+		flow := newGuardrailTestFlow(t, "hello")
+		original := string(flow.Request.Body)
+		addon.Request(flow)
+		assert.Nil(t, flow.Response)
+		assert.Equal(t, original, string(flow.Request.Body))
+		assert.Empty(t, flow.Request.Header.Get(GuardrailStatusHeader))
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		flow := newGuardrailTestFlow(t, "my password is hunter2")
+		addon.Request(flow)
+		require.NotNil(t, flow.Response)
+		assert.Equal(t, http.StatusForbidden, flow.Response.StatusCode)
+		assert.Equal(t, "blocked; direction=request; rules=secrets", flow.Response.Header.Get(GuardrailStatusHeader))
+
+		errResp := apiError{}
+		require.NoError(t, json.Unmarshal(flow.Response.Body, &errResp))
+		assert.Equal(t, "guardrail_violation", errResp.Error.Type)
+		assert.Equal(t, "request_blocked", errResp.Error.Code)
+	})
+
+	t.Run("non-json body", func(t *testing.T) {
+		flow := newGuardrailTestFlow(t, "hello")
+		flow.Request.Header.Set("Content-Type", "text/plain")
+		flow.Request.Body = []byte("password")
+		addon.Request(flow)
+		require.NotNil(t, flow.Response)
+		assert.Equal(t, http.StatusForbidden, flow.Response.StatusCode)
+		assert.Equal(t, "unchecked; direction=request", flow.Response.Header.Get(GuardrailStatusHeader))
+
+		errResp := apiError{}
+		require.NoError(t, json.Unmarshal(flow.Response.Body, &errResp))
+		assert.Equal(t, "request_unchecked", errResp.Error.Code)
+
+		failOpen := &GuardrailAddon{rules: &guardrails.RuleSet{Rules: addon.rules.Rules, FailOpen: true}}
+		flow.Response = nil
+		failOpen.Request(flow)
+		assert.Nil(t, flow.Response)
+	})
+
+	t.Run("empty body", func(t *testing.T) {
+		flow := newGuardrailTestFlow(t, "hello")
+		flow.Request.Method = "GET"
+		flow.Request.Body = nil
+		addon.Request(flow)
+		assert.Nil(t, flow.Response)
+	})
+
+	t.Run("redacted and tagged", func(t *testing.T) {
+		flow := newGuardrailTestFlow(t, "my ssn is 123-45-6789, I work at ACME Corp")
+		addon.Request(flow)
+		assert.Nil(t, flow.Response)
+		assert.Contains(t, string(flow.Request.Body), "my ssn is [REDACTED], I work at ACME Corp")
+		assert.Contains(t, string(flow.Request.Body), `"model":"gpt-4o"`)
+		assert.Empty(t, flow.Request.Header.Get(GuardrailStatusHeader)) // not sent upstream
+
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       []byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}}]}`),
+		}
+		addon.Response(flow)
+		assert.Equal(t,
+			[]string{"matched; direction=request; rules=ssn,competitors"},
+			flow.Response.Header.Values(GuardrailStatusHeader),
+		)
+		_, found := addon.statuses.Load(flow.Id)
+		assert.False(t, found)
+	})
+
+	t.Run("status set by the client or upstream", func(t *testing.T) {
+		flow := newGuardrailTestFlow(t, "hello")
+		flow.Request.Header.Set(GuardrailStatusHeader, "matched; direction=request; rules=forged")
+		addon.Request(flow)
+		assert.Nil(t, flow.Response)
+
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Content-Type":        []string{"application/json"},
+				GuardrailStatusHeader: []string{"matched; direction=response; rules=forged"},
+			},
+			Body: []byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}}]}`),
+		}
+		addon.Response(flow)
+		assert.Empty(t, flow.Response.Header.Values(GuardrailStatusHeader))
+	})
+
+	t.Run("multipart form", func(t *testing.T) {
+		newFormFlow := func(t *testing.T, prompt string) *px.Flow {
+			t.Helper()
+			flow := newGuardrailTestFlow(t, "")
+			flow.Request.URL.Path = "/v1/audio/transcriptions"
+			flow.Request.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+			flow.Request.Header.Set("Content-Length", "1")
+			flow.Request.Body = []byte("--x\r\n" +
+				"Content-Disposition: form-data; name=\"file\"; filename=\"audio.mp3\"\r\n" +
+				"Content-Type: audio/mpeg\r\n\r\n" +
+				"ID3 password 123-45-6789\r\n" +
+				"--x\r\n" +
+				"Content-Disposition: form-data; name=\"prompt\"\r\n\r\n" +
+				prompt + "\r\n" +
+				"--x--\r\n")
+			return flow
+		}
+
+		flow := newFormFlow(t, "Transcribe it")
+		original := string(flow.Request.Body)
+		addon.Request(flow)
+		assert.Nil(t, flow.Response) // the uploaded file isn't checked
+		assert.Equal(t, original, string(flow.Request.Body))
+
+		flow = newFormFlow(t, "my password")
+		addon.Request(flow)
+		require.NotNil(t, flow.Response)
+		assert.Equal(t, "blocked; direction=request; rules=secrets", flow.Response.Header.Get(GuardrailStatusHeader))
+
+		flow = newFormFlow(t, "ssn 123-45-6789")
+		addon.Request(flow)
+		assert.Nil(t, flow.Response)
+		assert.Contains(t, string(flow.Request.Body), "ID3 password 123-45-6789\r\n")
+		assert.Contains(t, string(flow.Request.Body), "name=\"prompt\"\r\n\r\nssn [REDACTED]\r\n")
+		assert.Equal(t, strconv.Itoa(len(flow.Request.Body)), flow.Request.Header.Get("Content-Length"))
+	})
+}
+
+func TestGuardrailAddon_Response(t *testing.T) {
+	addon := newGuardrailTestAddon(t)
+
+	t.Run("redacted json", func(t *testing.T) {
+		flow := newGuardrailTestFlow(t, "hello")
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       []byte(`{"choices": [{"message": {"role": "assistant", "content": "the ssn is 123-45-6789"}}], "usage": {"total_tokens": 12}}`),
+		}
+		addon.Response(flow)
+
+		assert.Equal(t, http.StatusOK, flow.Response.StatusCode)
+		assert.Contains(t, string(flow.Response.Body), `"content":"the ssn is [REDACTED]"`)
+		assert.Contains(t, string(flow.Response.Body), `"total_tokens":12`)
+		assert.Equal(t, "matched; direction=response; rules=ssn", flow.Response.Header.Get(GuardrailStatusHeader))
+	})
+
+	t.Run("redacted gzip json", func(t *testing.T) {
+		body, err := encodeBody([]byte(`{"choices": [{"message": {"content": "123-45-6789"}}]}`), "gzip")
+		require.NoError(t, err)
+
+		flow := newGuardrailTestFlow(t, "hello")
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}, "Content-Encoding": []string{"gzip"}},
+			Body:       body,
+		}
+		addon.Response(flow)
+
+		decoded, err := utils.DecodeBody(flow.Response.Body, "gzip")
+		require.NoError(t, err)
+		assert.Contains(t, string(decoded), "[REDACTED]")
+	})
+
+	t.Run("blocked stream spanning chunks", func(t *testing.T) {
+		chunks := []string{"here are the lau", "nch codes: 1234"}
+		var sb strings.Builder
+		for _, chunk := range chunks {
+			sb.WriteString(`data: {"choices": [{"delta": {"content": "` + chunk + `"}}]}` + "\n\n")
+		}
+		sb.WriteString("data: [DONE]\n\n")
+
+		flow := newGuardrailTestFlow(t, "hello")
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}, "X-Llm_proxy-Cache": []string{"MISS"}},
+			Body:       []byte(sb.String()),
+		}
+		addon.Response(flow)
+
+		assert.Equal(t, http.StatusForbidden, flow.Response.StatusCode)
+		assert.Equal(t, "MISS", flow.Response.Header.Get("X-Llm_proxy-Cache"))
+		assert.Equal(t,
+			"blocked; direction=response; rules=forbidden-output",
+			flow.Response.Header.Get(GuardrailStatusHeader),
+		)
+	})
+
+	t.Run("redacted stream", func(t *testing.T) {
+		body := `data: {"choices": [{"delta": {"content": "ssn 123-45-6789"}}]}` + "\n\n" + "data: [DONE]\n\n"
+		flow := newGuardrailTestFlow(t, "hello")
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       []byte(body),
+		}
+		addon.Response(flow)
+
+		assert.Equal(t, http.StatusOK, flow.Response.StatusCode)
+		assert.Contains(t, string(flow.Response.Body), `"content":"ssn [REDACTED]"`)
+		assert.Contains(t, string(flow.Response.Body), "data: [DONE]")
+	})
+
+	t.Run("redacted stream spanning chunks", func(t *testing.T) {
+		body := `data: {"choices": [{"delta": {"content": "ssn 123-4"}}]}` + "\n\n" +
+			`data: {"choices": [{"delta": {"content": "5-6789 ok"}}]}` + "\n\n" +
+			"data: [DONE]\n\n"
+		flow := newGuardrailTestFlow(t, "hello")
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       []byte(body),
+		}
+		addon.Response(flow)
+
+		assert.Equal(t, http.StatusOK, flow.Response.StatusCode)
+		events := utils.ParseSSE(string(flow.Response.Body))
+		require.Len(t, events, 3)
+		assert.Contains(t, events[0].Data, `"content":"ssn [REDACTED]"`)
+		assert.Contains(t, events[1].Data, `"content":" ok"`)
+		assert.Equal(t, utils.SSEDone, events[2].Data)
+		assert.Equal(t, "matched; direction=response; rules=ssn", flow.Response.Header.Get(GuardrailStatusHeader))
+	})
+
+	t.Run("plain text response", func(t *testing.T) {
+		flow := newGuardrailTestFlow(t, "hello")
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+			Body:       []byte("my ssn is 123-45-6789"),
+		}
+		addon.Response(flow)
+		assert.Equal(t, http.StatusOK, flow.Response.StatusCode)
+		assert.Equal(t, "my ssn is [REDACTED]", string(flow.Response.Body))
+		assert.Equal(t, "matched; direction=response; rules=ssn", flow.Response.Header.Get(GuardrailStatusHeader))
+
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/vtt"}},
+			Body:       []byte("WEBVTT\n\n00:00.000 --> 00:01.000\nthe launch codes"),
+		}
+		addon.Response(flow)
+		assert.Equal(t, http.StatusForbidden, flow.Response.StatusCode)
+	})
+
+	t.Run("non-json response", func(t *testing.T) {
+		flow := newGuardrailTestFlow(t, "hello")
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       []byte("the launch codes"),
+		}
+		addon.Response(flow)
+		assert.Equal(t, http.StatusForbidden, flow.Response.StatusCode)
+		assert.Equal(t, "unchecked; direction=response", flow.Response.Header.Get(GuardrailStatusHeader))
+
+		errResp := apiError{}
+		require.NoError(t, json.Unmarshal(flow.Response.Body, &errResp))
+		assert.Equal(t, "response_unchecked", errResp.Error.Code)
+	})
+
+	t.Run("non-json response, fail open", func(t *testing.T) {
+		failOpen := &GuardrailAddon{rules: &guardrails.RuleSet{Rules: addon.rules.Rules, FailOpen: true}}
+		flow := newGuardrailTestFlow(t, "hello")
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       []byte("the launch codes"),
+		}
+		failOpen.Response(flow)
+		assert.Equal(t, http.StatusOK, flow.Response.StatusCode)
+		assert.Empty(t, flow.Response.Header.Get(GuardrailStatusHeader))
+	})
+
+	t.Run("not checked", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			status      int
+			contentType string
+			body        string
+		}{
+			{name: "audio", status: http.StatusOK, contentType: "audio/mpeg", body: "ID3 launch codes"},
+			{name: "error response", status: http.StatusBadGateway, contentType: "text/html", body: "<html>bad gateway</html>"},
+			{name: "empty body", status: http.StatusNoContent, contentType: "application/json"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				flow := newGuardrailTestFlow(t, "hello")
+				flow.Response = &px.Response{
+					StatusCode: tt.status,
+					Header:     http.Header{"Content-Type": []string{tt.contentType}},
+					Body:       []byte(tt.body),
+				}
+				addon.Response(flow)
+				assert.Equal(t, tt.status, flow.Response.StatusCode)
+				assert.Equal(t, tt.body, string(flow.Response.Body))
+				assert.Empty(t, flow.Response.Header.Get(GuardrailStatusHeader))
+			})
+		}
+	})
+}
@@ -0,0 +1,280 @@
+package guardrails
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Direction selects which side of the exchange a rule is checked against
+type Direction string
+
+const (
+	Request  Direction = "request"
+	Response Direction = "response"
+	Both     Direction = "both"
+)
+
+// Action is what happens when a rule matches
+type Action string
+
+const (
+	Block  Action = "block"  // the request or response is replaced with an error
+	Redact Action = "redact" // the matching text is replaced
+	Tag    Action = "tag"    // the match is only logged, and tagged in the response headers
+)
+
+// RuleType selects how the rule's patterns are matched
+type RuleType string
+
+const (
+	Regex    RuleType = "regex"    // each pattern is a regular expression
+	Keyword  RuleType = "keyword"  // each pattern is a literal substring
+	Denylist RuleType = "denylist" // each pattern is a literal word or phrase, matched on word boundaries
+)
+
+const defaultReplacement = "[REDACTED]"
+
+// Rule is a single guardrail rule, loaded from the guardrails JSON file
+type Rule struct {
+	Name          string    `json:"name"`
+	Direction     Direction `json:"direction"`
+	Type          RuleType  `json:"type"`
+	Patterns      []string  `json:"patterns"`
+	Action        Action    `json:"action"`
+	CaseSensitive bool      `json:"case_sensitive,omitempty"`
+	Replacement   string    `json:"replacement,omitempty"` // used by the redact action
+	compiled      []*regexp.Regexp
+}
+
+// compile validates the rule and builds the regular expressions for the patterns
+func (r *Rule) compile() error {
+	switch r.Direction {
+	case Request, Response, Both:
+	case "":
+		r.Direction = Both
+	default:
+		return fmt.Errorf("invalid direction: %q", r.Direction)
+	}
+
+	switch r.Action {
+	case Block, Redact, Tag:
+	default:
+		return fmt.Errorf("invalid action: %q", r.Action)
+	}
+
+	if len(r.Patterns) == 0 {
+		return fmt.Errorf("no patterns defined")
+	}
+	if r.Replacement == "" {
+		r.Replacement = defaultReplacement
+	}
+
+	flags := "(?i)"
+	if r.CaseSensitive {
+		flags = ""
+	}
+
+	r.compiled = make([]*regexp.Regexp, 0, len(r.Patterns))
+	for _, pattern := range r.Patterns {
+		var expr string
+		switch r.Type {
+		case Regex:
+			expr = pattern
+		case Keyword:
+			expr = regexp.QuoteMeta(pattern)
+		case Denylist:
+			expr = `\b` + regexp.QuoteMeta(pattern) + `\b`
+		default:
+			return fmt.Errorf("invalid type: %q", r.Type)
+		}
+
+		re, err := regexp.Compile(flags + expr)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		r.compiled = append(r.compiled, re)
+	}
+	return nil
+}
+
+// appliesTo returns true if the rule should be checked for the direction
+func (r *Rule) appliesTo(direction Direction) bool {
+	return r.Direction == Both || r.Direction == direction
+}
+
+// Matches returns true if any of the rule's patterns match the text
+func (r *Rule) Matches(text string) bool {
+	for _, re := range r.compiled {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact replaces all pattern matches in the text
+func (r *Rule) redact(text string) string {
+	for _, re := range r.compiled {
+		text = re.ReplaceAllLiteralString(text, r.Replacement)
+	}
+	return text
+}
+
+// redactSegments replaces the pattern matches in text that was split into segments, e.g., the
+// deltas of a streamed response. The matches are found in the joined text, so a match can span
+// segments. The replacement is put in the segment where the match starts, and the rest of the
+// match is removed from the segments it continues into, so the number of segments is kept.
+func (r *Rule) redactSegments(segments []string) []string {
+	for _, re := range r.compiled {
+		joined := strings.Join(segments, "")
+		matches := re.FindAllStringIndex(joined, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		// ends[i] is the offset in the joined text where segment i ends
+		ends := make([]int, len(segments))
+		offset := 0
+		for i, segment := range segments {
+			offset += len(segment)
+			ends[i] = offset
+		}
+		out := make([]strings.Builder, len(segments))
+
+		// keep copies the joined text from start to end into the segments it came from
+		keep := func(start, end int) {
+			segmentStart := 0
+			for i := range segments {
+				from, to := max(start, segmentStart), min(end, ends[i])
+				if from < to {
+					out[i].WriteString(joined[from:to])
+				}
+				segmentStart = ends[i]
+			}
+		}
+		// segmentAt returns the segment with the byte at the offset, or the last segment for the end
+		segmentAt := func(offset int) int {
+			for i, end := range ends {
+				if offset < end {
+					return i
+				}
+			}
+			return len(segments) - 1
+		}
+
+		cursor := 0
+		for _, match := range matches {
+			keep(cursor, match[0])
+			out[segmentAt(match[0])].WriteString(r.Replacement)
+			cursor = match[1]
+		}
+		keep(cursor, len(joined))
+
+		segments = make([]string, len(out))
+		for i := range out {
+			segments[i] = out[i].String()
+		}
+	}
+	return segments
+}
+
+// Result is the outcome of checking text against the rules
+type Result struct {
+	BlockedBy string   // name of the first matching block rule, empty when not blocked
+	Redact    []*Rule  // matching redact rules, applied with RuleSet.Redact
+	Tags      []string // names of all matching rules
+}
+
+// Blocked returns true if a block rule matched
+func (r Result) Blocked() bool {
+	return r.BlockedBy != ""
+}
+
+// RedactText applies the matching redact rules to the text
+func (r Result) RedactText(text string) string {
+	for _, rule := range r.Redact {
+		text = rule.redact(text)
+	}
+	return text
+}
+
+// RedactSegments applies the matching redact rules to text that was split into segments, e.g.,
+// the deltas of a streamed response, including the matches that span segments. The returned
+// slice has the same length.
+func (r Result) RedactSegments(segments []string) []string {
+	if len(segments) == 0 {
+		return segments
+	}
+	for _, rule := range r.Redact {
+		segments = rule.redactSegments(segments)
+	}
+	return segments
+}
+
+// RuleSet is the list of rules loaded from the guardrails JSON file. A body that can't be checked,
+// e.g., a request that isn't JSON or a multipart form, is blocked unless FailOpen is set.
+type RuleSet struct {
+	Rules    []*Rule `json:"rules"`
+	FailOpen bool    `json:"fail_open,omitempty"` // pass on the bodies that can't be checked
+}
+
+// Check returns the result of all rules for the direction that match the text
+func (rs *RuleSet) Check(direction Direction, text string) Result {
+	result := Result{}
+	if strings.TrimSpace(text) == "" {
+		return result
+	}
+
+	for _, r := range rs.Rules {
+		if !r.appliesTo(direction) || !r.Matches(text) {
+			continue
+		}
+
+		result.Tags = append(result.Tags, r.Name)
+		switch r.Action {
+		case Block:
+			if result.BlockedBy == "" {
+				result.BlockedBy = r.Name
+			}
+		case Redact:
+			result.Redact = append(result.Redact, r)
+		}
+	}
+	return result
+}
+
+// HasRules returns true if any rule applies to the direction
+func (rs *RuleSet) HasRules(direction Direction) bool {
+	for _, r := range rs.Rules {
+		if r.appliesTo(direction) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRuleSetFromFile reads and compiles a guardrails JSON file
+func NewRuleSetFromFile(filePath string) (*RuleSet, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read guardrails file: %w", err)
+	}
+
+	rs := &RuleSet{}
+	if err := json.Unmarshal(data, rs); err != nil {
+		return nil, fmt.Errorf("failed to parse guardrails file: %w", err)
+	}
+
+	for i, r := range rs.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("invalid guardrails file %s, rule %s: %w", filePath, r.Name, err)
+		}
+	}
+	return rs, nil
+}
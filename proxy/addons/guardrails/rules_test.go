@@ -0,0 +1,230 @@
+package guardrails
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRules(t *testing.T, content string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "guardrails.json")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	return filePath
+}
+
+func TestNewRuleSetFromFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{
+			name:    "valid",
+			content: `{"rules": [{"name": "ssn", "type": "regex", "patterns": ["\\d{3}-\\d{2}-\\d{4}"], "action": "redact"}]}`,
+		},
+		{
+			name:        "invalid action",
+			content:     `{"rules": [{"type": "keyword", "patterns": ["x"], "action": "explode"}]}`,
+			expectedErr: `rule rule-0: invalid action: "explode"`,
+		},
+		{
+			name:        "invalid regex",
+			content:     `{"rules": [{"type": "regex", "patterns": ["("], "action": "block"}]}`,
+			expectedErr: "invalid pattern",
+		},
+		{
+			name:        "no patterns",
+			content:     `{"rules": [{"type": "keyword", "action": "tag"}]}`,
+			expectedErr: "no patterns defined",
+		},
+		{
+			name:        "invalid json",
+			content:     `{"rules": `,
+			expectedErr: "failed to parse guardrails file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := NewRuleSetFromFile(writeRules(t, tt.content))
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, Both, rs.Rules[0].Direction)
+			assert.Equal(t, defaultReplacement, rs.Rules[0].Replacement)
+		})
+	}
+
+	_, err := NewRuleSetFromFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestRuleSet_Check(t *testing.T) {
+	rs, err := NewRuleSetFromFile(writeRules(t, `{"rules": [
+		{"name": "secrets", "direction": "request", "type": "keyword", "patterns": ["password"], "action": "block"},
+		{"name": "ssn", "type": "regex", "patterns": ["\\d{3}-\\d{2}-\\d{4}"], "action": "redact", "replacement": "<ssn>"},
+		{"name": "competitors", "type": "denylist", "patterns": ["acme"], "action": "tag"},
+		{"name": "shouting", "direction": "response", "type": "keyword", "patterns": ["HELLO"], "action": "block", "case_sensitive": true}
+	]}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		direction       Direction
+		text            string
+		expectedBlocked string
+		expectedTags    []string
+		expectedRedact  string
+	}{
+		{
+			name:      "no match",
+			direction: Request,
+			text:      "hello world",
+		},
+		{
+			name:            "blocked request keyword, case insensitive",
+			direction:       Request,
+			text:            "my PASSWORD is 123-45-6789",
+			expectedBlocked: "secrets",
+			expectedTags:    []string{"secrets", "ssn"},
+			expectedRedact:  "my PASSWORD is <ssn>",
+		},
+		{
+			name:           "request only rule skipped for response",
+			direction:      Response,
+			text:           "the password is 123-45-6789",
+			expectedTags:   []string{"ssn"},
+			expectedRedact: "the password is <ssn>",
+		},
+		{
+			name:           "denylist matches whole words",
+			direction:      Request,
+			text:           "compare with Acme, not acmeville",
+			expectedTags:   []string{"competitors"},
+			expectedRedact: "compare with Acme, not acmeville",
+		},
+		{
+			name:           "denylist ignores partial words",
+			direction:      Request,
+			text:           "welcome to acmeville",
+			expectedRedact: "welcome to acmeville",
+		},
+		{
+			name:           "case sensitive rule",
+			direction:      Response,
+			text:           "hello",
+			expectedRedact: "hello",
+		},
+		{
+			name:            "case sensitive rule matches",
+			direction:       Response,
+			text:            "HELLO",
+			expectedBlocked: "shouting",
+			expectedTags:    []string{"shouting"},
+			expectedRedact:  "HELLO",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := rs.Check(tt.direction, tt.text)
+			assert.Equal(t, tt.expectedBlocked, result.BlockedBy)
+			assert.Equal(t, tt.expectedBlocked != "", result.Blocked())
+			assert.Equal(t, tt.expectedTags, result.Tags)
+			if tt.expectedRedact != "" {
+				assert.Equal(t, tt.expectedRedact, result.RedactText(tt.text))
+			}
+		})
+	}
+
+	assert.True(t, rs.HasRules(Request))
+	assert.True(t, rs.HasRules(Response))
+	assert.False(t, (&RuleSet{}).HasRules(Request))
+}
+
+func TestResult_RedactSegments(t *testing.T) {
+	rs, err := NewRuleSetFromFile(writeRules(t, `{"rules": [
+		{"name": "ssn", "type": "regex", "patterns": ["\\d{3}-\\d{2}-\\d{4}"], "action": "redact", "replacement": "<ssn>"},
+		{"name": "secret", "type": "keyword", "patterns": ["hunter2"], "action": "redact"}
+	]}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		segments []string
+		expected []string
+	}{
+		{
+			name:     "match in one segment",
+			segments: []string{"my ssn is ", "123-45-6789", " ok"},
+			expected: []string{"my ssn is ", "<ssn>", " ok"},
+		},
+		{
+			name:     "match spanning segments",
+			segments: []string{"my ssn is 123-4", "5-67", "89 ok"},
+			expected: []string{"my ssn is <ssn>", "", " ok"},
+		},
+		{
+			name:     "matches of several rules",
+			segments: []string{"123-45-", "6789 and hun", "ter2", ""},
+			expected: []string{"<ssn>", " and [REDACTED]", "", ""},
+		},
+		{
+			name:     "no match",
+			segments: []string{"hello ", "world"},
+			expected: []string{"hello ", "world"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := rs.Check(Response, strings.Join(tt.segments, ""))
+			assert.Equal(t, tt.expected, result.RedactSegments(tt.segments))
+		})
+	}
+}
+
+func TestWalkText(t *testing.T) {
+	request := map[string]any{
+		"system": "be nice",
+		"messages": []any{
+			map[string]any{"role": "user", "content": "first"},
+			map[string]any{"role": "user", "content": []any{
+				map[string]any{"type": "text", "text": "second"},
+				map[string]any{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/a.png"}},
+			}},
+		},
+		"input": []any{"third", "fourth"},
+	}
+	assert.Equal(t,
+		[]string{"first", "second", "be nice", "third", "fourth"},
+		CollectText(request, WalkRequestText),
+	)
+
+	WalkRequestText(request, func(text string) string { return "x" + text })
+	assert.Equal(t, "xbe nice", request["system"])
+	assert.Equal(t, []any{"xthird", "xfourth"}, request["input"])
+
+	response := map[string]any{
+		"choices": []any{
+			map[string]any{"message": map[string]any{"content": "answer"}},
+			map[string]any{"delta": map[string]any{"content": "chunk"}},
+			map[string]any{"text": "legacy"},
+		},
+	}
+	assert.Equal(t, []string{"answer", "chunk", "legacy"}, CollectText(response, WalkResponseText))
+
+	anthropic := map[string]any{
+		"content": []any{map[string]any{"type": "text", "text": "claude says"}},
+		"delta":   map[string]any{"type": "text_delta", "text": "more"},
+	}
+	assert.Equal(t, []string{"claude says", "more"}, CollectText(anthropic, WalkResponseText))
+}
@@ -0,0 +1,91 @@
+package guardrails
+
+// TextFunc receives a text field from a message body, and returns the (possibly modified) value
+type TextFunc func(text string) string
+
+// replaceString calls fn on container[key] when it's a string, and stores the result
+func replaceString(container map[string]any, key string, fn TextFunc) {
+	if s, ok := container[key].(string); ok {
+		container[key] = fn(s)
+	}
+}
+
+// walkContent handles a "content" value, which is either a string or a list of typed parts,
+// e.g., [{"type": "text", "text": "hello"}, {"type": "image_url", ...}]
+func walkContent(container map[string]any, key string, fn TextFunc) {
+	switch content := container[key].(type) {
+	case string:
+		container[key] = fn(content)
+	case []any:
+		for _, part := range content {
+			if partMap, ok := part.(map[string]any); ok {
+				replaceString(partMap, "text", fn)
+			}
+		}
+	}
+}
+
+// walkStringOrList handles values that are a string, or a list of strings, e.g., "prompt"
+func walkStringOrList(container map[string]any, key string, fn TextFunc) {
+	switch value := container[key].(type) {
+	case string:
+		container[key] = fn(value)
+	case []any:
+		for i, item := range value {
+			if s, ok := item.(string); ok {
+				value[i] = fn(s)
+			}
+		}
+	}
+}
+
+// WalkRequestText calls fn for each prompt text field in an OpenAI or Anthropic request body,
+// and replaces the field with the returned value
+func WalkRequestText(body map[string]any, fn TextFunc) {
+	if messages, ok := body["messages"].([]any); ok {
+		for _, message := range messages {
+			if messageMap, ok := message.(map[string]any); ok {
+				walkContent(messageMap, "content", fn)
+			}
+		}
+	}
+
+	walkContent(body, "system", fn)      // Anthropic system prompt
+	walkStringOrList(body, "prompt", fn) // legacy completions
+	walkStringOrList(body, "input", fn)  // embeddings and moderations
+}
+
+// WalkResponseText calls fn for each generated text field in an OpenAI or Anthropic response
+// body, or a single streamed chunk, and replaces the field with the returned value
+func WalkResponseText(body map[string]any, fn TextFunc) {
+	if choices, ok := body["choices"].([]any); ok {
+		for _, choice := range choices {
+			choiceMap, ok := choice.(map[string]any)
+			if !ok {
+				continue
+			}
+			replaceString(choiceMap, "text", fn)
+			for _, key := range []string{"message", "delta"} {
+				if messageMap, ok := choiceMap[key].(map[string]any); ok {
+					walkContent(messageMap, "content", fn)
+				}
+			}
+		}
+	}
+
+	// Anthropic message response, and content_block_delta stream events
+	walkContent(body, "content", fn)
+	if delta, ok := body["delta"].(map[string]any); ok {
+		replaceString(delta, "text", fn)
+	}
+}
+
+// CollectText returns all of the text fields visited by walk, without modifying the body
+func CollectText(body map[string]any, walk func(map[string]any, TextFunc)) []string {
+	texts := make([]string, 0)
+	walk(body, func(text string) string {
+		texts = append(texts, text)
+		return text
+	})
+	return texts
+}
@@ -0,0 +1,178 @@
+// Package ledger stores every audited transaction in a local bolt database, so the cost totals
+// survive restarts and can be reported on later.
+package ledger
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bojanz/currency"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/proxati/llm_proxy/fileUtils"
+)
+
+// entriesBucket holds the entries, keyed by timestamp and sequence number so a cursor can seek to
+// the start of a time range
+var entriesBucket = []byte("entries")
+
+// Entry is a single audited transaction. Cost is the total cost of the request, as a decimal
+// number in Currency.
+type Entry struct {
+	Timestamp         time.Time `json:"timestamp"`
+	URL               string    `json:"url"`
+	Model             string    `json:"model"`
+	InputTokens       int       `json:"input_tokens"`
+	CachedTokens      int       `json:"cached_tokens,omitempty"`
+	OutputTokens      int       `json:"output_tokens"`
+	ReasoningTokens   int       `json:"reasoning_tokens,omitempty"`
+	Cost              string    `json:"cost"`
+	Currency          string    `json:"currency"`
+	ConvertedCost     string    `json:"converted_cost,omitempty"`     // Cost in the reporting currency, when one is set
+	ConvertedCurrency string    `json:"converted_currency,omitempty"` // the reporting currency
+	Client            string    `json:"client,omitempty"`
+	Tags              []string  `json:"tags,omitempty"`
+	Batch             bool      `json:"batch,omitempty"`
+	Estimated         bool      `json:"estimated,omitempty"`
+}
+
+// Amount returns the cost of this entry as a currency amount
+func (e Entry) Amount() (currency.Amount, error) {
+	return currency.NewAmount(e.Cost, e.Currency)
+}
+
+// Ledger is an append-only store of audited transactions
+type Ledger struct {
+	db        *bolt.DB
+	closeOnce sync.Once
+}
+
+// Open loads or creates a ledger file, creating the parent directory if needed
+func Open(path string) (*Ledger, error) {
+	if path == "" {
+		return nil, fmt.Errorf("ledger file name is empty")
+	}
+
+	dirPath := filepath.Dir(path)
+	if err := fileUtils.DirExistsOrCreate(dirPath); err != nil {
+		return nil, fmt.Errorf("error creating ledger parent directory: %s", dirPath)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening ledger: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(entriesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating ledger bucket: %w", err)
+	}
+	return &Ledger{db: db}, nil
+}
+
+// OpenReadOnly loads an existing ledger file for reading, e.g., for reports
+func OpenReadOnly(path string) (*Ledger, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("error opening ledger %s (is it in use by a running proxy?): %w", path, err)
+	}
+	return &Ledger{db: db}, nil
+}
+
+// timeKey returns the first key for entries at or after t. Times before 1970 use the first key.
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 16)
+	if t.After(time.Unix(0, 0)) {
+		binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	}
+	return key
+}
+
+// Append stores an entry in the ledger
+func (l *Ledger) Append(entry Entry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshalling ledger entry: %w", err)
+	}
+
+	return l.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(entriesBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return fmt.Errorf("error getting ledger sequence: %w", err)
+		}
+
+		// entries with the same timestamp are kept in the order they were added
+		key := timeKey(entry.Timestamp)
+		binary.BigEndian.PutUint64(key[8:], seq)
+		return bucket.Put(key, value)
+	})
+}
+
+// Range calls fn for each entry from the start time, until the end time (exclusive), in the order
+// they were recorded. A zero until reads to the end of the ledger.
+func (l *Ledger) Range(from, until time.Time, fn func(Entry) error) error {
+	return l.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(entriesBucket)
+		if bucket == nil {
+			return nil // an empty ledger, opened read-only
+		}
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek(timeKey(from)); k != nil; k, v = cursor.Next() {
+			entry := Entry{}
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("error unmarshalling ledger entry: %w", err)
+			}
+			if !until.IsZero() && !entry.Timestamp.Before(until) {
+				return nil
+			}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Totals returns the total cost of the entries in a time range, for each currency
+func (l *Ledger) Totals(from, until time.Time) (map[string]currency.Amount, error) {
+	totals := make(map[string]currency.Amount)
+	err := l.Range(from, until, func(entry Entry) error {
+		amount, err := entry.Amount()
+		if err != nil {
+			return fmt.Errorf("invalid cost in ledger entry at %s: %w", entry.Timestamp, err)
+		}
+		total, err := totals[entry.Currency].Add(amount)
+		if err != nil {
+			return err
+		}
+		totals[entry.Currency] = total
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+// Close closes the ledger file
+func (l *Ledger) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		err = l.db.Close()
+	})
+	return err
+}
+
+// StartOfMonth returns midnight on the first day of the month of t, in the location of t
+func StartOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
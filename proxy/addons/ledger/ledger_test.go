@@ -0,0 +1,89 @@
+package ledger
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger", "ledger.db")
+	day := func(d int) time.Time { return time.Date(2024, time.October, d, 12, 0, 0, 0, time.UTC) }
+
+	l, err := Open(path)
+	require.NoError(t, err)
+
+	entries := []Entry{
+		{Timestamp: day(2), Model: "gpt-4o", Cost: "0.50", Currency: "USD", Tags: []string{"batch"}},
+		{Timestamp: day(1), Model: "gpt-4o", Cost: "0.25", Currency: "USD"},
+		{Timestamp: day(2), Model: "claude-3-5-haiku-latest", Cost: "1", Currency: "USD"},
+		{Timestamp: day(3), Model: "mistral", Cost: "2", Currency: "EUR"},
+	}
+	for _, entry := range entries {
+		require.NoError(t, l.Append(entry))
+	}
+
+	t.Run("Range", func(t *testing.T) {
+		models := make([]string, 0)
+		require.NoError(t, l.Range(day(2), day(3), func(entry Entry) error {
+			models = append(models, entry.Model)
+			return nil
+		}))
+		assert.Equal(t, []string{"gpt-4o", "claude-3-5-haiku-latest"}, models, "ordered by time, then insertion")
+	})
+
+	t.Run("Totals", func(t *testing.T) {
+		totals, err := l.Totals(day(1), time.Time{})
+		require.NoError(t, err)
+		require.Len(t, totals, 2)
+		assert.Equal(t, "1.75 USD", totals["USD"].String())
+		assert.Equal(t, "2 EUR", totals["EUR"].String())
+	})
+
+	t.Run("Reopen", func(t *testing.T) {
+		require.NoError(t, l.Close())
+		require.NoError(t, l.Close(), "closing twice is safe")
+
+		l, err = Open(path)
+		require.NoError(t, err)
+		defer l.Close()
+
+		count := 0
+		require.NoError(t, l.Range(time.Time{}, time.Time{}, func(entry Entry) error {
+			count++
+			return nil
+		}))
+		assert.Equal(t, len(entries), count)
+	})
+
+	t.Run("Read only", func(t *testing.T) {
+		require.NoError(t, l.Close())
+		readOnly, err := OpenReadOnly(path)
+		require.NoError(t, err)
+		defer readOnly.Close()
+
+		totals, err := readOnly.Totals(time.Time{}, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, "1.75 USD", totals["USD"].String())
+		assert.Error(t, readOnly.Append(Entry{Timestamp: day(4)}))
+	})
+
+	t.Run("Invalid path", func(t *testing.T) {
+		_, err := Open("")
+		assert.Error(t, err)
+
+		_, err = OpenReadOnly(filepath.Join(t.TempDir(), "missing.db"))
+		assert.Error(t, err)
+	})
+}
+
+func TestStartOfMonth(t *testing.T) {
+	loc := time.FixedZone("test", -5*60*60)
+	assert.Equal(t,
+		time.Date(2024, time.October, 1, 0, 0, 0, 0, loc),
+		StartOfMonth(time.Date(2024, time.October, 19, 15, 4, 5, 0, loc)),
+	)
+}
@@ -0,0 +1,249 @@
+package addons
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/proxy/addons/backends"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// lbFlowState tracks the backends chosen for a single flow
+type lbFlowState struct {
+	snapshot   *requestSnapshot
+	candidates []*backends.Backend
+	current    int
+}
+
+// LoadBalancerAddon spreads requests for a logical model across several backends, and fails
+// over to the next backend when a backend returns an error or doesn't respond in time. Flows that
+// were already sent elsewhere by another routing addon are left alone.
+//
+// The first attempt for each request is sent by the RoutedSenderAddon, with the pool's timeout,
+// which answers with an error response when the backend can't be reached, so it's failed over too.
+type LoadBalancerAddon struct {
+	px.BaseAddon
+	pool   *backends.Pool
+	client *http.Client
+	routed *FlowRoutes
+	check  func(f *px.Flow) *px.Response // checks a failover request before it's sent, may be nil
+	flows  sync.Map                      // key: flow ID, value: *lbFlowState
+	closed atomic.Bool
+	wg     sync.WaitGroup
+}
+
+// isFailoverResponse returns true if the response should be counted as a backend failure
+func isFailoverResponse(resp *px.Response) bool {
+	if resp == nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// applyBackend rewrites the request, based on the original snapshot, to target the backend
+func applyBackend(req *px.Request, snapshot *requestSnapshot, backend *backends.Backend) error {
+	snapshot.restore(req)
+	req.URL = backend.TargetURL(snapshot.url)
+
+	if backend.APIKey != "" {
+		req.Header.Del("Authorization")
+		req.Header.Del("Api-Key")
+		req.Header.Set(backend.AuthHeader, backend.AuthHeaderValue())
+	}
+
+	if backend.Model != "" {
+		body, err := decodeRequestJSON(req)
+		if err != nil {
+			return err
+		}
+		body["model"] = backend.Model
+		if err := encodeRequestJSON(req, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lb *LoadBalancerAddon) Request(f *px.Flow) {
+	if lb.closed.Load() {
+		log.Warn("LoadBalancer is being closed, not routing request")
+		return
+	}
+	if f.Request == nil || f.Request.URL == nil || f.Request.Method != "POST" {
+		return
+	}
+
+	body, err := decodeRequestJSON(f.Request)
+	if err != nil {
+		log.Debugf("load balancer skipping request without a JSON body: %s", f.Request.URL)
+		return
+	}
+
+	model := requestModel(body)
+	if !lb.pool.HasModel(model) {
+		return
+	}
+	if !lb.routed.claim(f.Id, lb.String()) {
+		log.Debugf("load balancer skipping request already routed by %s: %s", lb.routed.routedBy(f.Id), f.Request.URL)
+		return
+	}
+
+	state := &lbFlowState{
+		snapshot:   newRequestSnapshot(f.Request),
+		candidates: lb.pool.Candidates(model, time.Now()),
+	}
+	if err := applyBackend(f.Request, state.snapshot, state.candidates[0]); err != nil {
+		log.Errorf("error routing request to backend %s: %v", state.candidates[0].Name, err)
+		state.snapshot.restore(f.Request)
+		lb.routed.release(f.Id)
+		return
+	}
+	log.Debugf("routing model %s to backend %s: %s", model, state.candidates[0].Name, f.Request.URL)
+	lb.routed.limit(f.Id, lb.String(), lb.pool.Timeout())
+	lb.flows.Store(f.Id, state)
+
+	lb.wg.Add(1) // for blocking this addon during shutdown in .Close()
+	go func() {
+		defer lb.wg.Done()
+		<-f.Done()
+		lb.flows.Delete(f.Id)
+		lb.routed.release(f.Id)
+	}()
+}
+
+// handleResponse fails over to the next backend when the response is an error, and puts back the
+// client's request
+func (lb *LoadBalancerAddon) handleResponse(f *px.Flow) {
+	value, found := lb.flows.Load(f.Id)
+	if !found {
+		return
+	}
+	state := value.(*lbFlowState)
+
+	backend := state.candidates[state.current]
+	if !isFailoverResponse(f.Response) {
+		backend.RecordSuccess()
+	} else {
+		backend.RecordFailure(time.Now())
+		lb.failover(f, state)
+	}
+
+	// put back the original request, so the cache and logs match what the client sent
+	state.snapshot.restore(f.Request)
+}
+
+// failover sends the request to the remaining backends, until one of them succeeds
+func (lb *LoadBalancerAddon) failover(f *px.Flow, state *lbFlowState) {
+	for state.current+1 < len(state.candidates) {
+		if lb.closed.Load() {
+			return
+		}
+		state.current++
+		backend := state.candidates[state.current]
+
+		if err := applyBackend(f.Request, state.snapshot, backend); err != nil {
+			log.Errorf("error routing request to backend %s: %v", backend.Name, err)
+			continue
+		}
+		if lb.check != nil && lb.check(f) != nil {
+			log.Warnf("not failing over to backend %s, the request is denied: %s", backend.Name, f.Request.URL)
+			continue
+		}
+		log.Infof("failing over to backend %s: %s", backend.Name, f.Request.URL)
+
+		ctx, cancel := context.WithTimeout(context.Background(), lb.pool.Timeout())
+		resp, err := sendUpstream(ctx, lb.client, f.Request)
+		cancel()
+		if err != nil {
+			log.Warnf("backend %s failed: %v", backend.Name, err)
+			backend.RecordFailure(time.Now())
+			continue
+		}
+
+		replaceResponse(f, resp)
+		if isFailoverResponse(resp) {
+			backend.RecordFailure(time.Now())
+			continue
+		}
+		backend.RecordSuccess()
+		return
+	}
+}
+
+// AddToLog returns the function that adds the name of the backend that answered the flow to the
+// log container, or nil when the flow wasn't load balanced. The backend is read after the flow is
+// done, when the failover has finished. Used with MegaDumpAddon.AddContainerModifier.
+func (lb *LoadBalancerAddon) AddToLog(f *px.Flow) func(*schema.LogDumpContainer) {
+	value, found := lb.flows.Load(f.Id)
+	if !found {
+		return nil
+	}
+	state := value.(*lbFlowState)
+	return func(container *schema.LogDumpContainer) {
+		if container.ConnectionStats != nil {
+			container.ConnectionStats.Backend = state.candidates[state.current].Name
+		}
+	}
+}
+
+// LogWith adds the backend of each flow to the log containers written by the dumper
+func (lb *LoadBalancerAddon) LogWith(dumper *MegaDumpAddon) {
+	dumper.AddContainerModifier(lb.AddToLog)
+}
+
+// CheckFailoverWith sets a check for the requests to the failover backends, e.g., the egress
+// policy. A backend is skipped when the check returns an error response.
+func (lb *LoadBalancerAddon) CheckFailoverWith(check func(f *px.Flow) *px.Response) {
+	lb.check = check
+}
+
+// ResponseAddon returns the part of this addon that handles the Response event, which must be
+// added to the proxy before the guardrails and the cache and logging addons, so they see the
+// response from the backend that the request failed over to
+func (lb *LoadBalancerAddon) ResponseAddon() px.Addon {
+	return &loadBalancerResponse{lb: lb}
+}
+
+func (lb *LoadBalancerAddon) String() string {
+	return "LoadBalancerAddon"
+}
+
+func (lb *LoadBalancerAddon) Close() error {
+	if !lb.closed.Swap(true) {
+		log.Debug("Waiting for LoadBalancer shutdown...")
+		lb.wg.Wait()
+	}
+	return nil
+}
+
+// loadBalancerResponse is the Response event handler for LoadBalancerAddon
+type loadBalancerResponse struct {
+	px.BaseAddon
+	lb *LoadBalancerAddon
+}
+
+func (r *loadBalancerResponse) Response(f *px.Flow) {
+	r.lb.handleResponse(f)
+}
+
+// NewLoadBalancerAddon creates a new load balancer addon from a JSON config file
+func NewLoadBalancerAddon(backendsFile string, skipVerifyTLS bool, routed *FlowRoutes) (*LoadBalancerAddon, error) {
+	pool, err := backends.NewPoolFromFile(backendsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	lb := &LoadBalancerAddon{
+		pool:   pool,
+		client: newUpstreamClient(skipVerifyTLS),
+		routed: routed,
+	}
+	lb.closed.Store(false) // initialize as open
+	return lb, nil
+}
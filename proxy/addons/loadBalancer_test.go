@@ -0,0 +1,198 @@
+package addons
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+func newTestLoadBalancer(t *testing.T, backendsJSON string) *LoadBalancerAddon {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "backends.json")
+	require.NoError(t, os.WriteFile(filePath, []byte(backendsJSON), 0644))
+
+	lb, err := NewLoadBalancerAddon(filePath, false, NewFlowRoutes())
+	require.NoError(t, err)
+	return lb
+}
+
+func newLoadBalancerTestFlow(t *testing.T, body string) *px.Flow {
+	t.Helper()
+	u, err := url.Parse("http://api.openai.com/v1/chat/completions")
+	require.NoError(t, err)
+	return &px.Flow{
+		Id: uuid.NewV4(),
+		Request: &px.Request{
+			Method: "POST",
+			URL:    u,
+			Header: http.Header{
+				"Authorization": []string{"Bearer sk-client"},
+				"Content-Type":  []string{"application/json"},
+			},
+			Body: []byte(body),
+		},
+	}
+}
+
+func TestLoadBalancerAddon_Failover(t *testing.T) {
+	failedHits := new(atomic.Int32)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failedHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+
+	var receivedAuth, receivedBody, receivedPath string
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedAuth = r.Header.Get("Authorization")
+		receivedPath = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		receivedBody = string(body)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	t.Cleanup(healthy.Close)
+
+	lb := newTestLoadBalancer(t, `{"models": [{"name": "gpt-4o", "backends": [
+		{"name": "primary", "url": "`+failing.URL+`/v1", "weight": 1000000},
+		{"name": "secondary", "url": "`+healthy.URL+`/v1", "api_key": "sk-secondary", "model": "gpt-4o-mini", "weight": 1}
+	]}]}`)
+
+	flow := newLoadBalancerTestFlow(t, `{"model":"gpt-4o","messages":[]}`)
+	lb.Request(flow)
+	require.Equal(t, failing.URL+"/v1/chat/completions", flow.Request.URL.String())
+
+	// simulate the proxy receiving an error from the primary backend
+	flow.Response = &px.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	lb.ResponseAddon().Response(flow)
+
+	assert.Equal(t, http.StatusOK, flow.Response.StatusCode)
+	assert.Equal(t, []byte(`{"ok": true}`), flow.Response.Body)
+	assert.Empty(t, flow.Response.Header.Get("X-Llm_proxy-Backend"))
+	container := &schema.LogDumpContainer{ConnectionStats: &schema.ConnectionStatsContainer{}}
+	lb.AddToLog(flow)(container)
+	assert.Equal(t, "secondary", container.ConnectionStats.Backend)
+	assert.Equal(t, "Bearer sk-secondary", receivedAuth)
+	assert.Equal(t, "/v1/chat/completions", receivedPath)
+	assert.JSONEq(t, `{"model":"gpt-4o-mini","messages":[]}`, receivedBody)
+
+	// the original request is restored after the response
+	assert.Equal(t, "http://api.openai.com/v1/chat/completions", flow.Request.URL.String())
+	assert.Equal(t, "Bearer sk-client", flow.Request.Header.Get("Authorization"))
+	assert.Equal(t, `{"model":"gpt-4o","messages":[]}`, string(flow.Request.Body))
+}
+
+func TestLoadBalancerAddon_FailoverFirstAttempt(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	t.Cleanup(healthy.Close)
+
+	tests := []struct {
+		name       string
+		primaryURL string
+	}{
+		{"timeout", slow.URL},
+		{"connection error", "http://127.0.0.1:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := newTestLoadBalancer(t, `{"timeout": "200ms", "models": [{"name": "gpt-4o", "backends": [
+				{"name": "primary", "url": "`+tt.primaryURL+`/v1", "weight": 1000000},
+				{"name": "secondary", "url": "`+healthy.URL+`/v1", "weight": 1}
+			]}]}`)
+			sender := NewRoutedSenderAddon(lb.routed, []px.Addon{lb.ResponseAddon()}, false)
+
+			flow := newLoadBalancerTestFlow(t, `{"model":"gpt-4o"}`)
+			lb.Request(flow)
+			assert.Equal(t, 200*time.Millisecond, lb.routed.timeout(flow.Id))
+
+			start := time.Now()
+			sender.Request(flow)
+			assert.Less(t, time.Since(start), 5*time.Second)
+
+			require.NotNil(t, flow.Response)
+			assert.Equal(t, http.StatusOK, flow.Response.StatusCode)
+			assert.Equal(t, []byte(`{"ok": true}`), flow.Response.Body)
+			container := &schema.LogDumpContainer{ConnectionStats: &schema.ConnectionStatsContainer{}}
+			lb.AddToLog(flow)(container)
+			assert.Equal(t, "secondary", container.ConnectionStats.Backend)
+		})
+	}
+}
+
+func TestLoadBalancerAddon_SkipsUnknownModels(t *testing.T) {
+	lb := newTestLoadBalancer(t, `{"models": [{"name": "gpt-4o", "backends": [{"url": "http://localhost:1/v1"}]}]}`)
+
+	flow := newLoadBalancerTestFlow(t, `{"model":"gpt-3.5-turbo"}`)
+	lb.Request(flow)
+	assert.Equal(t, "http://api.openai.com/v1/chat/completions", flow.Request.URL.String())
+
+	assert.Nil(t, lb.AddToLog(flow))
+}
+
+func TestLoadBalancerAddon_FailoverDenied(t *testing.T) {
+	hits := new(atomic.Int32)
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(secondary.Close)
+
+	lb := newTestLoadBalancer(t, `{"models": [{"name": "gpt-4o", "backends": [
+		{"name": "primary", "url": "http://localhost:1/v1", "weight": 1000000},
+		{"name": "secondary", "url": "`+secondary.URL+`/v1", "weight": 1}
+	]}]}`)
+	lb.CheckFailoverWith(func(f *px.Flow) *px.Response {
+		return newErrorResponse(http.StatusForbidden, "policy_violation", "egress_denied", "denied")
+	})
+
+	flow := newLoadBalancerTestFlow(t, `{"model":"gpt-4o"}`)
+	lb.Request(flow)
+	flow.Response = &px.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	lb.ResponseAddon().Response(flow)
+
+	assert.Equal(t, http.StatusServiceUnavailable, flow.Response.StatusCode)
+	assert.Zero(t, hits.Load())
+}
+
+func TestLoadBalancerAddon_SkipsRoutedFlows(t *testing.T) {
+	lb := newTestLoadBalancer(t, `{"models": [{"name": "gpt-4o", "backends": [{"url": "http://localhost:1/v1"}]}]}`)
+
+	flow := newLoadBalancerTestFlow(t, `{"model":"gpt-4o"}`)
+	require.True(t, lb.routed.claim(flow.Id, "LocalRouteAddon"))
+	lb.Request(flow)
+	assert.Equal(t, "http://api.openai.com/v1/chat/completions", flow.Request.URL.String())
+	assert.Equal(t, "LocalRouteAddon", lb.routed.routedBy(flow.Id))
+
+	flow.Response = &px.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	lb.ResponseAddon().Response(flow)
+	assert.Equal(t, http.StatusServiceUnavailable, flow.Response.StatusCode)
+	assert.Nil(t, lb.AddToLog(flow))
+}
+
+func TestNewLoadBalancerAddon_Error(t *testing.T) {
+	_, err := NewLoadBalancerAddon(filepath.Join(t.TempDir(), "missing.json"), false, NewFlowRoutes())
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package addons
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/proxy/addons/routes"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// localRoute is the state kept between the request and the response of a routed flow
+type localRoute struct {
+	snapshot *requestSnapshot
+}
+
+// LocalRouteAddon sends the requests matching the local routes to a local OpenAI-compatible
+// server, e.g., Ollama, llama.cpp, or vLLM, instead of the original upstream. The client's API
+// keys are removed, so the clients don't need to change anything to use a local model.
+//
+// The addon has two parts, the same as AnthropicTranslatorAddon: the Request event must run after
+// the cache addon, so the cache key is the client's request, and the Response event (from
+// ResponseAddon) must run before the cache and logging addons, so they see the client's request.
+// The responses are priced at the rule's internal rate, which is free by default. The routed
+// requests are sent by the RoutedSenderAddon, so https targets on another host work over TLS too.
+type LocalRouteAddon struct {
+	px.BaseAddon
+	rules  *routes.RuleSet
+	routed *FlowRoutes
+	flows  sync.Map // key: flow ID, value: *localRoute
+	closed atomic.Bool
+	wg     sync.WaitGroup
+}
+
+// removeAuthHeaders deletes the client's API keys, which are for the original upstream
+func removeAuthHeaders(req *px.Request) {
+	for _, headers := range [][]string{openAIOnlyHeaders, shadowAuthHeaders} {
+		for _, name := range headers {
+			req.Header.Del(name)
+		}
+	}
+}
+
+func (a *LocalRouteAddon) Request(f *px.Flow) {
+	if a.closed.Load() {
+		log.Warn("LocalRouteAddon is being closed, not routing request")
+		return
+	}
+	if f.Response != nil || f.Request == nil || f.Request.URL == nil {
+		// already answered, e.g., from the cache
+		return
+	}
+
+	body, _ := decodeRequestJSON(f.Request) // nil for requests without a JSON body, e.g., listing models
+	req := routes.Request{
+		Host:  f.Request.URL.Hostname(),
+		Path:  f.Request.URL.Path,
+		Model: requestModel(body),
+		Tags:  requestTags(f.Request),
+	}
+	rule := a.rules.Find(req)
+	if rule == nil {
+		return
+	}
+	if !a.routed.claim(f.Id, a.String()) {
+		log.Debugf("local route %s: skipping request already routed by %s", rule.Name, a.routed.routedBy(f.Id))
+		return
+	}
+
+	state := &localRoute{snapshot: newRequestSnapshot(f.Request)}
+	if rule.Model != "" && body != nil {
+		body["model"] = rule.Model
+		if err := encodeRequestJSON(f.Request, body); err != nil {
+			log.Errorf("error encoding routed request, sending to the original upstream: %v", err)
+			state.snapshot.restore(f.Request)
+			a.routed.release(f.Id)
+			return
+		}
+	}
+	f.Request.URL = rule.TargetURL(state.snapshot.url)
+	removeAuthHeaders(f.Request)
+	if rule.APIKey != "" {
+		f.Request.Header.Set("Authorization", "Bearer "+rule.APIKey)
+	}
+	log.Debugf("local route %s: sending request for model %q to: %s", rule.Name, req.Model, f.Request.URL)
+	rate := rule.Rate()
+	a.routed.record(f.Id, a.String(), schema.Route{Upstream: f.Request.URL.String(), Rate: &rate})
+	a.flows.Store(f.Id, state)
+
+	a.wg.Add(1) // for blocking this addon during shutdown in .Close()
+	go func() {
+		defer a.wg.Done()
+		<-f.Done()
+		a.flows.Delete(f.Id) // normally removed in the Response event, unless the upstream connection failed
+		a.routed.release(f.Id)
+	}()
+}
+
+// restoreRequest puts back the client's request, so the cache and logs match what the client sent
+func (a *LocalRouteAddon) restoreRequest(f *px.Flow) {
+	value, found := a.flows.LoadAndDelete(f.Id)
+	if !found {
+		return
+	}
+	value.(*localRoute).snapshot.restore(f.Request)
+}
+
+// ResponseAddon returns the part of this addon that handles the Response event, which must be
+// added to the proxy before the cache and logging addons
+func (a *LocalRouteAddon) ResponseAddon() px.Addon {
+	return &localRouteResponse{router: a}
+}
+
+func (a *LocalRouteAddon) String() string {
+	return "LocalRouteAddon"
+}
+
+func (a *LocalRouteAddon) Close() error {
+	if !a.closed.Swap(true) {
+		log.Debug("Waiting for LocalRouteAddon shutdown...")
+		a.wg.Wait()
+	}
+	return nil
+}
+
+// localRouteResponse is the Response event handler for LocalRouteAddon
+type localRouteResponse struct {
+	px.BaseAddon
+	router *LocalRouteAddon
+}
+
+func (r *localRouteResponse) Response(f *px.Flow) {
+	r.router.restoreRequest(f)
+}
+
+// NewLocalRouteAddon creates a new addon that sends the requests matching the rules in the local
+// routes JSON file to local OpenAI-compatible servers
+func NewLocalRouteAddon(routesFile string, routed *FlowRoutes) (*LocalRouteAddon, error) {
+	rules, err := routes.NewRuleSetFromFile(routesFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules.Rules) == 0 {
+		return nil, fmt.Errorf("no local routes defined in: %s", routesFile)
+	}
+
+	a := &LocalRouteAddon{rules: rules, routed: routed}
+	a.closed.Store(false) // initialize as open
+	return a, nil
+}
@@ -0,0 +1,143 @@
+package addons
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+func newLocalRouteTestAddon(t *testing.T, content string) *LocalRouteAddon {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "routes.json")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	router, err := NewLocalRouteAddon(filePath, NewFlowRoutes())
+	require.NoError(t, err)
+	return router
+}
+
+func TestNewLocalRouteAddon(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "routes.json")
+	require.NoError(t, os.WriteFile(filePath, []byte(`{"rules": []}`), 0644))
+	_, err := NewLocalRouteAddon(filePath, NewFlowRoutes())
+	require.ErrorContains(t, err, "no local routes defined")
+
+	_, err = NewLocalRouteAddon(filepath.Join(t.TempDir(), "missing.json"), NewFlowRoutes())
+	require.ErrorContains(t, err, "failed to read local routes file")
+}
+
+func TestLocalRouteAddon(t *testing.T) {
+	router := newLocalRouteTestAddon(t, `{"rules": [
+		{"name": "ollama", "match": {"models": ["llama*"]}, "url": "http://localhost:11434/v1"},
+		{
+			"name": "vllm", "match": {"tags": ["local"]}, "url": "http://gpu-box:8000/v1", "model": "qwen2.5-7b",
+			"api_key": "internal-key", "input_token_cost": "0.0000001", "output_token_cost": "0.0000002"
+		}
+	]}`)
+	assert.Equal(t, "LocalRouteAddon", router.String())
+	responseAddon := router.ResponseAddon()
+
+	t.Run("not matched", func(t *testing.T) {
+		body := `{"model": "gpt-4o", "messages": []}`
+		flow := newTranslatorTestFlow(t, body)
+		router.Request(flow)
+		assert.Equal(t, "https://api.openai.com/v1/chat/completions", flow.Request.URL.String())
+		assert.Equal(t, "Bearer sk-ant-client", flow.Request.Header.Get("Authorization"))
+
+		flow.Response = &px.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+		responseAddon.Response(flow)
+		assert.Equal(t, schema.Route{}, router.routed.route(flow.Id))
+	})
+
+	t.Run("answered from the cache", func(t *testing.T) {
+		flow := newTranslatorTestFlow(t, `{"model": "llama3.1", "messages": []}`)
+		flow.Response = &px.Response{StatusCode: http.StatusOK}
+		router.Request(flow)
+		assert.Equal(t, "api.openai.com", flow.Request.URL.Host)
+	})
+
+	t.Run("routed by model", func(t *testing.T) {
+		body := `{"model": "llama3.1:8b", "messages": [{"role": "user", "content": "hi"}]}`
+		flow := newTranslatorTestFlow(t, body)
+		router.Request(flow)
+
+		assert.Equal(t, "http://localhost:11434/v1/chat/completions", flow.Request.URL.String())
+		assert.Empty(t, flow.Request.Header.Get("Authorization"))
+		assert.Empty(t, flow.Request.Header.Get("Openai-Organization"))
+		assert.Equal(t, body, string(flow.Request.Body))
+
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       []byte(`{"model": "llama3.1:8b", "usage": {"prompt_tokens": 1000000, "completion_tokens": 1000000}}`),
+		}
+		responseAddon.Response(flow)
+
+		// the original request is restored for the cache and logging addons
+		assert.Equal(t, "https://api.openai.com/v1/chat/completions", flow.Request.URL.String())
+		assert.Equal(t, "Bearer sk-ant-client", flow.Request.Header.Get("Authorization"))
+		route := router.routed.route(flow.Id)
+		assert.Equal(t, "http://localhost:11434/v1/chat/completions", route.Upstream)
+		require.NotNil(t, route.Rate)
+		assert.Equal(t, "0 0 USD", route.Rate.String())
+		assert.Empty(t, flow.Response.Header.Get("X-Llm_proxy-Upstream")) // the route isn't sent to the client
+
+		_, found := router.flows.Load(flow.Id)
+		assert.False(t, found)
+
+		// priced as free, instead of an unknown model
+		req, err := schema.NewProxyRequestFromMITMRequest(flow.Request, []string{})
+		require.NoError(t, err)
+		resp, err := schema.NewProxyResponseFromMITMResponse(flow.Response, []string{})
+		require.NoError(t, err)
+		auditOutput, err := schema.NewCostCounterDefaults().AddRouted(*req, *resp, 0, route)
+		require.NoError(t, err)
+		assert.Equal(t, "$0.00", auditOutput.TotalReqCost)
+	})
+
+	t.Run("routed by tag with a model and internal rate", func(t *testing.T) {
+		body := `{"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "hi"}]}`
+		flow := newTranslatorTestFlow(t, body)
+		flow.Request.Header.Set(RequestTagsHeader, "team-a, local")
+		router.Request(flow)
+
+		assert.Equal(t, "http://gpu-box:8000/v1/chat/completions", flow.Request.URL.String())
+		assert.Equal(t, "Bearer internal-key", flow.Request.Header.Get("Authorization"))
+		assert.JSONEq(t, `{"model": "qwen2.5-7b", "messages": [{"role": "user", "content": "hi"}]}`, string(flow.Request.Body))
+		assert.Equal(t, strconv.Itoa(len(flow.Request.Body)), flow.Request.Header.Get("Content-Length"))
+
+		flow.Response = &px.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       []byte(`{"usage": {"prompt_tokens": 1000000, "completion_tokens": 1000000}}`),
+		}
+		responseAddon.Response(flow)
+		assert.Equal(t, body, string(flow.Request.Body))
+		route := router.routed.route(flow.Id)
+		require.NotNil(t, route.Rate)
+		assert.Equal(t, "0.0000001 0.0000002 USD", route.Rate.String())
+
+		req, err := schema.NewProxyRequestFromMITMRequest(flow.Request, []string{})
+		require.NoError(t, err)
+		resp, err := schema.NewProxyResponseFromMITMResponse(flow.Response, []string{})
+		require.NoError(t, err)
+		auditOutput, err := schema.NewCostCounterDefaults().AddRouted(*req, *resp, 0, route)
+		require.NoError(t, err)
+		assert.Equal(t, "$0.30", auditOutput.TotalReqCost)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		closed := newLocalRouteTestAddon(t, `{"rules": [{"match": {"models": ["llama*"]}, "url": "http://localhost:11434/v1"}]}`)
+		require.NoError(t, closed.Close())
+		flow := newTranslatorTestFlow(t, `{"model": "llama3.1", "messages": []}`)
+		closed.Request(flow)
+		assert.Equal(t, "api.openai.com", flow.Request.URL.Host)
+	})
+}
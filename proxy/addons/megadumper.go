@@ -16,6 +16,17 @@ import (
 	"github.com/proxati/llm_proxy/schema"
 )
 
+// ContainerModifier is called in the Responseheaders event of a flow, and returns a function that
+// modifies the flow's log container before it's written, or nil. The returned function runs after
+// the flow is done, and may block until the addon's record is ready.
+type ContainerModifier func(*px.Flow) func(*schema.LogDumpContainer)
+
+// flowCapture is the per-flow state that is read before the flow is done, for its log container
+type flowCapture struct {
+	route     schema.Route
+	modifiers []func(*schema.LogDumpContainer)
+}
+
 type MegaDumpAddon struct {
 	px.BaseAddon
 	formatter         formatters.MegaDumpFormatter
@@ -23,6 +34,9 @@ type MegaDumpAddon struct {
 	writers           []writers.MegaDumpWriter
 	filterReqHeaders  []string
 	filterRespHeaders []string
+	modifiers         []ContainerModifier // called in the Responseheaders event of each flow
+	routed            *FlowRoutes         // where the routing addons sent each flow, may be nil
+	captured          sync.Map            // key: flow ID, value: *flowCapture, kept until the flow is logged
 	wg                sync.WaitGroup
 	closed            atomic.Bool
 }
@@ -42,6 +56,10 @@ func (d *MegaDumpAddon) Requestheaders(f *px.Flow) {
 		defer d.wg.Done()
 		<-f.Done()
 		doneAt := time.Since(start).Milliseconds()
+		capture := &flowCapture{}
+		if value, found := d.captured.LoadAndDelete(f.Id); found {
+			capture = value.(*flowCapture)
+		}
 
 		// load the selected fields into a container object
 		dumpContainer, err := schema.NewLogDumpContainer(f, d.logSources, doneAt, d.filterReqHeaders, d.filterRespHeaders)
@@ -50,6 +68,14 @@ func (d *MegaDumpAddon) Requestheaders(f *px.Flow) {
 			return
 		}
 
+		if dumpContainer.ConnectionStats != nil {
+			dumpContainer.ConnectionStats.SetRoute(capture.route)
+		}
+
+		for _, modifier := range capture.modifiers {
+			modifier(dumpContainer)
+		}
+
 		id := f.Id.String() // TODO: is the internal request ID unique enough?
 
 		// format the container object, reformatted into a byte array
@@ -74,6 +100,32 @@ func (d *MegaDumpAddon) Requestheaders(f *px.Flow) {
 	}()
 }
 
+// Responseheaders keeps the route of the flow, and the records of the other addons, for the log,
+// because they are released by those addons when the flow is done
+func (d *MegaDumpAddon) Responseheaders(f *px.Flow) {
+	capture := &flowCapture{route: d.routed.route(f.Id)}
+	for _, modifier := range d.modifiers {
+		if m := modifier(f); m != nil {
+			capture.modifiers = append(capture.modifiers, m)
+		}
+	}
+	if capture.route.Upstream != "" || len(capture.modifiers) > 0 {
+		d.captured.Store(f.Id, capture)
+	}
+}
+
+// LogRoutesFrom sets the routing record, so the logs show where the routing addons sent each flow
+func (d *MegaDumpAddon) LogRoutesFrom(routed *FlowRoutes) {
+	d.routed = routed
+}
+
+// AddContainerModifier adds a modifier for each log container, for addons that add their own
+// records to the log, e.g., the ShadowAddon. Flows without a response, e.g., when the upstream
+// connection failed, are logged without those records.
+func (d *MegaDumpAddon) AddContainerModifier(modifier ContainerModifier) {
+	d.modifiers = append(d.modifiers, modifier)
+}
+
 func (d *MegaDumpAddon) String() string {
 	return "MegaDirDumper"
 }
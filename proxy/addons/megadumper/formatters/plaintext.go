@@ -35,6 +35,16 @@ func (pt *PlainText) flatten() ([]byte, error) {
 		buf.WriteString("\r\n")
 	}
 
+	if pt.container.Shadow != nil && pt.container.Shadow.Response != nil {
+		if pt.container.Shadow.Response.Header != nil {
+			buf.WriteString(pt.container.Shadow.Response.HeaderString())
+		}
+		if pt.container.Shadow.Response.Body != "" {
+			buf.WriteString(pt.container.Shadow.Response.Body)
+			buf.WriteString("\r\n")
+		}
+	}
+
 	return buf.Bytes(), nil
 
 }
@@ -0,0 +1,51 @@
+package writers
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/proxati/llm_proxy/fileUtils"
+)
+
+// ToLines appends each record as a single line to a file that stays open, for JSON lines logs
+type ToLines struct {
+	targetFileName string
+	file           *os.File
+	mutex          sync.Mutex
+}
+
+// Write appends the bytes and a newline to the file, the identifier is ignored
+func (t *ToLines) Write(identifier string, bytes []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	line := make([]byte, 0, len(bytes)+1)
+	line = append(line, bytes...)
+	line = append(line, '\n')
+	return t.file.Write(line)
+}
+
+// Close closes the underlying file
+func (t *ToLines) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.file.Close()
+}
+
+// NewToLines opens (or creates) a file for appending, creating the parent directory if needed
+func NewToLines(target string) (*ToLines, error) {
+	if err := fileUtils.DirExistsOrCreate(filepath.Dir(target)); err != nil {
+		return nil, err
+	}
+
+	f, err := fileUtils.CreateNewFileFromFilename(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ToLines{
+		targetFileName: target,
+		file:           f,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package writers_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/proxati/llm_proxy/proxy/addons/megadumper/writers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToLines_Write(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "subdir", "audit.jsonl")
+
+	toLines, err := writers.NewToLines(target)
+	require.NoError(t, err)
+
+	_, err = toLines.Write("a", []byte(`{"n":1}`))
+	assert.NoError(t, err)
+	n, err := toLines.Write("b", []byte(`{"n":2}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 8, n)
+	require.NoError(t, toLines.Close())
+
+	// reopening the file appends to the existing content
+	toLines, err = writers.NewToLines(target)
+	require.NoError(t, err)
+	_, err = toLines.Write("c", []byte(`{"n":3}`))
+	assert.NoError(t, err)
+	require.NoError(t, toLines.Close())
+
+	fileData, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "{\"n\":1}\n{\"n\":2}\n{\"n\":3}\n", string(fileData))
+}
@@ -0,0 +1,301 @@
+// Package mock answers LLM API requests locally, from a directory of fixtures, or with generated
+// responses that have the same shape as the real APIs.
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Request holds the request fields that are checked by the fixture matchers
+type Request struct {
+	URL  string // without the query string, e.g., "https://api.openai.com/v1/chat/completions"
+	Path string
+	Body []byte // decoded JSON, or empty
+}
+
+// Match selects the requests that a fixture answers. Every field that is set must match, and an
+// empty match answers every request.
+type Match struct {
+	URL             string          `json:"url,omitempty"`               // glob pattern, "*" matches any characters
+	Body            json.RawMessage `json:"body,omitempty"`              // the request body is the same JSON value
+	BodySubset      json.RawMessage `json:"body_subset,omitempty"`       // every field in this object is in the request body
+	LastUserMessage string          `json:"last_user_message,omitempty"` // regex for the text of the last user message
+
+	urlPattern  *regexp.Regexp
+	body        any
+	bodySubset  any
+	userMessage *regexp.Regexp
+}
+
+// globToRegexp converts a glob pattern, where "*" matches any characters, to an anchored regex
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// decodeJSON parses a JSON value with numbers kept as json.Number, so they compare exactly
+func decodeJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (m *Match) validate() (err error) {
+	if m.URL != "" {
+		if m.urlPattern, err = globToRegexp(m.URL); err != nil {
+			return fmt.Errorf("invalid url pattern %q: %w", m.URL, err)
+		}
+	}
+	if len(m.Body) > 0 {
+		if m.body, err = decodeJSON(m.Body); err != nil {
+			return fmt.Errorf("invalid body: %w", err)
+		}
+	}
+	if len(m.BodySubset) > 0 {
+		if m.bodySubset, err = decodeJSON(m.BodySubset); err != nil {
+			return fmt.Errorf("invalid body_subset: %w", err)
+		}
+	}
+	if m.LastUserMessage != "" {
+		if m.userMessage, err = regexp.Compile(m.LastUserMessage); err != nil {
+			return fmt.Errorf("invalid last_user_message pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+// isSubset returns true if every field in the subset is in the value. Objects can have extra
+// fields, arrays must be the same length and each element is compared as a subset.
+func isSubset(subset, value any) bool {
+	switch s := subset.(type) {
+	case map[string]any:
+		v, ok := value.(map[string]any)
+		if !ok {
+			return false
+		}
+		for key, sub := range s {
+			if field, found := v[key]; !found || !isSubset(sub, field) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		v, ok := value.([]any)
+		if !ok || len(v) != len(s) {
+			return false
+		}
+		for i := range s {
+			if !isSubset(s[i], v[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(subset, value)
+	}
+}
+
+// matches returns true if the request matches all of the fields
+func (m *Match) matches(req Request) bool {
+	if m.urlPattern != nil && !m.urlPattern.MatchString(req.URL) {
+		return false
+	}
+	if m.body == nil && m.bodySubset == nil && m.userMessage == nil {
+		return true
+	}
+
+	body, err := decodeJSON(req.Body)
+	if err != nil {
+		return false
+	}
+	if m.body != nil && !reflect.DeepEqual(m.body, body) {
+		return false
+	}
+	if m.bodySubset != nil && !isSubset(m.bodySubset, body) {
+		return false
+	}
+	if m.userMessage != nil {
+		text, found := lastUserMessage(body)
+		if !found || !m.userMessage.MatchString(text) {
+			return false
+		}
+	}
+	return true
+}
+
+// lastUserMessage returns the text of the last message with the user role, from a chat
+// completions or Anthropic messages request. Content parts are joined with newlines.
+func lastUserMessage(body any) (string, bool) {
+	bodyMap, ok := body.(map[string]any)
+	if !ok {
+		return "", false
+	}
+	messages, _ := bodyMap["messages"].([]any)
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg, ok := messages[i].(map[string]any)
+		if !ok || msg["role"] != "user" {
+			continue
+		}
+		switch content := msg["content"].(type) {
+		case string:
+			return content, true
+		case []any:
+			texts := make([]string, 0, len(content))
+			for _, part := range content {
+				if partMap, ok := part.(map[string]any); ok {
+					if text, ok := partMap["text"].(string); ok {
+						texts = append(texts, text)
+					}
+				}
+			}
+			return strings.Join(texts, "\n"), true
+		}
+	}
+	return "", false
+}
+
+// Response is the canned response for a fixture. Body is sent as JSON, and Stream is sent as a
+// text/event-stream, one data event per element, followed by "data: [DONE]".
+type Response struct {
+	Status  int               `json:"status,omitempty"` // defaults to 200
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Stream  []json.RawMessage `json:"stream,omitempty"`
+}
+
+func (r *Response) validate() error {
+	if len(r.Body) > 0 && len(r.Stream) > 0 {
+		return fmt.Errorf("only one of body or stream can be set")
+	}
+	if len(r.Body) > 0 && !json.Valid(r.Body) {
+		return fmt.Errorf("invalid response body")
+	}
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	return nil
+}
+
+// Encode returns the response headers and body
+func (r *Response) Encode() (http.Header, []byte) {
+	header := http.Header{}
+	var body []byte
+	if len(r.Stream) > 0 {
+		header.Set("Content-Type", "text/event-stream")
+		buf := &bytes.Buffer{}
+		for _, event := range r.Stream {
+			buf.WriteString("data: ")
+			buf.Write(compactJSON(event))
+			buf.WriteString("\n\n")
+		}
+		buf.WriteString("data: [DONE]\n\n")
+		body = buf.Bytes()
+	} else {
+		header.Set("Content-Type", "application/json")
+		body = r.Body
+	}
+	for key, value := range r.Headers {
+		header.Set(key, value)
+	}
+	return header, body
+}
+
+// compactJSON removes the whitespace from a JSON value, so each stream event is a single line
+func compactJSON(data []byte) []byte {
+	buf := &bytes.Buffer{}
+	if err := json.Compact(buf, data); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
+
+// Fixture is a canned response for the requests that match it, loaded from a JSON file
+type Fixture struct {
+	Name     string   `json:"name"` // defaults to the file name
+	Match    Match    `json:"match"`
+	Response Response `json:"response"`
+}
+
+func (f *Fixture) validate() error {
+	if err := f.Match.validate(); err != nil {
+		return err
+	}
+	return f.Response.validate()
+}
+
+// Fixtures is an ordered list of fixtures, the first one that matches a request answers it
+type Fixtures struct {
+	Fixtures []Fixture
+}
+
+// Find returns the first fixture that matches the request, or nil
+func (fs *Fixtures) Find(req Request) *Fixture {
+	for i := range fs.Fixtures {
+		if fs.Fixtures[i].Match.matches(req) {
+			return &fs.Fixtures[i]
+		}
+	}
+	return nil
+}
+
+// LoadFixtures reads the JSON files in a directory, sorted by file name. Each file is a single
+// fixture, or a list of fixtures.
+func LoadFixtures(dir string) (*Fixtures, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing fixture files: %w", err)
+	}
+	sort.Strings(files)
+
+	fs := &Fixtures{Fixtures: make([]Fixture, 0, len(files))}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading fixture file: %w", err)
+		}
+
+		fixtures := make([]Fixture, 0, 1)
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(data, &fixtures)
+		} else {
+			fixture := Fixture{}
+			err = json.Unmarshal(data, &fixture)
+			fixtures = append(fixtures, fixture)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing fixture file %s: %w", file, err)
+		}
+
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		for i := range fixtures {
+			fixture := &fixtures[i]
+			if fixture.Name == "" {
+				fixture.Name = name
+				if len(fixtures) > 1 {
+					fixture.Name = fmt.Sprintf("%s-%d", name, i)
+				}
+			}
+			if err := fixture.validate(); err != nil {
+				return nil, fmt.Errorf("invalid fixture %s in %s: %w", fixture.Name, file, err)
+			}
+		}
+		fs.Fixtures = append(fs.Fixtures, fixtures...)
+	}
+	return fs, nil
+}
@@ -0,0 +1,161 @@
+package mock
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const chatURL = "https://api.openai.com/v1/chat/completions"
+
+func writeFixtures(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestLoadFixtures(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		expectedNames []string
+		expectedErr   string
+	}{
+		{
+			name: "single and list files, sorted by name",
+			files: map[string]string{
+				"b.json": `[{"response": {"body": {}}}, {"name": "named", "response": {"status": 500}}]`,
+				"a.json": `{"match": {"url": "*"}, "response": {"body": {}}}`,
+				"c.txt":  `not a fixture`,
+			},
+			expectedNames: []string{"a", "b-0", "named"},
+		},
+		{
+			name:        "invalid json",
+			files:       map[string]string{"a.json": `{`},
+			expectedErr: "error parsing fixture file",
+		},
+		{
+			name:        "bad regex",
+			files:       map[string]string{"a.json": `{"match": {"last_user_message": "("}}`},
+			expectedErr: "invalid fixture a",
+		},
+		{
+			name:        "body and stream",
+			files:       map[string]string{"a.json": `{"response": {"body": {}, "stream": [{}]}}`},
+			expectedErr: "only one of body or stream can be set",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fixtures, err := LoadFixtures(writeFixtures(t, tc.files))
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			names := make([]string, 0, len(fixtures.Fixtures))
+			for _, fixture := range fixtures.Fixtures {
+				names = append(names, fixture.Name)
+				assert.NotZero(t, fixture.Response.Status, "status defaults to 200")
+			}
+			assert.Equal(t, tc.expectedNames, names)
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := writeFixtures(t, map[string]string{
+		"1-exact.json":   `{"match": {"url": "` + chatURL + `", "body": {"model": "gpt-4o", "messages": []}}}`,
+		"2-subset.json":  `{"match": {"body_subset": {"model": "gpt-4o-mini", "messages": [{"role": "system"}, {}]}}}`,
+		"3-message.json": `{"match": {"url": "*/chat/*", "last_user_message": "(?i)weather"}}`,
+		"4-embed.json":   `{"match": {"url": "https://api.openai.com/v1/embeddings"}}`,
+	})
+	fixtures, err := LoadFixtures(dir)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		url      string
+		body     string
+		expected string
+	}{
+		{
+			name:     "exact body, different key order and whitespace",
+			url:      chatURL,
+			body:     `{"messages": [], "model":"gpt-4o"}`,
+			expected: "1-exact",
+		},
+		{
+			name: "exact body with an extra field",
+			url:  chatURL,
+			body: `{"model": "gpt-4o", "messages": [], "temperature": 0}`,
+		},
+		{
+			name:     "subset",
+			url:      chatURL,
+			body:     `{"model": "gpt-4o-mini", "temperature": 1, "messages": [{"role": "system", "content": "x"}, {"role": "user"}]}`,
+			expected: "2-subset",
+		},
+		{
+			name: "subset with a different array length",
+			url:  chatURL,
+			body: `{"model": "gpt-4o-mini", "messages": [{"role": "system"}]}`,
+		},
+		{
+			name:     "last user message",
+			url:      chatURL,
+			body:     `{"messages": [{"role": "user", "content": "Hello"}, {"role": "assistant", "content": "Hi"}, {"role": "user", "content": [{"type": "text", "text": "What's the Weather?"}]}]}`,
+			expected: "3-message",
+		},
+		{
+			name: "only an earlier user message matches",
+			url:  chatURL,
+			body: `{"messages": [{"role": "user", "content": "weather"}, {"role": "user", "content": "Hello"}]}`,
+		},
+		{
+			name:     "url only",
+			url:      "https://api.openai.com/v1/embeddings",
+			expected: "4-embed",
+		},
+		{
+			name: "url without a match",
+			url:  "https://api.openai.com/v1/models",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fixture := fixtures.Find(Request{URL: tc.url, Body: []byte(tc.body)})
+			if tc.expected == "" {
+				assert.Nil(t, fixture)
+				return
+			}
+			require.NotNil(t, fixture)
+			assert.Equal(t, tc.expected, fixture.Name)
+		})
+	}
+}
+
+func TestResponseEncode(t *testing.T) {
+	resp := &Response{Body: []byte(`{"id": "1"}`), Headers: map[string]string{"X-Test": "yes"}}
+	header, body := resp.Encode()
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "yes", header.Get("X-Test"))
+	assert.Equal(t, `{"id": "1"}`, string(body))
+
+	resp = &Response{Stream: []json.RawMessage{[]byte("{\n  \"id\": 1\n}"), []byte(`{"id": 2}`)}}
+	header, body = resp.Encode()
+	assert.Equal(t, "text/event-stream", header.Get("Content-Type"))
+	assert.Equal(t, "data: {\"id\":1}\n\ndata: {\"id\":2}\n\ndata: [DONE]\n\n", string(body))
+}
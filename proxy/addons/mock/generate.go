@@ -0,0 +1,246 @@
+package mock
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+	"github.com/proxati/llm_proxy/schema/providers/openai_com"
+)
+
+// GeneratedContent is the assistant message in generated chat completions
+const GeneratedContent = "This is a mock response from llm_proxy."
+
+const (
+	defaultDimensions = 1536
+	largeDimensions   = 3072 // text-embedding-3-large
+)
+
+// generatedIDs numbers the generated responses, so each one has a unique ID
+var generatedIDs atomic.Int64
+
+// Generate returns a response for a request that doesn't match a fixture. Chat completions,
+// streamed chat completions, and embeddings are generated, with usage counted the same way as
+// the API auditor estimates it. Other endpoints return nil.
+func Generate(req Request) (*Response, error) {
+	switch {
+	case strings.HasSuffix(req.Path, "/chat/completions"):
+		return generateChatCompletion(req.Body)
+	case strings.HasSuffix(req.Path, "/embeddings"):
+		return generateEmbeddings(req.Body)
+	default:
+		return nil, nil
+	}
+}
+
+// marshalResponse encodes a generated response body
+func marshalResponse(value any) (*Response, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding generated response: %w", err)
+	}
+	return &Response{Status: 200, Body: body}, nil
+}
+
+func generateChatCompletion(body []byte) (*Response, error) {
+	bodyStr := string(body)
+	chatReq, err := openai_com.NewOpenAIChatCompletionRequest(&bodyStr)
+	if err != nil {
+		return nil, err
+	}
+	estimate, err := (&openai_com.Provider{}).EstimateRequest(bodyStr)
+	if err != nil {
+		return nil, err
+	}
+
+	choices := max(chatReq.N, 1)
+	usage := openai.Usage{
+		PromptTokens:     estimate.InputTokens,
+		CompletionTokens: choices * providers.CountTokens(chatReq.Model, GeneratedContent),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	id := fmt.Sprintf("chatcmpl-mock-%d", generatedIDs.Add(1))
+	created := time.Now().Unix()
+	if chatReq.Stream {
+		return generateChatStream(chatReq, id, created, choices, usage)
+	}
+
+	resp := openai.ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   chatReq.Model,
+		Usage:   usage,
+	}
+	for i := 0; i < choices; i++ {
+		resp.Choices = append(resp.Choices, openai.ChatCompletionChoice{
+			Index:        i,
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: GeneratedContent},
+			FinishReason: openai.FinishReasonStop,
+		})
+	}
+	return marshalResponse(resp)
+}
+
+// generateChatStream returns the chunks of a streamed chat completion: the role, one chunk for
+// each word of the content, the finish reason, and the usage when it was requested
+func generateChatStream(chatReq *openai.ChatCompletionRequest, id string, created int64, choices int, usage openai.Usage) (*Response, error) {
+	chunks := make([]openai.ChatCompletionStreamResponse, 0)
+	chunk := func(index int, delta openai.ChatCompletionStreamChoiceDelta, finishReason openai.FinishReason) {
+		chunks = append(chunks, openai.ChatCompletionStreamResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   chatReq.Model,
+			Choices: []openai.ChatCompletionStreamChoice{{Index: index, Delta: delta, FinishReason: finishReason}},
+		})
+	}
+
+	for i := 0; i < choices; i++ {
+		chunk(i, openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "")
+		for j, word := range strings.Fields(GeneratedContent) {
+			if j > 0 {
+				word = " " + word
+			}
+			chunk(i, openai.ChatCompletionStreamChoiceDelta{Content: word}, "")
+		}
+		chunk(i, openai.ChatCompletionStreamChoiceDelta{}, openai.FinishReasonStop)
+	}
+	if chatReq.StreamOptions != nil && chatReq.StreamOptions.IncludeUsage {
+		chunks = append(chunks, openai.ChatCompletionStreamResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   chatReq.Model,
+			Choices: []openai.ChatCompletionStreamChoice{},
+			Usage:   &usage,
+		})
+	}
+
+	resp := &Response{Status: 200, Stream: make([]json.RawMessage, 0, len(chunks))}
+	for _, c := range chunks {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding generated response: %w", err)
+		}
+		resp.Stream = append(resp.Stream, data)
+	}
+	return resp, nil
+}
+
+// embeddingData is an embedding in the float or base64 encoding format
+type embeddingData struct {
+	Object    string `json:"object"`
+	Embedding any    `json:"embedding"`
+	Index     int    `json:"index"`
+}
+
+// embeddingInputs returns the text for each embedding input, token arrays are returned with the
+// number of tokens in them
+func embeddingInputs(input any) ([]string, []int, error) {
+	switch value := input.(type) {
+	case string:
+		return []string{value}, []int{-1}, nil
+	case []any:
+		texts, tokens := make([]string, 0, len(value)), make([]int, 0, len(value))
+		for _, item := range value {
+			switch v := item.(type) {
+			case string:
+				texts, tokens = append(texts, v), append(tokens, -1)
+			case float64:
+				// a single array of tokens
+				return []string{fmt.Sprint(value)}, []int{len(value)}, nil
+			case []any:
+				texts, tokens = append(texts, fmt.Sprint(v)), append(tokens, len(v))
+			default:
+				return nil, nil, fmt.Errorf("invalid embeddings input: %v", item)
+			}
+		}
+		return texts, tokens, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid embeddings input")
+	}
+}
+
+// embeddingVector returns a unit vector that is the same for the same text
+func embeddingVector(text string, dimensions int) []float32 {
+	hash := fnv.New64a()
+	hash.Write([]byte(text))
+	rng := rand.New(rand.NewSource(int64(hash.Sum64())))
+
+	vector := make([]float32, dimensions)
+	var norm float64
+	for i := range vector {
+		v := rng.NormFloat64()
+		vector[i] = float32(v)
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+// encodeBase64 encodes a vector as little-endian float32 values, like the base64 encoding format
+func encodeBase64(vector []float32) string {
+	data := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func generateEmbeddings(body []byte) (*Response, error) {
+	embReq := openai.EmbeddingRequest{}
+	if err := json.Unmarshal(body, &embReq); err != nil {
+		return nil, fmt.Errorf("could not unmarshal embeddings request body: %v", err)
+	}
+	texts, tokens, err := embeddingInputs(embReq.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	dimensions := embReq.Dimensions
+	if dimensions <= 0 {
+		dimensions = defaultDimensions
+		if strings.HasSuffix(string(embReq.Model), "-large") {
+			dimensions = largeDimensions
+		}
+	}
+
+	data := make([]embeddingData, 0, len(texts))
+	promptTokens := 0
+	for i, text := range texts {
+		if tokens[i] >= 0 {
+			promptTokens += tokens[i]
+		} else {
+			promptTokens += providers.CountTokens(string(embReq.Model), text)
+		}
+
+		vector := embeddingVector(text, dimensions)
+		var embedding any = vector
+		if embReq.EncodingFormat == openai.EmbeddingEncodingFormatBase64 {
+			embedding = encodeBase64(vector)
+		}
+		data = append(data, embeddingData{Object: "embedding", Embedding: embedding, Index: i})
+	}
+
+	return marshalResponse(map[string]any{
+		"object": "list",
+		"data":   data,
+		"model":  embReq.Model,
+		"usage":  openai.Usage{PromptTokens: promptTokens, TotalTokens: promptTokens},
+	})
+}
@@ -0,0 +1,164 @@
+package mock
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+	"github.com/proxati/llm_proxy/schema/providers/openai_com"
+)
+
+func TestGenerateChatCompletion(t *testing.T) {
+	reqBody := `{"model": "my-finetune", "n": 2, "messages": [{"role": "user", "content": "Hello there"}]}`
+	resp, err := Generate(Request{Path: "/v1/chat/completions", Body: []byte(reqBody)})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, 200, resp.Status)
+
+	body := string(resp.Body)
+	chatResp, err := openai_com.NewOpenAIChatCompletionResponse(&body)
+	require.NoError(t, err)
+	assert.Equal(t, "chat.completion", chatResp.Object)
+	assert.Equal(t, "my-finetune", chatResp.Model)
+	require.Len(t, chatResp.Choices, 2)
+	assert.Equal(t, GeneratedContent, chatResp.Choices[1].Message.Content)
+	assert.Equal(t, openai.FinishReasonStop, chatResp.Choices[1].FinishReason)
+
+	// the usage is the same as the auditor estimates for a response without usage data
+	usage, err := (&openai_com.Provider{}).ExtractUsage(reqBody, `{"choices": [{"message": {"content": "`+GeneratedContent+`"}}, {"message": {"content": "`+GeneratedContent+`"}}]}`)
+	require.NoError(t, err)
+	assert.Equal(t, usage.InputTokens, chatResp.Usage.PromptTokens)
+	assert.Equal(t, usage.OutputTokens, chatResp.Usage.CompletionTokens)
+	assert.Equal(t, chatResp.Usage.PromptTokens+chatResp.Usage.CompletionTokens, chatResp.Usage.TotalTokens)
+
+	_, err = Generate(Request{Path: "/v1/chat/completions", Body: []byte(`{`)})
+	assert.Error(t, err)
+}
+
+func TestGenerateChatStream(t *testing.T) {
+	tests := []struct {
+		name          string
+		reqBody       string
+		expectedUsage bool
+	}{
+		{
+			name:    "without usage",
+			reqBody: `{"model": "my-finetune", "stream": true, "messages": [{"role": "user", "content": "Hello there"}]}`,
+		},
+		{
+			name:          "with usage",
+			reqBody:       `{"model": "my-finetune", "stream": true, "stream_options": {"include_usage": true}, "messages": []}`,
+			expectedUsage: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := Generate(Request{Path: "/v1/chat/completions", Body: []byte(tc.reqBody)})
+			require.NoError(t, err)
+			require.NotNil(t, resp)
+			require.NotEmpty(t, resp.Stream)
+			assert.Empty(t, resp.Body)
+
+			_, body := resp.Encode()
+			bodyStr := string(body)
+			chatResp, err := openai_com.NewOpenAIChatCompletionStreamResponse(&bodyStr)
+			require.NoError(t, err)
+			require.Len(t, chatResp.Choices, 1)
+			assert.Equal(t, GeneratedContent, chatResp.Choices[0].Message.Content, "the chunks are the full content")
+			assert.Equal(t, openai.FinishReasonStop, chatResp.Choices[0].FinishReason)
+
+			last := openai.ChatCompletionStreamResponse{}
+			require.NoError(t, json.Unmarshal(resp.Stream[len(resp.Stream)-1], &last))
+			if tc.expectedUsage {
+				require.NotNil(t, last.Usage)
+				assert.Equal(t, providers.CountTokens("my-finetune", GeneratedContent), last.Usage.CompletionTokens)
+			} else {
+				assert.Nil(t, last.Usage)
+			}
+		})
+	}
+}
+
+func TestGenerateEmbeddings(t *testing.T) {
+	tests := []struct {
+		name               string
+		reqBody            string
+		expectedDimensions int
+		expectedCount      int
+		expectedTokens     int
+	}{
+		{
+			name:               "single input",
+			reqBody:            `{"model": "text-embedding-3-small", "input": "Hello there"}`,
+			expectedDimensions: defaultDimensions,
+			expectedCount:      1,
+			expectedTokens:     providers.CountTokens("text-embedding-3-small", "Hello there"),
+		},
+		{
+			name:               "list input, large model",
+			reqBody:            `{"model": "text-embedding-3-large", "input": ["Hello", "there"]}`,
+			expectedDimensions: largeDimensions,
+			expectedCount:      2,
+			expectedTokens:     2 * providers.CountTokens("text-embedding-3-large", "Hello"),
+		},
+		{
+			name:               "token arrays, with dimensions",
+			reqBody:            `{"model": "text-embedding-3-small", "input": [[1, 2, 3], [4]], "dimensions": 8}`,
+			expectedDimensions: 8,
+			expectedCount:      2,
+			expectedTokens:     4,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := Generate(Request{Path: "/v1/embeddings", Body: []byte(tc.reqBody)})
+			require.NoError(t, err)
+			require.NotNil(t, resp)
+
+			embResp := openai.EmbeddingResponse{}
+			require.NoError(t, json.Unmarshal(resp.Body, &embResp))
+			require.Len(t, embResp.Data, tc.expectedCount)
+			assert.Len(t, embResp.Data[0].Embedding, tc.expectedDimensions)
+			assert.Equal(t, tc.expectedTokens, embResp.Usage.PromptTokens)
+			assert.Equal(t, tc.expectedTokens, embResp.Usage.TotalTokens)
+
+			// the same input always has the same embedding
+			again, err := Generate(Request{Path: "/v1/embeddings", Body: []byte(tc.reqBody)})
+			require.NoError(t, err)
+			assert.Equal(t, resp.Body, again.Body)
+		})
+	}
+
+	t.Run("base64", func(t *testing.T) {
+		resp, err := Generate(Request{Path: "/v1/embeddings", Body: []byte(`{"model": "m", "input": "x", "encoding_format": "base64", "dimensions": 4}`)})
+		require.NoError(t, err)
+		embResp := struct {
+			Data []struct {
+				Embedding string `json:"embedding"`
+			} `json:"data"`
+		}{}
+		require.NoError(t, json.Unmarshal(resp.Body, &embResp))
+		require.Len(t, embResp.Data, 1)
+		decoded, err := base64.StdEncoding.DecodeString(embResp.Data[0].Embedding)
+		require.NoError(t, err)
+		assert.Len(t, decoded, 16, "4 float32 values")
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, err := Generate(Request{Path: "/v1/embeddings", Body: []byte(`{"model": "m", "input": 1}`)})
+		assert.Error(t, err)
+	})
+}
+
+func TestGenerateOtherEndpoints(t *testing.T) {
+	resp, err := Generate(Request{Path: "/v1/models"})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
@@ -0,0 +1,114 @@
+package addons
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/proxy/addons/mock"
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+const (
+	// MockStatusHeader is the name of the fixture that answered a request, or MockGenerated
+	MockStatusHeader = "X-Llm_proxy-Mock"
+	MockGenerated    = "generated"
+)
+
+// MockAddon answers every request locally, from the first fixture that matches it, or with a
+// generated response. Requests are never sent upstream.
+type MockAddon struct {
+	px.BaseAddon
+	fixtures  *mock.Fixtures
+	generate  bool             // generate responses for requests that don't match a fixture
+	modifiers []func(*px.Flow) // Response hooks of other addons, run on every mock response
+}
+
+// AddResponseModifier adds a function that is called with each mock response. The Response hooks
+// of the other addons are not called for a request that is answered by an addon, so this is used
+// for addons that change the response, e.g., the ChaosAddon.
+func (m *MockAddon) AddResponseModifier(modifier func(*px.Flow)) {
+	m.modifiers = append(m.modifiers, modifier)
+}
+
+// respond sets the mock response, and runs the response modifiers
+func (m *MockAddon) respond(f *px.Flow, resp *px.Response) {
+	f.Response = resp
+	for _, modifier := range m.modifiers {
+		modifier(f)
+	}
+}
+
+func (m *MockAddon) Request(f *px.Flow) {
+	if f.Response != nil {
+		// already answered, e.g., denied by the egress policy
+		return
+	}
+
+	body, err := utils.DecodeBody(f.Request.Body, f.Request.Header.Get("Content-Encoding"))
+	if err != nil {
+		f.Response = newErrorResponse(http.StatusBadRequest, "invalid_request_error", "", fmt.Sprintf("error decoding request body: %v", err))
+		return
+	}
+	u := *f.Request.URL
+	u.RawQuery = ""
+	req := mock.Request{URL: u.String(), Path: u.Path, Body: body}
+
+	if fixture := m.fixtures.Find(req); fixture != nil {
+		log.Debugf("mock fixture %s matched: %s", fixture.Name, f.Request.URL)
+		m.respond(f, newMockResponse(&fixture.Response, fixture.Name))
+		return
+	}
+
+	if m.generate {
+		resp, err := mock.Generate(req)
+		if err != nil {
+			f.Response = newErrorResponse(http.StatusBadRequest, "invalid_request_error", "", err.Error())
+			return
+		}
+		if resp != nil {
+			log.Debugf("generated mock response for: %s", f.Request.URL)
+			m.respond(f, newMockResponse(resp, MockGenerated))
+			return
+		}
+	}
+
+	log.Warnf("no mock fixture matches: %s %s", f.Request.Method, f.Request.URL)
+	f.Response = newErrorResponse(
+		http.StatusNotFound, "invalid_request_error", "mock_not_found",
+		fmt.Sprintf("no mock fixture matches: %s %s", f.Request.Method, u.String()),
+	)
+}
+
+// newMockResponse converts a fixture response, with the name of the source in MockStatusHeader
+func newMockResponse(resp *mock.Response, source string) *px.Response {
+	header, body := resp.Encode()
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Set(MockStatusHeader, source)
+	return &px.Response{StatusCode: resp.Status, Header: header, Body: body}
+}
+
+func (m *MockAddon) String() string {
+	return "MockAddon"
+}
+
+func (m *MockAddon) Close() error {
+	return nil
+}
+
+// NewMockAddon creates the mock addon, with the fixtures from a directory of JSON files. When
+// fixturesDir is empty, every response is generated.
+func NewMockAddon(fixturesDir string, generate bool) (*MockAddon, error) {
+	fixtures := &mock.Fixtures{}
+	if fixturesDir != "" {
+		var err error
+		if fixtures, err = mock.LoadFixtures(fixturesDir); err != nil {
+			return nil, err
+		}
+		log.Debugf("Loaded %d mock fixtures from: %s", len(fixtures.Fixtures), fixturesDir)
+	}
+	return &MockAddon{fixtures: fixtures, generate: generate}, nil
+}
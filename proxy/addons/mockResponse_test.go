@@ -0,0 +1,101 @@
+package addons
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockAddon(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "weather.json"), []byte(`{
+		"match": {"url": "https://api.openai.com/v1/chat/completions", "last_user_message": "weather"},
+		"response": {"status": 200, "headers": {"X-Test": "yes"}, "body": {"id": "chatcmpl-weather"}}
+	}`), 0644))
+
+	newFlow := func(rawURL, body string) *px.Flow {
+		reqURL, _ := url.Parse(rawURL)
+		return &px.Flow{Request: &px.Request{
+			Method: http.MethodPost,
+			URL:    reqURL,
+			Header: http.Header{},
+			Body:   []byte(body),
+		}}
+	}
+
+	tests := []struct {
+		name           string
+		generate       bool
+		url            string
+		body           string
+		expectedStatus int
+		expectedSource string
+		expectedBody   string
+	}{
+		{
+			name:           "fixture",
+			url:            "https://api.openai.com/v1/chat/completions?api-version=1",
+			body:           `{"model": "gpt-4o", "messages": [{"role": "user", "content": "what's the weather?"}]}`,
+			expectedStatus: http.StatusOK,
+			expectedSource: "weather",
+			expectedBody:   `{"id": "chatcmpl-weather"}`,
+		},
+		{
+			name:           "generated",
+			generate:       true,
+			url:            "https://api.openai.com/v1/chat/completions",
+			body:           `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hello"}]}`,
+			expectedStatus: http.StatusOK,
+			expectedSource: MockGenerated,
+		},
+		{
+			name:           "invalid request for the generator",
+			generate:       true,
+			url:            "https://api.openai.com/v1/chat/completions",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "not generated",
+			url:            "https://api.openai.com/v1/chat/completions",
+			body:           `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hello"}]}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "endpoint without a generator",
+			generate:       true,
+			url:            "https://api.openai.com/v1/models",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewMockAddon(dir, tc.generate)
+			require.NoError(t, err)
+
+			f := newFlow(tc.url, tc.body)
+			m.Request(f)
+			require.NotNil(t, f.Response, "every request is answered")
+			assert.Equal(t, tc.expectedStatus, f.Response.StatusCode)
+			assert.Equal(t, tc.expectedSource, f.Response.Header.Get(MockStatusHeader))
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, string(f.Response.Body))
+				assert.Equal(t, "yes", f.Response.Header.Get("X-Test"))
+			}
+		})
+	}
+
+	t.Run("invalid fixtures", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{`), 0644))
+		_, err := NewMockAddon(dir, true)
+		assert.Error(t, err)
+	})
+}
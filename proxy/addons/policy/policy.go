@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	defaultRuleName        = "default"
+	uncheckedModelRuleName = "unchecked-model"
+)
+
+// Request holds the request fields that are checked by the policy rules
+type Request struct {
+	Host   string
+	Path   string
+	Method string
+	Model  string // empty when the request body doesn't contain a model
+}
+
+// Decision is the result of evaluating a request against the policy
+type Decision struct {
+	Action Action
+	Rule   string
+	Reason string
+}
+
+// Allowed returns true if the request may be sent upstream
+func (d Decision) Allowed() bool {
+	return d.Action == Allow
+}
+
+// Policy is an ordered list of rules, the first matching rule decides the outcome
+type Policy struct {
+	Default Action `json:"default"` // used when no rules match, defaults to deny
+	Rules   []Rule `json:"rules"`
+}
+
+func (p *Policy) validate() error {
+	if p.Default == "" {
+		p.Default = Deny
+	}
+	if err := p.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i)
+		}
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the decision from the first matching rule, or the default action
+func (p *Policy) Evaluate(req Request) Decision {
+	for _, r := range p.Rules {
+		if !r.Matches(req) {
+			continue
+		}
+
+		reason := r.Reason
+		if reason == "" && r.Action == Deny {
+			reason = fmt.Sprintf("request denied by egress policy rule: %s", r.Name)
+		}
+		return Decision{Action: r.Action, Rule: r.Name, Reason: reason}
+	}
+
+	decision := Decision{Action: p.Default, Rule: defaultRuleName}
+	if p.Default == Deny {
+		decision.Reason = "request did not match any egress policy allow rule"
+	}
+	return decision
+}
+
+// DenyUncheckedModel is the decision for a request matching a rule that checks the model, when the
+// model can't be read from the request body, e.g., because it isn't JSON. These requests are
+// denied, so the model rules can't be skipped by sending a different body format.
+func DenyUncheckedModel(err error) Decision {
+	return Decision{
+		Action: Deny,
+		Rule:   uncheckedModelRuleName,
+		Reason: fmt.Sprintf("request denied, the egress policy can't read the model from the body: %v", err),
+	}
+}
+
+// NeedsModel returns true if the request's model decides which rule matches it, so the request
+// body only needs to be parsed when required. That's when the first rule matching the request's
+// host, path, and method checks the model; a rule without models before it always matches first.
+func (p *Policy) NeedsModel(req Request) bool {
+	for _, r := range p.Rules {
+		if r.matchesAnyModel(req) {
+			return len(r.Models) > 0
+		}
+	}
+	return false
+}
+
+// NewPolicyFromFile reads and validates a policy JSON file
+func NewPolicyFromFile(filePath string) (*Policy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", filePath, err)
+	}
+	return p, nil
+}
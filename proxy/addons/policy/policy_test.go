@@ -0,0 +1,142 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicyJSON = `{
+	"default": "deny",
+	"rules": [
+		{"name": "no-gpt-4", "action": "deny", "hosts": ["api.openai.com"], "models": ["gpt-4", "gpt-4-*"], "reason": "gpt-4 is too expensive"},
+		{"name": "no-files", "action": "deny", "paths": ["/v1/files", "/v1/files/*"]},
+		{"name": "openai", "action": "allow", "hosts": ["api.openai.com"], "methods": ["GET", "POST"]},
+		{"name": "anthropic", "action": "allow", "hosts": ["*.anthropic.com"]}
+	]
+}`
+
+func writeTestPolicy(t *testing.T, data string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(filePath, []byte(data), 0644))
+	return filePath
+}
+
+func TestPolicy_Evaluate(t *testing.T) {
+	p, err := NewPolicyFromFile(writeTestPolicy(t, testPolicyJSON))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		req            Request
+		expectedAction Action
+		expectedRule   string
+	}{
+		{
+			name:           "allowed model",
+			req:            Request{Host: "api.openai.com", Path: "/v1/chat/completions", Method: "POST", Model: "gpt-4o-mini"},
+			expectedAction: Allow,
+			expectedRule:   "openai",
+		},
+		{
+			name:           "denied model",
+			req:            Request{Host: "api.openai.com", Path: "/v1/chat/completions", Method: "POST", Model: "gpt-4-turbo"},
+			expectedAction: Deny,
+			expectedRule:   "no-gpt-4",
+		},
+		{
+			name:           "denied path",
+			req:            Request{Host: "api.openai.com", Path: "/v1/files/file-abc", Method: "GET"},
+			expectedAction: Deny,
+			expectedRule:   "no-files",
+		},
+		{
+			name:           "denied nested path",
+			req:            Request{Host: "api.openai.com", Path: "/v1/files/file-abc/content", Method: "GET"},
+			expectedAction: Deny,
+			expectedRule:   "no-files",
+		},
+		{
+			name:           "denied method",
+			req:            Request{Host: "api.openai.com", Path: "/v1/models/gpt-4o", Method: "DELETE"},
+			expectedAction: Deny,
+			expectedRule:   defaultRuleName,
+		},
+		{
+			name:           "host wildcard, case insensitive",
+			req:            Request{Host: "API.Anthropic.com", Path: "/v1/messages", Method: "POST"},
+			expectedAction: Allow,
+			expectedRule:   "anthropic",
+		},
+		{
+			name:           "unknown host",
+			req:            Request{Host: "example.com", Path: "/", Method: "GET"},
+			expectedAction: Deny,
+			expectedRule:   defaultRuleName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := p.Evaluate(tt.req)
+			assert.Equal(t, tt.expectedAction, decision.Action)
+			assert.Equal(t, tt.expectedRule, decision.Rule)
+			assert.Equal(t, tt.expectedAction == Allow, decision.Allowed())
+			if !decision.Allowed() {
+				assert.NotEmpty(t, decision.Reason)
+			}
+		})
+	}
+
+	assert.Equal(t, "gpt-4 is too expensive", p.Evaluate(tests[1].req).Reason)
+}
+
+func TestNewPolicyFromFile_Defaults(t *testing.T) {
+	p, err := NewPolicyFromFile(writeTestPolicy(t, `{"rules": [{"action": "allow", "hosts": ["api.openai.com"]}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, Deny, p.Default)
+	assert.Equal(t, "rule-0", p.Rules[0].Name)
+	assert.False(t, p.NeedsModel(Request{Host: "api.openai.com", Path: "/v1/chat/completions", Method: "POST"}))
+}
+
+func TestPolicy_NeedsModel(t *testing.T) {
+	p, err := NewPolicyFromFile(writeTestPolicy(t, testPolicyJSON))
+	require.NoError(t, err)
+
+	assert.True(t, p.NeedsModel(Request{Host: "api.openai.com", Path: "/v1/chat/completions", Method: "POST"}))
+	// the model rule is only for api.openai.com
+	assert.False(t, p.NeedsModel(Request{Host: "api.anthropic.com", Path: "/v1/messages", Method: "POST"}))
+
+	p.Rules[0].Hosts = nil
+	assert.True(t, p.NeedsModel(Request{Host: "api.anthropic.com", Path: "/v1/messages", Method: "POST"}))
+
+	// a rule without models matches first
+	p.Rules[0], p.Rules[1] = p.Rules[1], p.Rules[0]
+	assert.False(t, p.NeedsModel(Request{Host: "api.openai.com", Path: "/v1/files", Method: "POST"}))
+	assert.True(t, p.NeedsModel(Request{Host: "api.openai.com", Path: "/v1/chat/completions", Method: "POST"}))
+}
+
+func TestNewPolicyFromFile_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"invalid json", `{`},
+		{"invalid default", `{"default": "maybe"}`},
+		{"invalid action", `{"rules": [{"action": "block"}]}`},
+		{"invalid pattern", `{"rules": [{"action": "deny", "hosts": ["["]}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPolicyFromFile(writeTestPolicy(t, tt.data))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := NewPolicyFromFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
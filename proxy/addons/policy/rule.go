@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/proxati/llm_proxy/proxy/addons/glob"
+)
+
+// Action is the result of a matching rule
+type Action string
+
+const (
+	Allow Action = "allow"
+	Deny  Action = "deny"
+)
+
+func (a Action) validate() error {
+	switch a {
+	case Allow, Deny:
+		return nil
+	default:
+		return fmt.Errorf("invalid action: %q, must be %q or %q", a, Allow, Deny)
+	}
+}
+
+// Rule matches requests by host, path, method, and requested model. Each field is a list of glob
+// patterns (e.g., "*.openai.com" or "gpt-4*"), and an empty list matches everything. The patterns
+// are matched by the glob package, hosts and methods are compared ignoring case.
+type Rule struct {
+	Name    string   `json:"name"`
+	Action  Action   `json:"action"`
+	Hosts   []string `json:"hosts,omitempty"`
+	Paths   []string `json:"paths,omitempty"`
+	Methods []string `json:"methods,omitempty"`
+	Models  []string `json:"models,omitempty"`
+	Reason  string   `json:"reason,omitempty"` // returned to the client when the request is denied
+}
+
+func (r *Rule) validate() error {
+	if err := r.Action.validate(); err != nil {
+		return err
+	}
+
+	if err := glob.Validate(slices.Concat(r.Hosts, r.Paths, r.Methods, r.Models)...); err != nil {
+		return err
+	}
+
+	// hosts and methods are case insensitive, the request values are also lowercased by Matches
+	for _, patterns := range [][]string{r.Hosts, r.Methods} {
+		for i, pattern := range patterns {
+			patterns[i] = strings.ToLower(pattern)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the request matches all of the rule's fields
+func (r *Rule) Matches(req Request) bool {
+	return r.matchesAnyModel(req) && glob.MatchAny(r.Models, req.Model)
+}
+
+// matchesAnyModel returns true if the request matches the rule's host, path, and method, ignoring
+// the requested model
+func (r *Rule) matchesAnyModel(req Request) bool {
+	return glob.MatchAny(r.Hosts, strings.ToLower(req.Host)) &&
+		glob.MatchAny(r.Paths, req.Path) &&
+		glob.MatchAny(r.Methods, strings.ToLower(req.Method))
+}
@@ -0,0 +1,155 @@
+package addons
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bojanz/currency"
+	px "github.com/kardianos/mitmproxy/proxy"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// tokensPerMinuteWindow is the length of the window for the tokens per minute limit
+const tokensPerMinuteWindow = time.Minute
+
+// tokenUse is the estimated tokens of a request that was sent, for the tokens per minute limit
+type tokenUse struct {
+	at     time.Time
+	tokens int
+}
+
+// preflightLimits are checked with the estimate of each request, before it's sent upstream. A
+// request that would go over a limit is answered with a 429 error, and never sent.
+type preflightLimits struct {
+	budget          currency.Amount // spending limit for the grand total, empty when there's no budget
+	tokensPerMinute int             // estimated input and maximum output tokens, 0 is unlimited
+	used            []tokenUse      // oldest first, within the last tokensPerMinuteWindow
+	mutex           sync.Mutex
+	now             func() time.Time
+}
+
+// newPreflightLimits parses the budget, which is an amount in currencyCode, e.g., "100". An empty
+// budget is unlimited.
+func newPreflightLimits(budget, currencyCode string, tokensPerMinute int) (*preflightLimits, error) {
+	if tokensPerMinute < 0 {
+		return nil, fmt.Errorf("tokens per minute can't be negative: %d", tokensPerMinute)
+	}
+	limits := &preflightLimits{tokensPerMinute: tokensPerMinute, now: time.Now}
+	if budget == "" {
+		return limits, nil
+	}
+
+	amount, err := currency.NewAmount(budget, currencyCode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid budget %q: %w", budget, err)
+	}
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("budget must be greater than 0: %s", budget)
+	}
+	limits.budget = amount
+	return limits, nil
+}
+
+// enabled returns false when there are no limits to check
+func (l *preflightLimits) enabled() bool {
+	return l.budget.CurrencyCode() != "" || l.tokensPerMinute > 0
+}
+
+// checkBudget returns an error response when the estimated cost of the request, added to the
+// spent amount, is over the budget. Requests that aren't priced in the budget currency can't be
+// checked, and are allowed.
+func (l *preflightLimits) checkBudget(estimate *schema.RequestEstimate, spent currency.Amount) *px.Response {
+	if l.budget.CurrencyCode() == "" || !estimate.Priced() || estimate.Cost.CurrencyCode() != l.budget.CurrencyCode() {
+		return nil
+	}
+
+	projected := estimate.Cost
+	if spent.CurrencyCode() == l.budget.CurrencyCode() {
+		projected, _ = spent.Add(estimate.Cost) // same currency, can't fail
+	}
+	if cmp, _ := projected.Cmp(l.budget); cmp <= 0 {
+		return nil
+	}
+	return newErrorResponse(
+		http.StatusTooManyRequests, "insufficient_quota", "budget_exceeded",
+		fmt.Sprintf("The estimated cost of this request, %s, is over the remaining budget of %s.",
+			estimate.Cost, remainingBudget(l.budget, spent).Round()),
+	)
+}
+
+// remainingBudget returns the unspent part of the budget, which is zero when it's all spent
+func remainingBudget(budget, spent currency.Amount) currency.Amount {
+	if spent.CurrencyCode() != budget.CurrencyCode() {
+		return budget
+	}
+	remaining, _ := budget.Sub(spent)
+	if remaining.IsNegative() {
+		zero, _ := currency.NewAmount("0", budget.CurrencyCode())
+		return zero
+	}
+	return remaining
+}
+
+// reserveTokens counts the estimated tokens of a request in the current minute, or returns an
+// error response when they would go over the tokens per minute limit. Like the OpenAI rate
+// limits, the maximum output tokens are counted, not the tokens that are generated.
+func (l *preflightLimits) reserveTokens(usage int) *px.Response {
+	if l.tokensPerMinute <= 0 {
+		return nil
+	}
+	if usage > l.tokensPerMinute {
+		return newErrorResponse(
+			http.StatusTooManyRequests, "tokens", "rate_limit_exceeded",
+			fmt.Sprintf("Request too large: %d estimated tokens, the limit is %d tokens per minute.", usage, l.tokensPerMinute),
+		)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	expired := 0
+	for expired < len(l.used) && !l.used[expired].at.After(now.Add(-tokensPerMinuteWindow)) {
+		expired++
+	}
+	l.used = l.used[expired:]
+
+	total := usage
+	for _, use := range l.used {
+		total += use.tokens
+	}
+	if total <= l.tokensPerMinute {
+		l.used = append(l.used, tokenUse{at: now, tokens: usage})
+		return nil
+	}
+
+	// wait until enough of the oldest requests have left the window
+	retryAfter := tokensPerMinuteWindow
+	for _, use := range l.used {
+		total -= use.tokens
+		if total <= l.tokensPerMinute {
+			retryAfter = use.at.Add(tokensPerMinuteWindow).Sub(now)
+			break
+		}
+	}
+	resp := newErrorResponse(
+		http.StatusTooManyRequests, "tokens", "rate_limit_exceeded",
+		fmt.Sprintf("Rate limit reached: %d tokens per minute, this request needs %d estimated tokens.", l.tokensPerMinute, usage),
+	)
+	resp.Header.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return resp
+}
+
+// check returns an error response when the request would go over a limit, otherwise its tokens
+// are counted in the tokens per minute limit
+func (l *preflightLimits) check(estimate *schema.RequestEstimate, spent currency.Amount) *px.Response {
+	if resp := l.checkBudget(estimate, spent); resp != nil {
+		return resp
+	}
+	return l.reserveTokens(estimate.Usage.InputTokens + estimate.Usage.OutputTokens)
+}
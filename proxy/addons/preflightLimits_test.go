@@ -0,0 +1,102 @@
+package addons
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema"
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+func TestNewPreflightLimits(t *testing.T) {
+	limits, err := newPreflightLimits("", "USD", 0)
+	require.NoError(t, err)
+	assert.False(t, limits.enabled())
+
+	limits, err = newPreflightLimits("100", "EUR", 0)
+	require.NoError(t, err)
+	assert.True(t, limits.enabled())
+	assert.Equal(t, "100 EUR", limits.budget.String())
+
+	for _, budget := range []string{"lots", "0", "-5"} {
+		_, err := newPreflightLimits(budget, "USD", 0)
+		assert.Error(t, err, budget)
+	}
+	_, err = newPreflightLimits("", "USD", -1)
+	assert.Error(t, err)
+}
+
+func TestPreflightBudget(t *testing.T) {
+	amount := func(number, code string) currency.Amount {
+		a, err := currency.NewAmount(number, code)
+		require.NoError(t, err)
+		return a
+	}
+	limits, err := newPreflightLimits("1", "USD", 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		estimate schema.RequestEstimate
+		spent    currency.Amount
+		rejected bool
+	}{
+		{name: "nothing spent", estimate: schema.RequestEstimate{Cost: amount("0.5", "USD")}},
+		{name: "exactly the budget", estimate: schema.RequestEstimate{Cost: amount("0.5", "USD")}, spent: amount("0.5", "USD")},
+		{name: "over the budget", estimate: schema.RequestEstimate{Cost: amount("0.6", "USD")}, spent: amount("0.5", "USD"), rejected: true},
+		{name: "estimate alone is over", estimate: schema.RequestEstimate{Cost: amount("2", "USD")}, rejected: true},
+		{name: "not priced", estimate: schema.RequestEstimate{}, spent: amount("5", "USD")},
+		{name: "another currency", estimate: schema.RequestEstimate{Cost: amount("2", "EUR")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := limits.check(&tt.estimate, tt.spent)
+			if !tt.rejected {
+				assert.Nil(t, resp)
+				return
+			}
+			require.NotNil(t, resp)
+			assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+			assert.JSONEq(t, `{"error": {
+				"message": "The estimated cost of this request, `+tt.estimate.Cost.String()+`, is over the remaining budget of `+
+				remainingBudget(limits.budget, tt.spent).Round().String()+`.",
+				"type": "insufficient_quota", "code": "budget_exceeded"
+			}}`, string(resp.Body))
+		})
+	}
+
+	assert.Equal(t, "0 USD", remainingBudget(limits.budget, amount("3", "USD")).String())
+}
+
+func TestPreflightTokensPerMinute(t *testing.T) {
+	limits, err := newPreflightLimits("", "USD", 100)
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	limits.now = func() time.Time { return now }
+	estimate := func(input, output int) *schema.RequestEstimate {
+		return &schema.RequestEstimate{Usage: providers.Usage{InputTokens: input, OutputTokens: output}}
+	}
+
+	assert.Nil(t, limits.check(estimate(30, 20), currency.Amount{}), "50 of 100")
+	now = now.Add(20 * time.Second)
+	assert.Nil(t, limits.check(estimate(40, 0), currency.Amount{}), "90 of 100")
+
+	now = now.Add(10 * time.Second)
+	resp := limits.check(estimate(20, 0), currency.Amount{})
+	require.NotNil(t, resp, "110 of 100")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "30", resp.Header.Get("Retry-After"), "the first request leaves the window in 30 seconds")
+
+	now = now.Add(30 * time.Second)
+	assert.Nil(t, limits.check(estimate(20, 0), currency.Amount{}), "60 of 100, the first request has left the window")
+
+	resp = limits.check(estimate(101, 0), currency.Amount{})
+	require.NotNil(t, resp)
+	assert.Contains(t, string(resp.Body), "Request too large")
+	assert.Empty(t, resp.Header.Get("Retry-After"), "retrying won't help")
+}
@@ -0,0 +1,81 @@
+package addons
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+)
+
+// removeProxyHeaders deletes the llm_proxy headers, e.g., the client's tags, and returns them
+func removeProxyHeaders(header http.Header) http.Header {
+	removed := make(http.Header)
+	for key, values := range header {
+		if strings.HasPrefix(http.CanonicalHeaderKey(key), llmProxyHeaderPrefix) {
+			removed[key] = values
+			delete(header, key)
+		}
+	}
+	return removed
+}
+
+// ProxyHeaderFilterAddon removes the llm_proxy request headers, which are only for this proxy,
+// e.g., the client's tags, before the proxy sends the request upstream. They are put back in the
+// Responseheaders event, so the logs and the auditor see the request that the client sent. It must
+// be added after all of the addons that read those headers in the Request event.
+type ProxyHeaderFilterAddon struct {
+	px.BaseAddon
+	removed sync.Map // key: flow ID, value: http.Header
+	closed  atomic.Bool
+	wg      sync.WaitGroup
+}
+
+func (p *ProxyHeaderFilterAddon) Request(f *px.Flow) {
+	if f.Response != nil || f.Request == nil {
+		// already answered, nothing is sent upstream
+		return
+	}
+	removed := removeProxyHeaders(f.Request.Header)
+	if len(removed) == 0 || p.closed.Load() {
+		return
+	}
+	p.removed.Store(f.Id, removed)
+
+	p.wg.Add(1) // for blocking this addon during shutdown in .Close()
+	go func() {
+		defer p.wg.Done()
+		<-f.Done()
+		p.removed.Delete(f.Id) // normally removed in the Responseheaders event, unless there was no response
+	}()
+}
+
+func (p *ProxyHeaderFilterAddon) Responseheaders(f *px.Flow) {
+	value, found := p.removed.LoadAndDelete(f.Id)
+	if !found {
+		return
+	}
+	for key, values := range value.(http.Header) {
+		f.Request.Header[key] = values
+	}
+}
+
+func (p *ProxyHeaderFilterAddon) String() string {
+	return "ProxyHeaderFilterAddon"
+}
+
+func (p *ProxyHeaderFilterAddon) Close() error {
+	if !p.closed.Swap(true) {
+		log.Debug("Waiting for ProxyHeaderFilterAddon shutdown...")
+		p.wg.Wait()
+	}
+	return nil
+}
+
+// NewProxyHeaderFilterAddon creates the addon that keeps the llm_proxy request headers from being
+// sent upstream
+func NewProxyHeaderFilterAddon() *ProxyHeaderFilterAddon {
+	return &ProxyHeaderFilterAddon{}
+}
@@ -0,0 +1,62 @@
+package addons
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyHeaderFilterAddon(t *testing.T) {
+	filter := NewProxyHeaderFilterAddon()
+	assert.Equal(t, "ProxyHeaderFilterAddon", filter.String())
+
+	u, err := url.Parse("https://api.openai.com/v1/chat/completions")
+	require.NoError(t, err)
+	flow := &px.Flow{
+		Id: uuid.NewV4(),
+		Request: &px.Request{Method: "POST", URL: u, Header: http.Header{
+			"Authorization":        []string{"Bearer sk-client"},
+			RequestTagsHeader:      []string{"team-a"},
+			"X-Llm_proxy-Rewrites": []string{"forged"},
+		}},
+	}
+
+	// removed before the proxy sends the request
+	filter.Request(flow)
+	assert.Equal(t, http.Header{"Authorization": []string{"Bearer sk-client"}}, flow.Request.Header)
+
+	// put back for the logs
+	flow.Response = &px.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	filter.Responseheaders(flow)
+	assert.Equal(t, "team-a", flow.Request.Header.Get(RequestTagsHeader))
+	assert.Equal(t, "forged", flow.Request.Header.Get("X-Llm_proxy-Rewrites"))
+}
+
+func TestSendUpstream_RemovesProxyHeaders(t *testing.T) {
+	received := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+	}))
+	t.Cleanup(upstream.Close)
+
+	u, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+	req := &px.Request{Method: "GET", URL: u, Header: http.Header{
+		"Authorization":   []string{"Bearer sk-client"},
+		RequestTagsHeader: []string{"team-a"},
+	}}
+	_, err = sendUpstream(context.Background(), newUpstreamClient(false), req)
+	require.NoError(t, err)
+
+	header := <-received
+	assert.Equal(t, "Bearer sk-client", header.Get("Authorization"))
+	assert.Empty(t, header.Get(RequestTagsHeader))
+	assert.Equal(t, "team-a", req.Header.Get(RequestTagsHeader)) // the flow's request isn't changed
+}
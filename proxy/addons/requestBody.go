@@ -0,0 +1,141 @@
+package addons
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+// decodeRequestJSON decompresses and parses a JSON request body into a map. Numbers are kept as
+// json.Number, so values are not changed when the body is encoded again.
+func decodeRequestJSON(req *px.Request) (map[string]any, error) {
+	if req == nil || len(req.Body) == 0 {
+		return nil, fmt.Errorf("request body is empty")
+	}
+
+	decodedBody, err := utils.DecodeBody(req.Body, req.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding request body: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(decodedBody))
+	decoder.UseNumber()
+
+	body := make(map[string]any)
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("error parsing request body as JSON: %w", err)
+	}
+	return body, nil
+}
+
+// encodeRequestJSON replaces the request body with the JSON encoded map, compressed with the
+// request's original Content-Encoding, and updates the Content-Length header
+func encodeRequestJSON(req *px.Request, body map[string]any) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding request body as JSON: %w", err)
+	}
+
+	encodedBody, err := encodeBody(jsonBody, req.Header.Get("Content-Encoding"))
+	if err != nil {
+		return fmt.Errorf("error encoding request body: %w", err)
+	}
+
+	req.Body = encodedBody
+	if req.Header.Get("Content-Length") != "" {
+		req.Header.Set("Content-Length", strconv.Itoa(len(encodedBody)))
+	}
+	return nil
+}
+
+// formPart is a part of a multipart form request body, a text field or an uploaded file
+type formPart struct {
+	header textproto.MIMEHeader
+	isFile bool
+	value  []byte
+}
+
+// decodeRequestForm decompresses and parses a multipart form request body into its parts
+func decodeRequestForm(req *px.Request, boundary string) ([]formPart, error) {
+	decodedBody, err := utils.DecodeBody(req.Body, req.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding request body: %w", err)
+	}
+
+	parts := make([]formPart, 0)
+	reader := multipart.NewReader(bytes.NewReader(decodedBody), boundary)
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing request body as a multipart form: %w", err)
+		}
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("error reading multipart form field %s: %w", part.FormName(), err)
+		}
+		parts = append(parts, formPart{header: part.Header, isFile: part.FileName() != "", value: value})
+	}
+}
+
+// encodeRequestForm replaces the request body with the multipart form, using the same boundary
+// and the request's original Content-Encoding, and updates the Content-Length header
+func encodeRequestForm(req *px.Request, parts []formPart, boundary string) error {
+	var formBody bytes.Buffer
+	writer := multipart.NewWriter(&formBody)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return fmt.Errorf("error encoding multipart form: %w", err)
+	}
+	for _, part := range parts {
+		partWriter, err := writer.CreatePart(part.header)
+		if err != nil {
+			return fmt.Errorf("error encoding multipart form: %w", err)
+		}
+		if _, err := partWriter.Write(part.value); err != nil {
+			return fmt.Errorf("error encoding multipart form: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error encoding multipart form: %w", err)
+	}
+
+	encodedBody, err := encodeBody(formBody.Bytes(), req.Header.Get("Content-Encoding"))
+	if err != nil {
+		return fmt.Errorf("error encoding request body: %w", err)
+	}
+
+	req.Body = encodedBody
+	if req.Header.Get("Content-Length") != "" {
+		req.Header.Set("Content-Length", strconv.Itoa(len(encodedBody)))
+	}
+	return nil
+}
+
+// encodeBody compresses a body with the same content encoding that it was received with
+func encodeBody(body []byte, contentEncoding string) ([]byte, error) {
+	bodyStr := string(body)
+	encodedBody, encoding, err := utils.EncodeBody(&bodyStr, contentEncoding)
+	if err != nil {
+		return nil, err
+	}
+	if contentEncoding != "" && contentEncoding != "identity" && encoding != contentEncoding {
+		return nil, fmt.Errorf("unsupported content encoding: %s", contentEncoding)
+	}
+	return encodedBody, nil
+}
+
+// requestModel returns the "model" field from a JSON request body
+func requestModel(body map[string]any) string {
+	model, _ := body["model"].(string)
+	return model
+}
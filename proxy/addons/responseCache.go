@@ -130,6 +130,11 @@ func (c *ResponseCacheAddon) Response(f *px.Flow) {
 			log.Debugf("skipping cache storage for non-200 response: %s", f.Request.URL)
 			return
 		}
+		if f.Response.Header.Get(ChaosHeader) != "" {
+			f.Response.Header.Set(CacheStatusHeader, CacheStatusSkip)
+			log.Debugf("skipping cache storage for response with injected faults: %s", f.Request.URL)
+			return
+		}
 
 		// convert the request to an internal TrafficObject
 		tObjReq, err := schema.NewProxyRequestFromMITMRequest(f.Request, c.filterReqHeaders)
@@ -0,0 +1,340 @@
+package addons
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// upstream response codes that will trigger a retry
+var retryResponseCodes = map[int]struct{}{
+	http.StatusTooManyRequests:     {},
+	http.StatusInternalServerError: {},
+	http.StatusBadGateway:          {},
+	http.StatusServiceUnavailable:  {},
+	529:                            {}, // "overloaded", not an official status code
+}
+
+// request methods that are always safe to resend
+var retryOnlyMethods = map[string]struct{}{
+	"GET":     {},
+	"":        {},
+	"HEAD":    {},
+	"OPTIONS": {},
+}
+
+// POST endpoints that do not create state on the server, so they are safe to resend. The
+// "/completions" suffix also matches "/chat/completions".
+var retryPostPathSuffixes = []string{
+	"/completions",
+	"/embeddings",
+	"/moderations",
+	"/messages",
+}
+
+// POST endpoints that are only resent when enabled, because a failed response may still be
+// billed, and each attempt generates or transcribes the media again
+var retryMediaPathSuffixes = []string{
+	"/images/generations",
+	"/audio/speech",
+	"/audio/transcriptions",
+	"/audio/translations",
+}
+
+// rate limit reset headers sent by OpenAI, the reset value is used when the remaining value is 0
+var rateLimitResetHeaders = map[string]string{
+	"X-Ratelimit-Remaining-Requests": "X-Ratelimit-Reset-Requests",
+	"X-Ratelimit-Remaining-Tokens":   "X-Ratelimit-Reset-Tokens",
+}
+
+// retryFlowState is the state kept between the request and the response of a retryable flow
+type retryFlowState struct {
+	attempts int // number of upstream attempts, set in the Response event for a retryable response
+}
+
+// RetryAddon resends requests that failed with a retryable status code, using exponential
+// backoff with jitter, while honoring the rate limit hints returned by the upstream server.
+// Connection errors on the first attempt are answered by the proxy with a 502 before the Response
+// event, so they are not retried, only the connection errors of the retries are. The number of
+// attempts is kept per flow, and added to the flow's log entry.
+type RetryAddon struct {
+	px.BaseAddon
+	maxAttempts    int
+	retryMedia     bool // also resend the image and audio endpoints
+	maxTime        time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	client         *http.Client
+	randMu         sync.Mutex
+	rand           *rand.Rand
+	flows          sync.Map // key: flow ID, value: *retryFlowState
+	closed         atomic.Bool
+	wg             sync.WaitGroup
+}
+
+// isRetryableRequest returns true if the request can be sent again without side effects, the image
+// and audio endpoints only when retryMedia is set
+func isRetryableRequest(req *px.Request, retryMedia bool) bool {
+	if req == nil || req.URL == nil {
+		return false
+	}
+
+	if _, ok := retryOnlyMethods[req.Method]; ok {
+		return true
+	}
+
+	if req.Method != "POST" {
+		return false
+	}
+
+	for _, suffix := range retryPostPathSuffixes {
+		if strings.HasSuffix(req.URL.Path, suffix) {
+			return true
+		}
+	}
+	if !retryMedia {
+		return false
+	}
+	for _, suffix := range retryMediaPathSuffixes {
+		if strings.HasSuffix(req.URL.Path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableResponse returns true if the response status code indicates a transient error
+func isRetryableResponse(resp *px.Response) bool {
+	if resp == nil {
+		return false
+	}
+	_, ok := retryResponseCodes[resp.StatusCode]
+	return ok
+}
+
+// parseRetryAfter parses the Retry-After header, which is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// retryHintFromHeaders returns the delay requested by the upstream server, if any
+func retryHintFromHeaders(header http.Header, now time.Time) (time.Duration, bool) {
+	if header == nil {
+		return 0, false
+	}
+
+	// non-standard millisecond precision header, sent by OpenAI
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+
+	if delay, ok := parseRetryAfter(header.Get("Retry-After"), now); ok {
+		return delay, true
+	}
+
+	// rate limit headers, e.g.: "x-ratelimit-reset-requests: 1s" or "x-ratelimit-reset-tokens: 6m0s"
+	var hint time.Duration
+	var found bool
+	for remainingHeader, resetHeader := range rateLimitResetHeaders {
+		if header.Get(remainingHeader) != "0" {
+			continue
+		}
+		delay, err := time.ParseDuration(header.Get(resetHeader))
+		if err != nil || delay < 0 {
+			continue
+		}
+		if delay > hint {
+			hint = delay
+		}
+		found = true
+	}
+	return hint, found
+}
+
+// backoff returns the delay before the next attempt, attempt starts at 1 for the first retry
+func (r *RetryAddon) backoff(attempt int) time.Duration {
+	delay := r.initialBackoff
+	for i := 1; i < attempt && delay < r.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.maxBackoff {
+		delay = r.maxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// "equal jitter", wait at least half of the delay, plus a random portion of the other half
+	half := delay / 2
+	r.randMu.Lock()
+	defer r.randMu.Unlock()
+	return half + time.Duration(r.rand.Int63n(int64(half)+1))
+}
+
+// nextDelay combines the upstream retry hint with the local backoff, preferring the upstream hint
+func (r *RetryAddon) nextDelay(attempt int, resp *px.Response) time.Duration {
+	if resp != nil {
+		if hint, ok := retryHintFromHeaders(resp.Header, time.Now()); ok {
+			return hint
+		}
+	}
+	return r.backoff(attempt)
+}
+
+// wait blocks for the delay, returns false if the context was cancelled first
+func wait(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (r *RetryAddon) Request(f *px.Flow) {
+	if r.closed.Load() || !isRetryableRequest(f.Request, r.retryMedia) {
+		return
+	}
+	r.flows.Store(f.Id, &retryFlowState{})
+
+	r.wg.Add(1) // for blocking this addon during shutdown in .Close()
+	go func() {
+		defer r.wg.Done()
+		<-f.Done()
+		r.flows.Delete(f.Id)
+	}()
+}
+
+func (r *RetryAddon) Response(f *px.Flow) {
+	if !isRetryableResponse(f.Response) || !isRetryableRequest(f.Request, r.retryMedia) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.maxTime)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	attempts := 1
+	lastResp := f.Response
+	for attempts < r.maxAttempts {
+		if r.closed.Load() {
+			log.Warn("RetryAddon is being closed, not retrying request")
+			break
+		}
+
+		delay := r.nextDelay(attempts, lastResp)
+		if time.Now().Add(delay).After(deadline) {
+			log.Debugf("retry delay of %s exceeds the retry time limit for: %s", delay, f.Request.URL)
+			break
+		}
+
+		log.Debugf("retrying request in %s (attempt %d of %d): %s", delay, attempts+1, r.maxAttempts, f.Request.URL)
+		if !wait(ctx, delay) {
+			break
+		}
+
+		attempts++
+		resp, err := sendUpstream(ctx, r.client, f.Request)
+		if err != nil {
+			log.Warnf("retry attempt %d failed: %v", attempts, err)
+			continue
+		}
+
+		lastResp = resp
+		if !isRetryableResponse(resp) {
+			break
+		}
+	}
+
+	replaceResponse(f, lastResp)
+	if value, found := r.flows.Load(f.Id); found {
+		value.(*retryFlowState).attempts = attempts
+	}
+}
+
+// AddToLog returns the function that adds the number of upstream attempts to the log container, or
+// nil when the request can't be retried. The attempts are read after the flow is done, because the
+// retries happen after the Responseheaders event. Used with MegaDumpAddon.AddContainerModifier.
+func (r *RetryAddon) AddToLog(f *px.Flow) func(*schema.LogDumpContainer) {
+	value, found := r.flows.Load(f.Id)
+	if !found {
+		return nil
+	}
+	state := value.(*retryFlowState)
+	return func(container *schema.LogDumpContainer) {
+		if container.ConnectionStats != nil && state.attempts > 0 {
+			container.ConnectionStats.Attempts = state.attempts
+		}
+	}
+}
+
+// LogWith adds the number of upstream attempts of each flow to the log containers written by the
+// dumper
+func (r *RetryAddon) LogWith(dumper *MegaDumpAddon) {
+	dumper.AddContainerModifier(r.AddToLog)
+}
+
+func (r *RetryAddon) String() string {
+	return "RetryAddon"
+}
+
+func (r *RetryAddon) Close() error {
+	if !r.closed.Swap(true) {
+		log.Debug("Waiting for RetryAddon shutdown...")
+		r.wg.Wait()
+	}
+	return nil
+}
+
+// NewRetryAddon creates a new addon that retries failed upstream requests
+func NewRetryAddon(
+	maxAttempts int, // total number of upstream attempts, including the first
+	maxTime time.Duration, // upper limit on the time spent retrying a single request
+	initialBackoff, maxBackoff time.Duration, // exponential backoff settings
+	retryMedia bool, // also resend the image and audio endpoints
+	skipVerifyTLS bool, // skip upstream TLS verification, same as the proxy setting
+) *RetryAddon {
+	r := &RetryAddon{
+		maxAttempts:    maxAttempts,
+		maxTime:        maxTime,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		retryMedia:     retryMedia,
+		client:         newUpstreamClient(skipVerifyTLS),
+		rand:           rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	r.closed.Store(false) // initialize as open
+	return r
+}
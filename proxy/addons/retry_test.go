@@ -0,0 +1,237 @@
+package addons
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+func TestIsRetryableRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		expected  bool
+		withMedia bool
+	}{
+		{"GET models", "GET", "/v1/models", true, true},
+		{"POST chat completions", "POST", "/v1/chat/completions", true, true},
+		{"POST legacy completions", "POST", "/v1/completions", true, true},
+		{"POST embeddings", "POST", "/v1/embeddings", true, true},
+		{"POST anthropic messages", "POST", "/v1/messages", true, true},
+		{"POST image generations", "POST", "/v1/images/generations", false, true},
+		{"POST audio transcriptions", "POST", "/v1/audio/transcriptions", false, true},
+		{"POST file upload", "POST", "/v1/files", false, false},
+		{"DELETE file", "DELETE", "/v1/files/file-abc", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &px.Request{Method: tt.method, URL: &url.URL{Path: tt.path}}
+			assert.Equal(t, tt.expected, isRetryableRequest(req, false))
+			assert.Equal(t, tt.withMedia, isRetryableRequest(req, true))
+		})
+	}
+
+	assert.False(t, isRetryableRequest(nil, true))
+}
+
+func TestRetryHintFromHeaders(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		header        http.Header
+		expectedDelay time.Duration
+		expectedFound bool
+	}{
+		{
+			name:   "no hints",
+			header: http.Header{},
+		},
+		{
+			name:          "Retry-After seconds",
+			header:        http.Header{"Retry-After": []string{"2"}},
+			expectedDelay: 2 * time.Second,
+			expectedFound: true,
+		},
+		{
+			name:          "Retry-After http date",
+			header:        http.Header{"Retry-After": []string{now.Add(5 * time.Second).Format(http.TimeFormat)}},
+			expectedDelay: 5 * time.Second,
+			expectedFound: true,
+		},
+		{
+			name: "Retry-After-Ms preferred over Retry-After",
+			header: http.Header{
+				"Retry-After":    []string{"2"},
+				"Retry-After-Ms": []string{"1500"},
+			},
+			expectedDelay: 1500 * time.Millisecond,
+			expectedFound: true,
+		},
+		{
+			name: "token rate limit exhausted",
+			header: http.Header{
+				"X-Ratelimit-Remaining-Requests": []string{"10"},
+				"X-Ratelimit-Reset-Requests":     []string{"1s"},
+				"X-Ratelimit-Remaining-Tokens":   []string{"0"},
+				"X-Ratelimit-Reset-Tokens":       []string{"6m0s"},
+			},
+			expectedDelay: 6 * time.Minute,
+			expectedFound: true,
+		},
+		{
+			name: "rate limit not exhausted",
+			header: http.Header{
+				"X-Ratelimit-Remaining-Requests": []string{"10"},
+				"X-Ratelimit-Reset-Requests":     []string{"1s"},
+			},
+		},
+		{
+			name:   "invalid Retry-After",
+			header: http.Header{"Retry-After": []string{"soon"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, found := retryHintFromHeaders(tt.header, now)
+			assert.Equal(t, tt.expectedFound, found)
+			assert.Equal(t, tt.expectedDelay, delay)
+		})
+	}
+}
+
+func TestRetryAddon_Backoff(t *testing.T) {
+	r := NewRetryAddon(5, time.Minute, 100*time.Millisecond, 1*time.Second, false, false)
+
+	for attempt := 1; attempt < 10; attempt++ {
+		expected := 100 * time.Millisecond << (attempt - 1)
+		if expected > time.Second {
+			expected = time.Second
+		}
+		delay := r.backoff(attempt)
+		assert.GreaterOrEqual(t, delay, expected/2, "attempt %d", attempt)
+		assert.LessOrEqual(t, delay, expected, "attempt %d", attempt)
+	}
+}
+
+func newRetryTestFlow(t *testing.T, serverURL string, status int) *px.Flow {
+	t.Helper()
+	u, err := url.Parse(serverURL + "/v1/chat/completions")
+	require.NoError(t, err)
+	return &px.Flow{
+		Id: uuid.NewV4(),
+		Request: &px.Request{
+			Method: "POST",
+			URL:    u,
+			Header: http.Header{"Content-Type": []string{"application/json"}},
+			Body:   []byte(`{"model": "gpt-4o"}`),
+		},
+		Response: &px.Response{
+			StatusCode: status,
+			Header:     http.Header{},
+			Body:       []byte("first attempt"),
+		},
+	}
+}
+
+// loggedAttempts returns the number of attempts that the addon adds to the flow's log container
+func loggedAttempts(r *RetryAddon, f *px.Flow) int {
+	modify := r.AddToLog(f)
+	if modify == nil {
+		return 0
+	}
+	container := &schema.LogDumpContainer{ConnectionStats: &schema.ConnectionStatsContainer{}}
+	modify(container)
+	return container.ConnectionStats.Attempts
+}
+
+func TestRetryAddon_Response(t *testing.T) {
+	hits := new(atomic.Int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 2 {
+			w.Header().Set("Retry-After-Ms", "10")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("success"))
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Run("retry until success", func(t *testing.T) {
+		hits.Store(0)
+		r := NewRetryAddon(5, 10*time.Second, time.Millisecond, 10*time.Millisecond, false, false)
+		flow := newRetryTestFlow(t, srv.URL, http.StatusTooManyRequests)
+
+		r.Request(flow)
+		r.Response(flow)
+		assert.Equal(t, http.StatusOK, flow.Response.StatusCode)
+		assert.Equal(t, []byte("success"), flow.Response.Body)
+		assert.Equal(t, 3, loggedAttempts(r, flow))
+		assert.Equal(t, int32(2), hits.Load())
+	})
+
+	t.Run("max attempts reached", func(t *testing.T) {
+		hits.Store(-10)
+		r := NewRetryAddon(3, 10*time.Second, time.Millisecond, 10*time.Millisecond, false, false)
+		flow := newRetryTestFlow(t, srv.URL, http.StatusBadGateway)
+
+		r.Request(flow)
+		r.Response(flow)
+		assert.Equal(t, http.StatusServiceUnavailable, flow.Response.StatusCode)
+		assert.Equal(t, 3, loggedAttempts(r, flow))
+		assert.Equal(t, int32(-8), hits.Load())
+	})
+
+	t.Run("retry hint exceeds max time", func(t *testing.T) {
+		hits.Store(0)
+		r := NewRetryAddon(3, 10*time.Millisecond, time.Millisecond, 10*time.Millisecond, false, false)
+		flow := newRetryTestFlow(t, srv.URL, http.StatusTooManyRequests)
+		flow.Response.Header.Set("Retry-After", "60")
+
+		r.Request(flow)
+		r.Response(flow)
+		assert.Equal(t, http.StatusTooManyRequests, flow.Response.StatusCode)
+		assert.Equal(t, []byte("first attempt"), flow.Response.Body)
+		assert.Equal(t, 1, loggedAttempts(r, flow))
+		assert.Equal(t, int32(0), hits.Load())
+	})
+
+	t.Run("non-retryable response", func(t *testing.T) {
+		hits.Store(0)
+		r := NewRetryAddon(3, 10*time.Second, time.Millisecond, 10*time.Millisecond, false, false)
+		flow := newRetryTestFlow(t, srv.URL, http.StatusBadRequest)
+
+		r.Request(flow)
+		r.Response(flow)
+		assert.Equal(t, http.StatusBadRequest, flow.Response.StatusCode)
+		assert.Equal(t, 0, loggedAttempts(r, flow))
+		assert.Equal(t, int32(0), hits.Load())
+	})
+
+	t.Run("closed addon", func(t *testing.T) {
+		hits.Store(0)
+		r := NewRetryAddon(3, 10*time.Second, time.Millisecond, 10*time.Millisecond, false, false)
+		require.NoError(t, r.Close())
+		flow := newRetryTestFlow(t, srv.URL, http.StatusInternalServerError)
+
+		r.Request(flow)
+		r.Response(flow)
+		assert.Equal(t, http.StatusInternalServerError, flow.Response.StatusCode)
+		assert.Nil(t, r.AddToLog(flow))
+		assert.Equal(t, int32(0), hits.Load())
+	})
+}
@@ -0,0 +1,123 @@
+package addons
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/proxy/addons/rewrite"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// RequestTagsHeader is set by the client with a comma separated list of tags, used by the
+// rewrite rules to select requests, e.g., "X-Llm_proxy-Tags: batch, internal"
+const RequestTagsHeader = "X-Llm_proxy-Tags"
+
+// RewriteAddon modifies JSON request bodies before they are sent upstream, e.g., to replace the
+// model, clamp parameters, add a system prompt, or remove unsupported parameters. The changes are
+// kept per flow, and added to the flow's log entry.
+type RewriteAddon struct {
+	px.BaseAddon
+	rules  *rewrite.RuleSet
+	notes  sync.Map // key: flow ID, value: []string, one note for each change
+	closed atomic.Bool
+	wg     sync.WaitGroup
+}
+
+// requestTags parses the tags request header
+func requestTags(req *px.Request) []string {
+	tags := make([]string, 0)
+	for _, value := range req.Header.Values(RequestTagsHeader) {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+func (r *RewriteAddon) Request(f *px.Flow) {
+	if r.closed.Load() {
+		log.Warn("RewriteAddon is being closed, not rewriting request")
+		return
+	}
+	if f.Request == nil || f.Request.URL == nil {
+		return
+	}
+
+	body, err := decodeRequestJSON(f.Request)
+	if err != nil {
+		return
+	}
+
+	req := rewrite.Request{
+		Host:  f.Request.URL.Hostname(),
+		Path:  f.Request.URL.Path,
+		Model: requestModel(body),
+		Tags:  requestTags(f.Request),
+	}
+	notes := r.rules.Apply(req, body)
+	if len(notes) == 0 {
+		return
+	}
+
+	if err := encodeRequestJSON(f.Request, body); err != nil {
+		log.Errorf("error encoding rewritten request, sending the original: %v", err)
+		return
+	}
+	log.Debugf("rewrote request %s: %s", f.Request.URL, strings.Join(notes, "; "))
+	r.notes.Store(f.Id, notes)
+
+	r.wg.Add(1) // for blocking this addon during shutdown in .Close()
+	go func() {
+		defer r.wg.Done()
+		<-f.Done()
+		r.notes.Delete(f.Id)
+	}()
+}
+
+// AddToLog returns the function that adds the changes made to the flow's request to the log
+// container, or nil when the request wasn't changed. Used with MegaDumpAddon.AddContainerModifier.
+func (r *RewriteAddon) AddToLog(f *px.Flow) func(*schema.LogDumpContainer) {
+	value, found := r.notes.Load(f.Id)
+	if !found {
+		return nil
+	}
+	notes := value.([]string)
+	return func(container *schema.LogDumpContainer) {
+		if container.ConnectionStats != nil {
+			container.ConnectionStats.Rewrites = notes
+		}
+	}
+}
+
+// LogWith adds the changes made to each request to the log containers written by the dumper
+func (r *RewriteAddon) LogWith(dumper *MegaDumpAddon) {
+	dumper.AddContainerModifier(r.AddToLog)
+}
+
+func (r *RewriteAddon) String() string {
+	return "RewriteAddon"
+}
+
+func (r *RewriteAddon) Close() error {
+	if !r.closed.Swap(true) {
+		log.Debug("Waiting for RewriteAddon shutdown...")
+		r.wg.Wait()
+	}
+	return nil
+}
+
+// NewRewriteAddon creates a new request rewrite addon from a JSON rules file
+func NewRewriteAddon(rulesFile string) (*RewriteAddon, error) {
+	rules, err := rewrite.NewRuleSetFromFile(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Loaded %d request rewrite rules", len(rules.Rules))
+	return &RewriteAddon{rules: rules}, nil
+}
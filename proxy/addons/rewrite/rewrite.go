@@ -0,0 +1,60 @@
+package rewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// RuleSet is an ordered list of rewrite rules, every matching rule is applied
+type RuleSet struct {
+	Rules []Rule `json:"rules"`
+}
+
+func (rs *RuleSet) validate() error {
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i)
+		}
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Apply rewrites the JSON request body in place, and returns a note for each change. Rules are
+// applied in order, and later rules match against the model set by earlier rules.
+func (rs *RuleSet) Apply(req Request, body map[string]any) []string {
+	notes := make([]string, 0)
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		if model, ok := body["model"].(string); ok {
+			req.Model = model
+		}
+		if !r.Match.matches(req) {
+			continue
+		}
+		notes = append(notes, r.apply(req, body)...)
+	}
+	return notes
+}
+
+// NewRuleSetFromFile reads and validates a rewrite rules JSON file
+func NewRuleSetFromFile(filePath string) (*RuleSet, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rewrite rules file: %w", err)
+	}
+
+	rs := &RuleSet{}
+	if err := json.Unmarshal(data, rs); err != nil {
+		return nil, fmt.Errorf("failed to parse rewrite rules file: %w", err)
+	}
+
+	if err := rs.validate(); err != nil {
+		return nil, fmt.Errorf("invalid rewrite rules file %s: %w", filePath, err)
+	}
+	return rs, nil
+}
@@ -0,0 +1,157 @@
+package rewrite
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRules(t *testing.T, content string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "rewrite.json")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	return filePath
+}
+
+func decodeBody(t *testing.T, body string) map[string]any {
+	t.Helper()
+	decoder := json.NewDecoder(bytes.NewReader([]byte(body)))
+	decoder.UseNumber()
+	out := make(map[string]any)
+	require.NoError(t, decoder.Decode(&out))
+	return out
+}
+
+func TestNewRuleSetFromFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{
+			name:    "valid",
+			content: `{"rules": [{"match": {"models": ["gpt-4"]}, "model": "gpt-4o-mini"}]}`,
+		},
+		{
+			name:        "no rewrites",
+			content:     `{"rules": [{"name": "empty", "match": {"models": ["gpt-4"]}}]}`,
+			expectedErr: "rule empty: no rewrites defined",
+		},
+		{
+			name:        "empty clamp",
+			content:     `{"rules": [{"clamp": {"max_tokens": {}}}]}`,
+			expectedErr: "clamp max_tokens: min or max is required",
+		},
+		{
+			name:        "inverted clamp",
+			content:     `{"rules": [{"clamp": {"temperature": {"min": 1, "max": 0.5}}}]}`,
+			expectedErr: "min is greater than max",
+		},
+		{
+			name:        "bad pattern",
+			content:     `{"rules": [{"match": {"paths": ["[/v1"]}, "remove": ["user"]}]}`,
+			expectedErr: "invalid pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := NewRuleSetFromFile(writeRules(t, tt.content))
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "rule-0", rs.Rules[0].Name)
+		})
+	}
+}
+
+func TestRuleSet_Apply(t *testing.T) {
+	rs, err := NewRuleSetFromFile(writeRules(t, `{"rules": [
+		{"name": "cheap-batch", "match": {"models": ["gpt-4"], "tags": ["batch"]}, "model": "gpt-4o-mini"},
+		{"name": "limits", "match": {"models": ["gpt-4o*"]}, "clamp": {"max_tokens": {"max": 1024}, "temperature": {"min": 0, "max": 1}}},
+		{"name": "strip", "match": {"hosts": ["api.openai.com"]}, "remove": ["logit_bias"]},
+		{"name": "policy", "match": {"paths": ["/v1/chat/completions", "/v1/messages"]}, "system_prompt": "Be safe."}
+	]}`))
+	require.NoError(t, err)
+
+	openAIRequest := Request{Host: "api.openai.com", Path: "/v1/chat/completions"}
+	anthropicRequest := Request{Host: "api.anthropic.com", Path: "/v1/messages"}
+
+	tests := []struct {
+		name          string
+		req           Request
+		body          string
+		tags          []string
+		expectedBody  string
+		expectedNotes []string
+	}{
+		{
+			name: "model override for tagged request, then clamped by the new model",
+			req:  openAIRequest,
+			tags: []string{"batch"},
+			body: `{"model": "gpt-4", "max_tokens": 4096, "temperature": 1.5, "logit_bias": {"1": 2}, "messages": [{"role": "user", "content": "hi"}]}`,
+			expectedBody: `{"model": "gpt-4o-mini", "max_tokens": 1024, "temperature": 1, "messages": [` +
+				`{"role": "system", "content": "Be safe."}, {"role": "user", "content": "hi"}]}`,
+			expectedNotes: []string{
+				"cheap-batch: model gpt-4 -> gpt-4o-mini",
+				"limits: max_tokens 4096 -> 1024",
+				"limits: temperature 1.5 -> 1",
+				"strip: removed logit_bias",
+				"policy: added system prompt",
+			},
+		},
+		{
+			name:          "untagged request keeps the model",
+			req:           openAIRequest,
+			body:          `{"model": "gpt-4", "max_tokens": 4096, "messages": [{"role": "system", "content": "Be safe. And helpful."}]}`,
+			expectedBody:  `{"model": "gpt-4", "max_tokens": 4096, "messages": [{"role": "system", "content": "Be safe. And helpful."}]}`,
+			expectedNotes: []string{},
+		},
+		{
+			name:          "anthropic system prompt string",
+			req:           anthropicRequest,
+			body:          `{"model": "claude-3-5-sonnet", "system": "You are terse.", "messages": []}`,
+			expectedBody:  `{"model": "claude-3-5-sonnet", "system": "Be safe.\n\nYou are terse.", "messages": []}`,
+			expectedNotes: []string{"policy: added system prompt"},
+		},
+		{
+			name:          "anthropic system prompt blocks",
+			req:           anthropicRequest,
+			body:          `{"model": "claude-3-5-sonnet", "system": [{"type": "text", "text": "You are terse."}]}`,
+			expectedBody:  `{"model": "claude-3-5-sonnet", "system": [{"type": "text", "text": "Be safe."}, {"type": "text", "text": "You are terse."}]}`,
+			expectedNotes: []string{"policy: added system prompt"},
+		},
+		{
+			name:          "anthropic without system prompt",
+			req:           anthropicRequest,
+			body:          `{"model": "claude-3-5-sonnet"}`,
+			expectedBody:  `{"model": "claude-3-5-sonnet", "system": "Be safe."}`,
+			expectedNotes: []string{"policy: added system prompt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			req.Tags = tt.tags
+			body := decodeBody(t, tt.body)
+
+			notes := rs.Apply(req, body)
+			assert.Equal(t, tt.expectedNotes, notes)
+
+			actual, err := json.Marshal(body)
+			require.NoError(t, err)
+			expected, err := json.Marshal(decodeBody(t, tt.expectedBody))
+			require.NoError(t, err)
+			assert.JSONEq(t, string(expected), string(actual))
+		})
+	}
+}
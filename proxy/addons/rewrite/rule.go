@@ -0,0 +1,193 @@
+package rewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/proxati/llm_proxy/proxy/addons/glob"
+)
+
+// Request holds the request fields that are checked by the rule matchers
+type Request struct {
+	Host  string
+	Path  string
+	Model string
+	Tags  []string // from the tags request header, set by the client
+}
+
+// messagesAPI returns true for the Anthropic messages endpoint, which has a separate system field
+func (r Request) messagesAPI() bool {
+	return strings.HasSuffix(r.Path, "/v1/messages")
+}
+
+// Match selects the requests that a rule rewrites. The fields are lists of glob patterns, where
+// "*" also matches "/", e.g., "meta-llama/*". A request must match every field that isn't empty.
+type Match struct {
+	Hosts  []string `json:"hosts,omitempty"`
+	Paths  []string `json:"paths,omitempty"`
+	Models []string `json:"models,omitempty"`
+	Tags   []string `json:"tags,omitempty"` // at least one of the request tags must match
+}
+
+func (m *Match) validate() error {
+	if err := glob.Validate(slices.Concat(m.Hosts, m.Paths, m.Models, m.Tags)...); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Match) matches(req Request) bool {
+	return glob.MatchAny(m.Hosts, strings.ToLower(req.Host)) &&
+		glob.MatchAny(m.Paths, req.Path) &&
+		glob.MatchAny(m.Models, req.Model) &&
+		glob.MatchTags(m.Tags, req.Tags)
+}
+
+// Clamp is the allowed range for a numeric request parameter, either bound is optional
+type Clamp struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// Rule is a single rewrite rule, loaded from the rewrite rules JSON file
+type Rule struct {
+	Name         string           `json:"name"`
+	Match        Match            `json:"match"`
+	Model        string           `json:"model,omitempty"`         // replaces the requested model
+	Clamp        map[string]Clamp `json:"clamp,omitempty"`         // e.g., {"max_tokens": {"max": 1024}}
+	SystemPrompt string           `json:"system_prompt,omitempty"` // added before the other messages
+	Remove       []string         `json:"remove,omitempty"`        // top level parameters to delete
+}
+
+func (r *Rule) validate() error {
+	if err := r.Match.validate(); err != nil {
+		return err
+	}
+	for param, c := range r.Clamp {
+		if c.Min == nil && c.Max == nil {
+			return fmt.Errorf("clamp %s: min or max is required", param)
+		}
+		if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+			return fmt.Errorf("clamp %s: min is greater than max", param)
+		}
+	}
+	if r.Model == "" && len(r.Clamp) == 0 && r.SystemPrompt == "" && len(r.Remove) == 0 {
+		return fmt.Errorf("no rewrites defined")
+	}
+	return nil
+}
+
+// apply rewrites the body in place, and returns a note for each change that was made
+func (r *Rule) apply(req Request, body map[string]any) []string {
+	notes := make([]string, 0)
+	note := func(format string, args ...any) {
+		notes = append(notes, r.Name+": "+fmt.Sprintf(format, args...))
+	}
+
+	if r.Model != "" && req.Model != r.Model {
+		body["model"] = r.Model
+		note("model %s -> %s", req.Model, r.Model)
+	}
+
+	for _, param := range r.Remove {
+		if _, found := body[param]; found {
+			delete(body, param)
+			note("removed %s", param)
+		}
+	}
+
+	// sorted, so the changes are always noted in the same order
+	params := make([]string, 0, len(r.Clamp))
+	for param := range r.Clamp {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		value, ok := toFloat(body[param])
+		if !ok {
+			continue
+		}
+		clamped := value
+		c := r.Clamp[param]
+		if c.Min != nil && clamped < *c.Min {
+			clamped = *c.Min
+		}
+		if c.Max != nil && clamped > *c.Max {
+			clamped = *c.Max
+		}
+		if clamped != value {
+			body[param] = json.Number(formatFloat(clamped))
+			note("%s %s -> %s", param, formatFloat(value), formatFloat(clamped))
+		}
+	}
+
+	if r.SystemPrompt != "" && addSystemPrompt(req, body, r.SystemPrompt) {
+		note("added system prompt")
+	}
+	return notes
+}
+
+// addSystemPrompt adds the prompt before the existing system prompt or messages, unless it is
+// already present. Returns true if the body was changed.
+func addSystemPrompt(req Request, body map[string]any, prompt string) bool {
+	if req.messagesAPI() {
+		switch system := body["system"].(type) {
+		case nil:
+			body["system"] = prompt
+		case string:
+			if strings.Contains(system, prompt) {
+				return false
+			}
+			body["system"] = prompt + "\n\n" + system
+		case []any:
+			for _, block := range system {
+				if blockMap, ok := block.(map[string]any); ok && blockMap["text"] == prompt {
+					return false
+				}
+			}
+			body["system"] = append([]any{map[string]any{"type": "text", "text": prompt}}, system...)
+		default:
+			return false
+		}
+		return true
+	}
+
+	messages, ok := body["messages"].([]any)
+	if !ok {
+		return false
+	}
+	for _, message := range messages {
+		messageMap, ok := message.(map[string]any)
+		if !ok {
+			continue
+		}
+		role := messageMap["role"]
+		if content, ok := messageMap["content"].(string); ok && (role == "system" || role == "developer") && strings.Contains(content, prompt) {
+			return false
+		}
+	}
+	body["messages"] = append([]any{map[string]any{"role": "system", "content": prompt}}, messages...)
+	return true
+}
+
+// toFloat converts a decoded JSON number to a float64
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,91 @@
+package addons
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema"
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+func TestRewriteAddon(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "rewrite.json")
+	require.NoError(t, os.WriteFile(rulesFile, []byte(`{"rules": [
+		{"name": "cheap", "match": {"tags": ["batch"]}, "model": "gpt-4o-mini"},
+		{"name": "limits", "clamp": {"max_tokens": {"max": 100}}}
+	]}`), 0644))
+
+	addon, err := NewRewriteAddon(rulesFile)
+	require.NoError(t, err)
+	assert.Equal(t, "RewriteAddon", addon.String())
+
+	newFlow := func(t *testing.T, body []byte, header http.Header) *px.Flow {
+		t.Helper()
+		u, err := url.Parse("https://api.openai.com/v1/chat/completions")
+		require.NoError(t, err)
+		return &px.Flow{
+			Id:      uuid.NewV4(),
+			Request: &px.Request{Method: "POST", URL: u, Header: header, Body: body},
+		}
+	}
+
+	t.Run("rewritten and noted", func(t *testing.T) {
+		body, err := encodeBody([]byte(`{"model": "gpt-4", "max_tokens": 500}`), "gzip")
+		require.NoError(t, err)
+		flow := newFlow(t, body, http.Header{
+			"Content-Encoding": []string{"gzip"},
+			"Content-Length":   []string{"100"},
+			RequestTagsHeader:  []string{"internal, batch"},
+		})
+
+		addon.Request(flow)
+		decoded, err := utils.DecodeBody(flow.Request.Body, "gzip")
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"model": "gpt-4o-mini", "max_tokens": 100}`, string(decoded))
+		assert.NotEqual(t, "100", flow.Request.Header.Get("Content-Length"))
+
+		assert.Empty(t, flow.Request.Header.Values("X-Llm_proxy-Rewrites"))
+
+		container := &schema.LogDumpContainer{ConnectionStats: schema.NewConnectionStatusContainerWithDuration(flow, 0)}
+		addon.AddToLog(flow)(container)
+		expectedNotes := []string{"cheap: model gpt-4 -> gpt-4o-mini", "limits: max_tokens 500 -> 100"}
+		assert.Equal(t, expectedNotes, container.ConnectionStats.Rewrites)
+	})
+
+	t.Run("notes sent by the client", func(t *testing.T) {
+		flow := newFlow(t, []byte(`{"model": "gpt-4", "max_tokens": 50}`), http.Header{
+			"X-Llm_proxy-Rewrites": []string{"forged: model gpt-4 -> gpt-5"},
+		})
+		flow.Response = &px.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+
+		addon.Request(flow)
+		assert.Nil(t, addon.AddToLog(flow))
+		logLine := schema.NewConnectionStatusContainerWithDuration(flow, 0)
+		assert.Empty(t, logLine.Rewrites)
+	})
+
+	t.Run("no changes", func(t *testing.T) {
+		body := []byte(`{"model": "gpt-4", "max_tokens": 50}`)
+		flow := newFlow(t, body, http.Header{})
+
+		addon.Request(flow)
+		assert.Equal(t, body, flow.Request.Body)
+		assert.Nil(t, addon.AddToLog(flow))
+	})
+
+	t.Run("not json", func(t *testing.T) {
+		body := []byte("file upload")
+		flow := newFlow(t, body, http.Header{})
+
+		addon.Request(flow)
+		assert.Equal(t, body, flow.Request.Body)
+	})
+}
@@ -0,0 +1,88 @@
+package addons
+
+import (
+	"context"
+	"net/http"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+)
+
+// RoutedSenderAddon sends the flows that a routing addon sent to a different upstream. The proxy
+// can't send those itself: for HTTPS, it reuses the TLS connection to the host that the client
+// connected to, so the request would be sent to the original upstream, with the routed body and
+// API keys.
+//
+// Setting the response in the Request event skips the response events, so this addon runs them
+// for all of the other addons, the same way the proxy does for the responses it receives. It must
+// be the last addon added to the proxy.
+type RoutedSenderAddon struct {
+	px.BaseAddon
+	routed *FlowRoutes
+	addons []px.Addon
+	client *http.Client
+}
+
+func (s *RoutedSenderAddon) Request(f *px.Flow) {
+	if f.Response != nil || s.routed.routedBy(f.Id) == "" {
+		// already answered, or not routed, so it's sent by the proxy
+		return
+	}
+
+	resp, err := s.send(f)
+	if err != nil {
+		// answered with an error response, so the routing addons can fail over
+		log.Warnf("error sending routed request to %s: %v", f.Request.URL, err)
+		resp = newErrorResponse(http.StatusBadGateway, "api_error", "upstream_error", err.Error())
+	}
+	s.respond(f, resp)
+}
+
+// send sends the routed request, with the timeout set by the routing addon
+func (s *RoutedSenderAddon) send(f *px.Flow) (*px.Response, error) {
+	ctx := context.Background()
+	if timeout := s.routed.timeout(f.Id); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return sendUpstream(ctx, s.client, f.Request)
+}
+
+// respond runs the response events of the other addons for the upstream response
+func (s *RoutedSenderAddon) respond(f *px.Flow, resp *px.Response) {
+	body := resp.Body
+	resp.Body = nil
+	f.Response = resp
+
+	for _, addon := range s.addons {
+		addon.Responseheaders(f)
+		if f.Response.Body != nil {
+			// answered by the addon, the same as in the proxy
+			return
+		}
+	}
+
+	f.Response.Body = body
+	for _, addon := range s.addons {
+		addon.Response(f)
+	}
+}
+
+func (s *RoutedSenderAddon) String() string {
+	return "RoutedSenderAddon"
+}
+
+func (s *RoutedSenderAddon) Close() error {
+	return nil
+}
+
+// NewRoutedSenderAddon creates the addon that sends the routed flows, and runs the response events
+// of the addons, which are all of the addons added to the proxy before it
+func NewRoutedSenderAddon(routed *FlowRoutes, addons []px.Addon, skipVerifyTLS bool) *RoutedSenderAddon {
+	return &RoutedSenderAddon{
+		routed: routed,
+		addons: append([]px.Addon{}, addons...),
+		client: newUpstreamClient(skipVerifyTLS),
+	}
+}
@@ -0,0 +1,74 @@
+package addons
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// responseRecorder records the response events it receives
+type responseRecorder struct {
+	px.BaseAddon
+	events []string
+}
+
+func (r *responseRecorder) Responseheaders(f *px.Flow) {
+	r.events = append(r.events, "Responseheaders")
+}
+
+func (r *responseRecorder) Response(f *px.Flow) {
+	r.events = append(r.events, "Response: "+string(f.Response.Body))
+}
+
+func TestRoutedSenderAddon(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("routed"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	routed := NewFlowRoutes()
+	recorder := &responseRecorder{}
+	sender := NewRoutedSenderAddon(routed, []px.Addon{recorder}, false)
+	assert.Equal(t, "RoutedSenderAddon", sender.String())
+
+	newFlow := func(rawURL string) *px.Flow {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		return &px.Flow{Id: uuid.NewV4(), Request: &px.Request{Method: "GET", URL: u, Header: http.Header{}}}
+	}
+
+	t.Run("not routed", func(t *testing.T) {
+		flow := newFlow(upstream.URL)
+		sender.Request(flow)
+		assert.Nil(t, flow.Response)
+		assert.Empty(t, recorder.events)
+	})
+
+	t.Run("routed", func(t *testing.T) {
+		recorder.events = nil
+		flow := newFlow(upstream.URL)
+		require.True(t, routed.claim(flow.Id, "test"))
+		sender.Request(flow)
+		require.NotNil(t, flow.Response)
+		assert.Equal(t, http.StatusOK, flow.Response.StatusCode)
+		assert.Equal(t, "routed", string(flow.Response.Body))
+		assert.Equal(t, []string{"Responseheaders", "Response: routed"}, recorder.events)
+	})
+
+	t.Run("connection error", func(t *testing.T) {
+		recorder.events = nil
+		flow := newFlow("http://127.0.0.1:1/v1/models")
+		require.True(t, routed.claim(flow.Id, "test"))
+		sender.Request(flow)
+		require.NotNil(t, flow.Response)
+		assert.Equal(t, http.StatusBadGateway, flow.Response.StatusCode)
+		assert.Contains(t, string(flow.Response.Body), "upstream_error")
+		assert.Len(t, recorder.events, 2)
+	})
+}
@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// RuleSet is an ordered list of local routes, the first matching rule is used
+type RuleSet struct {
+	Rules []Rule `json:"rules"`
+}
+
+func (rs *RuleSet) validate() error {
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i)
+		}
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Find returns the first rule that matches the request, or nil when the request is sent to the
+// original upstream
+func (rs *RuleSet) Find(req Request) *Rule {
+	for i := range rs.Rules {
+		if rs.Rules[i].Match.matches(req) {
+			return &rs.Rules[i]
+		}
+	}
+	return nil
+}
+
+// NewRuleSetFromFile reads and validates a local routes JSON file
+func NewRuleSetFromFile(filePath string) (*RuleSet, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local routes file: %w", err)
+	}
+
+	rs := &RuleSet{}
+	if err := json.Unmarshal(data, rs); err != nil {
+		return nil, fmt.Errorf("failed to parse local routes file: %w", err)
+	}
+
+	if err := rs.validate(); err != nil {
+		return nil, fmt.Errorf("invalid local routes file %s: %w", filePath, err)
+	}
+	return rs, nil
+}
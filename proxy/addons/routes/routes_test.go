@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+func writeRules(t *testing.T, content string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "routes.json")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	return filePath
+}
+
+func TestNewRuleSetFromFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{
+			name:    "valid",
+			content: `{"rules": [{"match": {"models": ["llama*"]}, "url": "http://localhost:11434/v1"}]}`,
+		},
+		{
+			name:        "empty match",
+			content:     `{"rules": [{"name": "all", "url": "http://localhost:11434/v1"}]}`,
+			expectedErr: "rule all: match is empty",
+		},
+		{
+			name:        "missing url",
+			content:     `{"rules": [{"match": {"tags": ["local"]}}]}`,
+			expectedErr: "rule rule-0: url must include a scheme and host",
+		},
+		{
+			name:        "bad pattern",
+			content:     `{"rules": [{"match": {"models": ["[llama"]}, "url": "http://localhost:8080"}]}`,
+			expectedErr: "invalid pattern",
+		},
+		{
+			name:        "bad rate",
+			content:     `{"rules": [{"match": {"tags": ["local"]}, "url": "http://localhost:8080", "input_token_cost": "cheap"}]}`,
+			expectedErr: "invalid internal rate",
+		},
+		{
+			name:        "bad json",
+			content:     `{"rules": [`,
+			expectedErr: "failed to parse local routes file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := NewRuleSetFromFile(writeRules(t, tt.content))
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				assert.Nil(t, rs)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, rs.Rules, 1)
+			assert.Equal(t, "rule-0", rs.Rules[0].Name)
+		})
+	}
+
+	_, err := NewRuleSetFromFile(filepath.Join(t.TempDir(), "missing.json"))
+	require.ErrorContains(t, err, "failed to read local routes file")
+}
+
+func TestFind(t *testing.T) {
+	rs, err := NewRuleSetFromFile(writeRules(t, `{"rules": [
+		{"name": "ollama", "match": {"models": ["llama*", "qwen*"]}, "url": "http://localhost:11434/v1"},
+		{"name": "hf", "match": {"models": ["meta-llama/*"]}, "url": "http://gpu-box:8001/v1"},
+		{"name": "vllm", "match": {"hosts": ["api.openai.com"], "tags": ["local-*"]}, "url": "http://gpu-box:8000/v1"}
+	]}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		req      Request
+		expected string
+	}{
+		{name: "model", req: Request{Host: "api.openai.com", Model: "llama3.1:8b"}, expected: "ollama"},
+		{name: "model with a slash", req: Request{Host: "api.openai.com", Model: "meta-llama/Llama-3.1-8B-Instruct"}, expected: "hf"},
+		{name: "first match wins", req: Request{Host: "api.openai.com", Model: "qwen2", Tags: []string{"local-dev"}}, expected: "ollama"},
+		{name: "tag", req: Request{Host: "API.openai.com", Model: "gpt-4o", Tags: []string{"team-a", "local-dev"}}, expected: "vllm"},
+		{name: "tag on another host", req: Request{Host: "api.anthropic.com", Tags: []string{"local-dev"}}},
+		{name: "no match", req: Request{Host: "api.openai.com", Model: "gpt-4o"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := rs.Find(tt.req)
+			if tt.expected == "" {
+				assert.Nil(t, rule)
+				return
+			}
+			require.NotNil(t, rule)
+			assert.Equal(t, tt.expected, rule.Name)
+		})
+	}
+}
+
+func TestTargetURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseURL  string
+		client   string
+		expected string
+	}{
+		{
+			name:     "ollama",
+			baseURL:  "http://localhost:11434/v1",
+			client:   "https://api.openai.com/v1/chat/completions",
+			expected: "http://localhost:11434/v1/chat/completions",
+		},
+		{
+			name:     "root base url",
+			baseURL:  "http://localhost:8080/",
+			client:   "https://api.openai.com/v1/embeddings?debug=1",
+			expected: "http://localhost:8080/embeddings?debug=1",
+		},
+		{
+			name:     "base path",
+			baseURL:  "https://gpu-box.internal/llm/v1",
+			client:   "https://api.openai.com/v1/models",
+			expected: "https://gpu-box.internal/llm/v1/models",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &Rule{Match: Match{Tags: []string{"local"}}, URL: tt.baseURL}
+			require.NoError(t, rule.validate())
+			clientURL, err := url.Parse(tt.client)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, rule.TargetURL(clientURL).String())
+		})
+	}
+}
+
+func TestRate(t *testing.T) {
+	rule := &Rule{}
+	assert.Equal(t, "0 0 USD", rule.Rate().String())
+
+	rule = &Rule{InputTokenCost: "0.0000001", OutputTokenCost: "0.0000002", Currency: "EUR"}
+	assert.Equal(t, schema.InternalRate{InputTokenCost: "0.0000001", OutputTokenCost: "0.0000002", Currency: "EUR"}, rule.Rate())
+}
@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/proxati/llm_proxy/proxy/addons/glob"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// Request holds the request fields that are checked by the rule matchers
+type Request struct {
+	Host  string
+	Path  string
+	Model string   // empty when the request body doesn't contain a model
+	Tags  []string // from the tags request header, set by the client
+}
+
+// Match selects the requests that are sent to a local server. The patterns are matched by the
+// glob package, so "*" matches model names with a "/", which many local servers use. At least one
+// field must be set.
+type Match struct {
+	Hosts  []string `json:"hosts,omitempty"`
+	Paths  []string `json:"paths,omitempty"`
+	Models []string `json:"models,omitempty"`
+	Tags   []string `json:"tags,omitempty"` // at least one of the request tags must match
+}
+
+func (m *Match) validate() error {
+	if err := glob.Validate(slices.Concat(m.Hosts, m.Paths, m.Models, m.Tags)...); err != nil {
+		return err
+	}
+	if len(m.Hosts)+len(m.Paths)+len(m.Models)+len(m.Tags) == 0 {
+		return fmt.Errorf("match is empty, at least one pattern is required")
+	}
+	return nil
+}
+
+// matches returns true if the request matches every field, and any of the tags
+func (m *Match) matches(req Request) bool {
+	return glob.MatchAny(m.Hosts, strings.ToLower(req.Host)) &&
+		glob.MatchAny(m.Paths, req.Path) &&
+		glob.MatchAny(m.Models, req.Model) &&
+		glob.MatchTags(m.Tags, req.Tags)
+}
+
+// Rule sends the matching requests to a local OpenAI-compatible server, e.g., Ollama, llama.cpp,
+// or vLLM, loaded from the local routes JSON file. The client's API key is never sent to the
+// server, and the responses are priced at the internal rate, which is free unless the token
+// costs are set.
+type Rule struct {
+	Name            string `json:"name"`
+	Match           Match  `json:"match"`
+	URL             string `json:"url"`                         // base URL, e.g., http://localhost:11434/v1
+	Model           string `json:"model,omitempty"`             // replaces the requested model, e.g., "llama3.1:8b"
+	APIKey          string `json:"api_key,omitempty"`           // sent as a bearer token, e.g., for vllm --api-key
+	InputTokenCost  string `json:"input_token_cost,omitempty"`  // per token, e.g., "0.0000001"
+	OutputTokenCost string `json:"output_token_cost,omitempty"` // per token
+	Currency        string `json:"currency,omitempty"`          // default: USD
+	baseURL         *url.URL
+}
+
+func (r *Rule) validate() error {
+	if err := r.Match.validate(); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url %s: %w", r.URL, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("url must include a scheme and host: %s", r.URL)
+	}
+	r.baseURL = u
+
+	if err := r.Rate().Validate(); err != nil {
+		return fmt.Errorf("invalid internal rate: %w", err)
+	}
+	return nil
+}
+
+// TargetURL builds the local server URL for a client request, by replacing the "/v1" prefix of
+// the client's path with the rule's base URL
+func (r *Rule) TargetURL(clientURL *url.URL) *url.URL {
+	target := *r.baseURL
+	target.Path = strings.TrimSuffix(r.baseURL.Path, "/") + strings.TrimPrefix(clientURL.Path, "/v1")
+	target.RawQuery = clientURL.RawQuery
+	return &target
+}
+
+// Rate returns the internal rate that the responses from this server are priced at
+func (r *Rule) Rate() schema.InternalRate {
+	return schema.InternalRate{
+		InputTokenCost:  r.InputTokenCost,
+		OutputTokenCost: r.OutputTokenCost,
+		Currency:        r.Currency,
+	}
+}
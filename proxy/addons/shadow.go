@@ -0,0 +1,280 @@
+package addons
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// shadowPath is the endpoint that is mirrored, only chat completions are compared
+const shadowPath = "/chat/completions"
+
+// shadowAuthHeaders are removed from a mirrored request that is sent to another host, so the
+// client's API key isn't sent to the candidate backend
+var shadowAuthHeaders = []string{"Authorization", "Api-Key", "X-Api-Key"}
+
+// shadowResult is a mirrored request in progress, container is set when done is closed
+type shadowResult struct {
+	done      chan struct{}
+	container *schema.ShadowContainer
+}
+
+// ShadowAddon mirrors a share of the chat completion requests to a candidate backend or model,
+// without changing the response that the client gets. The shadow request is sent at the same
+// time as the original, and its response, latency and cost are added to the log by the
+// MegaDumpAddon, or written to the log output when there is no MegaDumpAddon. The cost is from
+// the embedded prices, or from the auditor's prices when it's set with PriceWith.
+type ShadowAddon struct {
+	px.BaseAddon
+	baseURL           *url.URL // nil sends to the original host
+	model             string   // empty keeps the original model
+	apiKey            string   // replaces the client's API key, when set
+	share             float64
+	timeout           time.Duration // 0 is unlimited
+	client            *http.Client
+	costCounter       *schema.CostCounter
+	filterReqHeaders  []string
+	filterRespHeaders []string
+	logged            bool     // the results are added to the MegaDumpAddon log containers
+	pending           sync.Map // key: *px.Flow, value: *shadowResult, removed when the flow is done
+	ctx               context.Context
+	cancel            context.CancelFunc
+	closed            atomic.Bool
+	wg                sync.WaitGroup
+}
+
+// targetURL builds the shadow URL, by replacing the "/v1" prefix of the client's path with the
+// base URL, the same as the load balancer backends
+func (s *ShadowAddon) targetURL(clientURL *url.URL) *url.URL {
+	if s.baseURL == nil {
+		u := *clientURL
+		return &u
+	}
+	target := *s.baseURL
+	target.Path = strings.TrimSuffix(s.baseURL.Path, "/") + strings.TrimPrefix(clientURL.Path, "/v1")
+	target.RawQuery = clientURL.RawQuery
+	return &target
+}
+
+// newShadowRequest copies the client's request, for the candidate backend and model
+func (s *ShadowAddon) newShadowRequest(req *px.Request) (*px.Request, error) {
+	snapshot := newRequestSnapshot(req)
+	shadowReq := &px.Request{
+		Method: req.Method,
+		URL:    s.targetURL(snapshot.url),
+		Proto:  req.Proto,
+		Header: snapshot.header,
+		Body:   snapshot.body,
+	}
+
+	if shadowReq.URL.Host != req.URL.Host || s.apiKey != "" {
+		for _, header := range shadowAuthHeaders {
+			shadowReq.Header.Del(header)
+		}
+	}
+	if s.apiKey != "" {
+		shadowReq.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	if s.model != "" {
+		body, err := decodeRequestJSON(shadowReq)
+		if err != nil {
+			return nil, err
+		}
+		body["model"] = s.model
+		if err := encodeRequestJSON(shadowReq, body); err != nil {
+			return nil, err
+		}
+	}
+	return shadowReq, nil
+}
+
+// send mirrors a request, and converts the result for the log
+func (s *ShadowAddon) send(shadowReq *px.Request) *schema.ShadowContainer {
+	container := &schema.ShadowContainer{}
+	if req, err := schema.NewProxyRequestFromMITMRequest(shadowReq, s.filterReqHeaders); err == nil {
+		container.Request = req
+	}
+
+	ctx := s.ctx
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	resp, err := sendUpstream(ctx, s.client, shadowReq)
+	container.Duration = time.Since(start).Milliseconds()
+	if err != nil {
+		container.Error = err.Error()
+		return container
+	}
+
+	container.Response, err = schema.NewProxyResponseFromMITMResponse(resp, s.filterRespHeaders)
+	if err != nil {
+		container.Error = err.Error()
+		return container
+	}
+	if container.Request == nil {
+		return container
+	}
+
+	auditOutput, err := s.costCounter.Price(*container.Request, *container.Response)
+	if err != nil {
+		log.Debugf("not pricing shadow response for %s: %v", shadowReq.URL, err)
+		return container
+	}
+	container.Model = auditOutput.Model
+	container.InputTokens = auditOutput.InputTokens + auditOutput.CachedTokens
+	container.OutputTokens = auditOutput.OutputTokens + auditOutput.ReasoningTokens
+	container.Cost = auditOutput.Cost
+	container.Currency = auditOutput.Currency
+	return container
+}
+
+// sampled returns true for the share of requests that are mirrored
+func (s *ShadowAddon) sampled() bool {
+	return s.share >= 1 || rand.Float64() < s.share
+}
+
+func (s *ShadowAddon) Request(f *px.Flow) {
+	if f.Response != nil || s.closed.Load() {
+		// already answered, e.g., from the cache
+		return
+	}
+	if f.Request.Method != http.MethodPost || !strings.HasSuffix(f.Request.URL.Path, shadowPath) || !s.sampled() {
+		return
+	}
+
+	shadowReq, err := s.newShadowRequest(f.Request)
+	if err != nil {
+		log.Warnf("not mirroring request to %s: %v", f.Request.URL, err)
+		return
+	}
+
+	result := &shadowResult{done: make(chan struct{})}
+	if s.logged {
+		s.pending.Store(f, result)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			// the dumper takes the result before the flow is done
+			select {
+			case <-f.Done():
+			case <-s.ctx.Done():
+			}
+			s.pending.Delete(f)
+		}()
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(result.done)
+		result.container = s.send(shadowReq)
+
+		if s.logged {
+			return
+		}
+		if result.container.Error != "" {
+			log.Warnf("shadow request to %s failed: %s", shadowReq.URL, result.container.Error)
+			return
+		}
+		log.Infof(
+			"shadow response from %s: status %d, model %s, %dms, cost %s %s",
+			shadowReq.URL, result.container.Response.Status, result.container.Model,
+			result.container.Duration, result.container.Cost, result.container.Currency,
+		)
+	}()
+}
+
+// AddToLog takes the shadow result for a flow, and returns the function that adds it to the log
+// container, after waiting for the shadow request to finish. It returns nil when the flow wasn't
+// mirrored. Used with MegaDumpAddon.AddContainerModifier.
+func (s *ShadowAddon) AddToLog(f *px.Flow) func(*schema.LogDumpContainer) {
+	value, found := s.pending.LoadAndDelete(f)
+	if !found {
+		return nil
+	}
+	result := value.(*shadowResult)
+	return func(container *schema.LogDumpContainer) {
+		<-result.done
+		container.Shadow = result.container
+	}
+}
+
+// LogWith adds the shadow results to the log containers written by the dumper, instead of the
+// log output
+func (s *ShadowAddon) LogWith(dumper *MegaDumpAddon) {
+	s.logged = true
+	dumper.AddContainerModifier(s.AddToLog)
+}
+
+// PriceWith prices the shadow responses with the auditor's prices, including its pricing file.
+// The shadow costs are not added to the auditor's totals, stats, or budget.
+func (s *ShadowAddon) PriceWith(auditor *APIAuditorAddon) {
+	s.costCounter = auditor.costCounter
+}
+
+func (s *ShadowAddon) String() string {
+	return "ShadowAddon"
+}
+
+// Close cancels the shadow requests in progress
+func (s *ShadowAddon) Close() error {
+	if !s.closed.Swap(true) {
+		s.cancel()
+		s.wg.Wait()
+	}
+	return nil
+}
+
+// NewShadowAddon creates an addon that mirrors a share (0 to 1) of the chat completion requests.
+// The baseURL replaces the "/v1" prefix of the request path, e.g., http://localhost:11434/v1, and
+// the model replaces the model in the request body. When baseURL is empty the requests are sent to
+// the original host, and the client's API key is only sent to the original host.
+func NewShadowAddon(
+	baseURL, model, apiKey string,
+	share float64,
+	timeout time.Duration,
+	skipVerifyTLS bool,
+	filterReqHeaders, filterRespHeaders []string,
+) (*ShadowAddon, error) {
+	if baseURL == "" && model == "" {
+		return nil, fmt.Errorf("a shadow URL or model is required")
+	}
+	if share <= 0 || share > 1 {
+		return nil, fmt.Errorf("shadow share must be greater than 0, and at most 1: %v", share)
+	}
+
+	s := &ShadowAddon{
+		model:             model,
+		apiKey:            apiKey,
+		share:             share,
+		timeout:           timeout,
+		client:            newUpstreamClient(skipVerifyTLS),
+		costCounter:       schema.NewCostCounterDefaults(),
+		filterReqHeaders:  filterReqHeaders,
+		filterRespHeaders: filterRespHeaders,
+	}
+	if baseURL != "" {
+		u, err := url.Parse(baseURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("shadow url must include a scheme and host: %s", baseURL)
+		}
+		s.baseURL = u
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s, nil
+}
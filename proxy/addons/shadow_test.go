@@ -0,0 +1,206 @@
+package addons
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/config"
+	md "github.com/proxati/llm_proxy/proxy/addons/megadumper"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// shadowTransport answers every request with a chat completion, and records the requests
+type shadowTransport struct {
+	requests chan *http.Request
+	bodies   chan string
+}
+
+func (st *shadowTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	st.requests <- req
+	st.bodies <- string(body)
+	respBody := `{"model": "gpt-4o-mini", "choices": [{"message": {"content": "Hi"}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 1000, "completion_tokens": 100}}`
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(respBody)),
+		Request:    req,
+	}, nil
+}
+
+func newShadowFlow(rawURL, body string) *px.Flow {
+	reqURL, _ := url.Parse(rawURL)
+	return &px.Flow{Request: &px.Request{
+		Method: http.MethodPost,
+		URL:    reqURL,
+		Header: http.Header{"Authorization": []string{"Bearer client-key"}, "Content-Type": []string{"application/json"}},
+		Body:   []byte(body),
+	}}
+}
+
+func TestShadowAddon(t *testing.T) {
+	const reqBody = `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hello"}]}`
+
+	t.Run("candidate model, logged", func(t *testing.T) {
+		s, err := NewShadowAddon("", "gpt-4o-mini", "", 1, time.Minute, false, []string{"Authorization"}, nil)
+		require.NoError(t, err)
+		defer s.Close()
+		transport := &shadowTransport{requests: make(chan *http.Request, 1), bodies: make(chan string, 1)}
+		s.client = &http.Client{Transport: transport}
+
+		dumper, err := NewMegaDirDumper(t.TempDir(), md.Format_JSON, config.LogSourceConfigAllTrue, nil, nil, nil)
+		require.NoError(t, err)
+		s.LogWith(dumper)
+		assert.Len(t, dumper.modifiers, 1)
+
+		f := newShadowFlow("https://api.openai.com/v1/chat/completions", reqBody)
+		s.Request(f)
+		assert.Nil(t, f.Response, "the client's request is not answered")
+
+		req := <-transport.requests
+		assert.Equal(t, "https://api.openai.com/v1/chat/completions", req.URL.String())
+		assert.Equal(t, "Bearer client-key", req.Header.Get("Authorization"), "the same host gets the client's key")
+		assert.JSONEq(t, `{"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "Hello"}]}`, <-transport.bodies)
+		assert.JSONEq(t, reqBody, string(f.Request.Body), "the client's request isn't changed")
+
+		// taken by the dumper before the flow is done
+		f.Response = &px.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+		dumper.Responseheaders(f)
+		value, found := dumper.captured.Load(f.Id)
+		require.True(t, found)
+		capture := value.(*flowCapture)
+		require.Len(t, capture.modifiers, 1)
+		_, found = s.pending.Load(f)
+		assert.False(t, found)
+
+		container := &schema.LogDumpContainer{}
+		capture.modifiers[0](container)
+		require.NotNil(t, container.Shadow)
+		assert.Empty(t, container.Shadow.Error)
+		assert.Equal(t, http.StatusOK, container.Shadow.Response.Status)
+		assert.Equal(t, "gpt-4o-mini", container.Shadow.Model)
+		assert.Equal(t, 1000, container.Shadow.InputTokens)
+		assert.Equal(t, 100, container.Shadow.OutputTokens)
+		assert.Equal(t, "USD", container.Shadow.Currency)
+		assert.NotEmpty(t, container.Shadow.Cost)
+		assert.Empty(t, container.Shadow.Request.Header.Get("Authorization"), "filtered from the log")
+
+		data, err := json.Marshal(container)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"shadow":{`)
+
+		assert.Nil(t, s.AddToLog(f), "each result is only added once")
+	})
+
+	t.Run("pending removed when closed", func(t *testing.T) {
+		s, err := NewShadowAddon("", "gpt-4o-mini", "", 1, time.Minute, false, nil, nil)
+		require.NoError(t, err)
+		transport := &shadowTransport{requests: make(chan *http.Request, 1), bodies: make(chan string, 1)}
+		s.client = &http.Client{Transport: transport}
+		s.logged = true
+
+		f := newShadowFlow("https://api.openai.com/v1/chat/completions", reqBody)
+		s.Request(f)
+		_, found := s.pending.Load(f)
+		assert.True(t, found)
+
+		// the flow is never done in the tests, closing also removes the results
+		require.NoError(t, s.Close())
+		_, found = s.pending.Load(f)
+		assert.False(t, found)
+	})
+
+	t.Run("priced with the auditor's prices", func(t *testing.T) {
+		pricingPath := filepath.Join(t.TempDir(), "pricing.json")
+		require.NoError(t, os.WriteFile(pricingPath, []byte(`[{
+			"url": "https://api.openai.com/v1/chat/completions",
+			"products": [{"name": "gpt-4o-mini", "inputTokenCost": "1", "outputTokenCost": "0", "currency": "USD"}]
+		}]`), 0o644))
+		aud, err := NewAPIAuditor(APIAuditorOptions{PricingPath: pricingPath})
+		require.NoError(t, err)
+		defer aud.Close()
+
+		s, err := NewShadowAddon("", "gpt-4o-mini", "", 1, time.Minute, false, nil, nil)
+		require.NoError(t, err)
+		defer s.Close()
+		s.client = &http.Client{Transport: &shadowTransport{requests: make(chan *http.Request, 1), bodies: make(chan string, 1)}}
+		s.PriceWith(aud)
+
+		shadowReq, err := s.newShadowRequest(newShadowFlow("https://api.openai.com/v1/chat/completions", reqBody).Request)
+		require.NoError(t, err)
+		container := s.send(shadowReq)
+		assert.Equal(t, "1000", container.Cost, "1000 input tokens at the pricing file rate")
+		assert.True(t, aud.costCounter.GrandTotal().IsZero(), "not added to the auditor's total")
+		assert.Empty(t, aud.Stats())
+	})
+
+	t.Run("candidate backend", func(t *testing.T) {
+		received := make(chan *http.Request, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- r
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		s, err := NewShadowAddon(server.URL+"/api/v1", "", "candidate-key", 1, time.Minute, false, nil, nil)
+		require.NoError(t, err)
+		defer s.Close()
+
+		s.Request(newShadowFlow("https://api.openai.com/v1/chat/completions?api-version=1", reqBody))
+		req := <-received
+		assert.Equal(t, "/api/v1/chat/completions", req.URL.Path)
+		assert.Equal(t, "api-version=1", req.URL.RawQuery)
+		assert.Equal(t, "Bearer candidate-key", req.Header.Get("Authorization"))
+	})
+
+	t.Run("not mirrored", func(t *testing.T) {
+		s, err := NewShadowAddon("", "gpt-4o-mini", "", 1, time.Minute, false, nil, nil)
+		require.NoError(t, err)
+		defer s.Close()
+		s.logged = true
+
+		flows := []*px.Flow{
+			newShadowFlow("https://api.openai.com/v1/embeddings", `{"model": "text-embedding-3-small", "input": "x"}`),
+			newShadowFlow("https://api.openai.com/v1/chat/completions", reqBody),
+		}
+		flows[1].Response = &px.Response{StatusCode: http.StatusOK} // e.g., a cache hit
+		for _, f := range flows {
+			s.Request(f)
+			_, found := s.pending.Load(f)
+			assert.False(t, found)
+		}
+	})
+
+	t.Run("share", func(t *testing.T) {
+		s, err := NewShadowAddon("", "gpt-4o-mini", "", 0.25, time.Minute, false, nil, nil)
+		require.NoError(t, err)
+		sampled := 0
+		for range 1000 {
+			if s.sampled() {
+				sampled++
+			}
+		}
+		assert.InDelta(t, 250, sampled, 60)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := NewShadowAddon("", "", "", 1, time.Minute, false, nil, nil)
+		assert.ErrorContains(t, err, "a shadow URL or model is required")
+		_, err = NewShadowAddon("", "gpt-4o-mini", "", 0, time.Minute, false, nil, nil)
+		assert.ErrorContains(t, err, "shadow share")
+		_, err = NewShadowAddon("localhost:11434", "", "", 1, time.Minute, false, nil, nil)
+		assert.ErrorContains(t, err, "must include a scheme and host")
+	})
+}
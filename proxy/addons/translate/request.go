@@ -0,0 +1,315 @@
+// Package translate converts between the OpenAI chat completions API, and the Anthropic
+// messages API, so OpenAI clients can use Anthropic models without code changes.
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// AnthropicVersion is sent in the anthropic-version header of translated requests
+	AnthropicVersion = "2023-06-01"
+
+	// AnthropicMessagesPath is the path of the Anthropic API endpoint that receives translated requests
+	AnthropicMessagesPath = "/v1/messages"
+
+	// defaultMaxTokens is used when the OpenAI request doesn't set a limit, Anthropic requires one
+	defaultMaxTokens = 4096
+)
+
+// RequestInfo describes the original OpenAI request, needed to translate the response
+type RequestInfo struct {
+	Model        string
+	Stream       bool
+	IncludeUsage bool // the client asked for a usage chunk at the end of the stream
+}
+
+// OpenAIToAnthropicRequest converts an OpenAI chat completions request body into an Anthropic
+// messages request body. OpenAI parameters without an Anthropic equivalent (e.g., n, seed,
+// logit_bias) are dropped.
+func OpenAIToAnthropicRequest(body []byte) ([]byte, *RequestInfo, error) {
+	req := openAIRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, nil, fmt.Errorf("error parsing chat completions request: %w", err)
+	}
+	if req.Model == "" {
+		return nil, nil, fmt.Errorf("model is required")
+	}
+
+	out := anthropicRequest{
+		Model:       req.Model,
+		MaxTokens:   defaultMaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+	}
+
+	switch {
+	case req.MaxCompletionTokens != nil:
+		out.MaxTokens = *req.MaxCompletionTokens
+	case req.MaxTokens != nil:
+		out.MaxTokens = *req.MaxTokens
+	}
+
+	// OpenAI allows a temperature up to 2, Anthropic up to 1
+	if out.Temperature != nil && *out.Temperature > 1 {
+		maxTemperature := 1.0
+		out.Temperature = &maxTemperature
+	}
+
+	if req.User != "" {
+		out.Metadata = &anthropicMetadata{UserID: req.User}
+	}
+
+	var err error
+	if out.StopSequences, err = parseStop(req.Stop); err != nil {
+		return nil, nil, err
+	}
+
+	if out.System, out.Messages, err = convertMessages(req.Messages); err != nil {
+		return nil, nil, err
+	}
+
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			return nil, nil, fmt.Errorf("unsupported tool type: %s", tool.Type)
+		}
+		schema := tool.Function.Parameters
+		if len(schema) == 0 || string(schema) == "null" {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		out.Tools = append(out.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	if out.ToolChoice, err = convertToolChoice(req.ToolChoice); err != nil {
+		return nil, nil, err
+	}
+
+	translated, err := json.Marshal(out)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding messages request: %w", err)
+	}
+
+	info := &RequestInfo{Model: req.Model, Stream: req.Stream}
+	if req.StreamOptions != nil {
+		info.IncludeUsage = req.StreamOptions.IncludeUsage
+	}
+	return translated, info, nil
+}
+
+// parseStop converts the stop parameter, which is a string or a list of strings
+func parseStop(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var stop string
+	if err := json.Unmarshal(raw, &stop); err == nil {
+		return []string{stop}, nil
+	}
+
+	var stops []string
+	if err := json.Unmarshal(raw, &stops); err != nil {
+		return nil, fmt.Errorf("invalid stop parameter: %w", err)
+	}
+	return stops, nil
+}
+
+// convertToolChoice converts the tool_choice parameter, which is a string or an object
+func convertToolChoice(raw json.RawMessage) (*anthropicToolChoice, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var choice string
+	if err := json.Unmarshal(raw, &choice); err == nil {
+		switch choice {
+		case "auto":
+			return &anthropicToolChoice{Type: "auto"}, nil
+		case "required":
+			return &anthropicToolChoice{Type: "any"}, nil
+		case "none":
+			return &anthropicToolChoice{Type: "none"}, nil
+		default:
+			return nil, fmt.Errorf("unsupported tool_choice: %s", choice)
+		}
+	}
+
+	named := struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}{}
+	if err := json.Unmarshal(raw, &named); err != nil || named.Function.Name == "" {
+		return nil, fmt.Errorf("invalid tool_choice: %s", raw)
+	}
+	return &anthropicToolChoice{Type: "tool", Name: named.Function.Name}, nil
+}
+
+// parseContent returns the content parts of a message, a plain string is returned as a single text part
+func parseContent(raw json.RawMessage) ([]openAIContentPart, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []openAIContentPart{{Type: "text", Text: text}}, nil
+	}
+
+	var parts []openAIContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, fmt.Errorf("invalid message content: %w", err)
+	}
+	return parts, nil
+}
+
+// contentText joins the text parts of a message
+func contentText(raw json.RawMessage) (string, error) {
+	parts, err := parseContent(raw)
+	if err != nil {
+		return "", err
+	}
+
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// convertImage converts an image_url part, which is either a URL or a base64 data URL
+func convertImage(imageURL *openAIImageURL) (anthropicContent, error) {
+	if imageURL == nil || imageURL.URL == "" {
+		return anthropicContent{}, fmt.Errorf("image_url is empty")
+	}
+
+	dataURL, found := strings.CutPrefix(imageURL.URL, "data:")
+	if !found {
+		return anthropicContent{
+			Type:   "image",
+			Source: &anthropicImageSource{Type: "url", URL: imageURL.URL},
+		}, nil
+	}
+
+	// e.g., data:image/png;base64,iVBORw0KGgo...
+	mediaType, data, found := strings.Cut(dataURL, ",")
+	mediaType, isBase64 := strings.CutSuffix(mediaType, ";base64")
+	if !found || !isBase64 {
+		return anthropicContent{}, fmt.Errorf("unsupported image data URL, only base64 is supported")
+	}
+	return anthropicContent{
+		Type:   "image",
+		Source: &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data},
+	}, nil
+}
+
+// convertContent converts the content of a user or assistant message to content blocks
+func convertContent(raw json.RawMessage) ([]anthropicContent, error) {
+	parts, err := parseContent(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]anthropicContent, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" { // empty text blocks are rejected by the messages API
+				blocks = append(blocks, anthropicContent{Type: "text", Text: part.Text})
+			}
+		case "image_url":
+			image, err := convertImage(part.ImageURL)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, image)
+		default:
+			return nil, fmt.Errorf("unsupported content part type: %s", part.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// convertMessages returns the system prompt, and the messages converted to content blocks. The
+// messages API requires alternating roles, so consecutive messages with the same role are merged.
+func convertMessages(messages []openAIMessage) (string, []anthropicMessage, error) {
+	systemPrompts := make([]string, 0)
+	out := make([]anthropicMessage, 0, len(messages))
+
+	appendBlocks := func(role string, blocks []anthropicContent) {
+		if len(blocks) == 0 {
+			return
+		}
+		if len(out) > 0 && out[len(out)-1].Role == role {
+			out[len(out)-1].Content = append(out[len(out)-1].Content, blocks...)
+			return
+		}
+		out = append(out, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for i, message := range messages {
+		switch message.Role {
+		case "system", "developer":
+			text, err := contentText(message.Content)
+			if err != nil {
+				return "", nil, fmt.Errorf("message %d: %w", i, err)
+			}
+			systemPrompts = append(systemPrompts, text)
+
+		case "user":
+			blocks, err := convertContent(message.Content)
+			if err != nil {
+				return "", nil, fmt.Errorf("message %d: %w", i, err)
+			}
+			appendBlocks("user", blocks)
+
+		case "assistant":
+			blocks, err := convertContent(message.Content)
+			if err != nil {
+				return "", nil, fmt.Errorf("message %d: %w", i, err)
+			}
+			for _, call := range message.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if len(bytes.TrimSpace(input)) == 0 {
+					input = json.RawMessage("{}")
+				} else if !json.Valid(input) {
+					return "", nil, fmt.Errorf("message %d: tool call %s has invalid JSON arguments", i, call.ID)
+				}
+				blocks = append(blocks, anthropicContent{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: input,
+				})
+			}
+			appendBlocks("assistant", blocks)
+
+		case "tool":
+			text, err := contentText(message.Content)
+			if err != nil {
+				return "", nil, fmt.Errorf("message %d: %w", i, err)
+			}
+			appendBlocks("user", []anthropicContent{{
+				Type:      "tool_result",
+				ToolUseID: message.ToolCallID,
+				Content:   text,
+			}})
+
+		default:
+			return "", nil, fmt.Errorf("message %d: unsupported role: %s", i, message.Role)
+		}
+	}
+
+	return strings.Join(systemPrompts, "\n\n"), out, nil
+}
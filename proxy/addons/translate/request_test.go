@@ -0,0 +1,147 @@
+package translate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIToAnthropicRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		expected     string
+		expectedInfo RequestInfo
+		expectedErr  string
+	}{
+		{
+			name: "messages and parameters",
+			input: `{
+				"model": "claude-3-5-sonnet-latest",
+				"messages": [
+					{"role": "system", "content": "You are terse."},
+					{"role": "developer", "content": [{"type": "text", "text": "Answer in English."}]},
+					{"role": "user", "content": "Hello"},
+					{"role": "user", "content": [
+						{"type": "text", "text": "What is this?"},
+						{"type": "image_url", "image_url": {"url": "data:image/png;base64,aGVsbG8="}},
+						{"type": "image_url", "image_url": {"url": "https://example.com/cat.jpg"}}
+					]}
+				],
+				"max_tokens": 100,
+				"temperature": 0,
+				"top_p": 0.9,
+				"stop": "END",
+				"n": 1,
+				"seed": 42,
+				"user": "user-123"
+			}`,
+			expected: `{
+				"model": "claude-3-5-sonnet-latest",
+				"system": "You are terse.\n\nAnswer in English.",
+				"messages": [
+					{"role": "user", "content": [
+						{"type": "text", "text": "Hello"},
+						{"type": "text", "text": "What is this?"},
+						{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "aGVsbG8="}},
+						{"type": "image", "source": {"type": "url", "url": "https://example.com/cat.jpg"}}
+					]}
+				],
+				"max_tokens": 100,
+				"temperature": 0,
+				"top_p": 0.9,
+				"stop_sequences": ["END"],
+				"metadata": {"user_id": "user-123"}
+			}`,
+			expectedInfo: RequestInfo{Model: "claude-3-5-sonnet-latest"},
+		},
+		{
+			name: "tools and streaming",
+			input: `{
+				"model": "claude-3-5-haiku-latest",
+				"messages": [
+					{"role": "user", "content": "Weather in Paris?"},
+					{"role": "assistant", "content": null, "tool_calls": [
+						{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}
+					]},
+					{"role": "tool", "tool_call_id": "call_1", "content": "18C and sunny"}
+				],
+				"tools": [
+					{"type": "function", "function": {"name": "get_weather", "description": "Get the weather", "parameters": {"type": "object", "properties": {"city": {"type": "string"}}}}},
+					{"type": "function", "function": {"name": "no_params"}}
+				],
+				"tool_choice": {"type": "function", "function": {"name": "get_weather"}},
+				"max_completion_tokens": 50,
+				"max_tokens": 10,
+				"temperature": 1.7,
+				"stop": ["a", "b"],
+				"stream": true,
+				"stream_options": {"include_usage": true}
+			}`,
+			expected: `{
+				"model": "claude-3-5-haiku-latest",
+				"messages": [
+					{"role": "user", "content": [{"type": "text", "text": "Weather in Paris?"}]},
+					{"role": "assistant", "content": [{"type": "tool_use", "id": "call_1", "name": "get_weather", "input": {"city": "Paris"}}]},
+					{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "call_1", "content": "18C and sunny"}]}
+				],
+				"tools": [
+					{"name": "get_weather", "description": "Get the weather", "input_schema": {"type": "object", "properties": {"city": {"type": "string"}}}},
+					{"name": "no_params", "input_schema": {"type": "object", "properties": {}}}
+				],
+				"tool_choice": {"type": "tool", "name": "get_weather"},
+				"max_tokens": 50,
+				"temperature": 1,
+				"stop_sequences": ["a", "b"],
+				"stream": true
+			}`,
+			expectedInfo: RequestInfo{Model: "claude-3-5-haiku-latest", Stream: true, IncludeUsage: true},
+		},
+		{
+			name:         "default max tokens and tool choice string",
+			input:        `{"model": "claude-3-opus-latest", "messages": [{"role": "user", "content": "hi"}], "tool_choice": "required"}`,
+			expected:     `{"model": "claude-3-opus-latest", "messages": [{"role": "user", "content": [{"type": "text", "text": "hi"}]}], "max_tokens": 4096, "tool_choice": {"type": "any"}}`,
+			expectedInfo: RequestInfo{Model: "claude-3-opus-latest"},
+		},
+		{
+			name:        "unsupported role",
+			input:       `{"model": "claude", "messages": [{"role": "function", "content": "x"}]}`,
+			expectedErr: "message 0: unsupported role: function",
+		},
+		{
+			name:        "unsupported image data URL",
+			input:       `{"model": "claude", "messages": [{"role": "user", "content": [{"type": "image_url", "image_url": {"url": "data:image/png,raw"}}]}]}`,
+			expectedErr: "only base64 is supported",
+		},
+		{
+			name:        "invalid tool arguments",
+			input:       `{"model": "claude", "messages": [{"role": "assistant", "tool_calls": [{"id": "call_1", "function": {"name": "x", "arguments": "{"}}]}]}`,
+			expectedErr: "invalid JSON arguments",
+		},
+		{
+			name:        "missing model",
+			input:       `{"messages": []}`,
+			expectedErr: "model is required",
+		},
+		{
+			name:        "not json",
+			input:       `hello`,
+			expectedErr: "error parsing chat completions request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, info, err := OpenAIToAnthropicRequest([]byte(tt.input))
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(out))
+			assert.Equal(t, tt.expectedInfo, *info)
+		})
+	}
+}
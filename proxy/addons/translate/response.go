@@ -0,0 +1,114 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// now is replaced in tests, for a stable "created" timestamp
+var now = time.Now
+
+// finishReason converts an Anthropic stop_reason to an OpenAI finish_reason
+func finishReason(stopReason string) *string {
+	var reason string
+	switch stopReason {
+	case "":
+		return nil
+	case "max_tokens":
+		reason = "length"
+	case "tool_use":
+		reason = "tool_calls"
+	case "refusal":
+		reason = "content_filter"
+	default: // end_turn, stop_sequence, pause_turn
+		reason = "stop"
+	}
+	return &reason
+}
+
+// convertUsage converts the token counts. OpenAI counts cached tokens as part of the prompt
+// tokens, Anthropic counts them separately.
+func convertUsage(usage anthropicUsage) *openAIUsage {
+	promptTokens := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+	out := &openAIUsage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      promptTokens + usage.OutputTokens,
+	}
+	if usage.CacheReadInputTokens > 0 {
+		out.PromptTokensDetails = &openAIPromptTokensDetails{CachedTokens: usage.CacheReadInputTokens}
+	}
+	return out
+}
+
+// AnthropicToOpenAIResponse converts an Anthropic messages response body into an OpenAI chat
+// completions response body
+func AnthropicToOpenAIResponse(body []byte) ([]byte, error) {
+	resp := anthropicResponse{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("error parsing messages response: %w", err)
+	}
+
+	texts := make([]string, 0)
+	toolCalls := make([]openAIToolCall, 0)
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "tool_use":
+			arguments := "{}"
+			compacted := bytes.Buffer{}
+			if err := json.Compact(&compacted, block.Input); err == nil {
+				arguments = compacted.String()
+			}
+			toolCalls = append(toolCalls, openAIToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+
+	message := &openAIResponseMessage{Role: "assistant"}
+	if text := strings.Join(texts, ""); text != "" || len(toolCalls) == 0 {
+		message.Content = &text
+	}
+	if len(toolCalls) > 0 {
+		message.ToolCalls = toolCalls
+	}
+
+	return json.Marshal(openAIResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: now().Unix(),
+		Model:   resp.Model,
+		Choices: []openAIChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: finishReason(resp.StopReason),
+		}},
+		Usage: convertUsage(resp.Usage),
+	})
+}
+
+// convertErrorDetail converts an error, the Anthropic error type is used as the OpenAI error code
+func convertErrorDetail(detail anthropicErrorDetail) openAIErrorDetail {
+	out := openAIErrorDetail{Message: detail.Message, Type: detail.Type}
+	if detail.Type != "" {
+		code := detail.Type
+		out.Code = &code
+	}
+	return out
+}
+
+// AnthropicToOpenAIError converts an Anthropic error response body into an OpenAI error body
+func AnthropicToOpenAIError(body []byte) ([]byte, error) {
+	resp := anthropicError{}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Type != "error" {
+		return nil, fmt.Errorf("error parsing messages error response: %s", body)
+	}
+	return json.Marshal(openAIError{Error: convertErrorDetail(resp.Error)})
+}
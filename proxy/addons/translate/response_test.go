@@ -0,0 +1,146 @@
+package translate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setNow(t *testing.T) {
+	t.Helper()
+	now = func() time.Time { return time.Unix(1700000000, 0) }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func TestAnthropicToOpenAIResponse(t *testing.T) {
+	setNow(t)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "text",
+			input: `{
+				"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-3-5-sonnet-20241022",
+				"content": [{"type": "text", "text": "Hello"}, {"type": "text", "text": " there"}],
+				"stop_reason": "end_turn",
+				"usage": {"input_tokens": 10, "output_tokens": 5, "cache_read_input_tokens": 100, "cache_creation_input_tokens": 20}
+			}`,
+			expected: `{
+				"id": "msg_1", "object": "chat.completion", "created": 1700000000, "model": "claude-3-5-sonnet-20241022",
+				"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello there"}, "finish_reason": "stop"}],
+				"usage": {"prompt_tokens": 130, "completion_tokens": 5, "total_tokens": 135, "prompt_tokens_details": {"cached_tokens": 100}}
+			}`,
+		},
+		{
+			name: "tool use",
+			input: `{
+				"id": "msg_2", "model": "claude-3-5-haiku-20241022",
+				"content": [{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}],
+				"stop_reason": "tool_use",
+				"usage": {"input_tokens": 10, "output_tokens": 5}
+			}`,
+			expected: `{
+				"id": "msg_2", "object": "chat.completion", "created": 1700000000, "model": "claude-3-5-haiku-20241022",
+				"choices": [{"index": 0, "message": {"role": "assistant", "tool_calls": [
+					{"id": "toolu_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}
+				]}, "finish_reason": "tool_calls"}],
+				"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+			}`,
+		},
+		{
+			name:  "max tokens",
+			input: `{"id": "msg_3", "model": "claude", "content": [], "stop_reason": "max_tokens", "usage": {}}`,
+			expected: `{
+				"id": "msg_3", "object": "chat.completion", "created": 1700000000, "model": "claude",
+				"choices": [{"index": 0, "message": {"role": "assistant", "content": ""}, "finish_reason": "length"}],
+				"usage": {"prompt_tokens": 0, "completion_tokens": 0, "total_tokens": 0}
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := AnthropicToOpenAIResponse([]byte(tt.input))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(out))
+		})
+	}
+
+	_, err := AnthropicToOpenAIResponse([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestAnthropicToOpenAIError(t *testing.T) {
+	out, err := AnthropicToOpenAIError([]byte(`{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"error": {"message": "Overloaded", "type": "overloaded_error", "code": "overloaded_error"}}`, string(out))
+
+	_, err = AnthropicToOpenAIError([]byte(`{"id": "msg_1"}`))
+	assert.Error(t, err)
+}
+
+func TestAnthropicToOpenAIStream(t *testing.T) {
+	setNow(t)
+
+	input := `event: message_start
+data: {"type": "message_start", "message": {"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-3-5-sonnet-20241022", "content": [], "usage": {"input_tokens": 25, "output_tokens": 1, "cache_read_input_tokens": 5}}}
+
+event: content_block_start
+data: {"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}
+
+event: ping
+data: {"type": "ping"}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Let me check"}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 0}
+
+event: content_block_start
+data: {"type": "content_block_start", "index": 1, "content_block": {"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {}}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": "{\"city\": \"Paris\"}"}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 1}
+
+event: message_delta
+data: {"type": "message_delta", "delta": {"stop_reason": "tool_use", "stop_sequence": null}, "usage": {"output_tokens": 15}}
+
+event: message_stop
+data: {"type": "message_stop"}
+
+`
+
+	chunk := func(data string) string { return "data: " + data + "\n\n" }
+	prefix := `{"id":"msg_1","object":"chat.completion.chunk","created":1700000000,"model":"claude-3-5-sonnet-20241022",`
+	expected := chunk(prefix+`"choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}`) +
+		chunk(prefix+`"choices":[{"index":0,"delta":{"content":"Let me check"},"finish_reason":null}]}`) +
+		chunk(prefix+`"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"toolu_1","type":"function","function":{"name":"get_weather","arguments":""}}]},"finish_reason":null}]}`) +
+		chunk(prefix+`"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\": \"Paris\"}"}}]},"finish_reason":null}]}`) +
+		chunk(prefix+`"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`)
+
+	t.Run("without usage", func(t *testing.T) {
+		assert.Equal(t, expected+"data: [DONE]\n\n", AnthropicToOpenAIStream(input, false))
+	})
+
+	t.Run("with usage", func(t *testing.T) {
+		usage := chunk(prefix + `"choices":[],"usage":{"prompt_tokens":30,"completion_tokens":15,"total_tokens":45,"prompt_tokens_details":{"cached_tokens":5}}}`)
+		assert.Equal(t, expected+usage+"data: [DONE]\n\n", AnthropicToOpenAIStream(input, true))
+	})
+
+	t.Run("error event", func(t *testing.T) {
+		out := AnthropicToOpenAIStream(`event: error
+data: {"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}
+
+`, false)
+		assert.Equal(t, chunk(`{"error":{"message":"Overloaded","type":"overloaded_error","code":"overloaded_error"}}`)+"data: [DONE]\n\n", out)
+	})
+}
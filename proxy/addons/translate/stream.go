@@ -0,0 +1,142 @@
+package translate
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+// streamTranslator keeps the state needed to convert a stream of Anthropic events
+type streamTranslator struct {
+	id        string
+	model     string
+	created   int64
+	usage     anthropicUsage
+	toolIndex map[int]int // Anthropic content block index -> OpenAI tool call index
+	out       strings.Builder
+}
+
+// writeData writes a single SSE data event
+func (s *streamTranslator) writeData(value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	s.out.WriteString("data: ")
+	s.out.Write(data)
+	s.out.WriteString("\n\n")
+}
+
+// writeChunk writes a chat.completion.chunk event with a single choice
+func (s *streamTranslator) writeChunk(delta *openAIResponseMessage, finish *string) {
+	s.writeData(openAIResponse{
+		ID:      s.id,
+		Object:  "chat.completion.chunk",
+		Created: s.created,
+		Model:   s.model,
+		Choices: []openAIChoice{{Index: 0, Delta: delta, FinishReason: finish}},
+	})
+}
+
+func (s *streamTranslator) handle(event anthropicStreamEvent) {
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			s.id = event.Message.ID
+			s.model = event.Message.Model
+			s.usage = event.Message.Usage
+		}
+		empty := ""
+		s.writeChunk(&openAIResponseMessage{Role: "assistant", Content: &empty}, nil)
+
+	case "content_block_start":
+		block := event.ContentBlock
+		if block == nil {
+			return
+		}
+		switch block.Type {
+		case "tool_use":
+			index := len(s.toolIndex)
+			s.toolIndex[event.Index] = index
+			s.writeChunk(&openAIResponseMessage{ToolCalls: []openAIToolCall{{
+				Index:    &index,
+				ID:       block.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: block.Name, Arguments: ""},
+			}}}, nil)
+		case "text":
+			if block.Text != "" {
+				text := block.Text
+				s.writeChunk(&openAIResponseMessage{Content: &text}, nil)
+			}
+		}
+
+	case "content_block_delta":
+		delta := event.Delta
+		if delta == nil {
+			return
+		}
+		switch delta.Type {
+		case "text_delta":
+			text := delta.Text
+			s.writeChunk(&openAIResponseMessage{Content: &text}, nil)
+		case "input_json_delta":
+			index, found := s.toolIndex[event.Index]
+			if !found {
+				return
+			}
+			s.writeChunk(&openAIResponseMessage{ToolCalls: []openAIToolCall{{
+				Index:    &index,
+				Function: openAIFunctionCall{Arguments: delta.PartialJSON},
+			}}}, nil)
+		}
+
+	case "message_delta":
+		if event.Usage != nil {
+			s.usage.OutputTokens = event.Usage.OutputTokens
+			if event.Usage.InputTokens > 0 {
+				s.usage.InputTokens = event.Usage.InputTokens
+			}
+		}
+		if event.Delta != nil && event.Delta.StopReason != "" {
+			s.writeChunk(&openAIResponseMessage{}, finishReason(event.Delta.StopReason))
+		}
+
+	case "error":
+		if event.Error != nil {
+			s.writeData(openAIError{Error: convertErrorDetail(*event.Error)})
+		}
+	}
+}
+
+// AnthropicToOpenAIStream converts a complete Anthropic messages event stream into an OpenAI
+// chat completions chunk stream. When includeUsage is set, a final chunk with the token usage
+// is added before the [DONE] event, same as OpenAI's stream_options.include_usage.
+func AnthropicToOpenAIStream(body string, includeUsage bool) string {
+	s := &streamTranslator{
+		created:   now().Unix(),
+		toolIndex: make(map[int]int),
+	}
+
+	for _, sseEvent := range utils.ParseSSE(body) {
+		event := anthropicStreamEvent{}
+		if err := json.Unmarshal([]byte(sseEvent.Data), &event); err != nil {
+			continue
+		}
+		s.handle(event)
+	}
+
+	if includeUsage {
+		s.writeData(openAIResponse{
+			ID:      s.id,
+			Object:  "chat.completion.chunk",
+			Created: s.created,
+			Model:   s.model,
+			Choices: []openAIChoice{},
+			Usage:   convertUsage(s.usage),
+		})
+	}
+	s.out.WriteString("data: " + utils.SSEDone + "\n\n")
+	return s.out.String()
+}
@@ -0,0 +1,119 @@
+package addons
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	px "github.com/kardianos/mitmproxy/proxy"
+)
+
+// newUpstreamClient returns an http client configured like the one used internally by the proxy,
+// for addons that need to send a request upstream on their own (e.g., retries)
+func newUpstreamClient(skipVerifyTLS bool) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:              http.ProxyFromEnvironment,
+			ForceAttemptHTTP2:  false,
+			DisableCompression: true, // keep the original response body, same as the proxy
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: skipVerifyTLS,
+			},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// sendUpstream sends a copy of the flow's request to the upstream server, without the llm_proxy
+// headers, and returns the fully buffered response
+func sendUpstream(ctx context.Context, client *http.Client, req *px.Request) (*px.Response, error) {
+	if req == nil || req.URL == nil {
+		return nil, fmt.Errorf("request or request URL is nil")
+	}
+
+	upstreamReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL.String(), bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating upstream request: %w", err)
+	}
+	upstreamReq.Header = req.Header.Clone()
+	removeProxyHeaders(upstreamReq.Header)
+
+	upstreamResp, err := client.Do(upstreamReq)
+	if err != nil {
+		return nil, fmt.Errorf("error sending upstream request: %w", err)
+	}
+	defer upstreamResp.Body.Close()
+
+	body, err := io.ReadAll(upstreamResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading upstream response body: %w", err)
+	}
+
+	return &px.Response{
+		StatusCode: upstreamResp.StatusCode,
+		Header:     upstreamResp.Header,
+		Body:       body,
+	}, nil
+}
+
+// llmProxyHeaderPrefix is used by all headers added by this proxy, e.g., X-Llm_proxy-Cache
+const llmProxyHeaderPrefix = "X-Llm_proxy-"
+
+// replaceResponse updates the flow's existing response object with the values from newResp, so
+// addons that run later see the final response. Headers added by other llm_proxy addons are kept.
+func replaceResponse(f *px.Flow, newResp *px.Response) {
+	if f.Response == nil {
+		f.Response = newResp
+		return
+	}
+	if newResp == f.Response {
+		return
+	}
+
+	header := newResp.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	for key, values := range f.Response.Header {
+		if strings.HasPrefix(key, llmProxyHeaderPrefix) && header.Get(key) == "" {
+			header[key] = values
+		}
+	}
+
+	f.Response.StatusCode = newResp.StatusCode
+	f.Response.Header = header
+	f.Response.Body = newResp.Body
+}
+
+// requestSnapshot is a copy of the parts of a request that are modified by the routing addons
+type requestSnapshot struct {
+	url    *url.URL
+	header http.Header
+	body   []byte
+}
+
+// newRequestSnapshot copies the request URL, headers, and body
+func newRequestSnapshot(req *px.Request) *requestSnapshot {
+	u := *req.URL
+	return &requestSnapshot{
+		url:    &u,
+		header: req.Header.Clone(),
+		body:   append([]byte{}, req.Body...),
+	}
+}
+
+// restore puts the original values back into the request, used after the upstream response is
+// received so the cache and logging addons see the request that the client sent
+func (s *requestSnapshot) restore(req *px.Request) {
+	u := *s.url
+	req.URL = &u
+	req.Header = s.header.Clone()
+	req.Body = append([]byte{}, s.body...)
+}
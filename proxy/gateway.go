@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/kardianos/mitmproxy/cert"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/config"
+	"github.com/proxati/llm_proxy/proxy/addons"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// gatewayToken is sent by the gateway to the proxy, which runs in the same process, so the proxy
+// can tell the gateway's requests apart from other clients
+var gatewayToken = newGatewayToken()
+
+// newGatewayToken returns a random token, used for the lifetime of the process
+func newGatewayToken() string {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		panic(fmt.Sprintf("failed to create the gateway token: %v", err))
+	}
+	return hex.EncodeToString(token)
+}
+
+// gatewayRoute maps a request path prefix to an upstream base URL
+type gatewayRoute struct {
+	prefix string
+	target *url.URL
+}
+
+// newGatewayRoutes validates the routes from the config, and sorts them longest prefix first
+func newGatewayRoutes(routes map[string]string) ([]gatewayRoute, error) {
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("no gateway routes configured")
+	}
+
+	out := make([]gatewayRoute, 0, len(routes))
+	for prefix, target := range routes {
+		prefix = "/" + strings.Trim(prefix, "/")
+		targetURL, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway route target for %s: %w", prefix, err)
+		}
+		if (targetURL.Scheme != "http" && targetURL.Scheme != "https") || targetURL.Host == "" {
+			return nil, fmt.Errorf("gateway route target for %s must be an absolute http or https URL: %s", prefix, target)
+		}
+		targetURL.Path = strings.TrimSuffix(targetURL.Path, "/")
+		out = append(out, gatewayRoute{prefix: prefix, target: targetURL})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return len(out[i].prefix) > len(out[j].prefix)
+	})
+	return out, nil
+}
+
+// matchGatewayRoute finds the route for the request path, and returns the upstream URL
+func matchGatewayRoute(routes []gatewayRoute, reqURL *url.URL) (*url.URL, bool) {
+	for _, route := range routes {
+		rest, found := strings.CutPrefix(reqURL.Path, route.prefix)
+		if !found || (rest != "" && !strings.HasPrefix(rest, "/") && route.prefix != "/") {
+			continue
+		}
+		if route.prefix == "/" {
+			rest = reqURL.Path
+		}
+
+		upstream := *route.target
+		upstream.Path = route.target.Path + rest
+		upstream.RawPath = ""
+		switch {
+		case route.target.RawQuery == "":
+			upstream.RawQuery = reqURL.RawQuery
+		case reqURL.RawQuery != "":
+			upstream.RawQuery = route.target.RawQuery + "&" + reqURL.RawQuery
+		}
+		return &upstream, true
+	}
+	return nil, false
+}
+
+// localProxyURL returns the URL used by the gateway to connect to the proxy listener
+func localProxyURL(listen string) (*url.URL, error) {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy listen address %s: %w", listen, err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(host, port)}, nil
+}
+
+// writeGatewayError sends an error in the same JSON format as the OpenAI API
+func writeGatewayError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]string{"message": message, "type": "gateway_error", "code": code},
+	})
+}
+
+// newGatewayServer returns an http server that maps path prefixes to upstream providers, e.g.,
+// http://localhost:8081/openai/v1/chat/completions -> https://api.openai.com/v1/chat/completions
+//
+// Requests are sent through the proxy listener, so all of the proxy addons run on them exactly as
+// they do for clients that use the proxy directly. The gateway trusts the proxy CA internally, so
+// clients don't need to. The client's IP is sent to the proxy in the schema.ClientAddressHeader,
+// with the gatewayToken, so the proxy only trusts the addresses sent by the gateway. Both headers
+// are removed by the proxy, and the X-Forwarded-For header sent by the client is removed by the
+// reverse proxy, so the client's IP isn't sent upstream.
+func newGatewayServer(cfg *config.Config, ca *cert.CA) (*http.Server, error) {
+	routes, err := newGatewayRoutes(cfg.GatewayRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	proxyURL, err := localProxyURL(cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(&ca.RootCert)
+
+	reverseProxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			upstream, _ := matchGatewayRoute(routes, pr.In.URL)
+			pr.Out.URL = upstream
+			pr.Out.Host = "" // use the upstream host
+			// read back by the proxy as the client address, for the logs and reports
+			if clientIP, _, err := net.SplitHostPort(pr.In.RemoteAddr); err == nil {
+				pr.Out.Header.Set(schema.ClientAddressHeader, clientIP)
+				pr.Out.Header.Set(addons.GatewayTokenHeader, gatewayToken)
+			}
+		},
+		Transport: &http.Transport{
+			Proxy:              http.ProxyURL(proxyURL),
+			ForceAttemptHTTP2:  false,
+			DisableCompression: true, // pass through the client's Accept-Encoding
+			TLSClientConfig: &tls.Config{
+				RootCAs: rootCAs,
+			},
+		},
+		FlushInterval: -1, // flush streamed responses immediately
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Errorf("gateway error for %s: %v", r.URL, err)
+			writeGatewayError(w, http.StatusBadGateway, "upstream_error", "error sending request through the proxy")
+		},
+	}
+
+	for _, route := range routes {
+		log.Infof("Gateway route: %s -> %s", route.prefix, route.target)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, found := matchGatewayRoute(routes, r.URL); !found {
+			writeGatewayError(w, http.StatusNotFound, "route_not_found", fmt.Sprintf("no gateway route for path: %s", r.URL.Path))
+			return
+		}
+		reverseProxy.ServeHTTP(w, r)
+	})
+
+	return &http.Server{
+		Addr:    cfg.GatewayListen,
+		Handler: handler,
+	}, nil
+}
+
+// configGateway returns the gateway server, or nil when the gateway is disabled. Must be called
+// after configProxy, which creates the CA when it doesn't exist yet.
+func configGateway(cfg *config.Config) (*http.Server, error) {
+	if !cfg.GatewayEnabled() {
+		return nil, nil
+	}
+
+	ca, err := newCA(cfg.CertDir)
+	if err != nil {
+		return nil, fmt.Errorf("setupCA error: %v", err)
+	}
+	return newGatewayServer(cfg, ca)
+}
@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/config"
+	"github.com/proxati/llm_proxy/proxy/addons"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+func TestMatchGatewayRoute(t *testing.T) {
+	routes, err := newGatewayRoutes(map[string]string{
+		"/openai":        "https://api.openai.com",
+		"/openai/azure/": "https://example.openai.azure.com/openai?api-version=2024-02-01",
+		"anthropic":      "https://api.anthropic.com/",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		reqURL   string
+		expected string
+	}{
+		{"openai", "/openai/v1/chat/completions", "https://api.openai.com/v1/chat/completions"},
+		{"longest prefix wins", "/openai/azure/deployments/gpt4/chat/completions?x=1", "https://example.openai.azure.com/openai/deployments/gpt4/chat/completions?api-version=2024-02-01&x=1"},
+		{"prefix without a trailing slash", "/anthropic/v1/messages", "https://api.anthropic.com/v1/messages"},
+		{"query string", "/openai/v1/models?limit=2", "https://api.openai.com/v1/models?limit=2"},
+		{"partial prefix", "/openaiv1/models", ""},
+		{"unknown prefix", "/v1/chat/completions", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqURL, err := url.Parse(tt.reqURL)
+			require.NoError(t, err)
+
+			upstream, found := matchGatewayRoute(routes, reqURL)
+			if tt.expected == "" {
+				assert.False(t, found)
+				return
+			}
+			require.True(t, found)
+			assert.Equal(t, tt.expected, upstream.String())
+		})
+	}
+}
+
+func TestNewGatewayRoutes_Invalid(t *testing.T) {
+	_, err := newGatewayRoutes(map[string]string{})
+	assert.Error(t, err)
+
+	_, err = newGatewayRoutes(map[string]string{"/openai": "api.openai.com"})
+	assert.ErrorContains(t, err, "must be an absolute http or https URL")
+}
+
+func TestLocalProxyURL(t *testing.T) {
+	tests := []struct {
+		listen   string
+		expected string
+	}{
+		{"127.0.0.1:8080", "http://127.0.0.1:8080"},
+		{":8080", "http://127.0.0.1:8080"},
+		{"0.0.0.0:8080", "http://127.0.0.1:8080"},
+		{"localhost:8080", "http://localhost:8080"},
+	}
+	for _, tt := range tests {
+		proxyURL, err := localProxyURL(tt.listen)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, proxyURL.String())
+	}
+
+	_, err := localProxyURL("8080")
+	assert.Error(t, err)
+}
+
+func TestGateway(t *testing.T) {
+	// plain http upstream
+	hitCounter := new(atomic.Int32)
+	testServerPort, err := getFreePort()
+	require.NoError(t, err)
+	_, srvShutdown := runWebServer(hitCounter, testServerPort)
+	t.Cleanup(srvShutdown)
+
+	// TLS upstream, verifies that the gateway trusts the proxy CA
+	tlsHits := new(atomic.Int32)
+	upstreamHeader := make(chan http.Header, 1)
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tlsHits.Add(1)
+		upstreamHeader <- r.Header
+		w.Write(respBuilder(tlsHits.Load(), r.Body))
+	}))
+	t.Cleanup(tlsSrv.Close)
+
+	proxyPort, err := getFreePort()
+	require.NoError(t, err)
+	gatewayPort, err := getFreePort()
+	require.NoError(t, err)
+
+	tmpDir := t.TempDir()
+	cfg := config.NewDefaultConfig()
+	cfg.Listen = proxyPort
+	cfg.CertDir = filepath.Join(tmpDir, certSubdir)
+	cfg.Cache.Dir = filepath.Join(tmpDir, cacheSubdir)
+	cfg.Debug = debugOutput
+	cfg.AppMode = config.CacheMode
+	cfg.NoHttpUpgrader = true
+	cfg.InsecureSkipVerifyTLS = true // for the httptest TLS server
+	cfg.GatewayListen = gatewayPort
+	cfg.GatewayRoutes = map[string]string{
+		"/plain": "http://" + testServerPort,
+		// the proxy creates certs from the TLS SNI, which isn't sent for IP addresses
+		"/tls": strings.Replace(tlsSrv.URL, "127.0.0.1", "localhost", 1) + "/base",
+	}
+
+	p, err := configProxy(cfg)
+	require.NoError(t, err)
+	gateway, err := configGateway(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, gateway)
+
+	shutdownChan := make(chan os.Signal, 1)
+	go func() {
+		if err := startProxy(p, gateway, shutdownChan); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	time.Sleep(defaultSleepTime)
+	t.Cleanup(func() { shutdownChan <- os.Interrupt })
+
+	// a regular client, without any proxy settings or extra CA
+	client := &http.Client{}
+	gatewayURL := "http://" + gatewayPort
+
+	t.Run("cache miss then hit", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			resp, err := client.Post(gatewayURL+"/plain/v1/chat/completions", "text/plain", strings.NewReader(t.Name()))
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, respBuilder(1, strings.NewReader(t.Name())), body)
+			if i == 0 {
+				assert.Equal(t, addons.CacheStatusMiss, resp.Header.Get(addons.CacheStatusHeader))
+				time.Sleep(defaultSleepTime) // wait for the cache to be written
+			} else {
+				assert.Equal(t, addons.CacheStatusHit, resp.Header.Get(addons.CacheStatusHeader))
+			}
+		}
+		assert.Equal(t, int32(1), hitCounter.Load())
+	})
+
+	t.Run("tls upstream", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, gatewayURL+"/tls/v1/embeddings", strings.NewReader("hello"))
+		require.NoError(t, err)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		req.Header.Set(schema.ClientAddressHeader, "203.0.113.8")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, addons.CacheStatusMiss, resp.Header.Get(addons.CacheStatusHeader))
+		assert.Equal(t, int32(1), tlsHits.Load())
+
+		// the client's address is only for the proxy logs
+		header := <-upstreamHeader
+		assert.Empty(t, header.Values("X-Forwarded-For"))
+		assert.Empty(t, header.Values(schema.ClientAddressHeader))
+		assert.Empty(t, header.Values(addons.GatewayTokenHeader))
+	})
+
+	t.Run("unknown route", func(t *testing.T) {
+		resp, err := client.Get(gatewayURL + "/nope/v1/models")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Contains(t, string(body), "route_not_found")
+	})
+}
+
+func TestGateway_LocalRouteHTTPS(t *testing.T) {
+	// the provider that the client's request is for, over TLS, so the proxy has a TLS connection to it
+	providerHits := new(atomic.Int32)
+	provider := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		providerHits.Add(1)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	t.Cleanup(provider.Close)
+
+	// the local server on another host, where the local route sends the request
+	received := make(chan string, 1)
+	local := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path
+		w.Write([]byte(`{"object": "chat.completion"}`))
+	}))
+	t.Cleanup(local.Close)
+
+	tmpDir := t.TempDir()
+	routesFile := filepath.Join(tmpDir, "routes.json")
+	require.NoError(t, os.WriteFile(routesFile, []byte(`{"rules": [
+		{"name": "local", "match": {"models": ["llama*"]}, "url": "`+local.URL+`/v1"}
+	]}`), 0644))
+
+	proxyPort, err := getFreePort()
+	require.NoError(t, err)
+	gatewayPort, err := getFreePort()
+	require.NoError(t, err)
+
+	cfg := config.NewDefaultConfig()
+	cfg.Listen = proxyPort
+	cfg.CertDir = filepath.Join(tmpDir, certSubdir)
+	cfg.Debug = debugOutput
+	cfg.AppMode = config.SimpleMode
+	cfg.InsecureSkipVerifyTLS = true // for the httptest TLS servers
+	cfg.LocalRoutesFile = routesFile
+	cfg.GatewayListen = gatewayPort
+	cfg.GatewayRoutes = map[string]string{
+		"/openai": strings.Replace(provider.URL, "127.0.0.1", "localhost", 1) + "/v1",
+	}
+
+	p, err := configProxy(cfg)
+	require.NoError(t, err)
+	gateway, err := configGateway(cfg)
+	require.NoError(t, err)
+
+	shutdownChan := make(chan os.Signal, 1)
+	go func() {
+		if err := startProxy(p, gateway, shutdownChan); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	time.Sleep(defaultSleepTime)
+	t.Cleanup(func() { shutdownChan <- os.Interrupt })
+
+	resp, err := http.Post("http://"+gatewayPort+"/openai/chat/completions", "application/json",
+		strings.NewReader(`{"model": "llama3.1", "messages": []}`))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"object": "chat.completion"}`, string(body))
+	require.Len(t, received, 1)
+	assert.Equal(t, "/v1/chat/completions", <-received)
+	assert.Equal(t, int32(0), providerHits.Load())
+}
@@ -72,18 +72,131 @@ func configProxy(cfg *config.Config) (*px.Proxy, error) {
 		return nil, fmt.Errorf("failed to create proxy: %v", err)
 	}
 
+	// first, so the other addons only see the client address when it was sent by the gateway
+	p.AddAddon(addons.NewGatewayClientAddon(gatewayToken))
+
 	if cfg.IsVerboseOrHigher() {
 		log.Debugf("Enabling traffic logging to terminal")
 		logDest = append(logDest, md.WriteToStdOut)
 		p.AddAddon(addons.NewStdOutLogger())
 	}
 
+	var retryAddon *addons.RetryAddon
+	if cfg.RetryEnabled() {
+		// added before the other addons, so their Response handlers only see the final response
+		log.Debugf("Enabling upstream retries, max attempts: %d", cfg.Retry.MaxAttempts)
+		retryAddon = addons.NewRetryAddon(
+			cfg.Retry.MaxAttempts,
+			cfg.Retry.MaxTime,
+			cfg.Retry.InitialBackoff,
+			cfg.Retry.MaxBackoff,
+			cfg.Retry.RetryMedia,
+			cfg.InsecureSkipVerifyTLS,
+		)
+		p.AddAddon(retryAddon)
+	}
+
 	if !cfg.NoHttpUpgrader {
 		// upgrade all http requests to https
 		log.Debug("NoHttpUpgrader is false, enabling http to https upgrade")
 		p.AddAddon(&addons.SchemeUpgrader{})
 	}
 
+	var rewriteAddon *addons.RewriteAddon
+	if cfg.RewriteFile != "" {
+		// added before the policy, so the policy is checked against the request that is sent upstream
+		log.Debugf("Enabling request rewrite rules from: %s", cfg.RewriteFile)
+		rewriteAddon, err = addons.NewRewriteAddon(cfg.RewriteFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load rewrite rules: %v", err)
+		}
+		p.AddAddon(rewriteAddon)
+	}
+
+	var policyAddon *addons.EgressPolicyAddon
+	if cfg.PolicyFile != "" {
+		// added before the mode addons, so denied requests are never answered from the cache
+		log.Debugf("Enabling egress policy from: %s", cfg.PolicyFile)
+		policyAddon, err = addons.NewEgressPolicyAddon(cfg.PolicyFile, cfg.PolicyAuditLog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load egress policy: %v", err)
+		}
+		p.AddAddon(policyAddon)
+	}
+
+	// shared by the routing addons, so a flow is only sent elsewhere by the first one that matches
+	routed := addons.NewFlowRoutes()
+
+	var lbAddon *addons.LoadBalancerAddon
+	if cfg.BackendsFile != "" {
+		log.Debugf("Enabling load balancer with backends from: %s", cfg.BackendsFile)
+		lbAddon, err = addons.NewLoadBalancerAddon(cfg.BackendsFile, cfg.InsecureSkipVerifyTLS, routed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load backends: %v", err)
+		}
+		if policyAddon != nil {
+			lbAddon.CheckFailoverWith(policyAddon.Check)
+		}
+		// failover responses replace the backend's response, so the guardrails must check them
+		p.AddAddon(lbAddon.ResponseAddon())
+	}
+
+	if cfg.GuardrailsFile != "" {
+		// also before the mode addons, so only redacted responses are stored in the cache
+		log.Debugf("Enabling guardrails from: %s", cfg.GuardrailsFile)
+		guardrailAddon, err := addons.NewGuardrailAddon(cfg.GuardrailsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load guardrails: %v", err)
+		}
+		p.AddAddon(guardrailAddon)
+	}
+
+	var chaosAddon *addons.ChaosAddon
+	if cfg.Chaos.RulesFile != "" {
+		// before the mode addons, so rate limits and errors are injected for cache hits too
+		log.Debugf("Enabling fault injection from: %s", cfg.Chaos.RulesFile)
+		chaosAddon, err = addons.NewChaosAddon(cfg.Chaos.RulesFile, cfg.Chaos.Seed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chaos rules: %v", err)
+		}
+		p.AddAddon(chaosAddon)
+	}
+
+	var translator *addons.AnthropicTranslatorAddon
+	if len(cfg.AnthropicModels) > 0 {
+		log.Debugf("Enabling Anthropic translation for models: %v", cfg.AnthropicModels)
+		translator, err = addons.NewAnthropicTranslatorAddon(cfg.AnthropicModels, os.Getenv("ANTHROPIC_API_KEY"), routed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Anthropic translator: %v", err)
+		}
+		// the response is translated before the mode addons, so they only see the OpenAI format
+		p.AddAddon(translator.ResponseAddon())
+	}
+
+	var localRouteAddon *addons.LocalRouteAddon
+	if cfg.LocalRoutesFile != "" {
+		log.Debugf("Enabling local routes from: %s", cfg.LocalRoutesFile)
+		localRouteAddon, err = addons.NewLocalRouteAddon(cfg.LocalRoutesFile, routed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load local routes: %v", err)
+		}
+		// the client's request is restored before the mode addons, so it's cached and logged as sent
+		p.AddAddon(localRouteAddon.ResponseAddon())
+	}
+
+	var shadowAddon *addons.ShadowAddon
+	if cfg.Shadow.Enabled() {
+		log.Debugf("Enabling shadow traffic to: %s %s", cfg.Shadow.URL, cfg.Shadow.Model)
+		shadowAddon, err = addons.NewShadowAddon(
+			cfg.Shadow.URL, cfg.Shadow.Model, os.Getenv("SHADOW_API_KEY"),
+			cfg.Shadow.Share, cfg.Shadow.Timeout, cfg.InsecureSkipVerifyTLS,
+			cfg.FilterReqHeaders, cfg.FilterRespHeaders,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create shadow addon: %v", err)
+		}
+	}
+
 	log.Debugf("AppMode set to: %v", cfg.AppMode)
 	switch cfg.AppMode {
 	case config.CacheMode:
@@ -152,26 +265,131 @@ func configProxy(cfg *config.Config) (*px.Proxy, error) {
 			return nil, fmt.Errorf("failed to create dumper: %v", err)
 		}
 
+		if shadowAddon != nil {
+			// the shadow responses are logged with the original responses
+			shadowAddon.LogWith(dumperAddon)
+		}
+		dumperAddon.LogRoutesFrom(routed)
+		if rewriteAddon != nil {
+			rewriteAddon.LogWith(dumperAddon)
+		}
+		if retryAddon != nil {
+			retryAddon.LogWith(dumperAddon)
+		}
+		if lbAddon != nil {
+			lbAddon.LogWith(dumperAddon)
+		}
+
 		// add the dumper to the proxy
 		p.AddAddon(dumperAddon)
 	case config.APIAuditMode:
 		log.Debug("Enabling API Auditor addon")
-		p.AddAddon(addons.NewAPIAuditor())
+		auditorAddon, err := addons.NewAPIAuditor(addons.APIAuditorOptions{
+			PricingPath:          cfg.Audit.PricingFile,
+			ReloadInterval:       cfg.Audit.PricingReloadInterval,
+			PriceByResponseModel: cfg.Audit.PriceByResponseModel,
+			LedgerPath:           cfg.Audit.LedgerFile,
+			StatsWindow:          cfg.Audit.StatsWindow,
+			StatsSamples:         cfg.Audit.StatsSamples,
+			OutputFormat:         cfg.Audit.OutputFormat,
+			OutputPath:           cfg.Audit.OutputFile,
+			Locale:               cfg.Audit.Locale,
+			CurrencyCode:         cfg.Audit.Currency,
+			ExchangeRatesPath:    cfg.Audit.ExchangeRatesFile,
+			EstimateCost:         cfg.Audit.EstimateCost,
+			Budget:               cfg.Audit.Budget,
+			TokensPerMinute:      cfg.Audit.TokensPerMinute,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create API auditor: %v", err)
+		}
+		auditorAddon.PriceRoutesFrom(routed)
+		if shadowAddon != nil {
+			// the shadow responses are priced with the pricing file
+			shadowAddon.PriceWith(auditorAddon)
+		}
+		p.AddAddon(auditorAddon)
+	case config.MockMode:
+		log.Debug("Enabling mock addon")
+		mockAddon, err := addons.NewMockAddon(cfg.Mock.FixturesDir, cfg.Mock.Generate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load mock fixtures: %v", err)
+		}
+		if chaosAddon != nil {
+			// the Response hooks aren't called for mock responses
+			mockAddon.AddResponseModifier(chaosAddon.Response)
+			mockAddon.AddResponseModifier(chaosAddon.ResponseAddon().Response)
+		}
+		p.AddAddon(mockAddon)
 	case config.SimpleMode:
 		log.Debugf("No addons enabled for SimpleMode")
 	default:
 		return nil, fmt.Errorf("unknown app mode: %v", cfg.AppMode)
 	}
 
+	if shadowAddon != nil {
+		// after the mode addons, so cache hits aren't mirrored, and before the routing addons
+		// change the request
+		p.AddAddon(shadowAddon)
+	}
+
+	// routing addons are added after the mode addons, so a cache lookup uses the original request.
+	// Local routes are first, a flow they route is skipped by the translator and load balancer.
+	if localRouteAddon != nil {
+		p.AddAddon(localRouteAddon)
+	}
+	if translator != nil {
+		p.AddAddon(translator)
+	}
+	if lbAddon != nil {
+		p.AddAddon(lbAddon)
+	}
+	if policyAddon != nil && (localRouteAddon != nil || translator != nil || lbAddon != nil) {
+		// the routing addons can change the upstream, so it's checked again before it's sent
+		p.AddAddon(policyAddon.RecheckAddon(routed))
+	}
+
+	if chaosAddon != nil {
+		// after the other response handlers, so they see the response before it's broken
+		p.AddAddon(chaosAddon.ResponseAddon())
+	}
+
+	// after all of the addons that read the llm_proxy request headers, e.g., the tags
+	p.AddAddon(addons.NewProxyHeaderFilterAddon())
+
+	if localRouteAddon != nil || translator != nil || lbAddon != nil {
+		// last, the routed flows are sent by this addon, which runs the response events of the
+		// addons before it
+		p.AddAddon(addons.NewRoutedSenderAddon(routed, p.Addons, cfg.InsecureSkipVerifyTLS))
+	}
+
 	return p, nil
 }
 
-// startProxy receives a pointer to a proxy object, runs it, and handles the shutdown signal
-func startProxy(p *px.Proxy, shutdown chan os.Signal) error {
+// startProxy receives a pointer to a proxy object, runs it, and handles the shutdown signal. The
+// optional gateway server is run alongside the proxy.
+func startProxy(p *px.Proxy, gateway *http.Server, shutdown chan os.Signal) error {
+	if gateway != nil {
+		go func() {
+			log.Infof("Gateway start listen at %v", gateway.Addr)
+			if err := gateway.ListenAndServe(); err != http.ErrServerClosed {
+				log.Errorf("gateway server error: %v", err)
+			}
+		}()
+	}
+
 	go func() {
 		<-shutdown
 		log.Info("Received SIGINT, shutting down now...")
 
+		// Stop accepting gateway requests before the proxy that they are sent through
+		if gateway != nil {
+			log.Debug("Closing gateway server...")
+			if err := gateway.Close(); err != nil {
+				log.Errorf("Error closing gateway server: %v", err)
+			}
+		}
+
 		// Then close all of the addon connections
 		for _, addon := range p.Addons {
 			myAddon, ok := addon.(addons.LLM_Addon)
@@ -218,7 +436,12 @@ func Run(cfg *config.Config) error {
 		return fmt.Errorf("failed to configure proxy: %v", err)
 	}
 
-	if err := startProxy(p, shutdown); err != nil {
+	gateway, err := configGateway(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to configure gateway: %v", err)
+	}
+
+	if err := startProxy(p, gateway, shutdown); err != nil {
 		return fmt.Errorf("failed to start proxy: %v", err)
 	}
 
@@ -138,7 +138,7 @@ func runProxy(proxyPort, tempDir string, proxyAppMode config.AppMode) (shutdownF
 
 	// start the proxy in the background
 	go func() {
-		err = startProxy(p, shutdownChan)
+		err = startProxy(p, nil, shutdownChan)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -549,5 +549,6 @@ func TestConfigProxy(t *testing.T) {
 	// Assert that a proxy was returned
 	assert.NotNil(t, p)
 
-	assert.Equal(t, 1, len(p.Addons))
+	// the gateway client, the scheme upgrader, and the proxy header filter
+	assert.Equal(t, 3, len(p.Addons))
 }
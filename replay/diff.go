@@ -0,0 +1,252 @@
+package replay
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bojanz/currency"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/proxy/addons/guardrails"
+	"github.com/proxati/llm_proxy/schema"
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+// Side is one response of a Diff, the original or the replayed one. Cost is empty when the
+// response couldn't be priced, and Duration is zero when it wasn't logged.
+type Side struct {
+	Status       int
+	Model        string
+	InputTokens  int // including cached tokens
+	OutputTokens int // including reasoning tokens
+	Cost         currency.Amount
+	Duration     time.Duration
+	FinishReason string // comma separated, for responses with more than one choice
+	Text         string // the generated text
+}
+
+// Diff compares the replayed response of a case with the original response
+type Diff struct {
+	Name       string
+	URL        string
+	Original   Side
+	Replay     Side
+	Similarity float64 // 0 to 1, of the generated text
+	Err        error   // the replay failed, only the Original is set
+}
+
+// responseText returns the generated text, and the finish reasons, from an OpenAI or Anthropic
+// response body, or a fully buffered stream
+func responseText(body string) (string, string) {
+	payloads := []string{body}
+	separator := "\n"
+	if utils.LooksLikeSSE(body) {
+		payloads = payloads[:0]
+		separator = "" // the chunks are parts of the same text
+		for _, event := range utils.ParseSSE(body) {
+			if data := strings.TrimSpace(event.Data); data != "" && data != utils.SSEDone {
+				payloads = append(payloads, data)
+			}
+		}
+	}
+
+	texts := make([]string, 0)
+	reasons := make([]string, 0)
+	for _, payload := range payloads {
+		parsed := make(map[string]any)
+		if err := json.Unmarshal([]byte(payload), &parsed); err != nil {
+			continue
+		}
+		texts = append(texts, guardrails.CollectText(parsed, guardrails.WalkResponseText)...)
+		for _, reason := range finishReasons(parsed) {
+			if !slices.Contains(reasons, reason) {
+				reasons = append(reasons, reason)
+			}
+		}
+	}
+	return strings.Join(texts, separator), strings.Join(reasons, ",")
+}
+
+// finishReasons returns the OpenAI finish reasons of each choice, or the Anthropic stop reason
+func finishReasons(body map[string]any) []string {
+	reasons := make([]string, 0)
+	if choices, ok := body["choices"].([]any); ok {
+		for _, choice := range choices {
+			if choiceMap, ok := choice.(map[string]any); ok {
+				if reason, ok := choiceMap["finish_reason"].(string); ok && reason != "" {
+					reasons = append(reasons, reason)
+				}
+			}
+		}
+	}
+	if reason, ok := body["stop_reason"].(string); ok && reason != "" {
+		reasons = append(reasons, reason)
+	}
+	if delta, ok := body["delta"].(map[string]any); ok {
+		if reason, ok := delta["stop_reason"].(string); ok && reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+// similarity returns the ratio of words in the longest common subsequence of the two texts, 1
+// for identical texts, and 0 when they have no words in common
+func similarity(a, b string) float64 {
+	wordsA, wordsB := strings.Fields(a), strings.Fields(b)
+	if len(wordsA)+len(wordsB) == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(wordsB)+1)
+	current := make([]int, len(wordsB)+1)
+	for i := range wordsA {
+		for j := range wordsB {
+			if wordsA[i] == wordsB[j] {
+				current[j+1] = previous[j] + 1
+			} else {
+				current[j+1] = max(previous[j+1], current[j])
+			}
+		}
+		previous, current = current, previous
+	}
+	return 2 * float64(previous[len(wordsB)]) / float64(len(wordsA)+len(wordsB))
+}
+
+// newSide reads one response, the usage and cost are from the pricing data
+func newSide(costCounter *schema.CostCounter, container *schema.LogDumpContainer) Side {
+	side := Side{}
+	if container.ConnectionStats != nil {
+		side.Duration = time.Duration(container.ConnectionStats.Duration) * time.Millisecond
+	}
+	if container.Response == nil {
+		return side
+	}
+	side.Status = container.Response.Status
+	side.Text, side.FinishReason = responseText(container.Response.Body)
+
+	auditOutput, err := costCounter.AddRouted(*container.Request, *container.Response, 0, container.Route())
+	if err != nil {
+		log.Debugf("not pricing %s: %v", container.Request.URL, err)
+		return side
+	}
+	side.Model = auditOutput.Model
+	side.InputTokens = auditOutput.InputTokens + auditOutput.CachedTokens
+	side.OutputTokens = auditOutput.OutputTokens + auditOutput.ReasoningTokens
+	if cost, err := currency.NewAmount(auditOutput.Cost, auditOutput.Currency); err == nil {
+		side.Cost = cost
+	}
+	return side
+}
+
+// Compare converts the replay results to diffs, in the same order
+func Compare(costCounter *schema.CostCounter, results []Result) []Diff {
+	diffs := make([]Diff, 0, len(results))
+	for _, result := range results {
+		diff := Diff{
+			Name:     result.Name,
+			URL:      result.Original.Request.URL.String(),
+			Original: newSide(costCounter, result.Original),
+			Err:      result.Err,
+		}
+		if result.Replayed != nil {
+			diff.Replay = newSide(costCounter, result.Replayed)
+			diff.Similarity = similarity(diff.Original.Text, diff.Replay.Text)
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// Totals is the sum of one side of the diffs
+type Totals struct {
+	InputTokens  int
+	OutputTokens int
+	Cost         currency.Amount
+	P50          time.Duration // median duration, of the responses with a logged duration
+}
+
+// Summary is the overall result of a replay
+type Summary struct {
+	Requests            int
+	Errors              int
+	StatusChanges       int
+	FinishReasonChanges int
+	MeanSimilarity      float64 // of the successful replays
+	Original            Totals
+	Replay              Totals
+}
+
+// addCost adds a cost to a total, costs in another currency than the total are skipped
+func addCost(total, cost currency.Amount) currency.Amount {
+	if cost.CurrencyCode() == "" {
+		return total
+	}
+	if total.CurrencyCode() == "" {
+		return cost
+	}
+	sum, err := total.Add(cost)
+	if err != nil {
+		log.Debugf("not adding cost: %v", err)
+		return total
+	}
+	return sum
+}
+
+// median returns the middle duration, or zero for an empty list
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations[len(durations)/2]
+}
+
+// Summarize adds up the diffs. Only the successful replays are counted in the totals, so both
+// sides are for the same requests.
+func Summarize(diffs []Diff) Summary {
+	summary := Summary{Requests: len(diffs)}
+	originalDurations := make([]time.Duration, 0, len(diffs))
+	replayDurations := make([]time.Duration, 0, len(diffs))
+	similarities := 0.0
+
+	for _, diff := range diffs {
+		if diff.Err != nil {
+			summary.Errors++
+			continue
+		}
+		if diff.Original.Status != diff.Replay.Status {
+			summary.StatusChanges++
+		}
+		if diff.Original.FinishReason != diff.Replay.FinishReason {
+			summary.FinishReasonChanges++
+		}
+		similarities += diff.Similarity
+
+		for _, pair := range []struct {
+			side      *Side
+			totals    *Totals
+			durations *[]time.Duration
+		}{
+			{&diff.Original, &summary.Original, &originalDurations},
+			{&diff.Replay, &summary.Replay, &replayDurations},
+		} {
+			pair.totals.InputTokens += pair.side.InputTokens
+			pair.totals.OutputTokens += pair.side.OutputTokens
+			pair.totals.Cost = addCost(pair.totals.Cost, pair.side.Cost)
+			if pair.side.Duration > 0 {
+				*pair.durations = append(*pair.durations, pair.side.Duration)
+			}
+		}
+	}
+
+	if replayed := summary.Requests - summary.Errors; replayed > 0 {
+		summary.MeanSimilarity = similarities / float64(replayed)
+	}
+	summary.Original.P50 = median(originalDurations)
+	summary.Replay.P50 = median(replayDurations)
+	return summary
+}
@@ -0,0 +1,115 @@
+package replay
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+func TestResponseText(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedText   string
+		expectedReason string
+	}{
+		{
+			name:           "chat completion",
+			body:           `{"choices": [{"message": {"content": "Hello"}, "finish_reason": "stop"}, {"message": {"content": "Hi"}, "finish_reason": "length"}]}`,
+			expectedText:   "Hello\nHi",
+			expectedReason: "stop,length",
+		},
+		{
+			name:           "anthropic message",
+			body:           `{"type": "message", "content": [{"type": "text", "text": "Hello"}], "stop_reason": "end_turn"}`,
+			expectedText:   "Hello",
+			expectedReason: "end_turn",
+		},
+		{
+			name: "chat completion stream",
+			body: "data: {\"choices\": [{\"delta\": {\"content\": \"Hel\"}, \"finish_reason\": null}]}\n\n" +
+				"data: {\"choices\": [{\"delta\": {\"content\": \"lo\"}, \"finish_reason\": \"stop\"}]}\n\n" +
+				"data: [DONE]\n\n",
+			expectedText:   "Hello",
+			expectedReason: "stop",
+		},
+		{
+			name: "anthropic stream",
+			body: "event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"delta\": {\"type\": \"text_delta\", \"text\": \"Hi\"}}\n\n" +
+				"event: message_delta\ndata: {\"type\": \"message_delta\", \"delta\": {\"stop_reason\": \"max_tokens\"}}\n\n",
+			expectedText:   "Hi",
+			expectedReason: "max_tokens",
+		},
+		{
+			name: "not JSON",
+			body: "upstream error",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			text, reason := responseText(tc.body)
+			assert.Equal(t, tc.expectedText, text)
+			assert.Equal(t, tc.expectedReason, reason)
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, similarity("", ""))
+	assert.Equal(t, 1.0, similarity("the quick brown fox", "the  quick brown\nfox"))
+	assert.Equal(t, 0.0, similarity("the quick brown fox", ""))
+	assert.Equal(t, 0.0, similarity("hello", "goodbye"))
+	assert.InDelta(t, 0.75, similarity("the quick brown fox", "the slow brown fox"), 0.001)
+	assert.InDelta(t, 0.25, similarity("a b c d", "d c b a"), 0.001, "the order of the words matters")
+}
+
+func TestCompare(t *testing.T) {
+	original := loadTestCase(t, "a")
+	replayed := loadTestCase(t, "a").Original
+	replayed.ConnectionStats.Duration = 400
+	replayed.Response.Body = `{"model": "gpt-4o-mini", "choices": [{"message": {"content": "Hi, how can I help?"}, "finish_reason": "length"}], "usage": {"prompt_tokens": 9, "completion_tokens": 6, "total_tokens": 15}}`
+
+	results := []Result{
+		{Case: original, Replayed: replayed},
+		{Case: loadTestCase(t, "b"), Err: errors.New("connection refused")},
+	}
+	diffs := Compare(schema.NewCostCounterDefaults(), results)
+	require.Len(t, diffs, 2)
+
+	diff := diffs[0]
+	assert.Equal(t, "a", diff.Name)
+	assert.Equal(t, "https://api.openai.com/v1/chat/completions", diff.URL)
+	assert.Equal(t, "gpt-4o-mini", diff.Original.Model)
+	assert.Equal(t, 9, diff.Original.InputTokens)
+	assert.Equal(t, 7, diff.Original.OutputTokens)
+	assert.Equal(t, 6, diff.Replay.OutputTokens)
+	assert.Equal(t, "stop", diff.Original.FinishReason)
+	assert.Equal(t, "length", diff.Replay.FinishReason)
+	assert.Equal(t, 800*time.Millisecond, diff.Original.Duration)
+	assert.Equal(t, 400*time.Millisecond, diff.Replay.Duration)
+	assert.Equal(t, "USD", diff.Original.Cost.CurrencyCode())
+	assert.InDelta(t, 2.0*4/11, diff.Similarity, 0.001, "4 of the words are the same")
+
+	assert.Error(t, diffs[1].Err)
+	assert.Equal(t, 200, diffs[1].Original.Status, "the original is still reported")
+
+	summary := Summarize(diffs)
+	assert.Equal(t, 2, summary.Requests)
+	assert.Equal(t, 1, summary.Errors)
+	assert.Equal(t, 0, summary.StatusChanges)
+	assert.Equal(t, 1, summary.FinishReasonChanges)
+	assert.InDelta(t, diff.Similarity, summary.MeanSimilarity, 0.001)
+	assert.Equal(t, 7, summary.Original.OutputTokens, "only the replayed requests are counted")
+	assert.Equal(t, 6, summary.Replay.OutputTokens)
+	assert.Equal(t, 800*time.Millisecond, summary.Original.P50)
+	assert.Equal(t, 400*time.Millisecond, summary.Replay.P50)
+	cmp, err := summary.Original.Cost.Cmp(summary.Replay.Cost)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cmp, "fewer output tokens cost less")
+}
@@ -0,0 +1,121 @@
+// Package replay resends captured requests to a new upstream, or with another model, and compares
+// the new responses with the originals, for the replay command.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// maxLineSize is the longest record in a JSON lines file
+const maxLineSize = 64 * 1024 * 1024
+
+// Case is a single captured transaction. The name is unique, and is used for the file name of the
+// replayed response.
+type Case struct {
+	Name     string
+	Original *schema.LogDumpContainer
+}
+
+// isRequestLog returns true for log records that have a request that can be sent again
+func isRequestLog(container *schema.LogDumpContainer) bool {
+	return container.Request != nil && container.Request.URL != nil && container.Request.URL.Host != ""
+}
+
+// Load reads the captured transactions from dir_logger JSON files, and from JSON lines files with
+// one log record on each line. Directories are read without recursion, and records without a
+// request are skipped.
+func Load(paths []string) ([]Case, error) {
+	files := make([]string, 0)
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("error reading replay source: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		for _, pattern := range []string{"*.json", "*.jsonl"} {
+			matches, err := filepath.Glob(filepath.Join(p, pattern))
+			if err != nil {
+				return nil, fmt.Errorf("error listing log files: %w", err)
+			}
+			files = append(files, matches...)
+		}
+	}
+	sort.Strings(files)
+
+	cases := make([]Case, 0, len(files))
+	names := make(map[string]int)
+	add := func(name string, container *schema.LogDumpContainer) {
+		names[name]++
+		if names[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, names[name])
+		}
+		cases = append(cases, Case{Name: name, Original: container})
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if filepath.Ext(file) != ".jsonl" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("error reading log file: %w", err)
+			}
+			container := &schema.LogDumpContainer{}
+			if err := json.Unmarshal(data, container); err != nil || !isRequestLog(container) {
+				log.Debugf("skipping file that isn't a request log: %s", file)
+				continue
+			}
+			add(name, container)
+			continue
+		}
+
+		containers, err := loadLines(file)
+		if err != nil {
+			return nil, err
+		}
+		for i, container := range containers {
+			if container != nil {
+				add(fmt.Sprintf("%s-%d", name, i+1), container)
+			}
+		}
+	}
+	return cases, nil
+}
+
+// loadLines reads a JSON lines file, the records that aren't request logs are nil
+func loadLines(file string) ([]*schema.LogDumpContainer, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading log file: %w", err)
+	}
+	defer f.Close()
+
+	containers := make([]*schema.LogDumpContainer, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		container := &schema.LogDumpContainer{}
+		if line == "" || json.Unmarshal([]byte(line), container) != nil || !isRequestLog(container) {
+			log.Debugf("skipping line %d that isn't a request log: %s", len(containers)+1, file)
+			container = nil
+		}
+		containers = append(containers, container)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading log file %s: %w", file, err)
+	}
+	return containers, nil
+}
@@ -0,0 +1,63 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLog = `{
+  "schema": "v2",
+  "timestamp": "2024-10-01T12:00:00Z",
+  "connection_stats": {"client_address": "127.0.0.1", "url": "https://api.openai.com/v1/chat/completions", "duration_ms": 800},
+  "request": {
+    "method": "POST",
+    "url": "https://api.openai.com/v1/chat/completions",
+    "header": {"Content-Type": ["application/json"], "Content-Length": ["80"], "X-Llm_proxy-Tags": ["eval"]},
+    "body": "{\"model\": \"gpt-4o-mini\", \"messages\": [{\"role\": \"user\", \"content\": \"Hello\"}]}"
+  },
+  "response": {
+    "status": 200,
+    "header": {"Content-Type": ["application/json"]},
+    "body": "{\"model\": \"gpt-4o-mini\", \"choices\": [{\"index\": 0, \"message\": {\"role\": \"assistant\", \"content\": \"Hello there, how can I help?\"}, \"finish_reason\": \"stop\"}], \"usage\": {\"prompt_tokens\": 9, \"completion_tokens\": 7, \"total_tokens\": 16}}"
+  }
+}`
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.json"), []byte(testLog), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"schema": "v2"}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(testLog), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "export.jsonl"), []byte(
+		compact(t, testLog)+"\n\n"+"not json\n"+compact(t, testLog)+"\n",
+	), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "replay"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "replay", "b.json"), []byte(testLog), 0644))
+
+	cases, err := Load([]string{dir, filepath.Join(dir, "b.json")})
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(cases))
+	for _, c := range cases {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"b", "b-2", "export-1", "export-4"}, names, "the line number is in the name, and duplicate names get a suffix")
+	assert.Equal(t, "https://api.openai.com/v1/chat/completions", cases[0].Original.Request.URL.String())
+	assert.Equal(t, 200, cases[0].Original.Response.Status)
+
+	_, err = Load([]string{filepath.Join(dir, "missing")})
+	assert.ErrorContains(t, err, "error reading replay source")
+}
+
+// compact converts a test log to a single line
+func compact(t *testing.T, s string) string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	require.NoError(t, json.Compact(buf, []byte(s)))
+	return buf.String()
+}
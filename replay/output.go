@@ -0,0 +1,217 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bojanz/currency"
+)
+
+// Format is the output format of the diff report
+type Format string
+
+const (
+	FormatTable Format = "table"
+	FormatJSON  Format = "json"
+)
+
+// FormatOptions lists the valid Format values, for the command help
+var FormatOptions = []Format{FormatTable, FormatJSON}
+
+// ParseFormat validates an output format option
+func ParseFormat(value string) (Format, error) {
+	for _, option := range FormatOptions {
+		if Format(value) == option {
+			return option, nil
+		}
+	}
+	return "", fmt.Errorf("invalid format %q, must be one of: %v", value, FormatOptions)
+}
+
+// jsonSide is one response in the JSON output, costs are decimal numbers in Currency
+type jsonSide struct {
+	Status       int    `json:"status,omitempty"`
+	Model        string `json:"model,omitempty"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+	Cost         string `json:"cost,omitempty"`
+	Currency     string `json:"currency,omitempty"`
+	DurationMs   int64  `json:"duration_ms,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+}
+
+// jsonTotals is the sum of one side in the JSON output
+type jsonTotals struct {
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+	Cost         string `json:"cost,omitempty"`
+	Currency     string `json:"currency,omitempty"`
+	P50Ms        int64  `json:"p50_ms,omitempty"`
+}
+
+// jsonDiff is a single case in the JSON output
+type jsonDiff struct {
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Original   jsonSide  `json:"original"`
+	Replay     *jsonSide `json:"replay,omitempty"`
+	Similarity *float64  `json:"similarity,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// number returns the decimal number of an amount, empty for an empty amount
+func number(amount currency.Amount) string {
+	if amount.CurrencyCode() == "" {
+		return ""
+	}
+	return amount.Number()
+}
+
+func (side *Side) toJSON() jsonSide {
+	return jsonSide{
+		Status:       side.Status,
+		Model:        side.Model,
+		InputTokens:  side.InputTokens,
+		OutputTokens: side.OutputTokens,
+		Cost:         number(side.Cost),
+		Currency:     side.Cost.CurrencyCode(),
+		DurationMs:   side.Duration.Milliseconds(),
+		FinishReason: side.FinishReason,
+	}
+}
+
+func (totals *Totals) toJSON() jsonTotals {
+	return jsonTotals{
+		InputTokens:  totals.InputTokens,
+		OutputTokens: totals.OutputTokens,
+		Cost:         number(totals.Cost),
+		Currency:     totals.Cost.CurrencyCode(),
+		P50Ms:        totals.P50.Milliseconds(),
+	}
+}
+
+func (diff *Diff) toJSON() jsonDiff {
+	out := jsonDiff{Name: diff.Name, URL: diff.URL, Original: diff.Original.toJSON()}
+	if diff.Err != nil {
+		out.Error = diff.Err.Error()
+		return out
+	}
+	replay := diff.Replay.toJSON()
+	out.Replay = &replay
+	out.Similarity = &diff.Similarity
+	return out
+}
+
+// change formats a value that may differ between the original and the replay, e.g., "200 -> 429"
+func change(original, replay string) string {
+	if original == "" {
+		original = "-"
+	}
+	if replay == "" {
+		replay = "-"
+	}
+	if original == replay {
+		return original
+	}
+	return original + " -> " + replay
+}
+
+// money formats a cost for the table, "-" when it couldn't be priced
+func money(amount currency.Amount) string {
+	if amount.CurrencyCode() == "" {
+		return "-"
+	}
+	return amount.String()
+}
+
+// millis formats a duration for the table, "-" when it wasn't logged
+func millis(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
+
+// itoa formats a count for the table, "-" for a missing status code
+func itoa(n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.Itoa(n)
+}
+
+// Write prints the diff of each case, and the summary, in the requested format
+func Write(w io.Writer, format Format, diffs []Diff, summary Summary) error {
+	switch format {
+	case FormatJSON:
+		out := struct {
+			Cases   []jsonDiff `json:"cases"`
+			Summary struct {
+				Requests            int        `json:"requests"`
+				Errors              int        `json:"errors"`
+				StatusChanges       int        `json:"status_changes"`
+				FinishReasonChanges int        `json:"finish_reason_changes"`
+				MeanSimilarity      float64    `json:"mean_similarity"`
+				Original            jsonTotals `json:"original"`
+				Replay              jsonTotals `json:"replay"`
+			} `json:"summary"`
+		}{Cases: make([]jsonDiff, 0, len(diffs))}
+		for i := range diffs {
+			out.Cases = append(out.Cases, diffs[i].toJSON())
+		}
+		out.Summary.Requests = summary.Requests
+		out.Summary.Errors = summary.Errors
+		out.Summary.StatusChanges = summary.StatusChanges
+		out.Summary.FinishReasonChanges = summary.FinishReasonChanges
+		out.Summary.MeanSimilarity = summary.MeanSimilarity
+		out.Summary.Original = summary.Original.toJSON()
+		out.Summary.Replay = summary.Replay.toJSON()
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(out)
+
+	case FormatTable:
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "case\tstatus\tmodel\tsimilarity\tinput_tokens\toutput_tokens\tlatency_ms\tcost\tfinish_reason\t")
+		for _, diff := range diffs {
+			if diff.Err != nil {
+				fmt.Fprintf(table, "%s\terror: %v\t\t\t\t\t\t\t\t\n", diff.Name, diff.Err)
+				continue
+			}
+			o, r := &diff.Original, &diff.Replay
+			fmt.Fprintf(table, "%s\t%s\t%s\t%.0f%%\t%s\t%s\t%s\t%s\t%s\t\n",
+				diff.Name,
+				change(itoa(o.Status), itoa(r.Status)),
+				change(o.Model, r.Model),
+				diff.Similarity*100,
+				change(strconv.Itoa(o.InputTokens), strconv.Itoa(r.InputTokens)),
+				change(strconv.Itoa(o.OutputTokens), strconv.Itoa(r.OutputTokens)),
+				change(millis(o.Duration), millis(r.Duration)),
+				change(money(o.Cost), money(r.Cost)),
+				change(o.FinishReason, r.FinishReason),
+			)
+		}
+		if err := table.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "\nreplayed %d of %d requests, %d errors\n", summary.Requests-summary.Errors, summary.Requests, summary.Errors)
+		fmt.Fprintf(w, "status changes: %d, finish reason changes: %d, mean similarity: %.1f%%\n",
+			summary.StatusChanges, summary.FinishReasonChanges, summary.MeanSimilarity*100)
+		fmt.Fprintf(w, "input tokens: %s, output tokens: %s\n",
+			change(strconv.Itoa(summary.Original.InputTokens), strconv.Itoa(summary.Replay.InputTokens)),
+			change(strconv.Itoa(summary.Original.OutputTokens), strconv.Itoa(summary.Replay.OutputTokens)),
+		)
+		_, err := fmt.Fprintf(w, "cost: %s, p50 latency ms: %s\n",
+			change(money(summary.Original.Cost), money(summary.Replay.Cost)),
+			change(millis(summary.Original.P50), millis(summary.Replay.P50)),
+		)
+		return err
+	}
+	return fmt.Errorf("unsupported format: %s", format)
+}
@@ -0,0 +1,73 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("json")
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSON, format)
+
+	_, err = ParseFormat("xml")
+	assert.ErrorContains(t, err, `invalid format "xml"`)
+}
+
+func TestWrite(t *testing.T) {
+	cost, _ := currency.NewAmount("0.0012", "USD")
+	diffs := []Diff{
+		{
+			Name:       "a",
+			URL:        "https://api.openai.com/v1/chat/completions",
+			Original:   Side{Status: 200, Model: "gpt-4o", InputTokens: 10, OutputTokens: 5, Cost: cost, Duration: time.Second, FinishReason: "stop"},
+			Replay:     Side{Status: 200, Model: "gpt-4o-mini", InputTokens: 10, OutputTokens: 7, Duration: 500 * time.Millisecond, FinishReason: "stop"},
+			Similarity: 0.5,
+		},
+		{Name: "b", URL: "https://api.openai.com/v1/embeddings", Err: errors.New("timeout")},
+	}
+	summary := Summarize(diffs)
+
+	t.Run("table", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, Write(buf, FormatTable, diffs, summary))
+		out := buf.String()
+		assert.Contains(t, out, "gpt-4o -> gpt-4o-mini")
+		assert.Contains(t, out, "50%")
+		assert.Contains(t, out, "5 -> 7")
+		assert.Contains(t, out, "1000 -> 500")
+		assert.Contains(t, out, "0.0012 USD -> -")
+		assert.Contains(t, out, "error: timeout")
+		assert.Contains(t, out, "replayed 1 of 2 requests, 1 errors")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, Write(buf, FormatJSON, diffs, summary))
+		out := struct {
+			Cases   []jsonDiff `json:"cases"`
+			Summary struct {
+				Errors   int        `json:"errors"`
+				Original jsonTotals `json:"original"`
+			} `json:"summary"`
+		}{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+		require.Len(t, out.Cases, 2)
+		require.NotNil(t, out.Cases[0].Replay)
+		assert.Equal(t, "gpt-4o-mini", out.Cases[0].Replay.Model)
+		assert.Equal(t, "0.0012", out.Cases[0].Original.Cost)
+		assert.Nil(t, out.Cases[1].Replay)
+		assert.Equal(t, "timeout", out.Cases[1].Error)
+		assert.Equal(t, 1, out.Summary.Errors)
+		assert.Equal(t, int64(1000), out.Summary.Original.P50Ms)
+	})
+
+	assert.Error(t, Write(&bytes.Buffer{}, Format("xml"), diffs, summary))
+}
@@ -0,0 +1,250 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/fileUtils"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// internalHeaderPrefix is the prefix of the headers added by llm_proxy, which aren't sent again
+const internalHeaderPrefix = "x-llm_proxy-"
+
+// skipHeaders are not copied from the captured request, the client sets them for the new request
+var skipHeaders = map[string]struct{}{
+	"Accept-Encoding":   {}, // the client decompresses the response when it sets this header
+	"Connection":        {},
+	"Content-Encoding":  {}, // the logged body is not encoded
+	"Content-Length":    {},
+	"Host":              {},
+	"Keep-Alive":        {},
+	"Proxy-Connection":  {},
+	"Transfer-Encoding": {},
+}
+
+// Options controls where, and how fast, the requests are sent
+type Options struct {
+	Upstream    *url.URL      // replaces the scheme and host, and is prepended to the path, nil keeps the original URL
+	Model       string        // replaces the model in the request body, empty keeps the original model
+	Header      http.Header   // added to every request, e.g., the API key that was filtered from the logs
+	Concurrency int           // requests in flight at once, at least 1
+	Rate        float64       // requests started per second, 0 is unlimited
+	Timeout     time.Duration // for each request, including the response body, 0 is unlimited
+}
+
+// Result is the replayed transaction for a case. Replayed is nil when the request failed.
+type Result struct {
+	Case
+	Replayed *schema.LogDumpContainer
+	Err      error
+}
+
+// replayURL returns the URL of the original request on the new upstream
+func replayURL(original *url.URL, upstream *url.URL) *url.URL {
+	u := *original
+	if upstream != nil {
+		u.Scheme = upstream.Scheme
+		u.Host = upstream.Host
+		u.Path = strings.TrimSuffix(upstream.Path, "/") + original.Path
+		u.RawPath = ""
+	}
+	return &u
+}
+
+// replaceModel sets the model in a JSON request body, bodies without a model are not changed
+func replaceModel(body, model string) (string, error) {
+	if model == "" {
+		return body, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	parsed := make(map[string]any)
+	if err := decoder.Decode(&parsed); err != nil {
+		return body, nil
+	}
+	if _, found := parsed["model"]; !found {
+		return body, nil
+	}
+	parsed["model"] = model
+
+	newBody, err := json.Marshal(parsed)
+	if err != nil {
+		return "", fmt.Errorf("error encoding request body: %w", err)
+	}
+	return string(newBody), nil
+}
+
+// NewRequest converts a captured request for the new upstream and model. The returned
+// ProxyRequest is the request that is recorded, it doesn't include the Options headers, which may
+// be secrets.
+func NewRequest(ctx context.Context, c Case, opts Options) (*http.Request, *schema.ProxyRequest, error) {
+	original := c.Original.Request
+	body, err := replaceModel(original.Body, opts.Model)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	method := original.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	recorded := &schema.ProxyRequest{
+		Method: method,
+		URL:    replayURL(original.URL, opts.Upstream),
+		Proto:  original.Proto,
+		Header: make(http.Header),
+		Body:   body,
+	}
+	for key, values := range original.Header {
+		if _, skip := skipHeaders[http.CanonicalHeaderKey(key)]; skip || strings.HasPrefix(strings.ToLower(key), internalHeaderPrefix) {
+			continue
+		}
+		recorded.Header[key] = append([]string{}, values...)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, recorded.URL.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header = recorded.Header.Clone()
+	for key, values := range opts.Header {
+		req.Header[key] = append([]string{}, values...)
+	}
+	return req, recorded, nil
+}
+
+// send replays a single case, the duration includes reading the whole response body
+func send(ctx context.Context, client *http.Client, c Case, opts Options) Result {
+	result := Result{Case: c}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	req, recorded, err := NewRequest(ctx, c, opts)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		result.Err = fmt.Errorf("error reading response body: %w", err)
+		return result
+	}
+	duration := time.Since(start)
+
+	result.Replayed = &schema.LogDumpContainer{
+		SchemaVersion: schema.SchemaVersion,
+		Timestamp:     start,
+		ConnectionStats: &schema.ConnectionStatsContainer{
+			URL:      recorded.URL.String(),
+			Duration: duration.Milliseconds(),
+		},
+		Request: recorded,
+		Response: &schema.ProxyResponse{
+			Status: resp.StatusCode,
+			Header: resp.Header,
+			Body:   string(body),
+		},
+	}
+	return result
+}
+
+// Run sends every case, with the concurrency and rate limits from the options. The results are in
+// the same order as the cases. Cases that weren't sent before the context was canceled have the
+// context error.
+func Run(ctx context.Context, client *http.Client, cases []Case, opts Options) []Result {
+	results := make([]Result, len(cases))
+	concurrency := max(opts.Concurrency, 1)
+
+	var tick <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = send(ctx, client, cases[i], opts)
+				if results[i].Err != nil {
+					log.Warnf("replay %s failed: %v", cases[i].Name, results[i].Err)
+				} else {
+					log.Debugf("replayed %s: %d", cases[i].Name, results[i].Replayed.Response.Status)
+				}
+			}
+		}()
+	}
+
+	next := 0
+dispatch:
+	for ; next < len(cases); next++ {
+		if tick != nil && next > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+		select {
+		case jobs <- next:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := next; i < len(cases); i++ {
+		results[i] = Result{Case: cases[i], Err: ctx.Err()}
+	}
+	return results
+}
+
+// Save writes each replayed transaction to the directory, in the dir_logger JSON format, with
+// the name of its case
+func Save(dir string, results []Result) error {
+	if err := fileUtils.DirExistsOrCreate(dir); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Replayed == nil {
+			continue
+		}
+		data, err := json.MarshalIndent(result.Replayed, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal replayed response to JSON: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, result.Name+".json"), data, 0644); err != nil {
+			return fmt.Errorf("error writing replayed response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// loadTestCase parses the test log, with a name
+func loadTestCase(t *testing.T, name string) Case {
+	t.Helper()
+	container := &schema.LogDumpContainer{}
+	require.NoError(t, json.Unmarshal([]byte(testLog), container))
+	return Case{Name: name, Original: container}
+}
+
+func TestNewRequest(t *testing.T) {
+	upstream, _ := url.Parse("http://localhost:11434/proxy/")
+	opts := Options{
+		Upstream: upstream,
+		Model:    "gpt-4.1-mini",
+		Header:   http.Header{"Authorization": []string{"Bearer secret"}},
+	}
+
+	req, recorded, err := NewRequest(context.Background(), loadTestCase(t, "a"), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:11434/proxy/v1/chat/completions", req.URL.String())
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Empty(t, req.Header.Get("Content-Length"), "set by the client for the new body")
+	assert.Empty(t, req.Header.Get("X-Llm_proxy-Tags"), "llm_proxy headers aren't sent again")
+
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model": "gpt-4.1-mini", "messages": [{"role": "user", "content": "Hello"}]}`, string(body))
+	assert.Equal(t, string(body), recorded.Body)
+	assert.Empty(t, recorded.Header.Get("Authorization"), "the added headers aren't recorded")
+
+	t.Run("original URL and model", func(t *testing.T) {
+		c := loadTestCase(t, "a")
+		req, recorded, err := NewRequest(context.Background(), c, Options{})
+		require.NoError(t, err)
+		assert.Equal(t, "https://api.openai.com/v1/chat/completions", req.URL.String())
+		assert.Equal(t, c.Original.Request.Body, recorded.Body)
+	})
+}
+
+func TestRun(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			previous := maxInFlight.Load()
+			if current <= previous || maxInFlight.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		body := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"model":   body["model"],
+			"choices": []any{map[string]any{"message": map[string]any{"content": "Hello, how can I help?"}, "finish_reason": "stop"}},
+		})
+	}))
+	defer server.Close()
+	upstream, _ := url.Parse(server.URL)
+
+	cases := make([]Case, 0, 6)
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		cases = append(cases, loadTestCase(t, name))
+	}
+	opts := Options{
+		Upstream:    upstream,
+		Model:       "gpt-4.1-mini",
+		Header:      http.Header{"Authorization": []string{"Bearer secret"}},
+		Concurrency: 2,
+	}
+
+	results := Run(context.Background(), server.Client(), cases, opts)
+	require.Len(t, results, len(cases))
+	for i, result := range results {
+		assert.Equal(t, cases[i].Name, result.Name, "the results are in order")
+		require.NoError(t, result.Err)
+		require.NotNil(t, result.Replayed)
+		assert.Equal(t, http.StatusOK, result.Replayed.Response.Status)
+		assert.Contains(t, result.Replayed.Response.Body, `"model":"gpt-4.1-mini"`)
+		assert.Equal(t, server.URL+"/v1/chat/completions", result.Replayed.ConnectionStats.URL)
+		assert.GreaterOrEqual(t, result.Replayed.ConnectionStats.Duration, int64(20))
+	}
+	assert.Equal(t, int32(2), maxInFlight.Load())
+
+	t.Run("rate limit", func(t *testing.T) {
+		opts := opts
+		opts.Concurrency = 10
+		opts.Rate = 20
+		start := time.Now()
+		results := Run(context.Background(), server.Client(), cases[:3], opts)
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "3 requests at 20 per second")
+		for _, result := range results {
+			assert.NoError(t, result.Err)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		results := Run(ctx, server.Client(), cases, opts)
+		require.Len(t, results, len(cases))
+		for _, result := range results {
+			assert.Error(t, result.Err)
+			assert.Nil(t, result.Replayed)
+		}
+	})
+
+	t.Run("save", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "replay")
+		failed := Result{Case: loadTestCase(t, "failed"), Err: context.Canceled}
+		require.NoError(t, Save(dir, append(results[:1], failed)))
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(dir, "a.json")}, files)
+
+		data, err := os.ReadFile(files[0])
+		require.NoError(t, err)
+		saved := &schema.LogDumpContainer{}
+		require.NoError(t, json.Unmarshal(data, saved))
+		assert.Equal(t, results[0].Replayed.Response.Body, saved.Response.Body)
+		assert.Equal(t, results[0].Replayed.Request.URL.String(), saved.Request.URL.String())
+	})
+}
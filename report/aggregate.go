@@ -0,0 +1,160 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/bojanz/currency"
+	log "github.com/sirupsen/logrus"
+)
+
+// GroupBy is the record field used to group the report rows
+type GroupBy string
+
+const (
+	GroupByDay    GroupBy = "day"
+	GroupByModel  GroupBy = "model"
+	GroupByHost   GroupBy = "host"
+	GroupByClient GroupBy = "client"
+	GroupByTag    GroupBy = "tag"
+
+	// noValue is the group key for records without a value for the grouped field
+	noValue = "(none)"
+)
+
+// GroupByOptions lists the valid GroupBy values, for the command help
+var GroupByOptions = []GroupBy{GroupByDay, GroupByModel, GroupByHost, GroupByClient, GroupByTag}
+
+// ParseGroupBy validates a group by option
+func ParseGroupBy(value string) (GroupBy, error) {
+	for _, option := range GroupByOptions {
+		if GroupBy(value) == option {
+			return option, nil
+		}
+	}
+	return "", fmt.Errorf("invalid group by option %q, must be one of: %v", value, GroupByOptions)
+}
+
+// keys returns the group keys for a record. Records with several tags are counted in the group for
+// each tag, so the tag totals can add up to more than the overall total.
+func (g GroupBy) keys(record Record) []string {
+	var key string
+	switch g {
+	case GroupByDay:
+		key = record.Timestamp.Format(time.DateOnly)
+	case GroupByModel:
+		key = record.Model
+	case GroupByHost:
+		key = record.Host
+	case GroupByClient:
+		// the client port changes for every connection
+		key = record.Client
+		if host, _, err := net.SplitHostPort(record.Client); err == nil {
+			key = host
+		}
+	case GroupByTag:
+		if len(record.Tags) > 0 {
+			return record.Tags
+		}
+	}
+	if key == "" {
+		return []string{noValue}
+	}
+	return []string{key}
+}
+
+// Row is the summary for a single group. Spend doesn't include the requests served from the
+// response cache, their cost is counted in Savings.
+type Row struct {
+	Group           string
+	Requests        int
+	Unpriced        int // requests that couldn't be priced, e.g., an unknown model
+	InputTokens     int
+	CachedTokens    int
+	OutputTokens    int
+	ReasoningTokens int
+	Spend           currency.Amount
+	CacheHits       int
+	Savings         currency.Amount
+	P50             time.Duration
+	P90             time.Duration
+	P99             time.Duration
+	durations       []time.Duration
+}
+
+// add counts a record in this row
+func (row *Row) add(record Record) {
+	row.Requests++
+	row.InputTokens += record.InputTokens
+	row.CachedTokens += record.CachedTokens
+	row.OutputTokens += record.OutputTokens
+	row.ReasoningTokens += record.ReasoningTokens
+	if record.Duration > 0 {
+		row.durations = append(row.durations, record.Duration)
+	}
+	if record.CacheHit {
+		row.CacheHits++
+	}
+
+	if !record.Priced {
+		row.Unpriced++
+		return
+	}
+	target := &row.Spend
+	if record.CacheHit {
+		target = &row.Savings
+	}
+	total, err := target.Add(record.Cost)
+	if err != nil {
+		log.Warnf("not adding %s to the %s total: %v", record.Cost, row.Group, err)
+		return
+	}
+	*target = total
+}
+
+// finish calculates the latency percentiles
+func (row *Row) finish() {
+	sort.Slice(row.durations, func(i, j int) bool { return row.durations[i] < row.durations[j] })
+	row.P50 = percentile(row.durations, 50)
+	row.P90 = percentile(row.durations, 90)
+	row.P99 = percentile(row.durations, 99)
+}
+
+// percentile returns the nearest-rank percentile of sorted durations, or zero when there are none
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// Aggregate groups the records, and returns one row per group sorted by the group key, and a total
+// row for all records
+func Aggregate(records []Record, groupBy GroupBy) (rows []*Row, total *Row) {
+	groups := make(map[string]*Row)
+	total = &Row{Group: "total"}
+	for _, record := range records {
+		total.add(record)
+		for _, key := range groupBy.keys(record) {
+			row, found := groups[key]
+			if !found {
+				row = &Row{Group: key}
+				groups[key] = row
+			}
+			row.add(record)
+		}
+	}
+
+	rows = make([]*Row, 0, len(groups))
+	for _, row := range groups {
+		row.finish()
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Group < rows[j].Group })
+	total.finish()
+	return rows, total
+}
@@ -0,0 +1,97 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func amount(t *testing.T, n string) currency.Amount {
+	t.Helper()
+	a, err := currency.NewAmount(n, "USD")
+	require.NoError(t, err)
+	return a
+}
+
+func testRecords(t *testing.T) []Record {
+	day := func(d int) time.Time { return time.Date(2024, time.October, d, 12, 0, 0, 0, time.UTC) }
+	return []Record{
+		{Timestamp: day(1), Model: "gpt-4o", Host: "api.openai.com", Client: "10.0.0.1:1000", Tags: []string{"a", "b"},
+			InputTokens: 100, OutputTokens: 10, Cost: amount(t, "1.00"), Priced: true, Duration: 100 * time.Millisecond},
+		{Timestamp: day(1), Model: "gpt-4o", Host: "api.openai.com", Client: "10.0.0.1:1001", Tags: []string{"a"},
+			InputTokens: 100, OutputTokens: 10, Cost: amount(t, "1.00"), Priced: true, CacheHit: true, Duration: 10 * time.Millisecond},
+		{Timestamp: day(2), Model: "claude-3-5-haiku-latest", Host: "api.anthropic.com", Client: "10.0.0.2:1000",
+			InputTokens: 50, OutputTokens: 5, Cost: amount(t, "0.50"), Priced: true, Duration: 300 * time.Millisecond},
+		{Timestamp: day(2), Host: "example.com"},
+	}
+}
+
+func TestParseGroupBy(t *testing.T) {
+	for _, option := range GroupByOptions {
+		groupBy, err := ParseGroupBy(string(option))
+		require.NoError(t, err)
+		assert.Equal(t, option, groupBy)
+	}
+	_, err := ParseGroupBy("week")
+	assert.Error(t, err)
+}
+
+func TestAggregate(t *testing.T) {
+	testCases := []struct {
+		groupBy  GroupBy
+		expected map[string]int // group to request count
+	}{
+		{GroupByDay, map[string]int{"2024-10-01": 2, "2024-10-02": 2}},
+		{GroupByModel, map[string]int{"gpt-4o": 2, "claude-3-5-haiku-latest": 1, noValue: 1}},
+		{GroupByHost, map[string]int{"api.openai.com": 2, "api.anthropic.com": 1, "example.com": 1}},
+		{GroupByClient, map[string]int{"10.0.0.1": 2, "10.0.0.2": 1, noValue: 1}},
+		{GroupByTag, map[string]int{"a": 2, "b": 1, noValue: 2}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.groupBy), func(t *testing.T) {
+			rows, total := Aggregate(testRecords(t), tc.groupBy)
+			groups := make(map[string]int)
+			for i, row := range rows {
+				groups[row.Group] = row.Requests
+				if i > 0 {
+					assert.Less(t, rows[i-1].Group, row.Group, "rows are sorted")
+				}
+			}
+			assert.Equal(t, tc.expected, groups)
+			assert.Equal(t, 4, total.Requests)
+		})
+	}
+}
+
+func TestAggregateTotals(t *testing.T) {
+	rows, total := Aggregate(testRecords(t), GroupByDay)
+	require.Len(t, rows, 2)
+
+	first := rows[0]
+	assert.Equal(t, 200, first.InputTokens)
+	assert.Equal(t, 1, first.CacheHits)
+	assert.Equal(t, "1.00 USD", first.Spend.String())
+	assert.Equal(t, "1.00 USD", first.Savings.String(), "cache hits are savings, not spend")
+	assert.Equal(t, 10*time.Millisecond, first.P50)
+	assert.Equal(t, 100*time.Millisecond, first.P99)
+
+	assert.Equal(t, 1, rows[1].Unpriced)
+	assert.Equal(t, "1.50 USD", total.Spend.String())
+	assert.Equal(t, 100*time.Millisecond, total.P50)
+	assert.Equal(t, 300*time.Millisecond, total.P90)
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 0, 100)
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	assert.Equal(t, time.Duration(50), percentile(sorted, 50))
+	assert.Equal(t, time.Duration(99), percentile(sorted, 99))
+	assert.Equal(t, time.Duration(1), percentile(sorted[:1], 50))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
@@ -0,0 +1,191 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bojanz/currency"
+)
+
+// Format is the output format of the report
+type Format string
+
+const (
+	FormatTable Format = "table"
+	FormatCSV   Format = "csv"
+	FormatJSON  Format = "json"
+)
+
+// FormatOptions lists the valid Format values, for the command help
+var FormatOptions = []Format{FormatTable, FormatCSV, FormatJSON}
+
+// ParseFormat validates an output format option
+func ParseFormat(value string) (Format, error) {
+	for _, option := range FormatOptions {
+		if Format(value) == option {
+			return option, nil
+		}
+	}
+	return "", fmt.Errorf("invalid format %q, must be one of: %v", value, FormatOptions)
+}
+
+// jsonRow is a single row in the JSON output. Costs are decimal numbers in Currency, and the
+// latency percentiles are omitted when the source doesn't record durations.
+type jsonRow struct {
+	Group           string `json:"group"`
+	Requests        int    `json:"requests"`
+	Unpriced        int    `json:"unpriced"`
+	InputTokens     int    `json:"input_tokens"`
+	CachedTokens    int    `json:"cached_tokens"`
+	OutputTokens    int    `json:"output_tokens"`
+	ReasoningTokens int    `json:"reasoning_tokens"`
+	Spend           string `json:"spend"`
+	CacheHits       int    `json:"cache_hits"`
+	Savings         string `json:"savings"`
+	Currency        string `json:"currency,omitempty"`
+	P50Ms           *int64 `json:"p50_ms,omitempty"`
+	P90Ms           *int64 `json:"p90_ms,omitempty"`
+	P99Ms           *int64 `json:"p99_ms,omitempty"`
+}
+
+// csvHeader is the header row for the CSV and table output, after the group column
+var csvHeader = []string{
+	"requests", "unpriced", "input_tokens", "cached_tokens", "output_tokens", "reasoning_tokens",
+	"spend", "cache_hits", "savings", "currency", "p50_ms", "p90_ms", "p99_ms",
+}
+
+// number returns the decimal number of an amount, "0" for an empty amount
+func number(amount currency.Amount) string {
+	if amount.CurrencyCode() == "" {
+		return "0"
+	}
+	return amount.Number()
+}
+
+// currencyCode returns the currency of the row's costs
+func (row *Row) currencyCode() string {
+	if code := row.Spend.CurrencyCode(); code != "" {
+		return code
+	}
+	return row.Savings.CurrencyCode()
+}
+
+// latencies returns the percentiles in milliseconds, nil when no durations were recorded
+func (row *Row) latencies() []*int64 {
+	if len(row.durations) == 0 {
+		return []*int64{nil, nil, nil}
+	}
+	out := make([]*int64, 0, 3)
+	for _, d := range []time.Duration{row.P50, row.P90, row.P99} {
+		ms := d.Milliseconds()
+		out = append(out, &ms)
+	}
+	return out
+}
+
+// toJSON converts a row for the JSON output
+func (row *Row) toJSON() jsonRow {
+	latencies := row.latencies()
+	return jsonRow{
+		Group:           row.Group,
+		Requests:        row.Requests,
+		Unpriced:        row.Unpriced,
+		InputTokens:     row.InputTokens,
+		CachedTokens:    row.CachedTokens,
+		OutputTokens:    row.OutputTokens,
+		ReasoningTokens: row.ReasoningTokens,
+		Spend:           number(row.Spend),
+		CacheHits:       row.CacheHits,
+		Savings:         number(row.Savings),
+		Currency:        row.currencyCode(),
+		P50Ms:           latencies[0],
+		P90Ms:           latencies[1],
+		P99Ms:           latencies[2],
+	}
+}
+
+// fields returns the row values in csvHeader order, formatting the costs and latencies with the
+// functions supplied by the output format
+func (row *Row) fields(money func(currency.Amount) string, missing string) []string {
+	values := []string{
+		strconv.Itoa(row.Requests),
+		strconv.Itoa(row.Unpriced),
+		strconv.Itoa(row.InputTokens),
+		strconv.Itoa(row.CachedTokens),
+		strconv.Itoa(row.OutputTokens),
+		strconv.Itoa(row.ReasoningTokens),
+		money(row.Spend),
+		strconv.Itoa(row.CacheHits),
+		money(row.Savings),
+		row.currencyCode(),
+	}
+	for _, latency := range row.latencies() {
+		if latency == nil {
+			values = append(values, missing)
+			continue
+		}
+		values = append(values, strconv.FormatInt(*latency, 10))
+	}
+	return values
+}
+
+// Write prints the report rows, and the total row, in the requested format. The locale is used to
+// format the costs in the table, e.g., "en-US".
+func Write(w io.Writer, format Format, groupBy GroupBy, rows []*Row, total *Row, locale string) error {
+	switch format {
+	case FormatJSON:
+		out := struct {
+			GroupBy GroupBy   `json:"group_by"`
+			Rows    []jsonRow `json:"rows"`
+			Total   jsonRow   `json:"total"`
+		}{GroupBy: groupBy, Rows: make([]jsonRow, 0, len(rows)), Total: total.toJSON()}
+		for _, row := range rows {
+			out.Rows = append(out.Rows, row.toJSON())
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(out)
+
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(append([]string{string(groupBy)}, csvHeader...)); err != nil {
+			return err
+		}
+		for _, row := range append(append([]*Row{}, rows...), total) {
+			if err := writer.Write(append([]string{row.Group}, row.fields(number, "")...)); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case FormatTable:
+		formatter := currency.NewFormatter(currency.NewLocale(locale))
+		money := func(amount currency.Amount) string {
+			if amount.CurrencyCode() == "" {
+				return "-"
+			}
+			return formatter.Format(amount)
+		}
+
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		writeLine := func(values []string) {
+			for _, value := range values {
+				fmt.Fprintf(table, "%s\t", value)
+			}
+			fmt.Fprintln(table)
+		}
+		writeLine(append([]string{string(groupBy)}, csvHeader...))
+		for _, row := range rows {
+			writeLine(append([]string{row.Group}, row.fields(money, "-")...))
+		}
+		writeLine(append([]string{total.Group}, total.fields(money, "-")...))
+		return table.Flush()
+	}
+	return fmt.Errorf("unsupported format: %s", format)
+}
@@ -0,0 +1,61 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("csv")
+	require.NoError(t, err)
+	assert.Equal(t, FormatCSV, format)
+
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestWrite(t *testing.T) {
+	rows, total := Aggregate(testRecords(t), GroupByModel)
+
+	t.Run("json", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, Write(buf, FormatJSON, GroupByModel, rows, total, "en-US"))
+
+		out := struct {
+			GroupBy string           `json:"group_by"`
+			Rows    []map[string]any `json:"rows"`
+			Total   map[string]any   `json:"total"`
+		}{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+		assert.Equal(t, "model", out.GroupBy)
+		require.Len(t, out.Rows, 3)
+		assert.Equal(t, "(none)", out.Rows[0]["group"])
+		assert.Equal(t, "0", out.Rows[0]["spend"])
+		assert.NotContains(t, out.Rows[0], "p50_ms", "no durations recorded")
+		assert.Equal(t, "1.50", out.Total["spend"])
+		assert.Equal(t, "USD", out.Total["currency"])
+		assert.Equal(t, float64(100), out.Total["p50_ms"])
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, Write(buf, FormatCSV, GroupByModel, rows, total, "en-US"))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 5, "header, three rows, and the total")
+		assert.True(t, strings.HasPrefix(lines[0], "model,requests,unpriced,"))
+		assert.Equal(t, "gpt-4o,2,0,200,0,20,0,1.00,1,1.00,USD,10,100,100", lines[3])
+		assert.True(t, strings.HasPrefix(lines[4], "total,4,1,"))
+	})
+
+	t.Run("table", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, Write(buf, FormatTable, GroupByModel, rows, total, "en-US"))
+		assert.Contains(t, buf.String(), "$1.50")
+		assert.Contains(t, buf.String(), "claude-3-5-haiku-latest")
+	})
+}
@@ -0,0 +1,192 @@
+// Package report summarizes spend, tokens, and latency from the dir_logger output, or from a cost
+// ledger, for the report command.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bojanz/currency"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/proxy/addons"
+	"github.com/proxati/llm_proxy/proxy/addons/ledger"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+// Record is a single transaction, from a log file or a ledger entry. Cost is zero when the
+// transaction couldn't be priced, and Duration is zero when the source doesn't record it.
+type Record struct {
+	Timestamp       time.Time
+	Host            string
+	Model           string
+	Client          string
+	Tags            []string
+	InputTokens     int
+	CachedTokens    int
+	OutputTokens    int
+	ReasoningTokens int
+	Cost            currency.Amount
+	ConvertedCost   currency.Amount // the cost converted when it was recorded, only from a ledger
+	Priced          bool
+	CacheHit        bool // served from the response cache, so the cost was saved
+	Duration        time.Duration
+}
+
+// LoadLogs reads the JSON log files written by dir_logger, and prices each transaction with the
+// built-in pricing data. Files that aren't request logs are skipped.
+func LoadLogs(dir string, from, until time.Time) ([]Record, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing log files: %w", err)
+	}
+	sort.Strings(files)
+
+	costCounter := schema.NewCostCounterDefaults()
+	records := make([]Record, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading log file: %w", err)
+		}
+
+		container := &schema.LogDumpContainer{}
+		if err := json.Unmarshal(data, container); err != nil || container.Request == nil || container.Request.URL == nil {
+			log.Debugf("skipping file that isn't a request log: %s", file)
+			continue
+		}
+		if !inRange(container.Timestamp, from, until) {
+			continue
+		}
+		records = append(records, newRecordFromLog(costCounter, container))
+	}
+	return records, nil
+}
+
+// newRecordFromLog converts a single log file, the cost is calculated from the request and response
+func newRecordFromLog(costCounter *schema.CostCounter, container *schema.LogDumpContainer) Record {
+	record := Record{
+		Timestamp: container.Timestamp,
+		Host:      container.Request.URL.Hostname(),
+		Tags:      headerTags(container.Request),
+	}
+	if container.ConnectionStats != nil {
+		record.Client = container.ConnectionStats.ClientAddress
+		record.Duration = time.Duration(container.ConnectionStats.Duration) * time.Millisecond
+	}
+
+	if container.Response == nil {
+		return record
+	}
+	record.CacheHit = container.Response.Header.Get(addons.CacheStatusHeader) == addons.CacheStatusHit
+
+	auditOutput, err := costCounter.AddRouted(*container.Request, *container.Response, 0, container.Route())
+	if err != nil {
+		log.Debugf("not pricing %s: %v", container.Request.URL, err)
+		return record
+	}
+	record.Model = auditOutput.Model
+	record.InputTokens = auditOutput.InputTokens
+	record.CachedTokens = auditOutput.CachedTokens
+	record.OutputTokens = auditOutput.OutputTokens
+	record.ReasoningTokens = auditOutput.ReasoningTokens
+	if cost, err := currency.NewAmount(auditOutput.Cost, auditOutput.Currency); err == nil {
+		record.Cost = cost
+		record.Priced = true
+	}
+	return record
+}
+
+// headerTags parses the tags request header, when request headers were logged
+func headerTags(req *schema.ProxyRequest) []string {
+	tags := make([]string, 0)
+	for _, value := range req.Header.Values(addons.RequestTagsHeader) {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// LoadLedger reads the entries from a cost ledger file
+func LoadLedger(path string, from, until time.Time) ([]Record, error) {
+	l, err := ledger.OpenReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	records := make([]Record, 0)
+	err = l.Range(from, until, func(entry ledger.Entry) error {
+		record := Record{
+			Timestamp:       entry.Timestamp,
+			Model:           entry.Model,
+			Client:          entry.Client,
+			Tags:            entry.Tags,
+			InputTokens:     entry.InputTokens,
+			CachedTokens:    entry.CachedTokens,
+			OutputTokens:    entry.OutputTokens,
+			ReasoningTokens: entry.ReasoningTokens,
+		}
+		if u, err := url.Parse(entry.URL); err == nil {
+			record.Host = u.Hostname()
+		}
+		if cost, err := entry.Amount(); err == nil {
+			record.Cost = cost
+			record.Priced = true
+		}
+		if entry.ConvertedCost != "" {
+			record.ConvertedCost, _ = currency.NewAmount(entry.ConvertedCost, entry.ConvertedCurrency)
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// inRange returns true if t is at or after from, and before until. Zero times are not checked.
+func inRange(t, from, until time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	if !until.IsZero() && !t.Before(until) {
+		return false
+	}
+	return true
+}
+
+// ConvertRecords converts the costs to the target currency. A cost that was converted to the
+// target currency when it was recorded keeps the rate from that time, the others are converted
+// with the exchange rates.
+func ConvertRecords(records []Record, rates *schema.ExchangeRates, target string) error {
+	for i := range records {
+		record := &records[i]
+		if !record.Priced || record.Cost.CurrencyCode() == target {
+			continue
+		}
+		if record.ConvertedCost.CurrencyCode() == target {
+			record.Cost = record.ConvertedCost
+			continue
+		}
+		if rates == nil {
+			return fmt.Errorf("exchange rates are required to convert %s to %s", record.Cost.CurrencyCode(), target)
+		}
+		converted, err := rates.Convert(record.Cost, target)
+		if err != nil {
+			return err
+		}
+		record.Cost = converted
+	}
+	return nil
+}
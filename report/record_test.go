@@ -0,0 +1,151 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/proxy/addons"
+	"github.com/proxati/llm_proxy/proxy/addons/ledger"
+	"github.com/proxati/llm_proxy/schema"
+)
+
+const chatResponse = `{"model": "gpt-4o", "usage": {"prompt_tokens": 1000, "completion_tokens": 500}}`
+
+func writeLog(t *testing.T, dir, name string, timestamp time.Time, respHeader http.Header) {
+	t.Helper()
+	u, err := url.Parse("https://api.openai.com/v1/chat/completions")
+	require.NoError(t, err)
+
+	container := &schema.LogDumpContainer{
+		Timestamp: timestamp,
+		ConnectionStats: &schema.ConnectionStatsContainer{
+			ClientAddress: "10.0.0.1:53211",
+			Duration:      250,
+		},
+		Request: &schema.ProxyRequest{
+			Method: http.MethodPost,
+			URL:    u,
+			Header: http.Header{addons.RequestTagsHeader: {"team-a, batch"}},
+			Body:   `{"model": "gpt-4o"}`,
+		},
+		Response: &schema.ProxyResponse{
+			Status: http.StatusOK,
+			Header: respHeader,
+			Body:   chatResponse,
+		},
+	}
+	data, err := json.Marshal(container)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+}
+
+func TestLoadLogs(t *testing.T) {
+	dir := t.TempDir()
+	day := func(d int) time.Time { return time.Date(2024, time.October, d, 12, 0, 0, 0, time.UTC) }
+
+	writeLog(t, dir, "1.json", day(1), http.Header{})
+	writeLog(t, dir, "2.json", day(2), http.Header{addons.CacheStatusHeader: {addons.CacheStatusHit}})
+	writeLog(t, dir, "3.json", day(3), http.Header{})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.json"), []byte(`{"not": "a log"}`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o600))
+
+	records, err := LoadLogs(dir, day(1), day(3))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	first := records[0]
+	assert.Equal(t, day(1), first.Timestamp)
+	assert.Equal(t, "api.openai.com", first.Host)
+	assert.Equal(t, "gpt-4o", first.Model)
+	assert.Equal(t, "10.0.0.1:53211", first.Client)
+	assert.Equal(t, []string{"team-a", "batch"}, first.Tags)
+	assert.Equal(t, 1000, first.InputTokens)
+	assert.Equal(t, 500, first.OutputTokens)
+	assert.Equal(t, 250*time.Millisecond, first.Duration)
+	assert.True(t, first.Priced)
+	assert.False(t, first.CacheHit)
+	assert.Equal(t, "USD", first.Cost.CurrencyCode())
+	assert.Equal(t, "0.01", first.Cost.RoundTo(2, 0).Number())
+
+	assert.True(t, records[1].CacheHit)
+
+	_, err = LoadLogs("[", time.Time{}, time.Time{})
+	assert.Error(t, err, "invalid glob pattern")
+}
+
+func TestLoadLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.db")
+	day := func(d int) time.Time { return time.Date(2024, time.October, d, 12, 0, 0, 0, time.UTC) }
+
+	l, err := ledger.Open(path)
+	require.NoError(t, err)
+	for d := 1; d <= 3; d++ {
+		require.NoError(t, l.Append(ledger.Entry{
+			Timestamp:   day(d),
+			URL:         "https://api.anthropic.com/v1/messages",
+			Model:       "claude-3-5-haiku-latest",
+			InputTokens: d,
+			Cost:        fmt.Sprintf("%d.50", d),
+			Currency:    "USD",
+			Client:      "127.0.0.1:9000",
+			Tags:        []string{"team-b"},
+		}))
+	}
+	require.NoError(t, l.Append(ledger.Entry{Timestamp: day(2), URL: "https://example.com/"}))
+	require.NoError(t, l.Append(ledger.Entry{
+		Timestamp: day(4), URL: "https://api.openai.com/v1/chat/completions", Cost: "2", Currency: "USD",
+		ConvertedCost: "1.8", ConvertedCurrency: "EUR",
+	}))
+	require.NoError(t, l.Close())
+
+	records, err := LoadLedger(path, day(2), time.Time{})
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+
+	assert.Equal(t, "api.anthropic.com", records[0].Host)
+	assert.Equal(t, "claude-3-5-haiku-latest", records[0].Model)
+	assert.Equal(t, []string{"team-b"}, records[0].Tags)
+	assert.Equal(t, 2, records[0].InputTokens)
+	assert.Equal(t, "2.50 USD", records[0].Cost.String())
+	assert.True(t, records[0].Priced)
+	assert.False(t, records[1].Priced, "entry without a cost")
+	assert.Equal(t, "1.8 EUR", records[3].ConvertedCost.String())
+
+	_, err = LoadLedger(filepath.Join(t.TempDir(), "missing.db"), time.Time{}, time.Time{})
+	assert.Error(t, err)
+}
+
+func TestConvertRecords(t *testing.T) {
+	amount := func(n, code string) currency.Amount {
+		a, err := currency.NewAmount(n, code)
+		require.NoError(t, err)
+		return a
+	}
+	rates := &schema.ExchangeRates{Base: "USD", Rates: map[string]string{"EUR": "0.5"}}
+
+	records := []Record{
+		{Cost: amount("10", "USD"), Priced: true},
+		{Cost: amount("10", "USD"), ConvertedCost: amount("4", "EUR"), Priced: true},
+		{Cost: amount("3", "EUR"), Priced: true},
+		{},
+	}
+	require.NoError(t, ConvertRecords(records, rates, "EUR"))
+	assert.Equal(t, "5.00 EUR", records[0].Cost.Round().String())
+	assert.Equal(t, "4 EUR", records[1].Cost.String(), "the rate when it was recorded")
+	assert.Equal(t, "3 EUR", records[2].Cost.String())
+	assert.False(t, records[3].Priced)
+
+	records = []Record{{Cost: amount("10", "USD"), Priced: true}}
+	assert.Error(t, ConvertRecords(records, nil, "EUR"), "exchange rates are required")
+	assert.Error(t, ConvertRecords(records, rates, "GBP"), "no rate")
+}
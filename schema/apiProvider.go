@@ -2,24 +2,33 @@ package schema
 
 import (
 	"fmt"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/bojanz/currency"
-	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/proxati/llm_proxy/schema/providers"
 )
 
 type API_Provider struct {
-	name               string
-	model              string
-	currencyUnit       string
-	costPerInputToken  currency.Amount
-	costPerOutputToken currency.Amount
-	totalCost          currency.Amount
-	apiRequests        []*ProxyRequest
-	apiRequestBodies   []*openai.ChatCompletionRequest
-	apiResponses       []*ProxyResponse
-	apiResponseBodies  []*openai.ChatCompletionResponse
-	rwMutex            sync.RWMutex
+	name                   string
+	model                  string
+	currencyUnit           string
+	costPerInputToken      currency.Amount
+	costPerOutputToken     currency.Amount
+	costPerCacheWriteToken currency.Amount
+	costPerCacheReadToken  currency.Amount
+	costPerReasoningToken  currency.Amount
+	costPerBatchInput      currency.Amount
+	costPerBatchOutput     currency.Amount
+	costPerImage           map[string]currency.Amount // key: image variant, e.g., "hd/1024x1024"
+	costPerMinute          currency.Amount
+	costPerCharacter       currency.Amount
+	totalCost              currency.Amount
+	effectiveFrom          time.Time // zero when the price has no start date
+	effectiveUntil         time.Time // zero when the price has no end date
+	rwMutex                sync.RWMutex
 }
 
 // newAPI_Provider creates a single object for a URL/Model combination
@@ -36,64 +45,272 @@ func newAPI_Provider(name, model, inputCost, outputCost, currencyUnit string) (*
 
 	total, _ := currency.NewAmount("0", currencyUnit)
 
+	// cache tokens are billed at the regular input rate, unless setCacheCosts is called. Reasoning
+	// and batch tokens are billed at the regular rates, unless setTierCosts is called.
 	return &API_Provider{
-		name:               name,
-		model:              model,
-		currencyUnit:       currencyUnit,
-		costPerInputToken:  iCost,
-		costPerOutputToken: oCost,
-		totalCost:          total,
-		apiRequests:        make([]*ProxyRequest, 0),
-		apiRequestBodies:   make([]*openai.ChatCompletionRequest, 0),
-		apiResponses:       make([]*ProxyResponse, 0),
-		apiResponseBodies:  make([]*openai.ChatCompletionResponse, 0),
-		rwMutex:            sync.RWMutex{},
+		name:                   name,
+		model:                  model,
+		currencyUnit:           currencyUnit,
+		costPerInputToken:      iCost,
+		costPerOutputToken:     oCost,
+		costPerCacheWriteToken: iCost,
+		costPerCacheReadToken:  iCost,
+		costPerReasoningToken:  oCost,
+		costPerBatchInput:      iCost,
+		costPerBatchOutput:     oCost,
+		costPerImage:           make(map[string]currency.Amount),
+		costPerMinute:          total,
+		costPerCharacter:       total,
+		totalCost:              total,
+		rwMutex:                sync.RWMutex{},
 	}, nil
 }
+
+// newAPI_ProviderFromPrice creates an API_Provider from the pricing data supplied by a provider package
+func newAPI_ProviderFromPrice(url string, price providers.Price) (*API_Provider, error) {
+	currencyUnit := price.Currency
+	if currencyUnit == "" {
+		currencyUnit = "USD"
+	}
+
+	// products that are not billed per token don't set the token costs
+	inputCost := price.InputTokenCost
+	if inputCost == "" {
+		inputCost = "0"
+	}
+	outputCost := price.OutputTokenCost
+	if outputCost == "" {
+		outputCost = "0"
+	}
+
+	apiProvider, err := newAPI_Provider(url, price.Model, inputCost, outputCost, currencyUnit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := apiProvider.setUnitCosts(price.ImageCosts, price.MinuteCost, price.CharacterCost); err != nil {
+		return nil, err
+	}
+	if err := apiProvider.setTierCosts(price.ReasoningTokenCost, price.BatchInputTokenCost, price.BatchOutputTokenCost); err != nil {
+		return nil, err
+	}
+	apiProvider.effectiveFrom = price.EffectiveFrom
+	apiProvider.effectiveUntil = price.EffectiveUntil
+
+	if price.CacheWriteTokenCost == "" && price.CacheReadTokenCost == "" {
+		return apiProvider, nil
+	}
+
+	cacheWriteCost := price.CacheWriteTokenCost
+	if cacheWriteCost == "" {
+		cacheWriteCost = inputCost
+	}
+	cacheReadCost := price.CacheReadTokenCost
+	if cacheReadCost == "" {
+		cacheReadCost = inputCost
+	}
+	if err := apiProvider.setCacheCosts(cacheWriteCost, cacheReadCost); err != nil {
+		return nil, err
+	}
+	return apiProvider, nil
+}
+
+// setCacheCosts sets the per-token prices for prompt cache writes and reads
+func (cc *API_Provider) setCacheCosts(cacheWriteCost, cacheReadCost string) error {
+	wCost, err := currency.NewAmount(cacheWriteCost, cc.currencyUnit)
+	if err != nil {
+		return fmt.Errorf("failed to create cache write currency amount: %v", err)
+	}
+
+	rCost, err := currency.NewAmount(cacheReadCost, cc.currencyUnit)
+	if err != nil {
+		return fmt.Errorf("failed to create cache read currency amount: %v", err)
+	}
+
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+	cc.costPerCacheWriteToken = wCost
+	cc.costPerCacheReadToken = rCost
+	return nil
+}
+
+// setTierCosts sets the per-token prices for reasoning tokens, and for batch input and output
+// tokens, empty costs are skipped
+func (cc *API_Provider) setTierCosts(reasoningCost, batchInputCost, batchOutputCost string) error {
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+
+	tiers := []struct {
+		name   string
+		cost   string
+		target *currency.Amount
+	}{
+		{name: "reasoning", cost: reasoningCost, target: &cc.costPerReasoningToken},
+		{name: "batch input", cost: batchInputCost, target: &cc.costPerBatchInput},
+		{name: "batch output", cost: batchOutputCost, target: &cc.costPerBatchOutput},
+	}
+	for _, tier := range tiers {
+		if tier.cost == "" {
+			continue
+		}
+		amount, err := currency.NewAmount(tier.cost, cc.currencyUnit)
+		if err != nil {
+			return fmt.Errorf("failed to create %s currency amount: %v", tier.name, err)
+		}
+		*tier.target = amount
+	}
+	return nil
+}
+
+// setUnitCosts sets the prices for products that are not billed per token, empty costs are skipped
+func (cc *API_Provider) setUnitCosts(imageCosts map[string]string, minuteCost, characterCost string) error {
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+
+	for variant, cost := range imageCosts {
+		iCost, err := currency.NewAmount(cost, cc.currencyUnit)
+		if err != nil {
+			return fmt.Errorf("failed to create image currency amount for %s: %v", variant, err)
+		}
+		cc.costPerImage[variant] = iCost
+	}
+
+	if minuteCost != "" {
+		mCost, err := currency.NewAmount(minuteCost, cc.currencyUnit)
+		if err != nil {
+			return fmt.Errorf("failed to create per minute currency amount: %v", err)
+		}
+		cc.costPerMinute = mCost
+	}
+
+	if characterCost != "" {
+		cCost, err := currency.NewAmount(characterCost, cc.currencyUnit)
+		if err != nil {
+			return fmt.Errorf("failed to create per character currency amount: %v", err)
+		}
+		cc.costPerCharacter = cCost
+	}
+	return nil
+}
+
+// effectiveAt returns true if this price is valid at time t
+func (cc *API_Provider) effectiveAt(t time.Time) bool {
+	return providers.Price{EffectiveFrom: cc.effectiveFrom, EffectiveUntil: cc.effectiveUntil}.EffectiveAt(t)
+}
+
 func (cc *API_Provider) String() string {
 	cc.rwMutex.RLock()
 	defer cc.rwMutex.RUnlock()
 	return cc.totalCost.Round().String()
 }
 
-func (cc *API_Provider) addRequest(req *ProxyRequest, chatCompReq *openai.ChatCompletionRequest) {
-	cc.rwMutex.Lock()
-	defer cc.rwMutex.Unlock()
-	cc.apiRequests = append(cc.apiRequests, req)
-	cc.apiRequestBodies = append(cc.apiRequestBodies, chatCompReq)
+// addUnitCost multiplies the unit cost by the quantity, and adds it to the subtotal
+func addUnitCost(subtotal, unitCost currency.Amount, quantity string) (currency.Amount, error) {
+	cost, err := unitCost.Mul(quantity)
+	if err != nil {
+		return currency.Amount{}, err
+	}
+	return subtotal.Add(cost)
+}
+
+// requestCost is the cost of a single response. The input cost includes the cached input cost,
+// and the output cost includes the reasoning cost.
+type requestCost struct {
+	input       currency.Amount
+	cachedInput currency.Amount // prompt cache writes and reads
+	output      currency.Amount
+	reasoning   currency.Amount
+}
+
+// total returns the sum of the input and output costs
+func (rc requestCost) total() (currency.Amount, error) {
+	return rc.input.Add(rc.output)
 }
 
-func (cc *API_Provider) addResponse(resp *ProxyResponse, chatCompResp *openai.ChatCompletionResponse) {
+// calculateCost adds the cost of a single response to the total
+func (cc *API_Provider) calculateCost(usage providers.Usage) (requestCost, error) {
 	cc.rwMutex.Lock()
 	defer cc.rwMutex.Unlock()
-	cc.apiResponses = append(cc.apiResponses, resp)
-	cc.apiResponseBodies = append(cc.apiResponseBodies, chatCompResp)
-}
 
-func (cc *API_Provider) calculateCost(chatCompResp *openai.ChatCompletionResponse) (inputCost, outputCost currency.Amount, err error) {
-	// extract token quant, and calculate cost of transaction
-	inputTokens := fmt.Sprint(chatCompResp.Usage.PromptTokens)
-	outputTokens := fmt.Sprint(chatCompResp.Usage.CompletionTokens)
+	rc, err := cc.price(usage)
+	if err != nil {
+		return requestCost{}, err
+	}
+	total, err := rc.total()
+	if err != nil {
+		return requestCost{}, fmt.Errorf("failed to calculate request cost: %v", err)
+	}
 
-	inputCost, err = cc.costPerInputToken.Mul(inputTokens)
+	cc.totalCost, err = cc.totalCost.Add(total)
 	if err != nil {
-		return currency.Amount{}, currency.Amount{}, fmt.Errorf("failed to calculate input cost: %v", err)
+		return requestCost{}, fmt.Errorf("failed to add request cost to totalCost: %v", err)
+	}
+	return rc, nil
+}
+
+// estimateCost returns the cost of the usage, without adding it to the total
+func (cc *API_Provider) estimateCost(usage providers.Usage) (requestCost, error) {
+	cc.rwMutex.RLock()
+	defer cc.rwMutex.RUnlock()
+	return cc.price(usage)
+}
+
+// price returns the cost of a single response, the caller must hold the lock. The input cost
+// includes the cost of any prompt cache writes and reads, transcribed audio, and characters
+// converted to speech. The output cost includes the cost of reasoning tokens and generated
+// images. Batch responses are billed at the batch input and output rates.
+func (cc *API_Provider) price(usage providers.Usage) (rc requestCost, err error) {
+	inputRate, outputRate, reasoningRate := cc.costPerInputToken, cc.costPerOutputToken, cc.costPerReasoningToken
+	if usage.Batch {
+		inputRate, outputRate, reasoningRate = cc.costPerBatchInput, cc.costPerBatchOutput, cc.costPerBatchOutput
 	}
 
-	outputCost, err = cc.costPerOutputToken.Mul(outputTokens)
+	rc.cachedInput, err = cc.costPerCacheWriteToken.Mul(fmt.Sprint(usage.CacheWriteTokens))
 	if err != nil {
-		return currency.Amount{}, currency.Amount{}, fmt.Errorf("failed to calculate output cost: %v", err)
+		return requestCost{}, fmt.Errorf("failed to calculate cache write cost: %v", err)
+	}
+	if rc.cachedInput, err = addUnitCost(rc.cachedInput, cc.costPerCacheReadToken, fmt.Sprint(usage.CacheReadTokens)); err != nil {
+		return requestCost{}, fmt.Errorf("failed to calculate cache read cost: %v", err)
 	}
 
-	cc.totalCost, err = cc.totalCost.Add(inputCost)
+	rc.input, err = inputRate.Mul(fmt.Sprint(usage.InputTokens))
 	if err != nil {
-		return currency.Amount{}, currency.Amount{}, fmt.Errorf("failed to add input cost to totalCost: %v", err)
+		return requestCost{}, fmt.Errorf("failed to calculate input cost: %v", err)
+	}
+	if rc.input, err = rc.input.Add(rc.cachedInput); err != nil {
+		return requestCost{}, fmt.Errorf("failed to add cache cost: %v", err)
 	}
 
-	cc.totalCost, err = cc.totalCost.Add(outputCost)
+	if usage.AudioSeconds > 0 {
+		minutes := strconv.FormatFloat(usage.AudioSeconds/60, 'f', -1, 64)
+		if rc.input, err = addUnitCost(rc.input, cc.costPerMinute, minutes); err != nil {
+			return requestCost{}, fmt.Errorf("failed to calculate audio cost: %v", err)
+		}
+	}
+
+	if usage.Characters > 0 {
+		if rc.input, err = addUnitCost(rc.input, cc.costPerCharacter, fmt.Sprint(usage.Characters)); err != nil {
+			return requestCost{}, fmt.Errorf("failed to calculate character cost: %v", err)
+		}
+	}
+
+	rc.reasoning, err = reasoningRate.Mul(fmt.Sprint(usage.ReasoningTokens))
 	if err != nil {
-		return currency.Amount{}, currency.Amount{}, fmt.Errorf("failed to add output cost  to totalCost: %v", err)
+		return requestCost{}, fmt.Errorf("failed to calculate reasoning cost: %v", err)
+	}
+
+	if rc.output, err = addUnitCost(rc.reasoning, outputRate, fmt.Sprint(usage.OutputTokens)); err != nil {
+		return requestCost{}, fmt.Errorf("failed to calculate output cost: %v", err)
 	}
 
-	return inputCost, outputCost, nil
+	if usage.Images > 0 {
+		imageCost, found := cc.costPerImage[usage.ImageVariant]
+		if !found {
+			return requestCost{}, fmt.Errorf("no image price for %s: %s", cc.model, usage.ImageVariant)
+		}
+		if rc.output, err = addUnitCost(rc.output, imageCost, fmt.Sprint(usage.Images)); err != nil {
+			return requestCost{}, fmt.Errorf("failed to calculate image cost: %v", err)
+		}
+	}
+	return rc, nil
 }
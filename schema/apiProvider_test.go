@@ -4,9 +4,10 @@ import (
 	"testing"
 
 	"github.com/bojanz/currency"
-	openai "github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema/providers"
 )
 
 func TestNewAPI_Provider(t *testing.T) {
@@ -40,54 +41,33 @@ func TestAPI_ProviderString(t *testing.T) {
 	assert.Equal(t, "1.00 USD", provider.String())
 }
 
-func TestAddRequest(t *testing.T) {
-	provider, _ := newAPI_Provider("test", "model", "0.01", "0.02", "USD")
-	req := &ProxyRequest{}
-	chatCompReq := &openai.ChatCompletionRequest{}
-	provider.addRequest(req, chatCompReq)
-	assert.Equal(t, 1, len(provider.apiRequests))
-	assert.Equal(t, 1, len(provider.apiRequestBodies))
-}
-
-func TestAddResponse(t *testing.T) {
+func TestCostSumming(t *testing.T) {
 	t.Run("Normal cost summing", func(t *testing.T) {
 		provider, _ := newAPI_Provider("test", "model", "0.01", "0.02", "USD")
-		resp := &ProxyResponse{}
-		chatCompResp := &openai.ChatCompletionResponse{
-			Usage: openai.Usage{
-				PromptTokens:     10,
-				CompletionTokens: 10,
-			},
+		usage := providers.Usage{
+			InputTokens:  10,
+			OutputTokens: 10,
 		}
-		provider.addResponse(resp, chatCompResp)
-		assert.Equal(t, 1, len(provider.apiResponses))
-		assert.Equal(t, 1, len(provider.apiResponseBodies))
 
 		require.Equal(t, "0 USD", provider.totalCost.String()) // not calculated yet
-		provider.calculateCost(chatCompResp)
+		provider.calculateCost(usage)
 
 		// check the cost: 0.01 * 10 + 0.02 * 10 = 0.30
 		expectedCost, _ := currency.NewAmount("0.30", "USD")
 		require.Equal(t, expectedCost.String(), provider.totalCost.String())
 
 		// add another response
-		provider.addResponse(resp, chatCompResp)
-		provider.calculateCost(chatCompResp)
-		assert.Equal(t, 2, len(provider.apiResponses))
-		assert.Equal(t, 2, len(provider.apiResponseBodies))
+		provider.calculateCost(usage)
 
 		// check the cost: 0.30 + 0.30 = 0.60
 		expectedCost, _ = currency.NewAmount("0.60", "USD")
 		require.Equal(t, expectedCost.String(), provider.totalCost.String())
 
 		// add another response with different token counts
-		chatCompResp.Usage.PromptTokens = 20
-		chatCompResp.Usage.CompletionTokens = 200
+		usage.InputTokens = 20
+		usage.OutputTokens = 200
 
-		provider.addResponse(resp, chatCompResp)
-		provider.calculateCost(chatCompResp)
-		assert.Equal(t, 3, len(provider.apiResponses))
-		assert.Equal(t, 3, len(provider.apiResponseBodies))
+		provider.calculateCost(usage)
 
 		// check the cost: 0.60 + 0.20 + 4.00 = 4.80
 		expectedCost, _ = currency.NewAmount("4.80", "USD")
@@ -96,15 +76,193 @@ func TestAddResponse(t *testing.T) {
 
 	t.Run("Empty cost summing", func(t *testing.T) {
 		provider, _ := newAPI_Provider("test", "model", "0.01", "0.02", "USD")
-		resp := &ProxyResponse{}
-		chatCompResp := &openai.ChatCompletionResponse{} // empty usage, no tokens spent
-
-		provider.addResponse(resp, chatCompResp)
-		assert.Equal(t, 1, len(provider.apiResponses))
-		assert.Equal(t, 1, len(provider.apiResponseBodies))
+		usage := providers.Usage{} // empty usage, no tokens spent
 
 		require.Equal(t, "0 USD", provider.totalCost.String()) // not calculated yet
-		provider.calculateCost(chatCompResp)
+		provider.calculateCost(usage)
 		require.Equal(t, "0.00 USD", provider.totalCost.String()) // formatted as 0.00 USD after being calculated
 	})
 }
+
+func TestCalculateCost(t *testing.T) {
+	t.Run("Cache tokens billed at the input rate by default", func(t *testing.T) {
+		provider, _ := newAPI_Provider("test", "model", "0.01", "0.02", "USD")
+		reqCost, err := provider.calculateCost(providers.Usage{InputTokens: 10, OutputTokens: 10, CacheWriteTokens: 10, CacheReadTokens: 10})
+		require.NoError(t, err)
+		assert.Equal(t, "0.30 USD", reqCost.input.String())
+		assert.Equal(t, "0.20 USD", reqCost.cachedInput.String())
+		assert.Equal(t, "0.20 USD", reqCost.output.String())
+		assert.Equal(t, "0.50 USD", provider.totalCost.String())
+	})
+
+	t.Run("Cache tokens with their own rates", func(t *testing.T) {
+		provider, _ := newAPI_Provider("test", "model", "0.01", "0.02", "USD")
+		require.NoError(t, provider.setCacheCosts("0.0125", "0.001"))
+		reqCost, err := provider.calculateCost(providers.Usage{InputTokens: 10, OutputTokens: 10, CacheWriteTokens: 100, CacheReadTokens: 1000})
+		require.NoError(t, err)
+
+		// 0.01 * 10 + 0.0125 * 100 + 0.001 * 1000 = 2.35
+		assert.Equal(t, "2.3500 USD", reqCost.input.String())
+		assert.Equal(t, "2.2500 USD", reqCost.cachedInput.String())
+		assert.Equal(t, "0.20 USD", reqCost.output.String())
+	})
+
+	t.Run("Invalid cache costs", func(t *testing.T) {
+		provider, _ := newAPI_Provider("test", "model", "0.01", "0.02", "USD")
+		assert.Error(t, provider.setCacheCosts("invalid", "0.001"))
+		assert.Error(t, provider.setCacheCosts("0.0125", "invalid"))
+	})
+}
+
+func TestCalculateCostTiers(t *testing.T) {
+	provider, err := newAPI_ProviderFromPrice("test", providers.Price{
+		Model:                "model",
+		InputTokenCost:       "0.01",
+		OutputTokenCost:      "0.04",
+		CacheReadTokenCost:   "0.005",
+		ReasoningTokenCost:   "0.03",
+		BatchInputTokenCost:  "0.005",
+		BatchOutputTokenCost: "0.02",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		usage             providers.Usage
+		expectedInput     string
+		expectedCached    string
+		expectedOutput    string
+		expectedReasoning string
+	}{
+		{
+			name:  "cached input and reasoning",
+			usage: providers.Usage{InputTokens: 10, CacheReadTokens: 20, OutputTokens: 10, ReasoningTokens: 100},
+			// 0.01 * 10 + 0.005 * 20, and 0.04 * 10 + 0.03 * 100
+			expectedInput: "0.2", expectedCached: "0.1", expectedOutput: "3.4", expectedReasoning: "3",
+		},
+		{
+			name:  "batch",
+			usage: providers.Usage{InputTokens: 10, CacheReadTokens: 20, OutputTokens: 10, ReasoningTokens: 100, Batch: true},
+			// 0.005 * 10 + 0.005 * 20, and reasoning at the batch output rate: 0.02 * 110
+			expectedInput: "0.15", expectedCached: "0.1", expectedOutput: "2.2", expectedReasoning: "2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqCost, err := provider.calculateCost(tt.usage)
+			require.NoError(t, err)
+			for expected, actual := range map[string]currency.Amount{
+				tt.expectedInput:     reqCost.input,
+				tt.expectedCached:    reqCost.cachedInput,
+				tt.expectedOutput:    reqCost.output,
+				tt.expectedReasoning: reqCost.reasoning,
+			} {
+				expectedAmount, _ := currency.NewAmount(expected, "USD")
+				assert.True(t, expectedAmount.Equal(actual), "expected %s, got %s", expected, actual)
+			}
+		})
+	}
+
+	t.Run("Defaults to the regular rates", func(t *testing.T) {
+		provider, err := newAPI_ProviderFromPrice("test", providers.Price{Model: "model", InputTokenCost: "0.01", OutputTokenCost: "0.04"})
+		require.NoError(t, err)
+		assert.Equal(t, provider.costPerOutputToken, provider.costPerReasoningToken)
+		assert.Equal(t, provider.costPerInputToken, provider.costPerBatchInput)
+		assert.Equal(t, provider.costPerOutputToken, provider.costPerBatchOutput)
+	})
+
+	t.Run("Invalid tier costs", func(t *testing.T) {
+		for _, price := range []providers.Price{
+			{Model: "model", ReasoningTokenCost: "invalid"},
+			{Model: "model", BatchInputTokenCost: "invalid"},
+			{Model: "model", BatchOutputTokenCost: "invalid"},
+		} {
+			provider, err := newAPI_ProviderFromPrice("test", price)
+			assert.Error(t, err)
+			assert.Nil(t, provider)
+		}
+	})
+}
+
+func TestNewAPI_ProviderFromPrice(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		provider, err := newAPI_ProviderFromPrice("test", providers.Price{Model: "model", InputTokenCost: "0.01", OutputTokenCost: "0.02"})
+		require.NoError(t, err)
+		assert.Equal(t, "USD", provider.currencyUnit)
+		assert.Equal(t, provider.costPerInputToken, provider.costPerCacheWriteToken)
+		assert.Equal(t, provider.costPerInputToken, provider.costPerCacheReadToken)
+	})
+
+	t.Run("Cache costs", func(t *testing.T) {
+		provider, err := newAPI_ProviderFromPrice("test", providers.Price{
+			Model:              "model",
+			Currency:           "EUR",
+			InputTokenCost:     "0.01",
+			OutputTokenCost:    "0.02",
+			CacheReadTokenCost: "0.001",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "0.01 EUR", provider.costPerCacheWriteToken.String())
+		assert.Equal(t, "0.001 EUR", provider.costPerCacheReadToken.String())
+	})
+
+	t.Run("Invalid cache cost", func(t *testing.T) {
+		provider, err := newAPI_ProviderFromPrice("test", providers.Price{
+			Model:               "model",
+			InputTokenCost:      "0.01",
+			OutputTokenCost:     "0.02",
+			CacheWriteTokenCost: "invalid",
+		})
+		assert.Error(t, err)
+		assert.Nil(t, provider)
+	})
+}
+
+func TestCalculateCostUnits(t *testing.T) {
+	provider, err := newAPI_ProviderFromPrice("test", providers.Price{
+		Model:         "model",
+		ImageCosts:    map[string]string{"hd/1024x1024": "0.08"},
+		MinuteCost:    "0.006",
+		CharacterCost: "0.00003",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		usage          providers.Usage
+		expectedInput  string
+		expectedOutput string
+		expectError    bool
+	}{
+		{name: "images", usage: providers.Usage{Images: 2, ImageVariant: "hd/1024x1024"}, expectedInput: "0", expectedOutput: "0.16"},
+		{name: "unknown image variant", usage: providers.Usage{Images: 1, ImageVariant: "standard/256x256"}, expectError: true},
+		{name: "audio", usage: providers.Usage{AudioSeconds: 90}, expectedInput: "0.009", expectedOutput: "0"},
+		{name: "characters", usage: providers.Usage{Characters: 1000}, expectedInput: "0.03", expectedOutput: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqCost, err := provider.calculateCost(tt.usage)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			expectedInput, _ := currency.NewAmount(tt.expectedInput, "USD")
+			expectedOutput, _ := currency.NewAmount(tt.expectedOutput, "USD")
+			assert.True(t, expectedInput.Equal(reqCost.input), reqCost.input.String())
+			assert.True(t, expectedOutput.Equal(reqCost.output), reqCost.output.String())
+		})
+	}
+
+	t.Run("Invalid unit costs", func(t *testing.T) {
+		for _, price := range []providers.Price{
+			{Model: "model", ImageCosts: map[string]string{"hd/1024x1024": "invalid"}},
+			{Model: "model", MinuteCost: "invalid"},
+			{Model: "model", CharacterCost: "invalid"},
+		} {
+			provider, err := newAPI_ProviderFromPrice("test", price)
+			assert.Error(t, err)
+			assert.Nil(t, provider)
+		}
+	})
+}
@@ -7,13 +7,48 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-const UnknownAddr = "unknown"
+const (
+	UnknownAddr = "unknown"
+
+	// ClientAddressHeader is added by the gateway, with the IP of the gateway's client. It's only
+	// kept on the requests from the gateway, by the proxy's GatewayClientAddon, and it isn't sent
+	// upstream.
+	ClientAddressHeader = "X-Llm_proxy-Client-Address"
+)
 
 type ConnectionStatsContainer struct {
-	ClientAddress string `json:"client_address"`
-	URL           string `json:"url"`
-	Duration      int64  `json:"duration_ms"`
-	ProxyID       string `json:"proxy_id,omitempty"`
+	ClientAddress string   `json:"client_address"`
+	URL           string   `json:"url"`
+	Duration      int64    `json:"duration_ms"`
+	ProxyID       string   `json:"proxy_id,omitempty"`
+	Attempts      int      `json:"attempts,omitempty"`
+	Backend       string   `json:"backend,omitempty"`
+	Rewrites      []string `json:"rewrites,omitempty"`
+	Upstream      string   `json:"upstream,omitempty"`      // set for requests sent elsewhere by a routing addon
+	InternalRate  string   `json:"internal_rate,omitempty"` // InternalRate.String of the self-hosted server
+}
+
+// SetRoute records where a routing addon sent the request, so it can be priced from the log
+func (obj *ConnectionStatsContainer) SetRoute(route Route) {
+	obj.Upstream = route.Upstream
+	obj.InternalRate = ""
+	if route.Rate != nil {
+		obj.InternalRate = route.Rate.String()
+	}
+}
+
+// Route returns where the request was sent, the zero Route when it wasn't routed
+func (obj *ConnectionStatsContainer) Route() (Route, error) {
+	route := Route{Upstream: obj.Upstream}
+	if obj.InternalRate == "" {
+		return route, nil
+	}
+	rate, err := ParseInternalRate(obj.InternalRate)
+	if err != nil {
+		return Route{}, err
+	}
+	route.Rate = &rate
+	return route, nil
 }
 
 func (obj *ConnectionStatsContainer) ToJSON() []byte {
@@ -30,11 +65,18 @@ func (obj *ConnectionStatsContainer) ToJSONstr() string {
 }
 
 func getClientAddr(f *px.Flow) string {
+	if f != nil && f.Request != nil {
+		// the gateway's client, the header is removed from the other clients' requests by the proxy
+		if client := f.Request.Header.Get(ClientAddressHeader); client != "" {
+			return client
+		}
+	}
 	if f == nil || f.ConnContext == nil || f.ConnContext.ClientConn == nil || f.ConnContext.ClientConn.Conn == nil {
 		// Ugh != nil
 		return UnknownAddr
 	}
-	remote := f.ConnContext.ClientConn.Conn.RemoteAddr()
+	conn := f.ConnContext.ClientConn.Conn
+	remote := conn.RemoteAddr()
 	if remote == nil {
 		return UnknownAddr
 	}
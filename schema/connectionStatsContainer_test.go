@@ -43,3 +43,33 @@ func TestNewLogLine(t *testing.T) {
 	assert.Equal(t, f.Id.String(), logLine.ProxyID)
 	assert.Equal(t, int64(100), logLine.Duration)
 }
+
+func TestConnectionStatsContainer_Route(t *testing.T) {
+	stats := &ConnectionStatsContainer{}
+	route, err := stats.Route()
+	assert.NoError(t, err)
+	assert.Equal(t, Route{}, route)
+
+	rate := InternalRate{InputTokenCost: "0.0000001"}
+	stats.SetRoute(Route{Upstream: "http://localhost:11434/v1/chat/completions", Rate: &rate})
+	assert.Contains(t, stats.ToJSONstr(), `"upstream":"http://localhost:11434/v1/chat/completions","internal_rate":"0.0000001 0 USD"`)
+
+	route, err = stats.Route()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:11434/v1/chat/completions", route.Upstream)
+	assert.Equal(t, &InternalRate{InputTokenCost: "0.0000001", OutputTokenCost: "0", Currency: "USD"}, route.Rate)
+
+	stats.InternalRate = "free"
+	_, err = stats.Route()
+	assert.Error(t, err)
+}
+
+func TestGetClientAddr(t *testing.T) {
+	f := &px.Flow{
+		Request: &px.Request{Method: "GET", Header: http.Header{"X-Forwarded-For": []string{"10.1.2.3"}}},
+	}
+	assert.Equal(t, UnknownAddr, getClientAddr(f), "X-Forwarded-For is set by the client")
+
+	f.Request.Header.Set(ClientAddressHeader, "10.1.2.3")
+	assert.Equal(t, "10.1.2.3", getClientAddr(f), "added by the gateway")
+}
@@ -1,28 +1,65 @@
 package schema
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/bojanz/currency"
+	log "github.com/sirupsen/logrus"
 
-	"github.com/proxati/llm_proxy/schema/providers/openai_com"
+	"github.com/proxati/llm_proxy/schema/providers"
+
+	// providers register themselves with the providers package when imported
+	_ "github.com/proxati/llm_proxy/schema/providers/anthropic_com"
+	_ "github.com/proxati/llm_proxy/schema/providers/openai_com"
 )
 
 const (
+	// OutputFormatFull and OutputFormatCompact are templates for OutputStringFormatter. The other
+	// placeholders are: {cachedInputCost}, {reasoningCost}, {cost}, {currency}, {timestamp},
+	// {tags}, {cacheStatus}, and {pricedModel}.
 	OutputFormatFull    = "URL: {url} Model: {model} inputCost: {inputCost} outputCost {outputCost} = Request Cost: {totalReqCost} Grand Total: {grandTotal}"
 	OutputFormatCompact = "Request Cost: {totalReqCost} Grand Total: {grandTotal}"
+
+	// estimatedSuffix is appended to the formatted output when the token usage was estimated
+	estimatedSuffix = " (estimated)"
+
+	// batchSuffix is appended to the formatted output for batch responses, billed at the batch rates
+	batchSuffix = " (batch)"
 )
 
-// AuditOutput is a struct that holds the output data (cost totals) from a single transaction
+// AuditOutput is a struct that holds the output data (cost totals) from a single transaction.
+// InputCost includes CachedInputCost, and OutputCost includes ReasoningCost. The token counts
+// don't overlap: InputTokens excludes the CachedTokens, and OutputTokens excludes the ReasoningTokens.
+// Cost is the unformatted TotalReqCost, as a decimal number in Currency, the currency of the price.
+// The formatted costs are converted to the target currency, when one is set.
 type AuditOutput struct {
-	URL          string `JSON:"url"`
-	Model        string `JSON:"model"`
-	InputCost    string `JSON:"inputCost"`
-	OutputCost   string `JSON:"outputCost"`
-	TotalReqCost string `JSON:"totalReqCost"`
-	GrandTotal   string `JSON:"grandTotal"`
+	Timestamp         time.Time `json:"timestamp"`
+	URL               string    `json:"url"`
+	Model             string    `json:"model"`
+	PricedModel       string    `json:"priced_model,omitempty"` // when it's not Model, e.g., the base model of a fine-tuned model
+	InputCost         string    `json:"input_cost"`
+	CachedInputCost   string    `json:"cached_input_cost"`
+	OutputCost        string    `json:"output_cost"`
+	ReasoningCost     string    `json:"reasoning_cost"`
+	TotalReqCost      string    `json:"total_req_cost"`
+	GrandTotal        string    `json:"grand_total"`
+	Cost              string    `json:"cost"`
+	Currency          string    `json:"currency"`
+	InputTokens       int       `json:"input_tokens"`
+	CachedTokens      int       `json:"cached_tokens"`
+	OutputTokens      int       `json:"output_tokens"`
+	ReasoningTokens   int       `json:"reasoning_tokens"`
+	Batch             bool      `json:"batch"`
+	Estimated         bool      `json:"estimated"`
+	ConvertedCost     string    `json:"converted_cost,omitempty"`     // Cost in the target currency, when one is set
+	ConvertedCurrency string    `json:"converted_currency,omitempty"` // the target currency
+	Tags              []string  `json:"tags,omitempty"`               // set by the caller, from the request tags header
+	CacheStatus       string    `json:"cache_status,omitempty"`       // set by the caller, from the response cache header
 }
 
 func (output *AuditOutput) String() string {
@@ -35,31 +72,71 @@ func (output *AuditOutput) OutputStringFormatter(formatString string) string {
 		formatString = OutputFormatFull
 	}
 
+	var timestamp string
+	if !output.Timestamp.IsZero() {
+		timestamp = output.Timestamp.Format(time.RFC3339)
+	}
+
 	data := map[string]string{
-		"{url}":          output.URL,
-		"{model}":        output.Model,
-		"{inputCost}":    output.InputCost,
-		"{outputCost}":   output.OutputCost,
-		"{totalReqCost}": output.TotalReqCost,
-		"{grandTotal}":   output.GrandTotal,
+		"{timestamp}":       timestamp,
+		"{url}":             output.URL,
+		"{model}":           output.Model,
+		"{inputCost}":       output.InputCost,
+		"{cachedInputCost}": output.CachedInputCost,
+		"{outputCost}":      output.OutputCost,
+		"{reasoningCost}":   output.ReasoningCost,
+		"{totalReqCost}":    output.TotalReqCost,
+		"{grandTotal}":      output.GrandTotal,
+		"{cost}":            output.Cost,
+		"{currency}":        output.Currency,
+		"{tags}":            strings.Join(output.Tags, ","),
+		"{cacheStatus}":     output.CacheStatus,
+		"{pricedModel}":     output.PricedModel,
 	}
 
+	// placeholders for empty values are removed, e.g., {tags} for a request without tags
 	for key, value := range data {
-		if value == "" {
-			continue
-		}
 		formatString = strings.Replace(formatString, key, value, -1)
 	}
+	if output.Batch {
+		formatString += batchSuffix
+	}
+	if output.Estimated {
+		formatString += estimatedSuffix
+	}
 	return formatString
 }
 
+// ErrUnknownModel is returned by Add when there is no price for the requested model
+var ErrUnknownModel = errors.New("no pricing data")
+
+// lookupCacheEntry is a cached providerLookup result, which is valid until the next effective date
+// of any price for the same URL and model
+type lookupCacheEntry struct {
+	provider *API_Provider
+	expires  time.Time // zero when no price for this model has a future effective date
+}
+
 // CostCounter is a struct that holds the state of the cost counter
 type CostCounter struct {
-	grandTotal  currency.Amount
-	providers   map[string][]*API_Provider // key: provider URL, value: slice of models/products
-	lookupCache map[string]*API_Provider   // key: provider URL + model, value: API_Provider
-	formatter   *currency.Formatter
-	rwMutex     sync.RWMutex
+	grandTotal       currency.Amount
+	monthStart       time.Time                    // start of the month of the grand total, zero when it's never reset
+	providers        map[string][]*API_Provider   // key: provider URL, value: slice of models/products
+	overrides        map[string][]*API_Provider   // same as providers, loaded from a pricing file
+	aliases          map[string]map[string]string // key: provider URL, value: alias to model name
+	overrideAliases  map[string]map[string]string // same as aliases, loaded from a pricing file
+	lookupCache      map[string]lookupCacheEntry  // key: provider URL + model
+	unknownModels    map[string]int               // key: provider URL + model, value: number of requests
+	guessedModels    map[string]bool              // key: provider URL + model, priced as a guessed model
+	stats            map[string]*providerStats    // key: pricing URL + model
+	statsWindow      time.Duration                // length of the rolling window for the stats
+	maxSamples       int                          // raw requests and responses kept per model
+	useResponseModel bool                         // price by the model in the response, instead of the request
+	formatter        *currency.Formatter
+	targetCurrency   string         // currency for the formatted costs, empty to use the price currency
+	exchangeRates    *ExchangeRates // converts the prices to targetCurrency
+	now              func() time.Time
+	rwMutex          sync.RWMutex
 }
 
 // NewCostCounter creates an object that _should_ be a singleton, in the Addon layer.
@@ -69,20 +146,31 @@ func NewCostCounter(currencyLocale string) *CostCounter {
 	loc := currency.NewLocale(currencyLocale) // "en-US" is the default
 
 	cc := &CostCounter{
-		providers:   make(map[string][]*API_Provider),
-		lookupCache: make(map[string]*API_Provider),
-		formatter:   currency.NewFormatter(loc),
-		rwMutex:     sync.RWMutex{},
+		providers:       make(map[string][]*API_Provider),
+		overrides:       make(map[string][]*API_Provider),
+		aliases:         make(map[string]map[string]string),
+		overrideAliases: make(map[string]map[string]string),
+		lookupCache:     make(map[string]lookupCacheEntry),
+		unknownModels:   make(map[string]int),
+		guessedModels:   make(map[string]bool),
+		stats:           make(map[string]*providerStats),
+		statsWindow:     DefaultStatsWindow,
+		formatter:       currency.NewFormatter(loc),
+		now:             time.Now,
+		rwMutex:         sync.RWMutex{},
 	}
 
-	// iterate over the pricing data and populate this struct, data loaded from json in the openai_com package
-	for _, provider := range openai_com.API_Endpoint_Data {
-		for _, product := range provider.Products {
-			apiProvider, err := newAPI_Provider(provider.URL, product.Name, product.InputTokenCost, product.OutputTokenCost, "USD")
-			if err != nil {
-				panic(fmt.Sprintf("Error creating API_Provider: %v", err))
+	// iterate over the pricing data from each registered provider, and populate this struct
+	for _, provider := range providers.All() {
+		for _, endpoint := range provider.Pricing() {
+			addAliases(cc.aliases, endpoint)
+			for _, price := range endpoint.Prices {
+				apiProvider, err := newAPI_ProviderFromPrice(endpoint.URL, price)
+				if err != nil {
+					panic(fmt.Sprintf("Error creating API_Provider for %s: %v", provider.Name(), err))
+				}
+				cc.providers[endpoint.URL] = append(cc.providers[endpoint.URL], apiProvider)
 			}
-			cc.providers[provider.URL] = append(cc.providers[provider.URL], apiProvider)
 		}
 	}
 	return cc
@@ -99,14 +187,209 @@ func (cc *CostCounter) String() string {
 	return cc.grandTotal.String()
 }
 
+// RestoreGrandTotal adds the cost of earlier transactions to the grand total, e.g., from a ledger
+// when the process starts
+func (cc *CostCounter) RestoreGrandTotal(amount currency.Amount) error {
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+
+	cc.resetMonth()
+	total, err := cc.grandTotal.Add(amount)
+	if err != nil {
+		return fmt.Errorf("failed to restore the grand total: %w", err)
+	}
+	cc.grandTotal = total
+	return nil
+}
+
+// SetMonthlyGrandTotal resets the grand total at the start of each month, so it's the month-to-date
+// cost, e.g., when it's restored from a ledger
+func (cc *CostCounter) SetMonthlyGrandTotal() {
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+	cc.monthStart = startOfMonth(cc.now())
+}
+
+// startOfMonth returns midnight on the first day of the month, in the same location as t
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// resetMonth clears the grand total when a new month started, the caller must hold the write lock
+func (cc *CostCounter) resetMonth() {
+	if cc.monthStart.IsZero() {
+		return
+	}
+	now := cc.now()
+	if now.Before(cc.monthStart.AddDate(0, 1, 0)) {
+		return
+	}
+	log.Infof("Resetting the month-to-date cost of %s", cc.grandTotal.Round())
+	cc.grandTotal = currency.Amount{}
+	cc.monthStart = startOfMonth(now)
+}
+
+// GrandTotal returns the total cost of the priced transactions, in the target currency when one is
+// set. The amount has no currency before the first transaction.
+func (cc *CostCounter) GrandTotal() currency.Amount {
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+	cc.resetMonth()
+	if cc.grandTotal.CurrencyCode() == "" {
+		return cc.grandTotal
+	}
+	return cc.convert(cc.grandTotal)
+}
+
+// addAliases copies the aliases for an endpoint into the map, which is keyed by the endpoint URL
+func addAliases(aliases map[string]map[string]string, endpoint providers.Endpoint) {
+	if len(endpoint.Aliases) == 0 {
+		return
+	}
+	if aliases[endpoint.URL] == nil {
+		aliases[endpoint.URL] = make(map[string]string)
+	}
+	for alias, model := range endpoint.Aliases {
+		aliases[endpoint.URL][alias] = model
+	}
+}
+
+// SetPriceByResponseModel enables pricing by the model reported in the response, e.g., the dated
+// snapshot that served the request, instead of the model requested by the client
+func (cc *CostCounter) SetPriceByResponseModel(enabled bool) {
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+	cc.useResponseModel = enabled
+}
+
+// SetTargetCurrency sets the currency for the formatted costs, the prices are converted with the
+// exchange rates. The original costs, in the price currency, are still returned in AuditOutput.Cost.
+func (cc *CostCounter) SetTargetCurrency(code string, rates *ExchangeRates) error {
+	if code != "" {
+		if !currency.IsValid(code) {
+			return fmt.Errorf("invalid currency: %q", code)
+		}
+		if rates == nil {
+			return fmt.Errorf("exchange rates are required to convert to %s", code)
+		}
+		if _, err := rates.rate(code); err != nil {
+			return err
+		}
+	}
+
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+	cc.targetCurrency = code
+	cc.exchangeRates = rates
+	return nil
+}
+
+// convert returns the amount in the target currency, or the original amount when it can't be
+// converted. The caller must hold the lock.
+func (cc *CostCounter) convert(amount currency.Amount) currency.Amount {
+	if cc.targetCurrency == "" {
+		return amount
+	}
+	converted, err := cc.exchangeRates.Convert(amount, cc.targetCurrency)
+	if err != nil {
+		log.Warnf("not converting %s to %s: %v", amount, cc.targetCurrency, err)
+		return amount
+	}
+	return converted
+}
+
+// format converts the amount to the target currency, and formats it for the locale. The caller
+// must hold the lock.
+func (cc *CostCounter) format(amount currency.Amount) string {
+	return cc.formatter.Format(cc.convert(amount))
+}
+
+// SetStatsOptions sets the length of the rolling window for the per-model stats, and the number of
+// raw requests and responses kept for each model. The stats counted so far are cleared.
+func (cc *CostCounter) SetStatsOptions(window time.Duration, maxSamples int) {
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+	if window <= 0 {
+		window = DefaultStatsWindow
+	}
+	cc.statsWindow = window
+	cc.maxSamples = maxSamples
+	cc.stats = make(map[string]*providerStats)
+}
+
+// SetPricingOverrides replaces the pricing data loaded from a pricing file. These prices are used
+// instead of the embedded prices for the same URL and model, and can add new models. The current
+// overrides are kept if any of the new prices are invalid.
+func (cc *CostCounter) SetPricingOverrides(endpoints []providers.Endpoint) error {
+	overrides := make(map[string][]*API_Provider)
+	overrideAliases := make(map[string]map[string]string)
+	for _, endpoint := range endpoints {
+		addAliases(overrideAliases, endpoint)
+		for _, price := range endpoint.Prices {
+			apiProvider, err := newAPI_ProviderFromPrice(endpoint.URL, price)
+			if err != nil {
+				return fmt.Errorf("invalid price for %s|%s: %w", endpoint.URL, price.Model, err)
+			}
+			overrides[endpoint.URL] = append(overrides[endpoint.URL], apiProvider)
+		}
+	}
+
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+	cc.overrides = overrides
+	cc.overrideAliases = overrideAliases
+	cc.lookupCache = make(map[string]lookupCacheEntry)
+	return nil
+}
+
+// UnknownModels returns the number of requests for each URL and model without pricing data
+func (cc *CostCounter) UnknownModels() map[string]int {
+	cc.rwMutex.RLock()
+	defer cc.rwMutex.RUnlock()
+
+	out := make(map[string]int, len(cc.unknownModels))
+	for key, count := range cc.unknownModels {
+		out[key] = count
+	}
+	return out
+}
+
 func (cc *CostCounter) providerCacheLookup(cacheKey string) *API_Provider {
 	cc.rwMutex.RLock()
 	defer cc.rwMutex.RUnlock()
 
-	if provider, found := cc.lookupCache[cacheKey]; found {
-		return provider // Return the cached result
+	entry, found := cc.lookupCache[cacheKey]
+	if !found {
+		return nil
 	}
-	return nil
+	if !entry.expires.IsZero() && !cc.now().Before(entry.expires) {
+		return nil // another price may be effective now
+	}
+	return entry.provider // Return the cached result
+}
+
+// selectPrice returns the price for the model that is effective at time t, preferring the one with
+// the latest start date. It also returns the next time that a different price could be selected.
+func selectPrice(candidates []*API_Provider, model string, t time.Time) (selected *API_Provider, expires time.Time) {
+	for _, candidate := range candidates {
+		if candidate.model != model {
+			continue
+		}
+
+		for _, boundary := range []time.Time{candidate.effectiveFrom, candidate.effectiveUntil} {
+			if boundary.After(t) && (expires.IsZero() || boundary.Before(expires)) {
+				expires = boundary
+			}
+		}
+
+		if !candidate.effectiveAt(t) {
+			continue
+		}
+		if selected == nil || candidate.effectiveFrom.After(selected.effectiveFrom) {
+			selected = candidate
+		}
+	}
+	return selected, expires
 }
 
 func (cc *CostCounter) providerLookup(url, product string) *API_Provider {
@@ -118,74 +401,308 @@ func (cc *CostCounter) providerLookup(url, product string) *API_Provider {
 		return provider
 	}
 
-	providers := cc.providers[url]
-	for _, provider := range providers {
-		if provider.model == product {
-			cc.rwMutex.Lock()
-			defer cc.rwMutex.Unlock()
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+
+	// aliases from the pricing file are used before the embedded aliases
+	aliases := make(map[string]string)
+	for alias, model := range cc.aliases[url] {
+		aliases[alias] = model
+	}
+	for alias, model := range cc.overrideAliases[url] {
+		aliases[alias] = model
+	}
 
-			cc.lookupCache[cacheKey] = provider // Cache the result
-			return provider
+	known := make([]string, 0, len(cc.overrides[url])+len(cc.providers[url]))
+	for _, prices := range [][]*API_Provider{cc.overrides[url], cc.providers[url]} {
+		for _, price := range prices {
+			known = append(known, price.model)
 		}
 	}
-	return nil
+
+	// try the exact name first, then aliases, snapshots and the longest known prefix. For each
+	// name, prices from the pricing file are used before the embedded prices.
+	t := cc.now()
+	var provider *API_Provider
+	var expires time.Time
+	candidates, guessed := providers.ModelCandidates(product, aliases, known)
+	for i, candidate := range candidates {
+		for _, prices := range [][]*API_Provider{cc.overrides[url], cc.providers[url]} {
+			selected, candidateExpires := selectPrice(prices, candidate, t)
+			if !candidateExpires.IsZero() && (expires.IsZero() || candidateExpires.Before(expires)) {
+				expires = candidateExpires
+			}
+			if selected != nil {
+				provider = selected
+				break
+			}
+		}
+		if provider != nil {
+			switch {
+			case i >= guessed && !cc.guessedModels[cacheKey]:
+				// warned once per model, the lookup is repeated when the cache expires
+				cc.guessedModels[cacheKey] = true
+				log.Warnf("No pricing data for model %q at %s, pricing it as %q, which may have a different price. Add it to a --pricing-file.", product, url, candidate)
+			case candidate != product:
+				log.Debugf("Pricing model %s as %s", product, candidate)
+			}
+			break
+		}
+	}
+	if provider == nil {
+		return nil
+	}
+
+	cc.lookupCache[cacheKey] = lookupCacheEntry{provider: provider, expires: expires} // Cache the result
+	return provider
+}
+
+// recordUnknownModel counts a request for a model without pricing data, and warns the first time
+// that each model is seen
+func (cc *CostCounter) recordUnknownModel(url, model string) {
+	cacheKey := fmt.Sprintf("%s|%s", url, model)
+
+	cc.rwMutex.Lock()
+	defer cc.rwMutex.Unlock()
+
+	cc.unknownModels[cacheKey]++
+	if cc.unknownModels[cacheKey] == 1 {
+		log.Warnf("No pricing data for model %q at %s, the cost of these requests is NOT counted. Add it to a --pricing-file.", model, url)
+	}
 }
 
 // Add is the primary method for working with this object, it takes a proxy req/resp
 // and calculates the cost of the transaction, returning a struct with the output data
 func (cc *CostCounter) Add(req ProxyRequest, resp ProxyResponse) (*AuditOutput, error) {
-	// parse the request
-	chatCompReq, err := openai_com.NewOpenAIChatCompletionRequest(&req.Body)
-	if err != nil || chatCompReq == nil {
-		return nil, fmt.Errorf("failed to create OpenAI completion request: %v", err)
+	return cc.AddWithLatency(req, resp, 0)
+}
+
+// AddWithLatency is the same as Add, and also counts the request latency in the stats for the
+// model. A zero latency isn't counted in the latency histogram.
+func (cc *CostCounter) AddWithLatency(req ProxyRequest, resp ProxyResponse, latency time.Duration) (*AuditOutput, error) {
+	return cc.AddRouted(req, resp, latency, Route{})
+}
+
+// AddRouted is the same as AddWithLatency, for a request that a routing addon sent to another
+// upstream. It's priced by the route's upstream, or at the route's internal rate when it's set.
+func (cc *CostCounter) AddRouted(req ProxyRequest, resp ProxyResponse, latency time.Duration, route Route) (*AuditOutput, error) {
+	return cc.add(req, resp, latency, route, true)
+}
+
+// Price calculates the cost of a transaction the same as Add, without adding it to the grand
+// total, the stats, or the unknown models, e.g., for a mirrored request that isn't client traffic
+func (cc *CostCounter) Price(req ProxyRequest, resp ProxyResponse) (*AuditOutput, error) {
+	return cc.add(req, resp, 0, Route{}, false)
+}
+
+// add prices a transaction, and counts it in the totals when count is set
+func (cc *CostCounter) add(req ProxyRequest, resp ProxyResponse, latency time.Duration, route Route, count bool) (*AuditOutput, error) {
+	// find the provider that can parse the request and response, from the URL the client called
+	parser := providers.Lookup(req.URL)
+	if parser == nil {
+		return nil, fmt.Errorf("no provider registered for: %s", req.URL)
 	}
 
-	// find the provider, which is a combination of the URL and the requested model
-	provider := cc.providerLookup(req.URL.String(), chatCompReq.Model)
-	if provider == nil {
-		return nil, fmt.Errorf("provider not found for: %s|%s", req.URL.String(), chatCompReq.Model)
+	model, err := parser.ExtractModel(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s request: %v", parser.Name(), err)
 	}
 
-	// store the request objects
-	provider.addRequest(&req, chatCompReq)
+	usage, err := parser.ExtractUsage(req.Body, resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s response: %w", parser.Name(), err)
+	}
 
-	// parse the response object
-	chatCompResp, err := openai_com.NewOpenAIChatCompletionResponse(&resp.Body)
-	if err != nil || chatCompResp == nil {
-		return nil, fmt.Errorf("failed to create OpenAI completion response: %v", err)
+	// the response can report a different model than the request, e.g., a dated snapshot, and
+	// it's the only source of the model for requests without a body, e.g., a batch output download
+	cc.rwMutex.RLock()
+	useResponseModel := cc.useResponseModel
+	cc.rwMutex.RUnlock()
+	if extractor, ok := parser.(providers.ResponseModelExtractor); ok && (useResponseModel || model == "") {
+		if respModel, err := extractor.ExtractResponseModel(resp.Body); err == nil && respModel != "" {
+			model = respModel
+		}
 	}
 
-	// store the response objects
-	provider.addResponse(&resp, chatCompResp)
+	// responses for another endpoint's models are billed by that endpoint, e.g., a batch output file
+	pricingURL := req.URL.String()
+	if resolver, ok := parser.(providers.PricingURLResolver); ok {
+		if pricingURL, err = resolver.PricingURL(resp.Body); err != nil {
+			return nil, fmt.Errorf("failed to parse %s response: %w", parser.Name(), err)
+		}
+	}
+
+	// requests that were translated to another API are billed by the upstream that served them
+	if route.Upstream != "" {
+		pricingURL = route.Upstream
+	}
+
+	// find the provider, which is a combination of the URL and the requested model. Requests that
+	// were routed to a self-hosted server are priced at its internal rate, for any model.
+	var provider *API_Provider
+	if route.Rate != nil {
+		if provider, err = route.Rate.provider(pricingURL, model); err != nil {
+			return nil, err
+		}
+	} else if provider = cc.providerLookup(pricingURL, model); provider == nil {
+		if count {
+			cc.recordUnknownModel(pricingURL, model)
+		}
+		return nil, fmt.Errorf("%w for: %s|%s", ErrUnknownModel, pricingURL, model)
+	}
 
 	// calculate the cost for this transaction
-	inputCost, outputCost, err := provider.calculateCost(chatCompResp)
+	reqCost, err := provider.calculateCost(usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate cost: %v", err)
+	}
+	totalReqCost, err := reqCost.total()
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate cost: %v", err)
 	}
 
-	// lock and update the grand total from the input/output token costs
+	// lock and update the grand total from the request cost
 	cc.rwMutex.Lock()
 	defer cc.rwMutex.Unlock()
 
-	cc.grandTotal, err = cc.grandTotal.Add(inputCost)
+	if count {
+		cc.resetMonth()
+		cc.grandTotal, err = cc.grandTotal.Add(totalReqCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add the request cost to the grand total: %v", err)
+		}
+		cc.recordStats(pricingURL, model, Sample{Request: &req, Response: &resp, Usage: usage}, totalReqCost, latency)
+	}
+
+	// return the output object with the formatted cost data w/ currency symbol added
+	output := &AuditOutput{
+		URL:             req.URL.String(),
+		Model:           model,
+		InputCost:       cc.format(reqCost.input),
+		CachedInputCost: cc.format(reqCost.cachedInput),
+		OutputCost:      cc.format(reqCost.output),
+		ReasoningCost:   cc.format(reqCost.reasoning),
+		TotalReqCost:    cc.format(totalReqCost),
+		GrandTotal:      cc.format(cc.grandTotal),
+		Cost:            totalReqCost.Number(),
+		Currency:        totalReqCost.CurrencyCode(),
+		InputTokens:     usage.InputTokens,
+		CachedTokens:    usage.CacheWriteTokens + usage.CacheReadTokens,
+		OutputTokens:    usage.OutputTokens,
+		ReasoningTokens: usage.ReasoningTokens,
+		Batch:           usage.Batch,
+		Estimated:       usage.Estimated,
+	}
+
+	if provider.model != model {
+		output.PricedModel = provider.model
+	}
+
+	// the original cost is kept, the converted cost is only set when a target currency is set
+	if cc.targetCurrency != "" {
+		convertedCost := cc.convert(totalReqCost)
+		output.ConvertedCost = convertedCost.Number()
+		output.ConvertedCurrency = convertedCost.CurrencyCode()
+	}
+	return output, nil
+}
+
+// RequestEstimate is the estimated cost of a request, before it's sent
+type RequestEstimate struct {
+	Model string
+	Usage providers.Usage // InputTokens from the prompt, OutputTokens is the requested maximum
+	Cost  currency.Amount // in the target currency when one is set, empty when the model isn't priced
+}
+
+// Priced returns false when there is no pricing data for the model, only the usage is estimated
+func (re *RequestEstimate) Priced() bool {
+	return re.Cost.CurrencyCode() != ""
+}
+
+// Header returns the estimated cost for the estimated cost response header, e.g., "0.0042 USD"
+func (re *RequestEstimate) Header() string {
+	return re.Cost.Number() + " " + re.Cost.CurrencyCode()
+}
+
+// Estimate prices a request before it's sent, from the prompt tokens and the maximum output
+// tokens requested by the client. The totals and stats are not changed. A model without pricing
+// data is only counted, the estimate has the usage and an empty cost.
+func (cc *CostCounter) Estimate(req ProxyRequest) (*RequestEstimate, error) {
+	parser := providers.Lookup(req.URL)
+	if parser == nil {
+		return nil, fmt.Errorf("no provider registered for: %s", req.URL)
+	}
+	estimator, ok := parser.(providers.RequestEstimator)
+	if !ok {
+		return nil, fmt.Errorf("%s requests can't be estimated", parser.Name())
+	}
+
+	model, err := parser.ExtractModel(req.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add inputCost to the grand total: %v", err)
+		return nil, fmt.Errorf("failed to parse %s request: %v", parser.Name(), err)
+	}
+	usage, err := estimator.EstimateRequest(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate %s request: %w", parser.Name(), err)
 	}
 
-	cc.grandTotal, err = cc.grandTotal.Add(outputCost)
+	provider := cc.providerLookup(req.URL.String(), model)
+	if provider == nil {
+		return &RequestEstimate{Model: model, Usage: usage}, nil
+	}
+	reqCost, err := provider.estimateCost(usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate cost: %v", err)
+	}
+	totalReqCost, err := reqCost.total()
 	if err != nil {
-		return nil, fmt.Errorf("failed to add outputCost to the grand total: %v", err)
+		return nil, fmt.Errorf("failed to calculate cost: %v", err)
 	}
-	totalReqCost, _ := inputCost.Add(outputCost)
 
-	// return the output object with the formatted cost data w/ currency symbol added
-	return &AuditOutput{
-		URL:          req.URL.String(),
-		Model:        chatCompReq.Model,
-		InputCost:    cc.formatter.Format(inputCost),
-		OutputCost:   cc.formatter.Format(outputCost),
-		TotalReqCost: cc.formatter.Format(totalReqCost),
-		GrandTotal:   cc.formatter.Format(cc.grandTotal),
-	}, nil
+	cc.rwMutex.RLock()
+	defer cc.rwMutex.RUnlock()
+	return &RequestEstimate{Model: model, Usage: usage, Cost: cc.convert(totalReqCost)}, nil
+}
+
+// recordStats counts a priced response in the stats for its URL and model, the caller must hold
+// the write lock
+func (cc *CostCounter) recordStats(url, model string, sample Sample, cost currency.Amount, latency time.Duration) {
+	cacheKey := fmt.Sprintf("%s|%s", url, model)
+	ps, found := cc.stats[cacheKey]
+	if !found {
+		ps = newProviderStatsWindow(url, model, cc.statsWindow, cc.maxSamples)
+		cc.stats[cacheKey] = ps
+	}
+	ps.add(cc.now(), sample, cost, latency)
+}
+
+// StatsSnapshot is a copy of the stats for a single URL and model. Total is since the cost counter
+// was created, and Window is for the rolling window ending now.
+type StatsSnapshot struct {
+	Total   ProviderStats
+	Window  ProviderStats
+	Samples []Sample // oldest first, empty unless samples are kept
+}
+
+// Stats returns the stats for each URL and model that was priced, sorted by URL and model
+func (cc *CostCounter) Stats() []StatsSnapshot {
+	cc.rwMutex.RLock()
+	defer cc.rwMutex.RUnlock()
+
+	now := cc.now()
+	out := make([]StatsSnapshot, 0, len(cc.stats))
+	for _, ps := range cc.stats {
+		out = append(out, StatsSnapshot{
+			Total:   copyStats(ps.total),
+			Window:  ps.window(now),
+			Samples: ps.recentSamples(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total.URL != out[j].Total.URL {
+			return out[i].Total.URL < out[j].Total.URL
+		}
+		return out[i].Total.Model < out[j].Total.Model
+	})
+	return out
 }
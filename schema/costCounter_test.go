@@ -1,11 +1,15 @@
 package schema
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bojanz/currency"
+	"github.com/proxati/llm_proxy/schema/providers"
 	"github.com/proxati/llm_proxy/schema/providers/openai_com"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -29,6 +33,46 @@ func TestCostCounterString(t *testing.T) {
 	assert.Equal(t, "100 USD", cc.String())
 }
 
+func TestRestoreGrandTotal(t *testing.T) {
+	cc := NewCostCounterDefaults()
+	restored, _ := currency.NewAmount("12.50", "USD")
+	require.NoError(t, cc.RestoreGrandTotal(restored))
+	require.NoError(t, cc.RestoreGrandTotal(restored))
+	assert.Equal(t, "25.00 USD", cc.String())
+
+	other, _ := currency.NewAmount("1", "EUR")
+	assert.Error(t, cc.RestoreGrandTotal(other), "mismatched currency")
+	assert.Equal(t, "25.00 USD", cc.String())
+}
+
+func TestMonthlyGrandTotal(t *testing.T) {
+	reqURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+	req := ProxyRequest{URL: reqURL, Body: `{"model": "gpt-4o"}`}
+	resp := ProxyResponse{Body: `{"usage": {"prompt_tokens": 1000000}}`}
+
+	cc := NewCostCounterDefaults()
+	now := time.Date(2024, time.October, 31, 23, 0, 0, 0, time.UTC)
+	cc.now = func() time.Time { return now }
+	cc.SetMonthlyGrandTotal()
+	restored, _ := currency.NewAmount("100", "USD")
+	require.NoError(t, cc.RestoreGrandTotal(restored))
+
+	out, err := cc.Add(req, resp)
+	require.NoError(t, err)
+	assert.Equal(t, "$105.00", out.GrandTotal)
+
+	now = now.Add(2 * time.Hour)
+	assert.True(t, cc.GrandTotal().IsZero(), "reset in November")
+	out, err = cc.Add(req, resp)
+	require.NoError(t, err)
+	assert.Equal(t, "$5.00", out.GrandTotal)
+
+	now = now.AddDate(0, 1, 0)
+	out, err = cc.Add(req, resp)
+	require.NoError(t, err)
+	assert.Equal(t, "$5.00", out.GrandTotal, "reset again in December")
+}
+
 func TestProviderLookup(t *testing.T) {
 	cc := NewCostCounterDefaults()
 	// Assuming there's a provider with URL "http://example.com" and product "testModel" for testing
@@ -61,7 +105,7 @@ func TestAdd(t *testing.T) {
 	// Setup: Assuming there's a provider with URL "http://example.com" and product "testModel" for testing
 	productURL := openai_com.API_Endpoint_Data[0]
 	model := productURL.Products[0]
-	provider := cc.providerLookup(productURL.URL, model.Name)
+	require.NotNil(t, cc.providerLookup(productURL.URL, model.Name))
 
 	reqURL, _ := url.Parse(productURL.URL)
 	req := ProxyRequest{
@@ -71,22 +115,26 @@ func TestAdd(t *testing.T) {
 	resp := ProxyResponse{
 		Body: `{"choices": [{"text": "Hello!"}]}`,
 	}
+	// the response doesn't have usage data, so it's estimated from the request
 	expectedOutput := &AuditOutput{
-		URL:          productURL.URL,
-		Model:        model.Name,
-		InputCost:    "$0.00",
-		OutputCost:   "$0.00",
-		TotalReqCost: "$0.00",
-		GrandTotal:   "$0.00",
+		URL:             productURL.URL,
+		Model:           model.Name,
+		InputCost:       "$0.000009",
+		CachedInputCost: "$0.00",
+		OutputCost:      "$0.00",
+		ReasoningCost:   "$0.00",
+		TotalReqCost:    "$0.000009",
+		GrandTotal:      "$0.000009",
+		Cost:            "0.000009",
+		Currency:        "USD",
+		InputTokens:     3,
+		Estimated:       true,
 	}
 
 	out, err := cc.Add(req, resp)
 	require.Error(t, err, "Error when invalid model is used in request")
 	require.Nil(t, out)
-	assert.Len(t, provider.apiRequests, 0)
-	assert.Len(t, provider.apiRequestBodies, 0)
-	assert.Len(t, provider.apiResponses, 0)
-	assert.Len(t, provider.apiResponseBodies, 0)
+	assert.Empty(t, cc.Stats())
 
 	// Valid request
 	req = ProxyRequest{
@@ -96,8 +144,595 @@ func TestAdd(t *testing.T) {
 	out, err = cc.Add(req, resp)
 	require.NoError(t, err)
 	require.Equal(t, expectedOutput, out)
-	assert.Len(t, provider.apiRequests, 1)
-	assert.Len(t, provider.apiRequestBodies, 1)
-	assert.Len(t, provider.apiResponses, 1)
-	assert.Len(t, provider.apiResponseBodies, 1)
+	stats := cc.Stats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, 1, stats[0].Total.Requests)
+	assert.Empty(t, stats[0].Samples, "samples are not kept by default")
+}
+
+func TestAddAnthropic(t *testing.T) {
+	messagesURL, _ := url.Parse("https://api.anthropic.com/v1/messages")
+	chatURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+
+	tests := []struct {
+		name     string
+		req      ProxyRequest
+		resp     ProxyResponse
+		route    Route
+		expected *AuditOutput
+	}{
+		{
+			name: "messages with cache tokens",
+			req: ProxyRequest{
+				URL:  messagesURL,
+				Body: `{"model": "claude-3-5-sonnet-20241022", "max_tokens": 1024}`,
+			},
+			resp: ProxyResponse{
+				// 1M * $3 + 1M * $3.75 + 10M * $0.30 = $9.75, 1M * $15 = $15
+				Body: `{"usage": {"input_tokens": 1000000, "output_tokens": 1000000, "cache_creation_input_tokens": 1000000, "cache_read_input_tokens": 10000000}}`,
+			},
+			expected: &AuditOutput{
+				URL:             messagesURL.String(),
+				Model:           "claude-3-5-sonnet-20241022",
+				InputCost:       "$9.75",
+				CachedInputCost: "$6.75",
+				OutputCost:      "$15.00",
+				ReasoningCost:   "$0.00",
+				TotalReqCost:    "$24.75",
+				GrandTotal:      "$24.75",
+				Cost:            "24.75000000",
+				Currency:        "USD",
+				InputTokens:     1000000,
+				CachedTokens:    11000000,
+				OutputTokens:    1000000,
+			},
+		},
+		{
+			name: "streamed messages",
+			req: ProxyRequest{
+				URL:  messagesURL,
+				Body: `{"model": "claude-3-5-sonnet-20241022", "max_tokens": 1024, "stream": true}`,
+			},
+			resp: ProxyResponse{
+				Body: "event: message_start\n" +
+					`data: {"type":"message_start","message":{"model":"claude-3-5-sonnet-20241022","usage":{"input_tokens":1000000,"output_tokens":1}}}` +
+					"\n\nevent: message_delta\n" +
+					`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":1000000}}` +
+					"\n\n",
+			},
+			expected: &AuditOutput{
+				URL:             messagesURL.String(),
+				Model:           "claude-3-5-sonnet-20241022",
+				InputCost:       "$3.00",
+				CachedInputCost: "$0.00",
+				OutputCost:      "$15.00",
+				ReasoningCost:   "$0.00",
+				TotalReqCost:    "$18.00",
+				GrandTotal:      "$18.00",
+				Cost:            "18.00000000",
+				Currency:        "USD",
+				InputTokens:     1000000,
+				OutputTokens:    1000000,
+			},
+		},
+		{
+			name: "chat completion translated to messages",
+			req: ProxyRequest{
+				URL:  chatURL,
+				Body: `{"model": "claude-3-5-haiku-latest", "messages": []}`,
+			},
+			route: Route{Upstream: messagesURL.String()},
+			resp: ProxyResponse{
+				Body: `{"usage": {"prompt_tokens": 1000000, "completion_tokens": 1000000}}`,
+			},
+			expected: &AuditOutput{
+				URL:             chatURL.String(),
+				Model:           "claude-3-5-haiku-latest",
+				InputCost:       "$0.80",
+				CachedInputCost: "$0.00",
+				OutputCost:      "$4.00",
+				ReasoningCost:   "$0.00",
+				TotalReqCost:    "$4.80",
+				GrandTotal:      "$4.80",
+				Cost:            "4.80000000",
+				Currency:        "USD",
+				InputTokens:     1000000,
+				OutputTokens:    1000000,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := NewCostCounterDefaults()
+			out, err := cc.AddRouted(tt.req, tt.resp, 0, tt.route)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+
+			stats := cc.Stats()
+			require.Len(t, stats, 1)
+			assert.Equal(t, messagesURL.String(), stats[0].Total.URL)
+			assert.Equal(t, 1, stats[0].Total.Requests)
+		})
+	}
+
+	t.Run("unknown model", func(t *testing.T) {
+		cc := NewCostCounterDefaults()
+		out, err := cc.Add(ProxyRequest{
+			URL:  messagesURL,
+			Body: `{"model": "claude-unknown"}`,
+		}, ProxyResponse{Body: `{"usage": {"input_tokens": 1}}`})
+		require.Error(t, err)
+		assert.Nil(t, out)
+	})
+}
+
+func TestAddInternalRate(t *testing.T) {
+	chatURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+	localURL := "http://localhost:11434/v1/chat/completions"
+	req := ProxyRequest{URL: chatURL, Body: `{"model": "llama3.1", "messages": []}`}
+	respBody := `{"usage": {"prompt_tokens": 1000000, "completion_tokens": 1000000}}`
+
+	tests := []struct {
+		name          string
+		rate          InternalRate
+		expectedTotal string
+		expectedErr   string
+	}{
+		{name: "free", rate: InternalRate{}, expectedTotal: "$0.00"},
+		{
+			name:          "configured rate",
+			rate:          InternalRate{InputTokenCost: "0.0000001", OutputTokenCost: "0.0000002"},
+			expectedTotal: "$0.30",
+		},
+		{name: "invalid rate", rate: InternalRate{InputTokenCost: "-1"}, expectedErr: "can't be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := NewCostCounterDefaults()
+			out, err := cc.AddRouted(req, ProxyResponse{Body: respBody}, 0, Route{Upstream: localURL, Rate: &tt.rate})
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				assert.Empty(t, cc.UnknownModels())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "llama3.1", out.Model)
+			assert.Equal(t, tt.expectedTotal, out.TotalReqCost)
+
+			stats := cc.Stats()
+			require.Len(t, stats, 1)
+			assert.Equal(t, localURL, stats[0].Total.URL)
+		})
+	}
+}
+
+func TestParseInternalRate(t *testing.T) {
+	rate, err := ParseInternalRate("0.0000001 0.0000002 EUR")
+	require.NoError(t, err)
+	assert.Equal(t, InternalRate{InputTokenCost: "0.0000001", OutputTokenCost: "0.0000002", Currency: "EUR"}, rate)
+	assert.Equal(t, "0 0 USD", InternalRate{}.String())
+
+	for _, value := range []string{"", "0 0", "a 0 USD", "0 0 XYZ", "-1 0 USD"} {
+		_, err := ParseInternalRate(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestAddUnsupportedURL(t *testing.T) {
+	cc := NewCostCounterDefaults()
+	reqURL, _ := url.Parse("https://api.openai.com/v1/models")
+	out, err := cc.Add(ProxyRequest{URL: reqURL}, ProxyResponse{})
+	require.ErrorContains(t, err, "no provider registered")
+	assert.Nil(t, out)
+}
+
+func TestAddStreamed(t *testing.T) {
+	reqURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+	chunk := `data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"General Kenobi"}}]}` + "\n\n"
+
+	tests := []struct {
+		name              string
+		respBody          string
+		expectedEstimated bool
+		expectedTotal     string
+	}{
+		{
+			name:          "with usage chunk",
+			respBody:      chunk + `data: {"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":1000000,"completion_tokens":1000000}}` + "\n\ndata: [DONE]\n\n",
+			expectedTotal: "$20.00",
+		},
+		{
+			// 9 input tokens, 3 output tokens, counted with the gpt-4o tokenizer
+			name:              "without usage chunk",
+			respBody:          chunk + "data: [DONE]\n\n",
+			expectedEstimated: true,
+			expectedTotal:     "$0.00009",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := NewCostCounter("en-US")
+			out, err := cc.Add(ProxyRequest{
+				URL:  reqURL,
+				Body: `{"model": "gpt-4o", "stream": true, "messages": [{"role": "user", "content": "Hello there"}]}`,
+			}, ProxyResponse{Body: tt.respBody})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedTotal, out.TotalReqCost)
+			assert.Equal(t, tt.expectedEstimated, out.Estimated)
+			assert.Equal(t, tt.expectedEstimated, strings.HasSuffix(out.String(), " (estimated)"))
+		})
+	}
+}
+
+func TestAddOtherEndpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		reqBody  string
+		respBody string
+		expected string
+	}{
+		{
+			name:     "embeddings",
+			url:      "https://api.openai.com/v1/embeddings",
+			reqBody:  `{"model": "text-embedding-3-large", "input": "hello"}`,
+			respBody: `{"usage": {"prompt_tokens": 1000000, "total_tokens": 1000000}}`,
+			expected: "$0.13",
+		},
+		{
+			name:     "images",
+			url:      "https://api.openai.com/v1/images/generations",
+			reqBody:  `{"model": "dall-e-3", "prompt": "a cat", "quality": "hd", "size": "1024x1792"}`,
+			respBody: `{"data": [{"url": "https://example.com/cat.png"}]}`,
+			expected: "$0.12",
+		},
+		{
+			name:     "transcription",
+			url:      "https://api.openai.com/v1/audio/transcriptions",
+			respBody: `{"duration": 600, "text": "..."}`,
+			expected: "$0.06",
+		},
+		{
+			name:     "speech",
+			url:      "https://api.openai.com/v1/audio/speech",
+			reqBody:  `{"model": "tts-1", "input": "0123456789"}`,
+			expected: "$0.00015",
+		},
+		{
+			name:     "moderation",
+			url:      "https://api.openai.com/v1/moderations",
+			reqBody:  `{"input": "hello"}`,
+			respBody: `{"results": []}`,
+			expected: "$0.00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := NewCostCounterDefaults()
+			reqURL, _ := url.Parse(tt.url)
+			out, err := cc.Add(ProxyRequest{URL: reqURL, Body: tt.reqBody}, ProxyResponse{Body: tt.respBody})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out.TotalReqCost)
+		})
+	}
+}
+
+func TestAddPricingTiers(t *testing.T) {
+	chatURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+	batchURL, _ := url.Parse("https://api.openai.com/v1/files/file-abc123/content")
+
+	t.Run("cached input and reasoning tokens", func(t *testing.T) {
+		cc := NewCostCounterDefaults()
+		out, err := cc.Add(ProxyRequest{
+			URL:  chatURL,
+			Body: `{"model": "o1", "messages": []}`,
+		}, ProxyResponse{
+			// 0.5M * $15 + 0.5M * $7.50, 1M * $60
+			Body: `{"usage": {"prompt_tokens": 1000000, "completion_tokens": 1000000,
+				"prompt_tokens_details": {"cached_tokens": 500000},
+				"completion_tokens_details": {"reasoning_tokens": 800000}}}`,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, &AuditOutput{
+			URL:             chatURL.String(),
+			Model:           "o1",
+			InputCost:       "$11.25",
+			CachedInputCost: "$3.75",
+			OutputCost:      "$60.00",
+			ReasoningCost:   "$48.00",
+			TotalReqCost:    "$71.25",
+			GrandTotal:      "$71.25",
+			Cost:            "71.2500000",
+			Currency:        "USD",
+			InputTokens:     500000,
+			CachedTokens:    500000,
+			OutputTokens:    200000,
+			ReasoningTokens: 800000,
+		}, out)
+	})
+
+	t.Run("batch output file", func(t *testing.T) {
+		cc := NewCostCounterDefaults()
+		line := `{"id": "batch_req_%d", "custom_id": "request-%d", "response": {"status_code": 200, "body": {"object": "chat.completion", "model": "gpt-4o-mini-2024-07-18", "usage": {"prompt_tokens": 1000000, "completion_tokens": 1000000}}}, "error": null}`
+		failed := `{"id": "batch_req_3", "custom_id": "request-3", "response": null, "error": {"code": "server_error"}}`
+		out, err := cc.Add(ProxyRequest{URL: batchURL}, ProxyResponse{
+			// 2M * $0.075 + 2M * $0.30
+			Body: fmt.Sprintf(line, 1, 1) + "\n" + fmt.Sprintf(line, 2, 2) + "\n" + failed + "\n",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "gpt-4o-mini-2024-07-18", out.Model)
+		assert.Equal(t, "$0.75", out.TotalReqCost)
+		assert.True(t, out.Batch)
+		assert.Contains(t, out.String(), batchSuffix)
+
+		stats := cc.Stats()
+		require.Len(t, stats, 1)
+		assert.Equal(t, chatURL.String(), stats[0].Total.URL, "counted with the chat model")
+		assert.Equal(t, 4_000_000, stats[0].Total.InputTokens+stats[0].Total.OutputTokens)
+	})
+
+	t.Run("other file download", func(t *testing.T) {
+		cc := NewCostCounterDefaults()
+		out, err := cc.Add(ProxyRequest{URL: batchURL}, ProxyResponse{Body: `{"messages": []}`})
+		require.ErrorIs(t, err, providers.ErrNotBillable)
+		assert.Nil(t, out)
+	})
+}
+
+func TestPricingOverrides(t *testing.T) {
+	const chatURL = "https://api.openai.com/v1/chat/completions"
+	reqURL, _ := url.Parse(chatURL)
+	day := func(d int) time.Time { return time.Date(2024, time.October, d, 0, 0, 0, 0, time.UTC) }
+
+	cc := NewCostCounterDefaults()
+	now := day(1)
+	cc.now = func() time.Time { return now }
+
+	err := cc.SetPricingOverrides([]providers.Endpoint{{
+		URL: chatURL,
+		Prices: []providers.Price{
+			{Model: "gpt-4o", InputTokenCost: "1", OutputTokenCost: "0"},
+			{Model: "gpt-4o", InputTokenCost: "2", OutputTokenCost: "0", EffectiveFrom: day(10), EffectiveUntil: day(20)},
+			{Model: "my-finetune", InputTokenCost: "3", OutputTokenCost: "0"},
+		},
+	}})
+	require.NoError(t, err)
+
+	cost := func(model string) string {
+		out, err := cc.Add(ProxyRequest{
+			URL:  reqURL,
+			Body: fmt.Sprintf(`{"model": %q}`, model),
+		}, ProxyResponse{Body: `{"usage": {"prompt_tokens": 1}}`})
+		require.NoError(t, err)
+		return out.TotalReqCost
+	}
+
+	assert.Equal(t, "$1.00", cost("gpt-4o"), "overrides the embedded price")
+	assert.Equal(t, "$3.00", cost("my-finetune"), "adds a new model")
+	assert.Equal(t, "$0.000005", cost("gpt-4o-2024-05-13"), "embedded price without an override")
+
+	now = day(10)
+	assert.Equal(t, "$2.00", cost("gpt-4o"), "cached lookup expires at the effective date")
+	now = day(20)
+	assert.Equal(t, "$1.00", cost("gpt-4o"), "effectiveUntil is exclusive")
+
+	t.Run("invalid prices keep the current overrides", func(t *testing.T) {
+		err := cc.SetPricingOverrides([]providers.Endpoint{{
+			URL:    chatURL,
+			Prices: []providers.Price{{Model: "gpt-4o", InputTokenCost: "invalid"}},
+		}})
+		require.Error(t, err)
+		assert.Equal(t, "$3.00", cost("my-finetune"))
+	})
+
+	t.Run("reload removes models", func(t *testing.T) {
+		require.NoError(t, cc.SetPricingOverrides(nil))
+		assert.Equal(t, "$0.000005", cost("gpt-4o"))
+		_, err := cc.Add(ProxyRequest{URL: reqURL, Body: `{"model": "my-finetune"}`}, ProxyResponse{Body: `{}`})
+		assert.ErrorIs(t, err, ErrUnknownModel)
+	})
+}
+
+func TestEstimate(t *testing.T) {
+	const chatURL = "https://api.openai.com/v1/chat/completions"
+	reqURL, _ := url.Parse(chatURL)
+
+	cc := NewCostCounterDefaults()
+	require.NoError(t, cc.SetPricingOverrides([]providers.Endpoint{{
+		URL:    chatURL,
+		Prices: []providers.Price{{Model: "my-finetune", InputTokenCost: "1", OutputTokenCost: "2"}},
+	}}))
+
+	// 10 input tokens (see the openai_com tests), and 5 output tokens
+	estimate, err := cc.Estimate(ProxyRequest{
+		URL:  reqURL,
+		Body: `{"model": "my-finetune", "max_tokens": 5, "messages": [{"role": "user", "content": "Hello there"}]}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "my-finetune", estimate.Model)
+	assert.Equal(t, providers.Usage{InputTokens: 10, OutputTokens: 5, Estimated: true}, estimate.Usage)
+	assert.True(t, estimate.Priced())
+	assert.Equal(t, "20 USD", estimate.Header())
+	assert.True(t, cc.grandTotal.IsZero(), "estimates are not counted")
+	assert.True(t, cc.GrandTotal().IsZero())
+	assert.Empty(t, cc.Stats())
+
+	// the tokens of a model without pricing data are still counted
+	estimate, err = cc.Estimate(ProxyRequest{URL: reqURL, Body: `{"model": "gpt-99", "max_tokens": 5, "messages": []}`})
+	require.NoError(t, err)
+	assert.False(t, estimate.Priced())
+	assert.Equal(t, 5, estimate.Usage.OutputTokens)
+	assert.Empty(t, cc.UnknownModels(), "only counted when the response is priced")
+
+	otherURL, _ := url.Parse("https://example.com/v1/chat/completions")
+	_, err = cc.Estimate(ProxyRequest{URL: otherURL, Body: `{}`})
+	assert.Error(t, err)
+}
+
+func TestUnknownModels(t *testing.T) {
+	cc := NewCostCounterDefaults()
+	reqURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+	for i := 0; i < 2; i++ {
+		out, err := cc.Add(ProxyRequest{URL: reqURL, Body: `{"model": "gpt-99"}`}, ProxyResponse{Body: `{}`})
+		require.ErrorIs(t, err, ErrUnknownModel)
+		assert.Nil(t, out)
+	}
+	assert.Equal(t, map[string]int{reqURL.String() + "|gpt-99": 2}, cc.UnknownModels())
+}
+
+func TestModelResolution(t *testing.T) {
+	const chatURL = "https://api.openai.com/v1/chat/completions"
+	reqURL, _ := url.Parse(chatURL)
+
+	cc := NewCostCounterDefaults()
+	require.NoError(t, cc.SetPricingOverrides([]providers.Endpoint{{
+		URL: chatURL,
+		Prices: []providers.Price{
+			{Model: "gpt-4o-2024-08-06", InputTokenCost: "2", OutputTokenCost: "0"},
+			{Model: "gpt-4o-mini", InputTokenCost: "3", OutputTokenCost: "0"},
+		},
+		Aliases: map[string]string{"my-alias": "gpt-4o-mini"},
+	}}))
+
+	tests := []struct {
+		model    string
+		expected string
+		priced   string
+		guessed  bool
+	}{
+		{model: "gpt-4o", expected: "$0.000005"},                                                         // exact, embedded
+		{model: "chatgpt-4o-latest", expected: "$0.000005", priced: "gpt-4o"},                            // embedded alias
+		{model: "gpt-4o-2024-08-06", expected: "$2.00"},                                                  // exact, override
+		{model: "gpt-4o-2024-11-20", expected: "$0.000005", priced: "gpt-4o"},                            // snapshot of gpt-4o
+		{model: "my-alias", expected: "$3.00", priced: "gpt-4o-mini"},                                    // override alias
+		{model: "gpt-4o-mini-2024-07-18", expected: "$3.00", priced: "gpt-4o-mini"},                      // snapshot of gpt-4o-mini, not gpt-4o
+		{model: "gpt-4-0613", expected: "$0.00003", priced: "gpt-4"},                                     // 4 digit snapshot
+		{model: "gpt-4o-mini-search-preview-x", expected: "$3.00", priced: "gpt-4o-mini", guessed: true}, // longest known prefix
+		{model: "ft:gpt-4o-mini:org::abc123", expected: "$3.00", priced: "gpt-4o-mini", guessed: true},   // base model of a fine-tune
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			out, err := cc.Add(ProxyRequest{
+				URL:  reqURL,
+				Body: fmt.Sprintf(`{"model": %q}`, tt.model),
+			}, ProxyResponse{Body: `{"usage": {"prompt_tokens": 1}}`})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out.TotalReqCost)
+			assert.Equal(t, tt.model, out.Model)
+			assert.Equal(t, tt.priced, out.PricedModel)
+			assert.Equal(t, tt.guessed, cc.guessedModels[chatURL+"|"+tt.model], "warned about the guessed price")
+		})
+	}
+
+	_, err := cc.Add(ProxyRequest{URL: reqURL, Body: `{"model": "gpt-4.5-preview"}`}, ProxyResponse{Body: `{}`})
+	assert.ErrorIs(t, err, ErrUnknownModel)
+}
+
+func TestPriceByResponseModel(t *testing.T) {
+	reqURL, _ := url.Parse("https://api.anthropic.com/v1/messages")
+	req := ProxyRequest{URL: reqURL, Body: `{"model": "claude-3-opus-latest"}`}
+	resp := ProxyResponse{Body: `{"model": "claude-3-haiku-20240307", "usage": {"input_tokens": 1000000}}`}
+
+	cc := NewCostCounterDefaults()
+	out, err := cc.Add(req, resp)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-3-opus-latest", out.Model)
+	assert.Equal(t, "$15.00", out.TotalReqCost)
+
+	cc.SetPriceByResponseModel(true)
+	out, err = cc.Add(req, resp)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-3-haiku-20240307", out.Model)
+	assert.Equal(t, "$0.25", out.TotalReqCost)
+
+	// falls back to the requested model when the response doesn't have one
+	out, err = cc.Add(req, ProxyResponse{Body: `{"usage": {"input_tokens": 1000000}}`})
+	require.NoError(t, err)
+	assert.Equal(t, "claude-3-opus-latest", out.Model)
+}
+
+func TestAuditOutputFormats(t *testing.T) {
+	output := &AuditOutput{
+		Timestamp:    time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC),
+		URL:          "https://api.openai.com/v1/chat/completions",
+		Model:        "gpt-4o",
+		TotalReqCost: "$0.01",
+		GrandTotal:   "$1.00",
+		Cost:         "0.0100",
+		Currency:     "USD",
+		Tags:         []string{"team-a", "nightly"},
+		CacheStatus:  "MISS",
+		PricedModel:  "gpt-4o-2024-08-06",
+		Estimated:    true,
+	}
+
+	t.Run("template", func(t *testing.T) {
+		assert.Equal(t,
+			"2024-10-01T12:00:00Z gpt-4o (gpt-4o-2024-08-06) 0.0100 USD [team-a,nightly] MISS (estimated)",
+			output.OutputStringFormatter("{timestamp} {model} ({pricedModel}) {cost} {currency} [{tags}] {cacheStatus}"),
+		)
+		assert.Equal(t, "Request Cost: $0.01 Grand Total: $1.00 (estimated)", output.OutputStringFormatter(OutputFormatCompact))
+		assert.Equal(t, "[] ", (&AuditOutput{}).OutputStringFormatter("[{tags}] {timestamp}"), "empty values are removed")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		data, err := json.Marshal(output)
+		require.NoError(t, err)
+		decoded := make(map[string]any)
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, "2024-10-01T12:00:00Z", decoded["timestamp"])
+		assert.Equal(t, "gpt-4o", decoded["model"])
+		assert.Equal(t, "$0.01", decoded["total_req_cost"])
+		assert.Equal(t, []any{"team-a", "nightly"}, decoded["tags"])
+		assert.Equal(t, "MISS", decoded["cache_status"])
+		assert.Equal(t, "gpt-4o-2024-08-06", decoded["priced_model"])
+		assert.Equal(t, true, decoded["estimated"])
+
+		data, err = json.Marshal(&AuditOutput{Model: "gpt-4o"})
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "tags")
+		assert.NotContains(t, string(data), "cache_status")
+		assert.NotContains(t, string(data), "priced_model")
+	})
+}
+
+func TestTargetCurrency(t *testing.T) {
+	reqURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+	rates := &ExchangeRates{Base: "USD", Rates: map[string]string{"EUR": "0.5"}}
+
+	cc := NewCostCounter("de-DE")
+	assert.Error(t, cc.SetTargetCurrency("XYZ", rates), "invalid currency")
+	assert.Error(t, cc.SetTargetCurrency("EUR", nil), "missing exchange rates")
+	assert.Error(t, cc.SetTargetCurrency("GBP", rates), "no rate for the currency")
+	require.NoError(t, cc.SetTargetCurrency("EUR", rates))
+
+	// gpt-4o: 1M input tokens * $0.000005 = $5.00
+	out, err := cc.Add(
+		ProxyRequest{URL: reqURL, Body: `{"model": "gpt-4o"}`},
+		ProxyResponse{Body: `{"usage": {"prompt_tokens": 1000000}}`},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "2,50 €", out.TotalReqCost)
+	assert.Equal(t, "2,50 €", out.GrandTotal)
+	assert.Equal(t, "USD", out.Currency, "the original cost is kept")
+	assert.Equal(t, "5.000000", out.Cost)
+	assert.Equal(t, "EUR", out.ConvertedCurrency)
+	assert.Equal(t, "2.5", currencyNumber(t, out.ConvertedCost))
+
+	require.NoError(t, cc.SetTargetCurrency("", nil))
+	out, err = cc.Add(
+		ProxyRequest{URL: reqURL, Body: `{"model": "gpt-4o"}`},
+		ProxyResponse{Body: `{"usage": {"prompt_tokens": 1000000}}`},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "10,00 $", out.GrandTotal)
+	assert.Empty(t, out.ConvertedCost)
+}
+
+// currencyNumber normalizes a decimal number, for comparing amounts with different precisions
+func currencyNumber(t *testing.T, n string) string {
+	t.Helper()
+	amount, err := currency.NewAmount(n, "USD")
+	require.NoError(t, err)
+	return strings.TrimRight(strings.TrimRight(amount.Number(), "0"), ".")
 }
@@ -0,0 +1,86 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bojanz/currency"
+)
+
+// ExchangeRates converts amounts between currencies, with the rates from a local file. The rates
+// are the price of one unit of the base currency, e.g., {"base": "USD", "rates": {"EUR": "0.92"}}
+type ExchangeRates struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"` // key: currency code, value: units per one Base
+}
+
+// LoadExchangeRates reads and validates an exchange rate file
+func LoadExchangeRates(path string) (*ExchangeRates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading exchange rate file: %w", err)
+	}
+
+	rates := &ExchangeRates{}
+	if err := json.Unmarshal(data, rates); err != nil {
+		return nil, fmt.Errorf("error parsing exchange rate file %s: %w", path, err)
+	}
+	if err := rates.validate(); err != nil {
+		return nil, fmt.Errorf("invalid exchange rate file %s: %w", path, err)
+	}
+	return rates, nil
+}
+
+// validate checks that the currency codes are known, and the rates are positive numbers
+func (er *ExchangeRates) validate() error {
+	if !currency.IsValid(er.Base) {
+		return fmt.Errorf("invalid base currency: %q", er.Base)
+	}
+	for code, rate := range er.Rates {
+		amount, err := currency.NewAmount(rate, code)
+		if err != nil {
+			return fmt.Errorf("invalid rate for %s: %w", code, err)
+		}
+		if !amount.IsPositive() {
+			return fmt.Errorf("invalid rate for %s: must be positive", code)
+		}
+	}
+	return nil
+}
+
+// rate returns the units of a currency per one unit of the base currency
+func (er *ExchangeRates) rate(code string) (string, error) {
+	if code == er.Base {
+		return "1", nil
+	}
+	rate, found := er.Rates[code]
+	if !found {
+		return "", fmt.Errorf("no exchange rate for %s", code)
+	}
+	return rate, nil
+}
+
+// Convert returns the amount in the target currency, converting through the base currency when
+// neither currency is the base. Empty amounts are returned unchanged.
+func (er *ExchangeRates) Convert(amount currency.Amount, target string) (currency.Amount, error) {
+	from := amount.CurrencyCode()
+	if from == "" || from == target {
+		return amount, nil
+	}
+
+	fromRate, err := er.rate(from)
+	if err != nil {
+		return currency.Amount{}, err
+	}
+	targetRate, err := er.rate(target)
+	if err != nil {
+		return currency.Amount{}, err
+	}
+
+	converted, err := amount.Convert(target, targetRate)
+	if err != nil {
+		return currency.Amount{}, err
+	}
+	return converted.Div(fromRate)
+}
@@ -0,0 +1,78 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bojanz/currency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadExchangeRates(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: `{"base": "USD", "rates": {"EUR": "0.92", "GBP": "0.79"}}`},
+		{name: "invalid json", content: `{"base": `, wantErr: true},
+		{name: "invalid base", content: `{"base": "XYZ", "rates": {}}`, wantErr: true},
+		{name: "invalid currency", content: `{"base": "USD", "rates": {"XYZ": "1"}}`, wantErr: true},
+		{name: "invalid rate", content: `{"base": "USD", "rates": {"EUR": "abc"}}`, wantErr: true},
+		{name: "zero rate", content: `{"base": "USD", "rates": {"EUR": "0"}}`, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rates.json")
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o644))
+			rates, err := LoadExchangeRates(path)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "USD", rates.Base)
+		})
+	}
+
+	_, err := LoadExchangeRates(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestExchangeRatesConvert(t *testing.T) {
+	rates := &ExchangeRates{Base: "USD", Rates: map[string]string{"EUR": "0.8", "GBP": "0.5"}}
+	amount := func(n, code string) currency.Amount {
+		a, err := currency.NewAmount(n, code)
+		require.NoError(t, err)
+		return a
+	}
+
+	testCases := []struct {
+		name     string
+		amount   currency.Amount
+		target   string
+		expected string
+		wantErr  bool
+	}{
+		{name: "from the base", amount: amount("10", "USD"), target: "EUR", expected: "8.00 EUR"},
+		{name: "to the base", amount: amount("8", "EUR"), target: "USD", expected: "10.00 USD"},
+		{name: "cross rate", amount: amount("8", "EUR"), target: "GBP", expected: "5.00 GBP"},
+		{name: "same currency", amount: amount("1", "EUR"), target: "EUR", expected: "1.00 EUR"},
+		{name: "empty amount", amount: currency.Amount{}, target: "EUR", expected: currency.Amount{}.String()},
+		{name: "unknown source", amount: amount("1", "JPY"), target: "EUR", wantErr: true},
+		{name: "unknown target", amount: amount("1", "USD"), target: "JPY", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			converted, err := rates.Convert(tc.amount, tc.target)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, converted.Round().String())
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InternalRate is the per token price of a self-hosted server, e.g., a local Ollama or vLLM
+// server, used instead of the public price of the requested model. The zero value is free.
+type InternalRate struct {
+	InputTokenCost  string // empty is free
+	OutputTokenCost string // empty is free
+	Currency        string // empty is USD
+}
+
+// withDefaults fills the empty fields
+func (r InternalRate) withDefaults() InternalRate {
+	if r.InputTokenCost == "" {
+		r.InputTokenCost = "0"
+	}
+	if r.OutputTokenCost == "" {
+		r.OutputTokenCost = "0"
+	}
+	if r.Currency == "" {
+		r.Currency = "USD"
+	}
+	return r
+}
+
+// String returns the rate in the format read by ParseInternalRate, e.g., "0.0000001 0.0000002 USD"
+func (r InternalRate) String() string {
+	r = r.withDefaults()
+	return r.InputTokenCost + " " + r.OutputTokenCost + " " + r.Currency
+}
+
+// provider creates the API_Provider that prices the responses for a URL and model at this rate
+func (r InternalRate) provider(url, model string) (*API_Provider, error) {
+	r = r.withDefaults()
+	provider, err := newAPI_Provider(url, model, r.InputTokenCost, r.OutputTokenCost, r.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if provider.costPerInputToken.IsNegative() || provider.costPerOutputToken.IsNegative() {
+		return nil, fmt.Errorf("token costs can't be negative")
+	}
+	return provider, nil
+}
+
+// Route is where a routing addon sent a request, e.g., to the Anthropic API or a local server.
+// These requests are priced by the upstream that served them, instead of the request URL.
+type Route struct {
+	Upstream string        // URL that served the request, empty when it wasn't routed
+	Rate     *InternalRate // price of a self-hosted server, nil to use the upstream's prices
+}
+
+// Validate returns an error if the costs or the currency are invalid
+func (r InternalRate) Validate() error {
+	_, err := r.provider("", "")
+	return err
+}
+
+// ParseInternalRate parses a rate from InternalRate.String, e.g., from the connection stats in a log
+func ParseInternalRate(value string) (InternalRate, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 {
+		return InternalRate{}, fmt.Errorf("invalid internal rate %q, must be \"<input cost> <output cost> <currency>\"", value)
+	}
+	rate := InternalRate{InputTokenCost: fields[0], OutputTokenCost: fields[1], Currency: fields[2]}
+	if err := rate.Validate(); err != nil {
+		return InternalRate{}, fmt.Errorf("invalid internal rate %q: %w", value, err)
+	}
+	return rate, nil
+}
@@ -20,6 +20,7 @@ type LogDumpContainer struct {
 	ConnectionStats *ConnectionStatsContainer `json:"connection_stats,omitempty"`
 	Request         *ProxyRequest             `json:"request,omitempty"`
 	Response        *ProxyResponse            `json:"response,omitempty"`
+	Shadow          *ShadowContainer          `json:"shadow,omitempty"` // set by the shadow addon, for mirrored requests
 	logConfig       config.LogSourceConfig
 }
 
@@ -75,3 +76,18 @@ func NewLogDumpContainer(f *px.Flow, logSources config.LogSourceConfig, doneAt i
 
 	return ldc, nil
 }
+
+// Route returns where the request was sent, from the connection stats. A log without connection
+// stats, or with an internal rate that doesn't parse, returns the zero Route, so the request is
+// priced by the upstream in the request URL.
+func (ldc *LogDumpContainer) Route() Route {
+	if ldc.ConnectionStats == nil {
+		return Route{}
+	}
+	route, err := ldc.ConnectionStats.Route()
+	if err != nil {
+		log.Debugf("ignoring the logged route: %v", err)
+		return Route{}
+	}
+	return route
+}
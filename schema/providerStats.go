@@ -0,0 +1,199 @@
+package schema
+
+import (
+	"time"
+
+	"github.com/bojanz/currency"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+const (
+	// DefaultStatsWindow is the length of the rolling window for the per-model stats
+	DefaultStatsWindow = time.Hour
+
+	// statsSlots is the number of slots in the rolling window, the window moves one slot at a time
+	statsSlots = 60
+)
+
+// LatencyBuckets are the upper bounds of the latency histogram buckets, the last count in
+// ProviderStats.Latency is for the requests that were slower than the last bound
+var LatencyBuckets = []time.Duration{
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// ProviderStats are the aggregate counts for a single URL and model. Latency only counts the
+// requests where the latency was measured.
+type ProviderStats struct {
+	URL             string
+	Model           string
+	Requests        int
+	InputTokens     int
+	CachedTokens    int // prompt cache writes and reads
+	OutputTokens    int
+	ReasoningTokens int
+	Cost            currency.Amount
+	Latency         []int // request count per LatencyBuckets bound, plus one for the slower requests
+}
+
+// newProviderStats creates an empty stats object for a URL and model
+func newProviderStats(url, model string) ProviderStats {
+	return ProviderStats{URL: url, Model: model, Latency: make([]int, len(LatencyBuckets)+1)}
+}
+
+// add counts a single priced response
+func (s *ProviderStats) add(usage providers.Usage, cost currency.Amount, latency time.Duration) {
+	s.Requests++
+	s.InputTokens += usage.InputTokens
+	s.CachedTokens += usage.CacheWriteTokens + usage.CacheReadTokens
+	s.OutputTokens += usage.OutputTokens
+	s.ReasoningTokens += usage.ReasoningTokens
+	s.addCost(cost)
+	if latency > 0 {
+		s.Latency[latencyBucket(latency)]++
+	}
+}
+
+// merge adds the counts from another stats object, used to sum the slots of the rolling window
+func (s *ProviderStats) merge(other ProviderStats) {
+	s.Requests += other.Requests
+	s.InputTokens += other.InputTokens
+	s.CachedTokens += other.CachedTokens
+	s.OutputTokens += other.OutputTokens
+	s.ReasoningTokens += other.ReasoningTokens
+	s.addCost(other.Cost)
+	for i, count := range other.Latency {
+		s.Latency[i] += count
+	}
+}
+
+// addCost adds to the cost, an empty amount is skipped so the stats take the currency of the first
+// priced request
+func (s *ProviderStats) addCost(cost currency.Amount) {
+	if cost.CurrencyCode() == "" {
+		return
+	}
+	total, err := s.Cost.Add(cost)
+	if err != nil {
+		log.Warnf("not adding %s to the stats for %s: %v", cost, s.Model, err)
+		return
+	}
+	s.Cost = total
+}
+
+// latencyBucket returns the index of the histogram bucket for a latency
+func latencyBucket(latency time.Duration) int {
+	for i, bound := range LatencyBuckets {
+		if latency <= bound {
+			return i
+		}
+	}
+	return len(LatencyBuckets)
+}
+
+// statsSlot is one slot of the rolling window, with the counts for the requests since start
+type statsSlot struct {
+	start time.Time
+	stats ProviderStats
+}
+
+// Sample is a raw request and response, kept for debugging when the cost counter is configured to
+// keep samples
+type Sample struct {
+	Timestamp time.Time
+	Request   *ProxyRequest
+	Response  *ProxyResponse
+	Usage     providers.Usage
+}
+
+// providerStats holds the lifetime and rolling window stats for a single URL and model, and the
+// last raw samples. The memory used is fixed, no matter how many requests are counted.
+type providerStats struct {
+	total      ProviderStats
+	slotLength time.Duration
+	slots      []statsSlot // ring buffer, indexed by the slot start time
+	samples    []Sample    // ring buffer, with a capacity of the number of samples to keep
+	nextSample int
+}
+
+// newProviderStatsWindow creates the stats for a URL and model, with a rolling window of the
+// given length, and keeping the last maxSamples raw requests and responses
+func newProviderStatsWindow(url, model string, window time.Duration, maxSamples int) *providerStats {
+	ps := &providerStats{
+		total:      newProviderStats(url, model),
+		slotLength: max(window/statsSlots, time.Nanosecond),
+		slots:      make([]statsSlot, statsSlots),
+		samples:    make([]Sample, 0, max(maxSamples, 0)),
+	}
+	for i := range ps.slots {
+		ps.slots[i].stats = newProviderStats(url, model)
+	}
+	return ps
+}
+
+// slot returns the window slot for time t, and clears it when it was last used for an older time
+func (ps *providerStats) slot(t time.Time) *statsSlot {
+	start := t.Truncate(ps.slotLength)
+	index := int((start.UnixNano() / int64(ps.slotLength)) % int64(len(ps.slots)))
+	if index < 0 {
+		index += len(ps.slots)
+	}
+	slot := &ps.slots[index]
+	if !slot.start.Equal(start) {
+		slot.start = start
+		slot.stats = newProviderStats(ps.total.URL, ps.total.Model)
+	}
+	return slot
+}
+
+// add counts a single priced response, and keeps the sample when samples are enabled
+func (ps *providerStats) add(now time.Time, sample Sample, cost currency.Amount, latency time.Duration) {
+	ps.total.add(sample.Usage, cost, latency)
+	ps.slot(now).stats.add(sample.Usage, cost, latency)
+
+	if cap(ps.samples) == 0 {
+		return
+	}
+	sample.Timestamp = now
+	if len(ps.samples) < cap(ps.samples) {
+		ps.samples = append(ps.samples, sample)
+		return
+	}
+	ps.samples[ps.nextSample] = sample
+	ps.nextSample = (ps.nextSample + 1) % len(ps.samples)
+}
+
+// window returns the sum of the slots that started within the window ending at now
+func (ps *providerStats) window(now time.Time) ProviderStats {
+	out := newProviderStats(ps.total.URL, ps.total.Model)
+	oldest := now.Truncate(ps.slotLength).Add(-ps.slotLength * time.Duration(len(ps.slots)-1))
+	for _, slot := range ps.slots {
+		if slot.start.IsZero() || slot.start.Before(oldest) || slot.start.After(now) {
+			continue
+		}
+		out.merge(slot.stats)
+	}
+	return out
+}
+
+// recentSamples returns a copy of the kept samples, oldest first
+func (ps *providerStats) recentSamples() []Sample {
+	out := make([]Sample, 0, len(ps.samples))
+	out = append(out, ps.samples[ps.nextSample:]...)
+	return append(out, ps.samples[:ps.nextSample]...)
+}
+
+// copyStats returns a copy of a stats object, that doesn't share the latency histogram
+func copyStats(s ProviderStats) ProviderStats {
+	s.Latency = append([]int(nil), s.Latency...)
+	return s
+}
@@ -0,0 +1,99 @@
+package schema
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+func TestLatencyBucket(t *testing.T) {
+	assert.Equal(t, 0, latencyBucket(time.Millisecond))
+	assert.Equal(t, 0, latencyBucket(100*time.Millisecond), "bounds are inclusive")
+	assert.Equal(t, 3, latencyBucket(700*time.Millisecond))
+	assert.Equal(t, len(LatencyBuckets), latencyBucket(time.Hour))
+}
+
+func TestProviderStatsWindow(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)
+	cost, _ := currency.NewAmount("0.10", "USD")
+	usage := providers.Usage{InputTokens: 10, OutputTokens: 5, CacheReadTokens: 2, ReasoningTokens: 1}
+
+	ps := newProviderStatsWindow("https://api.openai.com/v1/chat/completions", "gpt-4o", time.Hour, 2)
+	for i := 0; i < 5; i++ {
+		// one request every 20 minutes
+		ps.add(start.Add(time.Duration(i)*20*time.Minute), Sample{Usage: usage}, cost, 200*time.Millisecond)
+	}
+	now := start.Add(80 * time.Minute)
+
+	assert.Equal(t, 5, ps.total.Requests)
+	assert.Equal(t, 50, ps.total.InputTokens)
+	assert.Equal(t, 10, ps.total.CachedTokens)
+	assert.Equal(t, "0.50 USD", ps.total.Cost.String())
+	assert.Equal(t, 5, ps.total.Latency[1])
+
+	window := ps.window(now)
+	assert.Equal(t, 3, window.Requests, "only the last hour")
+	assert.Equal(t, 15, window.OutputTokens)
+	assert.Equal(t, 3, window.ReasoningTokens)
+	assert.Equal(t, "0.30 USD", window.Cost.String())
+	assert.Equal(t, 3, window.Latency[1])
+
+	assert.Equal(t, 0, ps.window(now.Add(2*time.Hour)).Requests, "the window moves without new requests")
+
+	samples := ps.recentSamples()
+	require.Len(t, samples, 2, "only the last samples are kept")
+	assert.Equal(t, start.Add(60*time.Minute), samples[0].Timestamp)
+	assert.Equal(t, start.Add(80*time.Minute), samples[1].Timestamp)
+}
+
+func TestCostCounterStats(t *testing.T) {
+	reqURL, _ := url.Parse("https://api.openai.com/v1/chat/completions")
+	start := time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+
+	cc := NewCostCounterDefaults()
+	cc.now = func() time.Time { return now }
+	cc.SetStatsOptions(10*time.Minute, 1)
+
+	add := func(model string, latency time.Duration) {
+		_, err := cc.AddWithLatency(
+			ProxyRequest{URL: reqURL, Body: fmt.Sprintf(`{"model": "%s"}`, model)},
+			ProxyResponse{Body: `{"usage": {"prompt_tokens": 1000, "completion_tokens": 100}}`},
+			latency,
+		)
+		require.NoError(t, err)
+	}
+	add("gpt-4o", 50*time.Millisecond)
+	now = now.Add(15 * time.Minute)
+	add("gpt-4o", 2*time.Minute)
+	add("gpt-4o-mini", 0)
+
+	stats := cc.Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "gpt-4o", stats[0].Total.Model)
+	assert.Equal(t, 2, stats[0].Total.Requests)
+	assert.Equal(t, 2000, stats[0].Total.InputTokens)
+	assert.Equal(t, 1, stats[0].Total.Latency[0])
+	assert.Equal(t, 1, stats[0].Total.Latency[len(LatencyBuckets)])
+	assert.Equal(t, 1, stats[0].Window.Requests, "the first request is outside the window")
+	require.Len(t, stats[0].Samples, 1)
+	assert.Equal(t, now, stats[0].Samples[0].Timestamp)
+
+	assert.Equal(t, "gpt-4o-mini", stats[1].Total.Model)
+	assert.Equal(t, 1, stats[1].Total.Requests)
+	assert.Equal(t, make([]int, len(LatencyBuckets)+1), stats[1].Total.Latency, "zero latency isn't counted")
+
+	// the snapshot is a copy
+	stats[0].Total.Latency[0] = 100
+	assert.Equal(t, 1, cc.Stats()[0].Total.Latency[0])
+
+	cc.SetStatsOptions(0, 0)
+	assert.Empty(t, cc.Stats(), "changing the options clears the stats")
+}
@@ -0,0 +1,154 @@
+package anthropic_com
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+// MessagesRequest holds the fields from an Anthropic Messages API request that are needed for auditing
+type MessagesRequest struct {
+	Model     string `json:"model"`
+	MaxTokens int    `json:"max_tokens"`
+	Stream    bool   `json:"stream,omitempty"`
+}
+
+// messagesPrompt holds the text of a Messages API request, for estimating the input tokens. The
+// system prompt and message content are either a string, or a list of content blocks.
+type messagesPrompt struct {
+	System   json.RawMessage `json:"system"`
+	Messages []struct {
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+}
+
+// contentText returns the text from a string, or from the text blocks in a list of content blocks
+func contentText(content json.RawMessage) string {
+	if len(content) == 0 {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+
+	blocks := make([]struct {
+		Text string `json:"text"`
+	}, 0)
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		texts = append(texts, block.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Usage is the token usage reported by the Messages API. InputTokens does not include the tokens
+// that were written to, or read from, the prompt cache.
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// MessagesResponse holds the fields from an Anthropic Messages API response that are needed for auditing
+type MessagesResponse struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Model      string `json:"model"`
+	StopReason string `json:"stop_reason"`
+	Usage      Usage  `json:"usage"`
+}
+
+// streamEvent is a single data payload from a streamed Messages API response
+type streamEvent struct {
+	Type    string            `json:"type"`
+	Message *MessagesResponse `json:"message,omitempty"`
+	Delta   struct {
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// NewMessagesRequest creates a new Anthropic Messages Request object from a JSON string
+func NewMessagesRequest(body *string) (request *MessagesRequest, err error) {
+	err = json.Unmarshal([]byte(*body), &request)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal Anthropic messages request body: %v", err)
+	}
+
+	return request, nil
+}
+
+// NewMessagesResponse creates a new Anthropic Messages Response object from a JSON string, or
+// from a fully buffered text/event-stream body.
+func NewMessagesResponse(body *string) (response *MessagesResponse, err error) {
+	if utils.LooksLikeSSE(*body) {
+		return newMessagesResponseFromStream(*body)
+	}
+
+	err = json.Unmarshal([]byte(*body), &response)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal Anthropic messages response body: %v", err)
+	}
+
+	return response, nil
+}
+
+// newMessagesResponseFromStream rebuilds the response metadata from a streamed response. The
+// message_start event holds the input token counts, and each message_delta event holds the
+// cumulative output token count.
+func newMessagesResponseFromStream(body string) (*MessagesResponse, error) {
+	var response *MessagesResponse
+	for _, sse := range utils.ParseSSE(body) {
+		if sse.Data == "" || strings.TrimSpace(sse.Data) == utils.SSEDone {
+			continue
+		}
+
+		event := streamEvent{}
+		if err := json.Unmarshal([]byte(sse.Data), &event); err != nil {
+			return nil, fmt.Errorf("could not unmarshal Anthropic stream event: %v", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			response = event.Message
+		case "message_delta":
+			if response == nil {
+				return nil, fmt.Errorf("message_delta event received before message_start")
+			}
+			if event.Delta.StopReason != "" {
+				response.StopReason = event.Delta.StopReason
+			}
+			if event.Usage != nil {
+				mergeUsage(&response.Usage, event.Usage)
+			}
+		}
+	}
+
+	if response == nil {
+		return nil, fmt.Errorf("no message_start event found in Anthropic stream")
+	}
+	return response, nil
+}
+
+// mergeUsage copies the non-zero counts from a message_delta event, which are cumulative totals
+func mergeUsage(dst, src *Usage) {
+	if src.InputTokens > 0 {
+		dst.InputTokens = src.InputTokens
+	}
+	if src.OutputTokens > 0 {
+		dst.OutputTokens = src.OutputTokens
+	}
+	if src.CacheCreationInputTokens > 0 {
+		dst.CacheCreationInputTokens = src.CacheCreationInputTokens
+	}
+	if src.CacheReadInputTokens > 0 {
+		dst.CacheReadInputTokens = src.CacheReadInputTokens
+	}
+}
@@ -0,0 +1,151 @@
+package anthropic_com
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMessagesRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectError    bool
+		expectedResult *MessagesRequest
+	}{
+		{
+			name: "Valid JSON",
+			body: `{
+	"model": "claude-3-5-sonnet-20241022",
+	"max_tokens": 1024,
+	"stream": true,
+	"messages": [{"role": "user", "content": "Hello"}]
+}`,
+			expectedResult: &MessagesRequest{
+				Model:     "claude-3-5-sonnet-20241022",
+				MaxTokens: 1024,
+				Stream:    true,
+			},
+		},
+		{
+			name:        "Invalid JSON",
+			body:        `{"model": [}`,
+			expectError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewMessagesRequest(&tt.body)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedResult, result)
+		})
+	}
+}
+
+func TestNewMessagesResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectError    bool
+		expectedResult *MessagesResponse
+	}{
+		{
+			name: "Valid JSON",
+			body: `{
+	"id": "msg_01",
+	"type": "message",
+	"role": "assistant",
+	"model": "claude-3-5-sonnet-20241022",
+	"content": [{"type": "text", "text": "Hi!"}],
+	"stop_reason": "end_turn",
+	"usage": {
+		"input_tokens": 12,
+		"output_tokens": 6,
+		"cache_creation_input_tokens": 100,
+		"cache_read_input_tokens": 200
+	}
+}`,
+			expectedResult: &MessagesResponse{
+				ID:         "msg_01",
+				Type:       "message",
+				Model:      "claude-3-5-sonnet-20241022",
+				StopReason: "end_turn",
+				Usage: Usage{
+					InputTokens:              12,
+					OutputTokens:             6,
+					CacheCreationInputTokens: 100,
+					CacheReadInputTokens:     200,
+				},
+			},
+		},
+		{
+			name: "Streamed response",
+			body: `event: message_start
+data: {"type":"message_start","message":{"id":"msg_02","type":"message","role":"assistant","model":"claude-3-5-haiku-20241022","content":[],"stop_reason":null,"usage":{"input_tokens":25,"output_tokens":1,"cache_creation_input_tokens":0,"cache_read_input_tokens":300}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":15}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`,
+			expectedResult: &MessagesResponse{
+				ID:         "msg_02",
+				Type:       "message",
+				Model:      "claude-3-5-haiku-20241022",
+				StopReason: "end_turn",
+				Usage: Usage{
+					InputTokens:          25,
+					OutputTokens:         15,
+					CacheReadInputTokens: 300,
+				},
+			},
+		},
+		{
+			name: "Stream without message_start",
+			body: `event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":15}}
+
+`,
+			expectError: true,
+		},
+		{
+			name:        "Invalid JSON",
+			body:        `{"id": "msg_01", "usage": [}`,
+			expectError: true,
+		},
+		{
+			name:           "Valid JSON, missing fields",
+			body:           `{"foo": "bar"}`,
+			expectedResult: &MessagesResponse{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewMessagesResponse(&tt.body)
+			if tt.expectError {
+				assert.Error(t, err)
+				require.Nil(t, result)
+			} else {
+				assert.NoError(t, err)
+				require.NotNil(t, result)
+			}
+			assert.Equal(t, tt.expectedResult, result)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package anthropic_com
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+)
+
+//go:embed data.json
+var pricingDataJSON embed.FS
+
+// API_Endpoint_Data is populated from init() with data loaded from the embedded JSON file
+var API_Endpoint_Data []APIEndpoint
+
+// Product represents a model attached to an endpoint. Prompt caching is billed separately: tokens
+// written to the cache cost more than regular input tokens, and tokens read from it cost less.
+type Product struct {
+	Name                string `json:"name"`
+	InputTokenCost      string `json:"inputTokenCost"`
+	OutputTokenCost     string `json:"outputTokenCost"`
+	CacheWriteTokenCost string `json:"cacheWriteTokenCost"`
+	CacheReadTokenCost  string `json:"cacheReadTokenCost"`
+	Currency            string `json:"currency"`
+}
+
+// APIEndpoint represents the pricing data for a single API endpoint, such as "https://api.anthropic.com/v1/messages"
+type APIEndpoint struct {
+	URL      string            `json:"url"`
+	Products []Product         `json:"products"`
+	Aliases  map[string]string `json:"aliases,omitempty"` // key: alias, value: product name
+}
+
+func loadEmbeddedDataJSON() error {
+	data, err := fs.ReadFile(pricingDataJSON, "data.json")
+	if err != nil {
+		return fmt.Errorf("failed to read embedded data.json: %w", err)
+	}
+	return json.Unmarshal(data, &API_Endpoint_Data)
+}
+
+func init() {
+	err := loadEmbeddedDataJSON()
+	if err != nil {
+		panic(fmt.Sprintf("Error loading anthropic pricing data: %v\n", err))
+	}
+}
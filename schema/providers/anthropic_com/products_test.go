@@ -0,0 +1,23 @@
+package anthropic_com
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEmbeddedDataJSON(t *testing.T) {
+	assert.NotEmpty(t, API_Endpoint_Data, "init() populates this variable")
+
+	// Reset API_Endpoint_Data before test
+	API_Endpoint_Data = nil
+
+	err := loadEmbeddedDataJSON()
+	assert.Nil(t, err, "Expected no error loading data.json, but got an error")
+
+	assert.NotEmpty(t, API_Endpoint_Data, "Expected API_Endpoint_Data to be populated, but it was empty")
+	for _, product := range API_Endpoint_Data[0].Products {
+		assert.NotEmpty(t, product.CacheWriteTokenCost, product.Name)
+		assert.NotEmpty(t, product.CacheReadTokenCost, product.Name)
+	}
+}
@@ -0,0 +1,100 @@
+package anthropic_com
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+const (
+	hostname     = "api.anthropic.com"
+	messagesPath = "/v1/messages"
+)
+
+// Provider parses Anthropic Messages API traffic for the cost counter
+type Provider struct{}
+
+func (p *Provider) Name() string {
+	return hostname
+}
+
+func (p *Provider) MatchURL(u *url.URL) bool {
+	return strings.EqualFold(u.Hostname(), hostname) && u.Path == messagesPath
+}
+
+func (p *Provider) ExtractModel(reqBody string) (string, error) {
+	messagesReq, err := NewMessagesRequest(&reqBody)
+	if err != nil {
+		return "", err
+	}
+	return messagesReq.Model, nil
+}
+
+func (p *Provider) ExtractUsage(reqBody, respBody string) (providers.Usage, error) {
+	messagesResp, err := NewMessagesResponse(&respBody)
+	if err != nil {
+		return providers.Usage{}, err
+	}
+	return providers.Usage{
+		InputTokens:      messagesResp.Usage.InputTokens,
+		OutputTokens:     messagesResp.Usage.OutputTokens,
+		CacheWriteTokens: messagesResp.Usage.CacheCreationInputTokens,
+		CacheReadTokens:  messagesResp.Usage.CacheReadInputTokens,
+	}, nil
+}
+
+// EstimateRequest estimates the prompt tokens before the request is sent, and uses max_tokens for
+// the output tokens. Anthropic doesn't publish its tokenizer, so the count is approximate.
+func (p *Provider) EstimateRequest(reqBody string) (providers.Usage, error) {
+	messagesReq, err := NewMessagesRequest(&reqBody)
+	if err != nil {
+		return providers.Usage{}, err
+	}
+	prompt := messagesPrompt{}
+	if err := json.Unmarshal([]byte(reqBody), &prompt); err != nil {
+		return providers.Usage{}, err
+	}
+
+	inputTokens := providers.EstimateTokens(contentText(prompt.System))
+	for _, msg := range prompt.Messages {
+		inputTokens += providers.EstimateTokens(contentText(msg.Content))
+	}
+	return providers.Usage{
+		InputTokens:  inputTokens,
+		OutputTokens: messagesReq.MaxTokens,
+		Estimated:    true,
+	}, nil
+}
+
+func (p *Provider) ExtractResponseModel(respBody string) (string, error) {
+	messagesResp, err := NewMessagesResponse(&respBody)
+	if err != nil {
+		return "", err
+	}
+	return messagesResp.Model, nil
+}
+
+func (p *Provider) Pricing() []providers.Endpoint {
+	endpoints := make([]providers.Endpoint, 0, len(API_Endpoint_Data))
+	for _, endpoint := range API_Endpoint_Data {
+		prices := make([]providers.Price, 0, len(endpoint.Products))
+		for _, product := range endpoint.Products {
+			prices = append(prices, providers.Price{
+				Model:               product.Name,
+				Currency:            product.Currency,
+				InputTokenCost:      product.InputTokenCost,
+				OutputTokenCost:     product.OutputTokenCost,
+				CacheWriteTokenCost: product.CacheWriteTokenCost,
+				CacheReadTokenCost:  product.CacheReadTokenCost,
+			})
+		}
+		endpoints = append(endpoints, providers.Endpoint{URL: endpoint.URL, Prices: prices, Aliases: endpoint.Aliases})
+	}
+	return endpoints
+}
+
+func init() {
+	providers.Register(&Provider{})
+}
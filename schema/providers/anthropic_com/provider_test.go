@@ -0,0 +1,83 @@
+package anthropic_com
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+func TestProvider(t *testing.T) {
+	u, err := url.Parse("https://api.anthropic.com/v1/messages")
+	require.NoError(t, err)
+	assert.IsType(t, &Provider{}, providers.Lookup(u), "registered from init()")
+
+	p := &Provider{}
+	t.Run("MatchURL", func(t *testing.T) {
+		for rawURL, expected := range map[string]bool{
+			"https://api.anthropic.com/v1/messages":              true,
+			"http://API.ANTHROPIC.COM/v1/messages":               true,
+			"https://api.anthropic.com/v1/messages/count_tokens": false,
+			"https://example.com/v1/messages":                    false,
+		} {
+			u, err := url.Parse(rawURL)
+			require.NoError(t, err)
+			assert.Equal(t, expected, p.MatchURL(u), rawURL)
+		}
+	})
+
+	t.Run("ExtractModel", func(t *testing.T) {
+		model, err := p.ExtractModel(`{"model": "claude-3-5-haiku-20241022", "max_tokens": 10}`)
+		require.NoError(t, err)
+		assert.Equal(t, "claude-3-5-haiku-20241022", model)
+
+		_, err = p.ExtractModel(`{`)
+		assert.Error(t, err)
+	})
+
+	t.Run("ExtractUsage", func(t *testing.T) {
+		usage, err := p.ExtractUsage("", `{"usage": {"input_tokens": 1, "output_tokens": 2, "cache_creation_input_tokens": 3, "cache_read_input_tokens": 4}}`)
+		require.NoError(t, err)
+		assert.Equal(t, providers.Usage{InputTokens: 1, OutputTokens: 2, CacheWriteTokens: 3, CacheReadTokens: 4}, usage)
+
+		_, err = p.ExtractUsage("", `{`)
+		assert.Error(t, err)
+	})
+
+	t.Run("EstimateRequest", func(t *testing.T) {
+		// 2 ("Be brief") + 3 ("Hello there") + 4 ("General Kenobi") input tokens
+		usage, err := p.EstimateRequest(`{"model": "claude-3-5-haiku-20241022", "max_tokens": 50, "system": "Be brief",
+			"messages": [{"role": "user", "content": "Hello there"}, {"role": "assistant", "content": [{"type": "text", "text": "General Kenobi"}]}]}`)
+		require.NoError(t, err)
+		assert.Equal(t, providers.Usage{InputTokens: 9, OutputTokens: 50, Estimated: true}, usage)
+
+		_, err = p.EstimateRequest(`{`)
+		assert.Error(t, err)
+	})
+
+	t.Run("ExtractResponseModel", func(t *testing.T) {
+		model, err := p.ExtractResponseModel(`{"model": "claude-3-5-haiku-20241022"}`)
+		require.NoError(t, err)
+		assert.Equal(t, "claude-3-5-haiku-20241022", model)
+
+		_, err = p.ExtractResponseModel(`{`)
+		assert.Error(t, err)
+	})
+
+	t.Run("Pricing", func(t *testing.T) {
+		pricing := p.Pricing()
+		require.Len(t, pricing, len(API_Endpoint_Data))
+		product := API_Endpoint_Data[0].Products[0]
+		assert.Equal(t, providers.Price{
+			Model:               product.Name,
+			Currency:            product.Currency,
+			InputTokenCost:      product.InputTokenCost,
+			OutputTokenCost:     product.OutputTokenCost,
+			CacheWriteTokenCost: product.CacheWriteTokenCost,
+			CacheReadTokenCost:  product.CacheReadTokenCost,
+		}, pricing[0].Prices[0])
+	})
+}
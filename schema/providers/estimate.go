@@ -0,0 +1,26 @@
+package providers
+
+import (
+	"unicode/utf8"
+
+	"github.com/proxati/llm_proxy/schema/tokenizer"
+)
+
+// charsPerToken is the rough average number of characters in a token, for English text
+const charsPerToken = 4
+
+// EstimateTokens returns a rough token count for a string, for when a response doesn't include
+// usage data. It's not a tokenizer, so costs calculated from it should be reported as estimates.
+func EstimateTokens(text string) int {
+	chars := utf8.RuneCountInString(text)
+	return (chars + charsPerToken - 1) / charsPerToken
+}
+
+// CountTokens returns the token count for a string with the local tokenizer for the model, or
+// falls back to EstimateTokens for models without an embedded tokenizer
+func CountTokens(model, text string) int {
+	if encoding := tokenizer.ForModel(model); encoding != nil {
+		return encoding.Count(text)
+	}
+	return EstimateTokens(text)
+}
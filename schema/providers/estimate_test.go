@@ -0,0 +1,25 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{text: "", expected: 0},
+		{text: "Hi", expected: 1},
+		{text: "Hello", expected: 2},
+		{text: "Hello world!", expected: 3},
+		{text: "héllo wörld!", expected: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.expected, EstimateTokens(tt.text))
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package openai_com
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+// filesContentPath matches a file download, which is how the output of a batch is retrieved
+var filesContentPath = regexp.MustCompile(`^/v1/files/[^/]+/content$`)
+
+// batchResponseObjects maps the object type of a batch response body to the endpoint that
+// served it, for pricing
+var batchResponseObjects = map[string]string{
+	"chat.completion": chatCompletionPath,
+	"list":            embeddingsPath,
+}
+
+// batchOutputLine is a single line of a batch output file. Response is nil for requests that
+// failed, which are not billed.
+type batchOutputLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+}
+
+// batchResponseBody holds the fields of a chat completion, or embeddings, response that are used
+// for pricing
+type batchResponseBody struct {
+	Object string       `json:"object"`
+	Model  string       `json:"model"`
+	Usage  usageDetails `json:"usage"`
+}
+
+// parseBatchOutput returns the successful response bodies from a batch output file. Other file
+// downloads, and batches without a successful request, return providers.ErrNotBillable.
+func parseBatchOutput(respBody string) ([]batchResponseBody, error) {
+	bodies := make([]batchResponseBody, 0)
+	for _, line := range strings.Split(respBody, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		outputLine := batchOutputLine{}
+		if err := json.Unmarshal([]byte(line), &outputLine); err != nil || outputLine.CustomID == "" {
+			return nil, fmt.Errorf("%w: not a batch output file", providers.ErrNotBillable)
+		}
+		if outputLine.Response == nil || outputLine.Response.StatusCode != http.StatusOK {
+			continue
+		}
+
+		body := batchResponseBody{}
+		if err := json.Unmarshal(outputLine.Response.Body, &body); err != nil {
+			return nil, fmt.Errorf("could not unmarshal OpenAI batch response body for %s: %v", outputLine.CustomID, err)
+		}
+		bodies = append(bodies, body)
+	}
+
+	if len(bodies) == 0 {
+		return nil, fmt.Errorf("%w: no successful requests in batch output", providers.ErrNotBillable)
+	}
+	return bodies, nil
+}
+
+// BatchOutputProvider parses the output file of an OpenAI batch, when it's downloaded through the
+// proxy. Each batch uses a single model and endpoint, and is billed at the batch rates.
+type BatchOutputProvider struct{}
+
+func (p *BatchOutputProvider) Name() string                  { return endpointName("/v1/files/{file_id}/content") }
+func (p *BatchOutputProvider) Pricing() []providers.Endpoint { return nil }
+
+func (p *BatchOutputProvider) MatchURL(u *url.URL) bool {
+	return strings.EqualFold(u.Hostname(), hostname) && filesContentPath.MatchString(u.Path)
+}
+
+// ExtractModel returns an empty model, the request is a download without a body. The model is
+// read from the response by ExtractResponseModel.
+func (p *BatchOutputProvider) ExtractModel(reqBody string) (string, error) {
+	return "", nil
+}
+
+func (p *BatchOutputProvider) ExtractResponseModel(respBody string) (string, error) {
+	bodies, err := parseBatchOutput(respBody)
+	if err != nil {
+		return "", err
+	}
+	return bodies[0].Model, nil
+}
+
+// PricingURL returns the endpoint that served the requests in the batch
+func (p *BatchOutputProvider) PricingURL(respBody string) (string, error) {
+	bodies, err := parseBatchOutput(respBody)
+	if err != nil {
+		return "", err
+	}
+	path, found := batchResponseObjects[bodies[0].Object]
+	if !found {
+		return "", fmt.Errorf("unsupported OpenAI batch response object: %q", bodies[0].Object)
+	}
+	return "https://" + hostname + path, nil
+}
+
+// ExtractUsage returns the total usage of all successful requests in the batch
+func (p *BatchOutputProvider) ExtractUsage(reqBody, respBody string) (providers.Usage, error) {
+	bodies, err := parseBatchOutput(respBody)
+	if err != nil {
+		return providers.Usage{}, err
+	}
+
+	total := providers.Usage{Batch: true}
+	for _, body := range bodies {
+		usage := body.Usage.toUsage()
+		total.InputTokens += usage.InputTokens
+		total.OutputTokens += usage.OutputTokens
+		total.CacheReadTokens += usage.CacheReadTokens
+		total.ReasoningTokens += usage.ReasoningTokens
+	}
+	return total, nil
+}
@@ -0,0 +1,82 @@
+package openai_com
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+func TestBatchOutputProvider(t *testing.T) {
+	p := &BatchOutputProvider{}
+
+	t.Run("MatchURL", func(t *testing.T) {
+		for rawURL, expected := range map[string]bool{
+			"https://api.openai.com/v1/files/file-abc123/content": true,
+			"https://api.openai.com/v1/files/file-abc123":         false,
+			"https://api.openai.com/v1/files":                     false,
+			"https://example.com/v1/files/file-abc123/content":    false,
+		} {
+			u, err := url.Parse(rawURL)
+			require.NoError(t, err)
+			assert.Equal(t, expected, p.MatchURL(u), rawURL)
+		}
+	})
+
+	chatOutput := strings.Join([]string{
+		`{"id": "batch_req_1", "custom_id": "request-1", "response": {"status_code": 200, "body": {"object": "chat.completion", "model": "gpt-4o-mini-2024-07-18", "usage": {"prompt_tokens": 20, "completion_tokens": 10, "prompt_tokens_details": {"cached_tokens": 5}}}}, "error": null}`,
+		`{"id": "batch_req_2", "custom_id": "request-2", "response": {"status_code": 200, "body": {"object": "chat.completion", "model": "gpt-4o-mini-2024-07-18", "usage": {"prompt_tokens": 30, "completion_tokens": 20, "completion_tokens_details": {"reasoning_tokens": 15}}}}, "error": null}`,
+		`{"id": "batch_req_3", "custom_id": "request-3", "response": {"status_code": 400, "body": {"error": {"message": "bad request"}}}, "error": null}`,
+		"",
+	}, "\n")
+	embeddingsOutput := `{"id": "batch_req_1", "custom_id": "request-1", "response": {"status_code": 200, "body": {"object": "list", "model": "text-embedding-3-small", "usage": {"prompt_tokens": 8, "total_tokens": 8}}}, "error": null}`
+
+	t.Run("ExtractUsage", func(t *testing.T) {
+		usage, err := p.ExtractUsage("", chatOutput)
+		require.NoError(t, err)
+		assert.Equal(t, providers.Usage{InputTokens: 45, CacheReadTokens: 5, OutputTokens: 15, ReasoningTokens: 15, Batch: true}, usage)
+
+		usage, err = p.ExtractUsage("", embeddingsOutput)
+		require.NoError(t, err)
+		assert.Equal(t, providers.Usage{InputTokens: 8, Batch: true}, usage)
+	})
+
+	t.Run("ExtractResponseModel", func(t *testing.T) {
+		model, err := p.ExtractModel("")
+		require.NoError(t, err)
+		assert.Empty(t, model, "the model is only in the response")
+
+		model, err = p.ExtractResponseModel(chatOutput)
+		require.NoError(t, err)
+		assert.Equal(t, "gpt-4o-mini-2024-07-18", model)
+	})
+
+	t.Run("PricingURL", func(t *testing.T) {
+		pricingURL, err := p.PricingURL(chatOutput)
+		require.NoError(t, err)
+		assert.Equal(t, "https://api.openai.com/v1/chat/completions", pricingURL)
+
+		pricingURL, err = p.PricingURL(embeddingsOutput)
+		require.NoError(t, err)
+		assert.Equal(t, "https://api.openai.com/v1/embeddings", pricingURL)
+
+		_, err = p.PricingURL(`{"custom_id": "request-1", "response": {"status_code": 200, "body": {"object": "response"}}}`)
+		assert.Error(t, err)
+	})
+
+	t.Run("Not billable", func(t *testing.T) {
+		for name, body := range map[string]string{
+			"training file": `{"messages": [{"role": "user", "content": "Hello"}]}`,
+			"batch input":   `{"custom_id": "request-1", "method": "POST", "url": "/v1/chat/completions", "body": {}}`,
+			"all failed":    `{"custom_id": "request-1", "response": null, "error": {"code": "server_error"}}`,
+			"binary":        "\x89PNG",
+		} {
+			_, err := p.ExtractUsage("", body)
+			assert.ErrorIs(t, err, providers.ErrNotBillable, name)
+		}
+	})
+}
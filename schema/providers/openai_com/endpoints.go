@@ -0,0 +1,262 @@
+package openai_com
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+const (
+	embeddingsPath     = "/v1/embeddings"
+	imagesPath         = "/v1/images/generations"
+	transcriptionsPath = "/v1/audio/transcriptions"
+	speechPath         = "/v1/audio/speech"
+	moderationsPath    = "/v1/moderations"
+
+	// defaults used by the API when the request doesn't set these fields
+	defaultImageModel         = "dall-e-2"
+	defaultImageSize          = "1024x1024"
+	defaultImageQuality       = "standard"
+	defaultTranscriptionModel = "whisper-1"
+	defaultModerationModel    = "omni-moderation-latest"
+
+	// speechWordsPerMinute is used to estimate the audio length from a transcription, when the
+	// response format doesn't include timestamps
+	speechWordsPerMinute = 150
+)
+
+// subtitleTimestamp matches the end time of an SRT or VTT cue, e.g., "--> 00:01:02,500"
+var subtitleTimestamp = regexp.MustCompile(`-->\s*(\d+):(\d{2}):(\d{2})[,.](\d{3})`)
+
+// requestFields holds the JSON request fields used by the non-chat endpoints
+type requestFields struct {
+	Model   string `json:"model"`
+	Input   string `json:"input"`
+	Size    string `json:"size"`
+	Quality string `json:"quality"`
+}
+
+// parseRequestFields parses a JSON request body. Input is left empty when it's not a string,
+// e.g., a list of strings for the embeddings endpoint.
+func parseRequestFields(reqBody string) (*requestFields, error) {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal([]byte(reqBody), &raw); err != nil {
+		return nil, fmt.Errorf("could not unmarshal OpenAI request body: %v", err)
+	}
+
+	fields := &requestFields{}
+	targets := map[string]any{
+		"model":   &fields.Model,
+		"input":   &fields.Input,
+		"size":    &fields.Size,
+		"quality": &fields.Quality,
+	}
+	for key, target := range targets {
+		if value, found := raw[key]; found {
+			_ = json.Unmarshal(value, target) // wrong types are left as the zero value
+		}
+	}
+	return fields, nil
+}
+
+// responseModel reads the "model" field from a JSON response body
+func responseModel(respBody string) (string, error) {
+	resp := struct {
+		Model string `json:"model"`
+	}{}
+	if err := json.Unmarshal([]byte(respBody), &resp); err != nil {
+		return "", fmt.Errorf("could not unmarshal OpenAI response body: %v", err)
+	}
+	return resp.Model, nil
+}
+
+// EmbeddingsProvider parses OpenAI embeddings traffic, billed per input token
+type EmbeddingsProvider struct{}
+
+func (p *EmbeddingsProvider) Name() string                  { return endpointName(embeddingsPath) }
+func (p *EmbeddingsProvider) MatchURL(u *url.URL) bool      { return matchEndpoint(u, embeddingsPath) }
+func (p *EmbeddingsProvider) Pricing() []providers.Endpoint { return pricingFor(embeddingsPath) }
+
+func (p *EmbeddingsProvider) ExtractModel(reqBody string) (string, error) {
+	fields, err := parseRequestFields(reqBody)
+	if err != nil {
+		return "", err
+	}
+	return fields.Model, nil
+}
+
+func (p *EmbeddingsProvider) ExtractResponseModel(respBody string) (string, error) {
+	return responseModel(respBody)
+}
+
+func (p *EmbeddingsProvider) ExtractUsage(reqBody, respBody string) (providers.Usage, error) {
+	resp := struct {
+		Usage struct {
+			PromptTokens int `json:"prompt_tokens"`
+		} `json:"usage"`
+	}{}
+	if err := json.Unmarshal([]byte(respBody), &resp); err != nil {
+		return providers.Usage{}, fmt.Errorf("could not unmarshal OpenAI embeddings response body: %v", err)
+	}
+	return providers.Usage{InputTokens: resp.Usage.PromptTokens}, nil
+}
+
+// ImagesProvider parses OpenAI image generation traffic, billed per image of each quality and size
+type ImagesProvider struct{}
+
+func (p *ImagesProvider) Name() string                  { return endpointName(imagesPath) }
+func (p *ImagesProvider) MatchURL(u *url.URL) bool      { return matchEndpoint(u, imagesPath) }
+func (p *ImagesProvider) Pricing() []providers.Endpoint { return pricingFor(imagesPath) }
+
+func (p *ImagesProvider) ExtractModel(reqBody string) (string, error) {
+	fields, err := parseRequestFields(reqBody)
+	if err != nil {
+		return "", err
+	}
+	if fields.Model == "" {
+		return defaultImageModel, nil
+	}
+	return fields.Model, nil
+}
+
+func (p *ImagesProvider) ExtractUsage(reqBody, respBody string) (providers.Usage, error) {
+	fields, err := parseRequestFields(reqBody)
+	if err != nil {
+		return providers.Usage{}, err
+	}
+
+	resp := struct {
+		Data []json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal([]byte(respBody), &resp); err != nil {
+		return providers.Usage{}, fmt.Errorf("could not unmarshal OpenAI images response body: %v", err)
+	}
+
+	size := fields.Size
+	if size == "" {
+		size = defaultImageSize
+	}
+	quality := fields.Quality
+	if quality == "" {
+		quality = defaultImageQuality
+	}
+
+	return providers.Usage{
+		Images:       len(resp.Data),
+		ImageVariant: quality + "/" + size,
+	}, nil
+}
+
+// TranscriptionProvider parses OpenAI audio transcription traffic, billed per minute of audio
+type TranscriptionProvider struct{}
+
+func (p *TranscriptionProvider) Name() string { return endpointName(transcriptionsPath) }
+func (p *TranscriptionProvider) MatchURL(u *url.URL) bool {
+	return matchEndpoint(u, transcriptionsPath)
+}
+func (p *TranscriptionProvider) Pricing() []providers.Endpoint { return pricingFor(transcriptionsPath) }
+
+// ExtractModel reads the model from the multipart form. Bodies with binary audio data are not
+// stored by the proxy, so the default model is returned when the form can't be read.
+func (p *TranscriptionProvider) ExtractModel(reqBody string) (string, error) {
+	if model := multipartFields(reqBody)["model"]; model != "" {
+		return model, nil
+	}
+	return defaultTranscriptionModel, nil
+}
+
+// ExtractUsage reads the audio length from the "duration" field of a verbose_json response, or
+// from the last cue of an SRT or VTT response. The length of json and text responses is estimated
+// from the number of words in the transcript.
+func (p *TranscriptionProvider) ExtractUsage(reqBody, respBody string) (providers.Usage, error) {
+	resp := struct {
+		Text     string   `json:"text"`
+		Duration *float64 `json:"duration"`
+	}{}
+	if err := json.Unmarshal([]byte(respBody), &resp); err != nil {
+		// not JSON, one of the text response formats
+		resp.Text = respBody
+	}
+	if resp.Duration != nil {
+		return providers.Usage{AudioSeconds: *resp.Duration}, nil
+	}
+
+	if matches := subtitleTimestamp.FindAllStringSubmatch(resp.Text, -1); len(matches) > 0 {
+		last := matches[len(matches)-1]
+		hours, _ := strconv.Atoi(last[1])
+		minutes, _ := strconv.Atoi(last[2])
+		seconds, _ := strconv.Atoi(last[3])
+		millis, _ := strconv.Atoi(last[4])
+		return providers.Usage{
+			AudioSeconds: float64(hours*3600+minutes*60+seconds) + float64(millis)/1000,
+		}, nil
+	}
+
+	words := len(strings.Fields(resp.Text))
+	return providers.Usage{
+		AudioSeconds: float64(words) * 60 / speechWordsPerMinute,
+		Estimated:    true,
+	}, nil
+}
+
+// SpeechProvider parses OpenAI text-to-speech traffic, billed per input character
+type SpeechProvider struct{}
+
+func (p *SpeechProvider) Name() string                  { return endpointName(speechPath) }
+func (p *SpeechProvider) MatchURL(u *url.URL) bool      { return matchEndpoint(u, speechPath) }
+func (p *SpeechProvider) Pricing() []providers.Endpoint { return pricingFor(speechPath) }
+
+func (p *SpeechProvider) ExtractModel(reqBody string) (string, error) {
+	fields, err := parseRequestFields(reqBody)
+	if err != nil {
+		return "", err
+	}
+	return fields.Model, nil
+}
+
+// ExtractUsage counts the characters in the request, the response body is the audio file
+func (p *SpeechProvider) ExtractUsage(reqBody, respBody string) (providers.Usage, error) {
+	fields, err := parseRequestFields(reqBody)
+	if err != nil {
+		return providers.Usage{}, err
+	}
+	return providers.Usage{Characters: utf8.RuneCountInString(fields.Input)}, nil
+}
+
+// ModerationsProvider parses OpenAI moderation traffic, which is free, but is still counted
+type ModerationsProvider struct{}
+
+func (p *ModerationsProvider) Name() string                  { return endpointName(moderationsPath) }
+func (p *ModerationsProvider) MatchURL(u *url.URL) bool      { return matchEndpoint(u, moderationsPath) }
+func (p *ModerationsProvider) Pricing() []providers.Endpoint { return pricingFor(moderationsPath) }
+
+func (p *ModerationsProvider) ExtractModel(reqBody string) (string, error) {
+	fields, err := parseRequestFields(reqBody)
+	if err != nil {
+		return "", err
+	}
+	if fields.Model == "" {
+		return defaultModerationModel, nil
+	}
+	return fields.Model, nil
+}
+
+func (p *ModerationsProvider) ExtractResponseModel(respBody string) (string, error) {
+	return responseModel(respBody)
+}
+
+func (p *ModerationsProvider) ExtractUsage(reqBody, respBody string) (providers.Usage, error) {
+	resp := struct {
+		Results []json.RawMessage `json:"results"`
+	}{}
+	if err := json.Unmarshal([]byte(respBody), &resp); err != nil {
+		return providers.Usage{}, fmt.Errorf("could not unmarshal OpenAI moderations response body: %v", err)
+	}
+	return providers.Usage{}, nil
+}
@@ -0,0 +1,185 @@
+package openai_com
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+func TestEndpointProvidersRegistered(t *testing.T) {
+	tests := map[string]providers.Provider{
+		"https://api.openai.com/v1/chat/completions":     &Provider{},
+		"https://api.openai.com/v1/embeddings":           &EmbeddingsProvider{},
+		"https://api.openai.com/v1/images/generations":   &ImagesProvider{},
+		"https://api.openai.com/v1/audio/transcriptions": &TranscriptionProvider{},
+		"https://api.openai.com/v1/audio/speech":         &SpeechProvider{},
+		"https://api.openai.com/v1/moderations":          &ModerationsProvider{},
+	}
+	for rawURL, expected := range tests {
+		t.Run(rawURL, func(t *testing.T) {
+			u, err := url.Parse(rawURL)
+			require.NoError(t, err)
+			p := providers.Lookup(u)
+			require.IsType(t, expected, p)
+
+			pricing := p.Pricing()
+			require.Len(t, pricing, 1)
+			assert.Equal(t, rawURL, pricing[0].URL)
+			assert.NotEmpty(t, pricing[0].Prices)
+		})
+	}
+}
+
+func TestEmbeddingsProvider(t *testing.T) {
+	p := &EmbeddingsProvider{}
+	model, err := p.ExtractModel(`{"model": "text-embedding-3-small", "input": ["a", "b"]}`)
+	require.NoError(t, err)
+	assert.Equal(t, "text-embedding-3-small", model)
+
+	model, err = p.ExtractResponseModel(`{"object": "list", "model": "text-embedding-3-small"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "text-embedding-3-small", model)
+
+	usage, err := p.ExtractUsage("", `{"object": "list", "data": [], "usage": {"prompt_tokens": 8, "total_tokens": 8}}`)
+	require.NoError(t, err)
+	assert.Equal(t, providers.Usage{InputTokens: 8}, usage)
+
+	_, err = p.ExtractUsage("", `{`)
+	assert.Error(t, err)
+}
+
+func TestImagesProvider(t *testing.T) {
+	p := &ImagesProvider{}
+	tests := []struct {
+		name          string
+		reqBody       string
+		respBody      string
+		expectedModel string
+		expectedUsage providers.Usage
+	}{
+		{
+			name:          "defaults",
+			reqBody:       `{"prompt": "a cat"}`,
+			respBody:      `{"created": 1, "data": [{"url": "https://example.com/1.png"}]}`,
+			expectedModel: "dall-e-2",
+			expectedUsage: providers.Usage{Images: 1, ImageVariant: "standard/1024x1024"},
+		},
+		{
+			name:          "hd images",
+			reqBody:       `{"model": "dall-e-3", "prompt": "a cat", "n": 2, "size": "1792x1024", "quality": "hd"}`,
+			respBody:      `{"created": 1, "data": [{"b64_json": "AA=="}, {"b64_json": "AA=="}]}`,
+			expectedModel: "dall-e-3",
+			expectedUsage: providers.Usage{Images: 2, ImageVariant: "hd/1792x1024"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := p.ExtractModel(tt.reqBody)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedModel, model)
+
+			usage, err := p.ExtractUsage(tt.reqBody, tt.respBody)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedUsage, usage)
+		})
+	}
+
+	_, err := p.ExtractUsage(`{}`, `{`)
+	assert.Error(t, err)
+}
+
+func TestTranscriptionProvider(t *testing.T) {
+	p := &TranscriptionProvider{}
+
+	t.Run("ExtractModel", func(t *testing.T) {
+		body := "--xyz\r\n" +
+			"Content-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\n" +
+			"not really audio\r\n" +
+			"--xyz\r\n" +
+			"Content-Disposition: form-data; name=\"model\"\r\n\r\n" +
+			"whisper-2\r\n" +
+			"--xyz--\r\n"
+		model, err := p.ExtractModel(body)
+		require.NoError(t, err)
+		assert.Equal(t, "whisper-2", model)
+
+		model, err = p.ExtractModel("") // binary bodies are not stored
+		require.NoError(t, err)
+		assert.Equal(t, "whisper-1", model)
+	})
+
+	tests := []struct {
+		name     string
+		respBody string
+		expected providers.Usage
+	}{
+		{
+			name:     "verbose_json",
+			respBody: `{"task": "transcribe", "duration": 8.47, "text": "Hello"}`,
+			expected: providers.Usage{AudioSeconds: 8.47},
+		},
+		{
+			name:     "srt",
+			respBody: "1\n00:00:00,000 --> 00:00:04,000\nHello\n\n2\n00:00:04,000 --> 00:01:02,500\nthere\n",
+			expected: providers.Usage{AudioSeconds: 62.5},
+		},
+		{
+			name:     "vtt",
+			respBody: "WEBVTT\n\n00:00:00.000 --> 01:00:01.250\nHello\n",
+			expected: providers.Usage{AudioSeconds: 3601.25},
+		},
+		{
+			name:     "json is estimated",
+			respBody: `{"text": "one two three four five six seven eight nine ten"}`,
+			expected: providers.Usage{AudioSeconds: 4, Estimated: true},
+		},
+		{
+			name:     "text is estimated",
+			respBody: "one two three four five",
+			expected: providers.Usage{AudioSeconds: 2, Estimated: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := p.ExtractUsage("", tt.respBody)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, usage)
+		})
+	}
+}
+
+func TestSpeechProvider(t *testing.T) {
+	p := &SpeechProvider{}
+	reqBody := `{"model": "tts-1-hd", "input": "Héllo!", "voice": "alloy"}`
+
+	model, err := p.ExtractModel(reqBody)
+	require.NoError(t, err)
+	assert.Equal(t, "tts-1-hd", model)
+
+	usage, err := p.ExtractUsage(reqBody, "")
+	require.NoError(t, err)
+	assert.Equal(t, providers.Usage{Characters: 6}, usage)
+
+	_, err = p.ExtractUsage(`{`, "")
+	assert.Error(t, err)
+}
+
+func TestModerationsProvider(t *testing.T) {
+	p := &ModerationsProvider{}
+
+	model, err := p.ExtractModel(`{"input": "hello"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "omni-moderation-latest", model)
+
+	model, err = p.ExtractModel(`{"model": "text-moderation-stable", "input": "hello"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "text-moderation-stable", model)
+
+	usage, err := p.ExtractUsage("", `{"id": "modr-1", "results": [{"flagged": false}]}`)
+	require.NoError(t, err)
+	assert.Equal(t, providers.Usage{}, usage)
+}
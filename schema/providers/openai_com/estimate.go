@@ -0,0 +1,48 @@
+package openai_com
+
+import (
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+const (
+	// tokensPerMessage is the overhead for the role and separators around each chat message
+	tokensPerMessage = 4
+
+	// tokensPerReply is the overhead for priming the assistant's reply
+	tokensPerReply = 3
+)
+
+// estimateUsage estimates the token usage of a chat completion from the message text, for
+// responses that were sent without usage data, e.g., a stream without a usage chunk.
+func estimateUsage(req *openai.ChatCompletionRequest, resp *openai.ChatCompletionResponse) providers.Usage {
+	usage := providers.Usage{Estimated: true, InputTokens: estimatePromptTokens(req)}
+	for _, choice := range resp.Choices {
+		usage.OutputTokens += estimateMessageTokens(req.Model, choice.Message)
+	}
+	return usage
+}
+
+// estimatePromptTokens counts the tokens for the request messages, with the overhead added by
+// the chat format
+func estimatePromptTokens(req *openai.ChatCompletionRequest) int {
+	tokens := tokensPerReply
+	for _, msg := range req.Messages {
+		tokens += tokensPerMessage + estimateMessageTokens(req.Model, msg)
+	}
+	return tokens
+}
+
+// estimateMessageTokens counts the tokens for the text parts and tool calls of a single message,
+// with the local tokenizer for the model when it's available
+func estimateMessageTokens(model string, msg openai.ChatCompletionMessage) int {
+	tokens := providers.CountTokens(model, msg.Content) + providers.CountTokens(model, msg.Name)
+	for _, part := range msg.MultiContent {
+		tokens += providers.CountTokens(model, part.Text)
+	}
+	for _, toolCall := range msg.ToolCalls {
+		tokens += providers.CountTokens(model, toolCall.Function.Name) + providers.CountTokens(model, toolCall.Function.Arguments)
+	}
+	return tokens
+}
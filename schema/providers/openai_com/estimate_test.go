@@ -0,0 +1,33 @@
+package openai_com
+
+import (
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+func TestEstimateUsage(t *testing.T) {
+	req := &openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: "system", Content: "Be brief"}, // 4 + 2
+			{Role: "user", MultiContent: []openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeText, Text: "What is this?"}, // 4 + 4
+				{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/cat.png"}},
+			}},
+		},
+	}
+	resp := &openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Content: "A cat"}}, // 2
+			{Message: openai.ChatCompletionMessage{ToolCalls: []openai.ToolCall{
+				{Function: openai.FunctionCall{Name: "lookup", Arguments: `{"q":"cat"}`}}, // 2 + 3
+			}}},
+		},
+	}
+
+	assert.Equal(t, providers.Usage{InputTokens: 17, OutputTokens: 7, Estimated: true}, estimateUsage(req, resp))
+	assert.Equal(t, providers.Usage{InputTokens: tokensPerReply, Estimated: true}, estimateUsage(&openai.ChatCompletionRequest{}, &openai.ChatCompletionResponse{}))
+}
@@ -3,8 +3,12 @@ package openai_com
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/proxati/llm_proxy/schema/utils"
 )
 
 // NewOpenAIChatCompletionRequest creates a new OpenAI ChatCompletion Request object from a JSON string
@@ -30,3 +34,89 @@ func NewOpenAIChatCompletionResponse(body *string) (completion *openai.ChatCompl
 
 	return completion, nil
 }
+
+// NewOpenAIChatCompletionStreamResponse creates a new OpenAI ChatCompletion Response object from a
+// fully buffered text/event-stream body, by joining the deltas from each chunk. Usage is only set
+// when the request had stream_options.include_usage enabled.
+func NewOpenAIChatCompletionStreamResponse(body *string) (completion *openai.ChatCompletionResponse, err error) {
+	completion = &openai.ChatCompletionResponse{}
+	choices := make(map[int]*openai.ChatCompletionChoice)
+	chunks := 0
+
+	for _, event := range utils.ParseSSE(*body) {
+		data := strings.TrimSpace(event.Data)
+		if data == "" || data == utils.SSEDone {
+			continue
+		}
+
+		chunk := openai.ChatCompletionStreamResponse{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("could not unmarshal OpenAI completion stream chunk: %v", err)
+		}
+		chunks++
+
+		completion.ID = chunk.ID
+		completion.Created = chunk.Created
+		completion.Model = chunk.Model
+		completion.SystemFingerprint = chunk.SystemFingerprint
+		if chunk.Usage != nil {
+			completion.Usage = *chunk.Usage
+		}
+
+		for _, streamChoice := range chunk.Choices {
+			choice, found := choices[streamChoice.Index]
+			if !found {
+				choice = &openai.ChatCompletionChoice{Index: streamChoice.Index}
+				choices[streamChoice.Index] = choice
+			}
+			mergeStreamDelta(choice, streamChoice)
+		}
+	}
+
+	if chunks == 0 {
+		return nil, fmt.Errorf("no chunks found in OpenAI completion stream")
+	}
+
+	completion.Object = "chat.completion"
+	completion.Choices = make([]openai.ChatCompletionChoice, 0, len(choices))
+	for _, choice := range choices {
+		completion.Choices = append(completion.Choices, *choice)
+	}
+	sort.Slice(completion.Choices, func(i, j int) bool {
+		return completion.Choices[i].Index < completion.Choices[j].Index
+	})
+	return completion, nil
+}
+
+// mergeStreamDelta appends the content and tool call fragments from a single chunk to the choice
+func mergeStreamDelta(choice *openai.ChatCompletionChoice, streamChoice openai.ChatCompletionStreamChoice) {
+	delta := streamChoice.Delta
+	if delta.Role != "" {
+		choice.Message.Role = delta.Role
+	}
+	choice.Message.Content += delta.Content
+	if streamChoice.FinishReason != "" {
+		choice.FinishReason = streamChoice.FinishReason
+	}
+
+	for _, toolCall := range delta.ToolCalls {
+		// tool calls are streamed as fragments, and the index identifies the call they belong to
+		index := len(choice.Message.ToolCalls)
+		if toolCall.Index != nil {
+			index = *toolCall.Index
+		}
+		for len(choice.Message.ToolCalls) <= index {
+			choice.Message.ToolCalls = append(choice.Message.ToolCalls, openai.ToolCall{})
+		}
+
+		existing := &choice.Message.ToolCalls[index]
+		if toolCall.ID != "" {
+			existing.ID = toolCall.ID
+		}
+		if toolCall.Type != "" {
+			existing.Type = toolCall.Type
+		}
+		existing.Function.Name += toolCall.Function.Name
+		existing.Function.Arguments += toolCall.Function.Arguments
+	}
+}
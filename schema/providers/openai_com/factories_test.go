@@ -148,3 +148,99 @@ func TestNewOpenAIChatCompletionResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestNewOpenAIChatCompletionStreamResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectError    bool
+		expectedResult *openai.ChatCompletionResponse
+	}{
+		{
+			name: "Stream with usage chunk",
+			body: `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1718416045,"model":"gpt-4o-2024-05-13","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1718416045,"model":"gpt-4o-2024-05-13","choices":[{"index":0,"delta":{"content":"Thank"},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1718416045,"model":"gpt-4o-2024-05-13","choices":[{"index":0,"delta":{"content":" you"},"finish_reason":"stop"}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1718416045,"model":"gpt-4o-2024-05-13","choices":[],"usage":{"prompt_tokens":13,"completion_tokens":2,"total_tokens":15}}
+
+data: [DONE]
+
+`,
+			expectedResult: &openai.ChatCompletionResponse{
+				ID:      "chatcmpl-1",
+				Object:  "chat.completion",
+				Created: 1718416045,
+				Model:   "gpt-4o-2024-05-13",
+				Choices: []openai.ChatCompletionChoice{
+					{
+						Index:        0,
+						Message:      openai.ChatCompletionMessage{Role: "assistant", Content: "Thank you"},
+						FinishReason: "stop",
+					},
+				},
+				Usage: openai.Usage{PromptTokens: 13, CompletionTokens: 2, TotalTokens: 15},
+			},
+		},
+		{
+			name: "Stream with tool call fragments and two choices",
+			body: `data: {"id":"chatcmpl-2","model":"gpt-4o","choices":[{"index":1,"delta":{"role":"assistant","content":"Hi"}}]}
+
+data: {"id":"chatcmpl-2","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}
+
+data: {"id":"chatcmpl-2","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}
+
+data: {"id":"chatcmpl-2","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}
+
+data: [DONE]
+`,
+			expectedResult: &openai.ChatCompletionResponse{
+				ID:     "chatcmpl-2",
+				Object: "chat.completion",
+				Model:  "gpt-4o",
+				Choices: []openai.ChatCompletionChoice{
+					{
+						Index: 0,
+						Message: openai.ChatCompletionMessage{
+							Role: "assistant",
+							ToolCalls: []openai.ToolCall{{
+								ID:       "call_1",
+								Type:     "function",
+								Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`},
+							}},
+						},
+						FinishReason: "tool_calls",
+					},
+					{
+						Index:   1,
+						Message: openai.ChatCompletionMessage{Role: "assistant", Content: "Hi"},
+					},
+				},
+			},
+		},
+		{
+			name:        "Invalid chunk",
+			body:        "data: {\"id\": [}\n\n",
+			expectError: true,
+		},
+		{
+			name:        "No chunks",
+			body:        "data: [DONE]\n\n",
+			expectError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewOpenAIChatCompletionStreamResponse(&tt.body)
+			if tt.expectError {
+				assert.Error(t, err)
+				require.Nil(t, result)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedResult, result)
+		})
+	}
+}
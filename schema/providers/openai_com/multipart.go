@@ -0,0 +1,37 @@
+package openai_com
+
+import (
+	"io"
+	"mime/multipart"
+	"strings"
+)
+
+// multipartFields returns the text fields from a multipart/form-data body. The boundary is read
+// from the first line of the body, because the cost counter doesn't have the request headers.
+// File parts are skipped.
+func multipartFields(body string) map[string]string {
+	fields := make(map[string]string)
+
+	firstLine, _, found := strings.Cut(body, "\n")
+	if !found || !strings.HasPrefix(firstLine, "--") {
+		return fields
+	}
+	boundary := strings.TrimSuffix(strings.TrimPrefix(firstLine, "--"), "\r")
+
+	reader := multipart.NewReader(strings.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			// io.EOF at the end of the body, or a truncated body
+			return fields
+		}
+		if part.FileName() != "" {
+			continue
+		}
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return fields
+		}
+		fields[part.FormName()] = string(value)
+	}
+}
@@ -13,18 +13,29 @@ var pricingDataJSON embed.FS
 // API_Endpoint_Data is populated from init() with data loaded from the embedded JSON file
 var API_Endpoint_Data []APIEndpoint
 
-// Product represents a model or other product attached to an endpoint
+// Product represents a model or other product attached to an endpoint. Cached input tokens,
+// reasoning tokens, and requests sent with the Batch API can have their own per-token prices.
+// Products that are not billed per token use one of the other units: images are priced by
+// "quality/size", audio transcriptions per minute, and text-to-speech per input character.
 type Product struct {
-	Name            string `json:"name"`
-	InputTokenCost  string `json:"inputTokenCost"`
-	OutputTokenCost string `json:"outputTokenCost"`
-	Currency        string `json:"currency"`
+	Name                 string            `json:"name"`
+	InputTokenCost       string            `json:"inputTokenCost,omitempty"`
+	OutputTokenCost      string            `json:"outputTokenCost,omitempty"`
+	CacheReadTokenCost   string            `json:"cacheReadTokenCost,omitempty"`
+	ReasoningTokenCost   string            `json:"reasoningTokenCost,omitempty"`
+	BatchInputTokenCost  string            `json:"batchInputTokenCost,omitempty"`
+	BatchOutputTokenCost string            `json:"batchOutputTokenCost,omitempty"`
+	ImageCost            map[string]string `json:"imageCost,omitempty"`
+	MinuteCost           string            `json:"minuteCost,omitempty"`
+	CharacterCost        string            `json:"characterCost,omitempty"`
+	Currency             string            `json:"currency"`
 }
 
 // APIEndpoint represents the pricing data for a single API endpoint, such as "https://api.openai.com/v1/chat/completions"
 type APIEndpoint struct {
-	URL      string    `json:"url"`
-	Products []Product `json:"products"`
+	URL      string            `json:"url"`
+	Products []Product         `json:"products"`
+	Aliases  map[string]string `json:"aliases,omitempty"` // key: alias, value: product name
 }
 
 func loadEmbeddedDataJSON() error {
@@ -0,0 +1,162 @@
+package openai_com
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+const (
+	hostname           = "api.openai.com"
+	chatCompletionPath = "/v1/chat/completions"
+)
+
+// matchEndpoint returns true if the URL is for the API path on the OpenAI host
+func matchEndpoint(u *url.URL, path string) bool {
+	return strings.EqualFold(u.Hostname(), hostname) && u.Path == path
+}
+
+// endpointName returns the registered name for a provider of a single API path
+func endpointName(path string) string {
+	return hostname + path
+}
+
+// pricingFor converts the embedded pricing data for a single API path
+func pricingFor(path string) []providers.Endpoint {
+	endpoints := make([]providers.Endpoint, 0, 1)
+	for _, endpoint := range API_Endpoint_Data {
+		if endpoint.URL != "https://"+hostname+path {
+			continue
+		}
+		prices := make([]providers.Price, 0, len(endpoint.Products))
+		for _, product := range endpoint.Products {
+			prices = append(prices, providers.Price{
+				Model:                product.Name,
+				Currency:             product.Currency,
+				InputTokenCost:       product.InputTokenCost,
+				OutputTokenCost:      product.OutputTokenCost,
+				CacheReadTokenCost:   product.CacheReadTokenCost,
+				ReasoningTokenCost:   product.ReasoningTokenCost,
+				BatchInputTokenCost:  product.BatchInputTokenCost,
+				BatchOutputTokenCost: product.BatchOutputTokenCost,
+				ImageCosts:           product.ImageCost,
+				MinuteCost:           product.MinuteCost,
+				CharacterCost:        product.CharacterCost,
+			})
+		}
+		endpoints = append(endpoints, providers.Endpoint{URL: endpoint.URL, Prices: prices, Aliases: endpoint.Aliases})
+	}
+	return endpoints
+}
+
+// Provider parses OpenAI chat completion traffic for the cost counter
+type Provider struct{}
+
+func (p *Provider) Name() string {
+	return endpointName(chatCompletionPath)
+}
+
+func (p *Provider) MatchURL(u *url.URL) bool {
+	return matchEndpoint(u, chatCompletionPath)
+}
+
+func (p *Provider) ExtractModel(reqBody string) (string, error) {
+	chatCompReq, err := NewOpenAIChatCompletionRequest(&reqBody)
+	if err != nil {
+		return "", err
+	}
+	return chatCompReq.Model, nil
+}
+
+func (p *Provider) ExtractUsage(reqBody, respBody string) (providers.Usage, error) {
+	if utils.LooksLikeSSE(respBody) {
+		return p.extractStreamUsage(reqBody, respBody)
+	}
+
+	usage, err := parseUsage(respBody)
+	if err != nil {
+		return providers.Usage{}, err
+	}
+	if usage.PromptTokens > 0 || usage.CompletionTokens > 0 {
+		return usage.toUsage(), nil
+	}
+
+	// some compatible servers, and proxies, don't return the usage data
+	chatCompReq, err := NewOpenAIChatCompletionRequest(&reqBody)
+	if err != nil {
+		return providers.Usage{}, err
+	}
+	chatCompResp, err := NewOpenAIChatCompletionResponse(&respBody)
+	if err != nil {
+		return providers.Usage{}, err
+	}
+	return estimateUsage(chatCompReq, chatCompResp), nil
+}
+
+// EstimateRequest counts the prompt tokens before the request is sent, and uses the requested
+// maximum for the output tokens
+func (p *Provider) EstimateRequest(reqBody string) (providers.Usage, error) {
+	chatCompReq, err := NewOpenAIChatCompletionRequest(&reqBody)
+	if err != nil {
+		return providers.Usage{}, err
+	}
+
+	// the go-openai request doesn't have the newer max_completion_tokens field
+	limits := struct {
+		MaxCompletionTokens int `json:"max_completion_tokens"`
+	}{}
+	_ = json.Unmarshal([]byte(reqBody), &limits)
+
+	return providers.Usage{
+		InputTokens:  estimatePromptTokens(chatCompReq),
+		OutputTokens: max(limits.MaxCompletionTokens, chatCompReq.MaxTokens),
+		Estimated:    true,
+	}, nil
+}
+
+// extractStreamUsage reads the usage from the final chunk of a streamed response, which is only
+// sent when the request enabled stream_options.include_usage. Otherwise the usage is estimated.
+func (p *Provider) extractStreamUsage(reqBody, respBody string) (providers.Usage, error) {
+	chatCompResp, err := NewOpenAIChatCompletionStreamResponse(&respBody)
+	if err != nil {
+		return providers.Usage{}, err
+	}
+	if usage := parseStreamUsage(respBody); usage.PromptTokens > 0 || usage.CompletionTokens > 0 {
+		return usage.toUsage(), nil
+	}
+
+	chatCompReq, err := NewOpenAIChatCompletionRequest(&reqBody)
+	if err != nil {
+		return providers.Usage{}, err
+	}
+	return estimateUsage(chatCompReq, chatCompResp), nil
+}
+
+func (p *Provider) ExtractResponseModel(respBody string) (string, error) {
+	parse := NewOpenAIChatCompletionResponse
+	if utils.LooksLikeSSE(respBody) {
+		parse = NewOpenAIChatCompletionStreamResponse
+	}
+	chatCompResp, err := parse(&respBody)
+	if err != nil {
+		return "", err
+	}
+	return chatCompResp.Model, nil
+}
+
+func (p *Provider) Pricing() []providers.Endpoint {
+	return pricingFor(chatCompletionPath)
+}
+
+func init() {
+	providers.Register(&Provider{})
+	providers.Register(&EmbeddingsProvider{})
+	providers.Register(&ImagesProvider{})
+	providers.Register(&TranscriptionProvider{})
+	providers.Register(&SpeechProvider{})
+	providers.Register(&ModerationsProvider{})
+	providers.Register(&BatchOutputProvider{})
+}
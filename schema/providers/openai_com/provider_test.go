@@ -0,0 +1,142 @@
+package openai_com
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+)
+
+func TestProvider(t *testing.T) {
+	u, err := url.Parse("https://api.openai.com/v1/chat/completions")
+	require.NoError(t, err)
+	assert.IsType(t, &Provider{}, providers.Lookup(u), "registered from init()")
+
+	p := &Provider{}
+	t.Run("MatchURL", func(t *testing.T) {
+		for rawURL, expected := range map[string]bool{
+			"https://api.openai.com/v1/chat/completions": true,
+			"http://API.OPENAI.COM/v1/chat/completions":  true,
+			"https://api.openai.com/v1/models":           false,
+			"https://example.com/v1/chat/completions":    false,
+		} {
+			u, err := url.Parse(rawURL)
+			require.NoError(t, err)
+			assert.Equal(t, expected, p.MatchURL(u), rawURL)
+		}
+	})
+
+	t.Run("ExtractModel", func(t *testing.T) {
+		model, err := p.ExtractModel(`{"model": "gpt-4o", "messages": []}`)
+		require.NoError(t, err)
+		assert.Equal(t, "gpt-4o", model)
+
+		_, err = p.ExtractModel(`{`)
+		assert.Error(t, err)
+	})
+
+	t.Run("ExtractUsage", func(t *testing.T) {
+		usage, err := p.ExtractUsage("", `{"usage": {"prompt_tokens": 13, "completion_tokens": 20, "total_tokens": 33}}`)
+		require.NoError(t, err)
+		assert.Equal(t, providers.Usage{InputTokens: 13, OutputTokens: 20}, usage)
+
+		usage, err = p.ExtractUsage("", `{"usage": {"prompt_tokens": 13, "completion_tokens": 20,
+			"prompt_tokens_details": {"cached_tokens": 10}, "completion_tokens_details": {"reasoning_tokens": 15}}}`)
+		require.NoError(t, err)
+		assert.Equal(t, providers.Usage{InputTokens: 3, CacheReadTokens: 10, OutputTokens: 5, ReasoningTokens: 15}, usage)
+
+		_, err = p.ExtractUsage("", `{`)
+		assert.Error(t, err)
+	})
+
+	t.Run("ExtractUsage from stream", func(t *testing.T) {
+		reqBody := `{"model": "gpt-4o", "stream": true, "messages": [{"role": "user", "content": "Hello there"}]}`
+		chunk := `data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"General Kenobi"}}]}` + "\n\n"
+
+		usage, err := p.ExtractUsage(reqBody, chunk+`data: {"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":4}}`+"\n\ndata: [DONE]\n\n")
+		require.NoError(t, err)
+		assert.Equal(t, providers.Usage{InputTokens: 10, OutputTokens: 4}, usage)
+
+		usage, err = p.ExtractUsage(reqBody, chunk+`data: {"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":4,"prompt_tokens_details":{"cached_tokens":8}}}`+"\n\ndata: [DONE]\n\n")
+		require.NoError(t, err)
+		assert.Equal(t, providers.Usage{InputTokens: 2, CacheReadTokens: 8, OutputTokens: 4}, usage)
+
+		// without a usage chunk, counted with the gpt-4o tokenizer: 4 + 2 ("Hello there") + 3 = 9
+		// input, 3 ("General Kenobi") output
+		usage, err = p.ExtractUsage(reqBody, chunk+"data: [DONE]\n\n")
+		require.NoError(t, err)
+		assert.Equal(t, providers.Usage{InputTokens: 9, OutputTokens: 3, Estimated: true}, usage)
+
+		_, err = p.ExtractUsage(`{`, chunk)
+		assert.Error(t, err, "invalid request body, can't estimate")
+
+		_, err = p.ExtractUsage(reqBody, "data: {\n\n")
+		assert.Error(t, err)
+	})
+
+	t.Run("ExtractUsage without usage data", func(t *testing.T) {
+		// my-finetune doesn't have a tokenizer: 4 + 3 ("Hello there") + 3 = 10 input, 4 ("General Kenobi") output
+		reqBody := `{"model": "my-finetune", "messages": [{"role": "user", "content": "Hello there"}]}`
+		usage, err := p.ExtractUsage(reqBody, `{"choices": [{"message": {"role": "assistant", "content": "General Kenobi"}}]}`)
+		require.NoError(t, err)
+		assert.Equal(t, providers.Usage{InputTokens: 10, OutputTokens: 4, Estimated: true}, usage)
+	})
+
+	t.Run("EstimateRequest", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			reqBody  string
+			expected providers.Usage
+		}{
+			{
+				name:     "no max tokens",
+				reqBody:  `{"model": "my-finetune", "messages": [{"role": "user", "content": "Hello there"}]}`,
+				expected: providers.Usage{InputTokens: 10, Estimated: true},
+			},
+			{
+				name:     "max_tokens",
+				reqBody:  `{"model": "my-finetune", "max_tokens": 100, "messages": [{"role": "user", "content": "Hello there"}]}`,
+				expected: providers.Usage{InputTokens: 10, OutputTokens: 100, Estimated: true},
+			},
+			{
+				name:     "max_completion_tokens",
+				reqBody:  `{"model": "my-finetune", "max_completion_tokens": 200, "messages": []}`,
+				expected: providers.Usage{InputTokens: 3, OutputTokens: 200, Estimated: true},
+			},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				usage, err := p.EstimateRequest(tc.reqBody)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, usage)
+			})
+		}
+
+		_, err := p.EstimateRequest(`{`)
+		assert.Error(t, err)
+	})
+
+	t.Run("ExtractResponseModel", func(t *testing.T) {
+		model, err := p.ExtractResponseModel(`{"model": "gpt-4o-2024-08-06", "choices": []}`)
+		require.NoError(t, err)
+		assert.Equal(t, "gpt-4o-2024-08-06", model)
+
+		model, err = p.ExtractResponseModel("data: {\"model\": \"gpt-4o-2024-08-06\", \"choices\": []}\n\ndata: [DONE]\n\n")
+		require.NoError(t, err)
+		assert.Equal(t, "gpt-4o-2024-08-06", model)
+
+		_, err = p.ExtractResponseModel(`{`)
+		assert.Error(t, err)
+	})
+
+	t.Run("Pricing", func(t *testing.T) {
+		pricing := p.Pricing()
+		require.Len(t, pricing, 1, "only the chat completions endpoint")
+		assert.Equal(t, "gpt-4o", pricing[0].Aliases["chatgpt-4o-latest"])
+		assert.Equal(t, API_Endpoint_Data[0].URL, pricing[0].URL)
+		assert.Len(t, pricing[0].Prices, len(API_Endpoint_Data[0].Products))
+	})
+}
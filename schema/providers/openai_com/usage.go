@@ -0,0 +1,73 @@
+package openai_com
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/proxati/llm_proxy/schema/providers"
+	"github.com/proxati/llm_proxy/schema/utils"
+)
+
+// usageDetails is the usage object from a chat completion or embeddings response. The go-openai
+// Usage type doesn't include the token details, which are billed at different rates.
+type usageDetails struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details,omitempty"`
+}
+
+// toUsage converts the usage object, the prompt and completion token counts from the API include
+// the cached and reasoning tokens
+func (u usageDetails) toUsage() providers.Usage {
+	usage := providers.Usage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+	}
+	if u.PromptTokensDetails != nil {
+		usage.CacheReadTokens = min(u.PromptTokensDetails.CachedTokens, u.PromptTokens)
+		usage.InputTokens -= usage.CacheReadTokens
+	}
+	if u.CompletionTokensDetails != nil {
+		usage.ReasoningTokens = min(u.CompletionTokensDetails.ReasoningTokens, u.CompletionTokens)
+		usage.OutputTokens -= usage.ReasoningTokens
+	}
+	return usage
+}
+
+// parseUsage reads the usage object from a JSON response body
+func parseUsage(respBody string) (usageDetails, error) {
+	resp := struct {
+		Usage usageDetails `json:"usage"`
+	}{}
+	if err := json.Unmarshal([]byte(respBody), &resp); err != nil {
+		return usageDetails{}, fmt.Errorf("could not unmarshal OpenAI completion response body: %v", err)
+	}
+	return resp.Usage, nil
+}
+
+// parseStreamUsage reads the usage object from the last chunk of a streamed response that has
+// one. Chunks that can't be parsed are skipped, the stream is validated by the stream factory.
+func parseStreamUsage(respBody string) usageDetails {
+	usage := usageDetails{}
+	for _, event := range utils.ParseSSE(respBody) {
+		data := strings.TrimSpace(event.Data)
+		if data == "" || data == utils.SSEDone {
+			continue
+		}
+
+		chunk := struct {
+			Usage *usageDetails `json:"usage"`
+		}{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil || chunk.Usage == nil {
+			continue
+		}
+		usage = *chunk.Usage
+	}
+	return usage
+}
@@ -0,0 +1,152 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// pricingFileProduct is a single model in a pricing file, the cost fields use the same names as
+// the data.json files embedded in the provider packages
+type pricingFileProduct struct {
+	Name                 string            `json:"name"`
+	InputTokenCost       string            `json:"inputTokenCost,omitempty"`
+	OutputTokenCost      string            `json:"outputTokenCost,omitempty"`
+	CacheWriteTokenCost  string            `json:"cacheWriteTokenCost,omitempty"`
+	CacheReadTokenCost   string            `json:"cacheReadTokenCost,omitempty"`
+	ReasoningTokenCost   string            `json:"reasoningTokenCost,omitempty"`
+	BatchInputTokenCost  string            `json:"batchInputTokenCost,omitempty"`
+	BatchOutputTokenCost string            `json:"batchOutputTokenCost,omitempty"`
+	ImageCost            map[string]string `json:"imageCost,omitempty"`
+	MinuteCost           string            `json:"minuteCost,omitempty"`
+	CharacterCost        string            `json:"characterCost,omitempty"`
+	Currency             string            `json:"currency"`
+	EffectiveFrom        string            `json:"effectiveFrom,omitempty"`  // YYYY-MM-DD or RFC 3339
+	EffectiveUntil       string            `json:"effectiveUntil,omitempty"` // YYYY-MM-DD or RFC 3339, exclusive
+}
+
+type pricingFileEndpoint struct {
+	URL      string               `json:"url"`
+	Products []pricingFileProduct `json:"products"`
+	Aliases  map[string]string    `json:"aliases,omitempty"`
+}
+
+// parseEffectiveDate parses a date, or a timestamp, from a pricing file. Dates are in UTC.
+func parseEffectiveDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// PricingFiles returns the JSON files to load from a pricing path, which can be a single file or
+// a directory. Files in a directory are sorted by name, so later files override earlier ones.
+func PricingFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// LoadPricing loads the pricing tables from a JSON file, or from all JSON files in a directory
+func LoadPricing(path string) ([]Endpoint, error) {
+	files, err := PricingFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading pricing path: %w", err)
+	}
+
+	endpoints := make([]Endpoint, 0)
+	for _, file := range files {
+		fileEndpoints, err := loadPricingFile(file)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, fileEndpoints...)
+	}
+	return endpoints, nil
+}
+
+func loadPricingFile(path string) ([]Endpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading pricing file: %w", err)
+	}
+
+	fileEndpoints := make([]pricingFileEndpoint, 0)
+	if err := json.Unmarshal(data, &fileEndpoints); err != nil {
+		return nil, fmt.Errorf("error parsing pricing file %s: %w", path, err)
+	}
+
+	endpoints := make([]Endpoint, 0, len(fileEndpoints))
+	for i, fileEndpoint := range fileEndpoints {
+		if fileEndpoint.URL == "" {
+			return nil, fmt.Errorf("invalid pricing file %s: endpoint %d: url is required", path, i)
+		}
+
+		endpoint := Endpoint{
+			URL:     fileEndpoint.URL,
+			Prices:  make([]Price, 0, len(fileEndpoint.Products)),
+			Aliases: fileEndpoint.Aliases,
+		}
+		for _, product := range fileEndpoint.Products {
+			price, err := product.toPrice()
+			if err != nil {
+				return nil, fmt.Errorf("invalid pricing file %s: %s: %w", path, fileEndpoint.URL, err)
+			}
+			endpoint.Prices = append(endpoint.Prices, price)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
+}
+
+func (product pricingFileProduct) toPrice() (Price, error) {
+	if product.Name == "" {
+		return Price{}, fmt.Errorf("product name is required")
+	}
+
+	from, err := parseEffectiveDate(product.EffectiveFrom)
+	if err != nil {
+		return Price{}, fmt.Errorf("product %s: invalid effectiveFrom: %w", product.Name, err)
+	}
+	until, err := parseEffectiveDate(product.EffectiveUntil)
+	if err != nil {
+		return Price{}, fmt.Errorf("product %s: invalid effectiveUntil: %w", product.Name, err)
+	}
+	if !from.IsZero() && !until.IsZero() && !until.After(from) {
+		return Price{}, fmt.Errorf("product %s: effectiveUntil must be after effectiveFrom", product.Name)
+	}
+
+	return Price{
+		Model:                product.Name,
+		Currency:             product.Currency,
+		InputTokenCost:       product.InputTokenCost,
+		OutputTokenCost:      product.OutputTokenCost,
+		CacheWriteTokenCost:  product.CacheWriteTokenCost,
+		CacheReadTokenCost:   product.CacheReadTokenCost,
+		ReasoningTokenCost:   product.ReasoningTokenCost,
+		BatchInputTokenCost:  product.BatchInputTokenCost,
+		BatchOutputTokenCost: product.BatchOutputTokenCost,
+		ImageCosts:           product.ImageCost,
+		MinuteCost:           product.MinuteCost,
+		CharacterCost:        product.CharacterCost,
+		EffectiveFrom:        from,
+		EffectiveUntil:       until,
+	}, nil
+}
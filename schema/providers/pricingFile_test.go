@@ -0,0 +1,99 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePricingFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadPricing(t *testing.T) {
+	dir := t.TempDir()
+	file := writePricingFile(t, dir, "10-openai.json", `[{
+		"url": "https://api.openai.com/v1/chat/completions",
+		"products": [
+			{"name": "gpt-4o", "inputTokenCost": "0.0000025", "outputTokenCost": "0.00001", "currency": "USD",
+			 "cacheReadTokenCost": "0.00000125", "reasoningTokenCost": "0.00001",
+			 "batchInputTokenCost": "0.00000125", "batchOutputTokenCost": "0.000005",
+			 "effectiveFrom": "2024-10-01", "effectiveUntil": "2025-01-01T12:00:00Z"}
+		]
+	}]`)
+	writePricingFile(t, dir, "20-images.json", `[{
+		"url": "https://api.openai.com/v1/images/generations",
+		"products": [{"name": "dall-e-3", "imageCost": {"standard/1024x1024": "0.04"}, "currency": "USD"}],
+		"aliases": {"dalle": "dall-e-3"}
+	}]`)
+	writePricingFile(t, dir, "notes.txt", "not a pricing file")
+
+	t.Run("file", func(t *testing.T) {
+		endpoints, err := LoadPricing(file)
+		require.NoError(t, err)
+		require.Len(t, endpoints, 1)
+		assert.Equal(t, Endpoint{
+			URL: "https://api.openai.com/v1/chat/completions",
+			Prices: []Price{{
+				Model:                "gpt-4o",
+				Currency:             "USD",
+				InputTokenCost:       "0.0000025",
+				OutputTokenCost:      "0.00001",
+				CacheReadTokenCost:   "0.00000125",
+				ReasoningTokenCost:   "0.00001",
+				BatchInputTokenCost:  "0.00000125",
+				BatchOutputTokenCost: "0.000005",
+				EffectiveFrom:        time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC),
+				EffectiveUntil:       time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC),
+			}},
+		}, endpoints[0])
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		endpoints, err := LoadPricing(dir)
+		require.NoError(t, err)
+		require.Len(t, endpoints, 2)
+		assert.Equal(t, "https://api.openai.com/v1/chat/completions", endpoints[0].URL)
+		assert.Equal(t, map[string]string{"standard/1024x1024": "0.04"}, endpoints[1].Prices[0].ImageCosts)
+		assert.Equal(t, map[string]string{"dalle": "dall-e-3"}, endpoints[1].Aliases)
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		_, err := LoadPricing(filepath.Join(dir, "missing.json"))
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadPricingInvalid(t *testing.T) {
+	tests := map[string]string{
+		"invalid json":      `[{`,
+		"missing url":       `[{"products": [{"name": "gpt-4o"}]}]`,
+		"missing name":      `[{"url": "https://example.com", "products": [{"inputTokenCost": "1"}]}]`,
+		"invalid date":      `[{"url": "https://example.com", "products": [{"name": "a", "effectiveFrom": "October"}]}]`,
+		"until before from": `[{"url": "https://example.com", "products": [{"name": "a", "effectiveFrom": "2024-10-01", "effectiveUntil": "2024-10-01"}]}]`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := writePricingFile(t, t.TempDir(), "pricing.json", content)
+			_, err := LoadPricing(path)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPriceEffectiveAt(t *testing.T) {
+	from := time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC)
+	until := from.AddDate(0, 1, 0)
+
+	assert.True(t, Price{}.EffectiveAt(from))
+	assert.False(t, Price{EffectiveFrom: from}.EffectiveAt(from.Add(-time.Second)))
+	assert.True(t, Price{EffectiveFrom: from, EffectiveUntil: until}.EffectiveAt(from))
+	assert.False(t, Price{EffectiveFrom: from, EffectiveUntil: until}.EffectiveAt(until))
+}
@@ -0,0 +1,117 @@
+// Package providers defines the interface used by the cost counter to parse and price API
+// traffic. Each API provider lives in a subpackage, and registers itself from init().
+package providers
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+// ErrNotBillable is returned by ExtractUsage for responses on a matched URL that are not billed,
+// e.g., a file download that is not the output of a batch
+var ErrNotBillable = errors.New("response is not billable")
+
+// Usage is the billable usage from a single response. InputTokens does not include the tokens that
+// were written to, or read from, a prompt cache, and OutputTokens does not include the ReasoningTokens
+// used by reasoning models. Batch is true for responses from a batch job, which are billed at the
+// batch rates. Estimated is true when the response did not include usage data, and the counts were
+// estimated from the request and response text.
+//
+// Endpoints that are not billed per token use the other units: Images is the number of generated
+// images of ImageVariant (e.g., "hd/1024x1024"), AudioSeconds is the length of transcribed audio,
+// and Characters is the length of the text converted to speech.
+type Usage struct {
+	InputTokens      int
+	OutputTokens     int
+	CacheWriteTokens int
+	CacheReadTokens  int
+	ReasoningTokens  int
+	Images           int
+	ImageVariant     string
+	AudioSeconds     float64
+	Characters       int
+	Batch            bool
+	Estimated        bool
+}
+
+// Price is the cost of a single model. Empty cache costs are billed at the input rate, empty
+// reasoning costs at the output rate, empty batch costs at the regular input and output rates, and
+// other empty costs are free. A price is only used between EffectiveFrom and EffectiveUntil, when they
+// are set.
+type Price struct {
+	Model                string
+	Currency             string
+	InputTokenCost       string
+	OutputTokenCost      string
+	CacheWriteTokenCost  string
+	CacheReadTokenCost   string
+	ReasoningTokenCost   string
+	BatchInputTokenCost  string
+	BatchOutputTokenCost string
+	ImageCosts           map[string]string // key: image variant, value: cost per image
+	MinuteCost           string            // cost per minute of audio
+	CharacterCost        string            // cost per input character
+	EffectiveFrom        time.Time
+	EffectiveUntil       time.Time
+}
+
+// EffectiveAt returns true if the price is valid at time t
+func (p Price) EffectiveAt(t time.Time) bool {
+	if !p.EffectiveFrom.IsZero() && t.Before(p.EffectiveFrom) {
+		return false
+	}
+	if !p.EffectiveUntil.IsZero() && !t.Before(p.EffectiveUntil) {
+		return false
+	}
+	return true
+}
+
+// Endpoint is the pricing data for a single API endpoint, such as "https://api.openai.com/v1/chat/completions".
+// Aliases maps other model names to the name used in Prices, e.g., "chatgpt-4o-latest" to "gpt-4o".
+type Endpoint struct {
+	URL     string
+	Prices  []Price
+	Aliases map[string]string
+}
+
+// Provider parses the request and response bodies of a single API, and supplies the pricing data
+// for the models served by that API.
+type Provider interface {
+	// Name returns a unique name for this provider, e.g., "openai.com"
+	Name() string
+
+	// MatchURL returns true if the request and response bodies for this URL can be parsed by this provider
+	MatchURL(u *url.URL) bool
+
+	// ExtractModel returns the requested model from a request body
+	ExtractModel(reqBody string) (string, error)
+
+	// ExtractUsage returns the token usage from a response body, which can be a streamed response.
+	// The request body is used to estimate the usage when the response doesn't include it.
+	ExtractUsage(reqBody, respBody string) (Usage, error)
+
+	// Pricing returns the per-token prices, for each endpoint served by this provider
+	Pricing() []Endpoint
+}
+
+// ResponseModelExtractor is implemented by providers that can read the model that served a
+// request from the response body. This can be a dated snapshot of the requested model, e.g.,
+// "gpt-4o-2024-08-06" for a request for "gpt-4o".
+type ResponseModelExtractor interface {
+	ExtractResponseModel(respBody string) (string, error)
+}
+
+// PricingURLResolver is implemented by providers that parse responses for another endpoint's
+// models, e.g., a batch output file with chat completions. The returned URL is used to find the
+// price, instead of the request URL.
+type PricingURLResolver interface {
+	PricingURL(respBody string) (string, error)
+}
+
+// RequestEstimator is implemented by providers that can estimate the usage of a request before
+// it's sent, from the request body. InputTokens is counted from the prompt, and OutputTokens is
+// the maximum output requested by the client, or 0 when it's not set.
+type RequestEstimator interface {
+	EstimateRequest(reqBody string) (Usage, error)
+}
@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make([]Provider, 0)
+)
+
+// Register adds a provider to the registry, it should be called from the init() of the provider
+// package. Registering two providers with the same name panics.
+func Register(p Provider) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if p == nil {
+		panic("providers: Register provider is nil")
+	}
+	for _, existing := range registry {
+		if existing.Name() == p.Name() {
+			panic(fmt.Sprintf("providers: Register called twice for provider %s", p.Name()))
+		}
+	}
+	registry = append(registry, p)
+}
+
+// Lookup returns the first registered provider that matches the URL, or nil
+func Lookup(u *url.URL) Provider {
+	if u == nil {
+		return nil
+	}
+
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	for _, p := range registry {
+		if p.MatchURL(u) {
+			return p
+		}
+	}
+	return nil
+}
+
+// All returns all registered providers, in the order they were registered
+func All() []Provider {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	out := make([]Provider, len(registry))
+	copy(out, registry)
+	return out
+}
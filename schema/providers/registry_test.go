@@ -0,0 +1,67 @@
+package providers
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	name string
+	host string
+}
+
+func (p *fakeProvider) Name() string                               { return p.name }
+func (p *fakeProvider) MatchURL(u *url.URL) bool                   { return strings.EqualFold(u.Hostname(), p.host) }
+func (p *fakeProvider) ExtractModel(string) (string, error)        { return "", nil }
+func (p *fakeProvider) ExtractUsage(string, string) (Usage, error) { return Usage{}, nil }
+func (p *fakeProvider) Pricing() []Endpoint                        { return nil }
+
+// resetRegistry swaps in an empty registry for the duration of a test
+func resetRegistry(t *testing.T) {
+	t.Helper()
+	saved := registry
+	registry = make([]Provider, 0)
+	t.Cleanup(func() { registry = saved })
+}
+
+func TestRegistry(t *testing.T) {
+	resetRegistry(t)
+
+	first := &fakeProvider{name: "first", host: "api.example.com"}
+	second := &fakeProvider{name: "second", host: "api.example.org"}
+	Register(first)
+	Register(second)
+
+	assert.Equal(t, []Provider{first, second}, All())
+
+	tests := []struct {
+		name     string
+		url      string
+		expected Provider
+	}{
+		{name: "first", url: "https://api.example.com/v1/chat", expected: first},
+		{name: "second", url: "https://API.example.org:443/v1/chat", expected: second},
+		{name: "no match", url: "https://api.example.net/v1/chat", expected: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, Lookup(u))
+		})
+	}
+	assert.Nil(t, Lookup(nil))
+}
+
+func TestRegisterInvalid(t *testing.T) {
+	resetRegistry(t)
+
+	Register(&fakeProvider{name: "dupe"})
+	assert.Panics(t, func() { Register(&fakeProvider{name: "dupe"}) })
+	assert.Panics(t, func() { Register(nil) })
+	assert.Len(t, All(), 1)
+}
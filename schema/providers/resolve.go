@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// latestSuffix is the name suffix used by some APIs for the newest snapshot of a model
+const latestSuffix = "-latest"
+
+// fineTunePrefix starts the name of an OpenAI fine-tuned model, e.g., "ft:gpt-4o-mini:org::id"
+const fineTunePrefix = "ft:"
+
+// snapshotSuffix matches the date that identifies a model snapshot, e.g., "-2024-08-06" in
+// "gpt-4o-2024-08-06", "-20241022" in "claude-3-5-sonnet-20241022", or "-0613" in "gpt-4-0613"
+var snapshotSuffix = regexp.MustCompile(`-(\d{4}-\d{2}-\d{2}|\d{8}|\d{4})$`)
+
+// ModelCandidates returns the model names to try when looking up a price, in order of preference:
+// the exact name, its alias, the name with the snapshot date removed, which is also tried with the
+// "-latest" suffix, and then the known names that the model starts with, longest first.
+//
+// A known name only matches up to a "-" or ":" in the model, so "gpt-4o-mini-search-preview-x"
+// resolves to "gpt-4o-mini-search-preview" or "gpt-4o-mini", but "gpt-4o-mini" never resolves to
+// "gpt-4". Fine-tuned models are tried as their base model, e.g., "ft:gpt-4o-mini:org::id" as
+// "gpt-4o-mini".
+//
+// The base models of fine-tuned models and the known prefixes are guesses, which may not have the
+// same price. guessed is the index of the first of those candidates, or len(candidates).
+func ModelCandidates(model string, aliases map[string]string, known []string) (candidates []string, guessed int) {
+	candidates = make([]string, 0, 4)
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		candidates = append(candidates, name)
+		if target, found := aliases[name]; found && !seen[target] {
+			seen[target] = true
+			candidates = append(candidates, target)
+		}
+	}
+	addSnapshots := func(name string) {
+		add(name)
+		prefix := name
+		for {
+			loc := snapshotSuffix.FindStringIndex(prefix)
+			if loc == nil || loc[0] == 0 {
+				break
+			}
+			prefix = prefix[:loc[0]]
+			add(prefix)
+			add(prefix + latestSuffix)
+		}
+	}
+
+	addSnapshots(model)
+	guessed = len(candidates)
+	base := model
+	if strings.HasPrefix(model, fineTunePrefix) {
+		base, _, _ = strings.Cut(strings.TrimPrefix(model, fineTunePrefix), ":")
+		addSnapshots(base)
+	}
+	for _, name := range knownPrefixes(base, aliases, known) {
+		add(name)
+	}
+	return candidates, guessed
+}
+
+// knownPrefixes returns the known names, and aliases, that the model starts with up to a "-" or
+// ":", longest first
+func knownPrefixes(model string, aliases map[string]string, known []string) []string {
+	prefixes := make([]string, 0)
+	isPrefix := func(name string) bool {
+		return name != "" && len(name) < len(model) && strings.HasPrefix(model, name) &&
+			(model[len(name)] == '-' || model[len(name)] == ':')
+	}
+	for _, name := range known {
+		if isPrefix(name) {
+			prefixes = append(prefixes, name)
+		}
+	}
+	for alias := range aliases {
+		if isPrefix(alias) {
+			prefixes = append(prefixes, alias)
+		}
+	}
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		if len(prefixes[i]) != len(prefixes[j]) {
+			return len(prefixes[i]) > len(prefixes[j])
+		}
+		return prefixes[i] < prefixes[j]
+	})
+	return prefixes
+}
@@ -0,0 +1,65 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelCandidates(t *testing.T) {
+	aliases := map[string]string{
+		"chatgpt-4o-latest": "gpt-4o",
+		"gpt-4o":            "gpt-4o-2024-08-06",
+	}
+	known := []string{"gpt-4", "gpt-4o", "gpt-4o-mini", "gpt-4o-mini-search-preview", "gpt-4o-2024-08-06", "claude-3-5-sonnet-latest"}
+
+	tests := []struct {
+		model    string
+		expected []string
+		guessed  int
+	}{
+		{model: "", expected: []string{}, guessed: 0},
+		{model: "gpt-4", expected: []string{"gpt-4"}, guessed: 1},
+		{model: "chatgpt-4o-latest", expected: []string{"chatgpt-4o-latest", "gpt-4o"}, guessed: 2},
+		{
+			model:    "gpt-4o-2024-11-20",
+			expected: []string{"gpt-4o-2024-11-20", "gpt-4o", "gpt-4o-2024-08-06", "gpt-4o-latest"},
+			guessed:  4,
+		},
+		{
+			model:    "gpt-4o-mini-2024-07-18",
+			expected: []string{"gpt-4o-mini-2024-07-18", "gpt-4o-mini", "gpt-4o-mini-latest", "gpt-4o", "gpt-4o-2024-08-06"},
+			guessed:  3,
+		},
+		{
+			model:    "claude-3-5-sonnet-20250101",
+			expected: []string{"claude-3-5-sonnet-20250101", "claude-3-5-sonnet", "claude-3-5-sonnet-latest"},
+			guessed:  3,
+		},
+		{model: "gpt-4-0613", expected: []string{"gpt-4-0613", "gpt-4", "gpt-4-latest"}, guessed: 3},
+		{model: "gpt-3.5-turbo-16k-0613", expected: []string{"gpt-3.5-turbo-16k-0613", "gpt-3.5-turbo-16k", "gpt-3.5-turbo-16k-latest"}, guessed: 3},
+		{
+			model:    "ft:gpt-4o-2024-08-06:org::abc123",
+			expected: []string{"ft:gpt-4o-2024-08-06:org::abc123", "gpt-4o-2024-08-06", "gpt-4o", "gpt-4o-latest"},
+			guessed:  1,
+		},
+		{model: "ft:gpt-4o-mini:org::abc123", expected: []string{"ft:gpt-4o-mini:org::abc123", "gpt-4o-mini", "gpt-4o", "gpt-4o-2024-08-06"}, guessed: 1},
+		{
+			model:    "gpt-4o-mini-search-preview-x",
+			expected: []string{"gpt-4o-mini-search-preview-x", "gpt-4o-mini-search-preview", "gpt-4o-mini", "gpt-4o", "gpt-4o-2024-08-06"},
+			guessed:  1,
+		},
+		{model: "gpt-4o-mini", expected: []string{"gpt-4o-mini", "gpt-4o", "gpt-4o-2024-08-06"}, guessed: 1},
+		{model: "gpt-4-turbo-preview", expected: []string{"gpt-4-turbo-preview", "gpt-4"}, guessed: 1},
+		{model: "gpt-4.5-preview", expected: []string{"gpt-4.5-preview"}, guessed: 1},
+		{model: "-2024", expected: []string{"-2024"}, guessed: 1},
+		{model: "gpt-4-32k", expected: []string{"gpt-4-32k", "gpt-4"}, guessed: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			candidates, guessed := ModelCandidates(tt.model, aliases, known)
+			assert.Equal(t, tt.expected, candidates)
+			assert.Equal(t, tt.guessed, guessed)
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package schema
+
+// ShadowContainer is the result of a request that was mirrored to a candidate backend or model. The
+// client never sees the shadow response. Cost is empty when the response couldn't be priced, and
+// Error is set when the shadow request failed.
+type ShadowContainer struct {
+	Request      *ProxyRequest  `json:"request,omitempty"`
+	Response     *ProxyResponse `json:"response,omitempty"`
+	Duration     int64          `json:"duration_ms"`
+	Model        string         `json:"model,omitempty"`
+	InputTokens  int            `json:"input_tokens,omitempty"`
+	OutputTokens int            `json:"output_tokens,omitempty"`
+	Cost         string         `json:"cost,omitempty"`
+	Currency     string         `json:"currency,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
@@ -0,0 +1,240 @@
+// Package tokenizer counts tokens locally with the byte pair encodings used by OpenAI models, so a
+// request can be priced before it's sent. The vocab files are embedded from the vocab directory,
+// and models without an available encoding return nil from ForModel.
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Encoding names, the vocab file for each is "<name>.tiktoken" in the vocab directory
+const (
+	CL100KBase = "cl100k_base"
+	O200KBase  = "o200k_base"
+)
+
+//go:embed vocab
+var vocabFS embed.FS
+
+// whitespace matches the characters that Python's \s matches, which is used by the tiktoken
+// patterns. Go's \s only matches ASCII whitespace.
+const whitespace = `\s\x{0B}\x{1C}-\x{1F}\x{85}\p{Z}`
+
+// patterns are the pre-tokenization patterns for each encoding. The original patterns end with
+// `\s+(?!\S)|\s+`, Go doesn't support the lookahead so it's applied by splitPieces instead.
+var patterns = map[string]string{
+	CL100KBase: `(?i:'s|'t|'re|'ve|'m|'ll|'d)` +
+		`|[^\r\n\p{L}\p{N}]?\p{L}+` +
+		`|\p{N}{1,3}` +
+		`| ?[^WS\p{L}\p{N}]+[\r\n]*` +
+		`|[WS]*[\r\n]+` +
+		`|[WS]+`,
+	O200KBase: `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}` +
+		`| ?[^WS\p{L}\p{N}]+[\r\n/]*` +
+		`|[WS]*[\r\n]+` +
+		`|[WS]+`,
+}
+
+// modelEncodings maps model name prefixes to encodings, the first matching prefix is used
+var modelEncodings = []struct {
+	prefix   string
+	encoding string
+}{
+	{prefix: "gpt-4o", encoding: O200KBase},
+	{prefix: "chatgpt-4o", encoding: O200KBase},
+	{prefix: "gpt-4.1", encoding: O200KBase},
+	{prefix: "gpt-4.5", encoding: O200KBase},
+	{prefix: "o1", encoding: O200KBase},
+	{prefix: "o3", encoding: O200KBase},
+	{prefix: "o4", encoding: O200KBase},
+	{prefix: "gpt-4", encoding: CL100KBase},
+	{prefix: "gpt-3.5", encoding: CL100KBase},
+	{prefix: "gpt-35", encoding: CL100KBase},
+	{prefix: "text-embedding-", encoding: CL100KBase},
+}
+
+// Encoding is a byte pair encoding, with the token ranks from a vocab file
+type Encoding struct {
+	Name    string
+	pattern *regexp.Regexp
+	ranks   map[string]int // key: token bytes, value: rank, lower ranks are merged first
+}
+
+// newEncoding creates an encoding from the ranks, with the pattern for the encoding name
+func newEncoding(name string, ranks map[string]int) (*Encoding, error) {
+	pattern, found := patterns[name]
+	if !found {
+		return nil, fmt.Errorf("unknown encoding: %s", name)
+	}
+	pattern = strings.ReplaceAll(pattern, "WS", whitespace)
+	return &Encoding{Name: name, pattern: regexp.MustCompile(pattern), ranks: ranks}, nil
+}
+
+// parseRanks reads a tiktoken vocab file, each line is a base64 encoded token and its rank
+func parseRanks(data []byte) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid vocab line %d", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token on vocab line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank on vocab line %d: %w", line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	return ranks, scanner.Err()
+}
+
+// isSpace matches the same characters as the whitespace pattern
+func isSpace(r rune) bool {
+	return unicode.IsSpace(r) || (r >= 0x1C && r <= 0x1F)
+}
+
+// splitPieces splits the text with the pre-tokenization pattern. A run of whitespace that is
+// followed by other text gives back its last character, so it's part of the next piece, which
+// is what `\s+(?!\S)` does in the original patterns.
+func (e *Encoding) splitPieces(text string) []string {
+	pieces := make([]string, 0)
+	for start := 0; start < len(text); {
+		loc := e.pattern.FindStringIndex(text[start:])
+		if loc == nil || loc[0] != 0 || loc[1] == 0 {
+			// not expected, every character is matched by one of the patterns
+			_, size := utf8.DecodeRuneInString(text[start:])
+			pieces = append(pieces, text[start:start+size])
+			start += size
+			continue
+		}
+
+		end := start + loc[1]
+		piece := text[start:end]
+		if end < len(text) && strings.IndexFunc(piece, func(r rune) bool { return !isSpace(r) }) < 0 {
+			last, size := utf8.DecodeLastRuneInString(piece)
+			next, _ := utf8.DecodeRuneInString(text[end:])
+			if last != '\r' && last != '\n' && !isSpace(next) && size < len(piece) {
+				end -= size
+				piece = text[start:end]
+			}
+		}
+		pieces = append(pieces, piece)
+		start = end
+	}
+	return pieces
+}
+
+// bytePairMerge returns the number of tokens in a piece, by merging the adjacent pair with the
+// lowest rank until no pair is in the vocab
+func (e *Encoding) bytePairMerge(piece string) int {
+	if _, found := e.ranks[piece]; found {
+		return 1
+	}
+
+	// boundaries of the current parts, starting with single bytes
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+	for len(parts) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(parts); i++ {
+			rank, found := e.ranks[piece[parts[i]:parts[i+2]]]
+			if found && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return len(parts) - 1
+}
+
+// Count returns the number of tokens in the text
+func (e *Encoding) Count(text string) int {
+	tokens := 0
+	for _, piece := range e.splitPieces(text) {
+		tokens += e.bytePairMerge(piece)
+	}
+	return tokens
+}
+
+var (
+	encodings      = make(map[string]*Encoding) // key: encoding name, nil when the vocab isn't available
+	encodingsMutex sync.Mutex
+)
+
+// loadEncoding returns the encoding with the embedded vocab, or nil when the vocab file isn't
+// embedded. The vocab is only parsed once.
+func loadEncoding(name string) (*Encoding, error) {
+	encodingsMutex.Lock()
+	defer encodingsMutex.Unlock()
+
+	if encoding, found := encodings[name]; found {
+		return encoding, nil
+	}
+
+	data, err := fs.ReadFile(vocabFS, "vocab/"+name+".tiktoken")
+	if err != nil {
+		encodings[name] = nil
+		return nil, nil
+	}
+	ranks, err := parseRanks(data)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s vocab: %w", name, err)
+	}
+	encoding, err := newEncoding(name, ranks)
+	if err != nil {
+		return nil, err
+	}
+	encodings[name] = encoding
+	return encoding, nil
+}
+
+// EncodingName returns the name of the encoding used by a model, or "" for models that don't use
+// one of the OpenAI encodings
+func EncodingName(model string) string {
+	for _, entry := range modelEncodings {
+		if strings.HasPrefix(model, entry.prefix) {
+			return entry.encoding
+		}
+	}
+	return ""
+}
+
+// ForModel returns the encoding used by a model, or nil when the model doesn't use one of the
+// OpenAI encodings, or its vocab file isn't embedded
+func ForModel(model string) *Encoding {
+	name := EncodingName(model)
+	if name == "" {
+		return nil
+	}
+	encoding, err := loadEncoding(name)
+	if err != nil {
+		// only an invalid embedded file, which is a build problem
+		panic(err)
+	}
+	return encoding
+}
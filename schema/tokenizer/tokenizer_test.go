@@ -0,0 +1,115 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPieces(t *testing.T) {
+	testCases := []struct {
+		encoding string
+		text     string
+		expected []string
+	}{
+		{
+			encoding: CL100KBase,
+			text:     "Hello world  foo\n\nbar's 12345",
+			expected: []string{"Hello", " world", " ", " foo", "\n\n", "bar", "'s", " ", "123", "45"},
+		},
+		{
+			encoding: CL100KBase,
+			text:     "x = {\"a\": 1}  ",
+			expected: []string{"x", " =", " {\"", "a", "\":", " ", "1", "}", "  "},
+		},
+		{
+			encoding: O200KBase,
+			text:     "HelloWorld I'm here",
+			expected: []string{"Hello", "World", " I'm", " here"},
+		},
+		{
+			encoding: O200KBase,
+			text:     "path/to\n  x",
+			expected: []string{"path", "/to", "\n", " ", " x"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.encoding+" "+tc.text, func(t *testing.T) {
+			encoding, err := newEncoding(tc.encoding, map[string]int{})
+			require.NoError(t, err)
+			pieces := encoding.splitPieces(tc.text)
+			assert.Equal(t, tc.expected, pieces)
+			assert.Equal(t, tc.text, strings.Join(pieces, ""), "no text is lost")
+		})
+	}
+}
+
+func TestCount(t *testing.T) {
+	vocab := make([]string, 0)
+	for rank, token := range []string{"a", "b", "c", " ", "ab", "abc", " abc"} {
+		vocab = append(vocab, fmt.Sprintf("%s %d", base64.StdEncoding.EncodeToString([]byte(token)), rank))
+	}
+	ranks, err := parseRanks([]byte(strings.Join(vocab, "\n") + "\n"))
+	require.NoError(t, err)
+	require.Len(t, ranks, 7)
+
+	encoding, err := newEncoding(CL100KBase, ranks)
+	require.NoError(t, err)
+	assert.Equal(t, 1, encoding.bytePairMerge("abc"))
+	assert.Equal(t, 2, encoding.bytePairMerge(" abcab"), `" abc" + "ab"`)
+	assert.Equal(t, 3, encoding.Count("abc abcab"))
+	assert.Equal(t, 0, encoding.Count(""))
+	assert.Equal(t, 3, encoding.bytePairMerge("xyz"), "unknown bytes are one token each")
+
+	_, err = newEncoding("p50k_base", ranks)
+	assert.Error(t, err)
+}
+
+func TestParseRanksInvalid(t *testing.T) {
+	for _, data := range []string{"YQ==", "not-base64! 1", "YQ== one"} {
+		_, err := parseRanks([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestEncodingName(t *testing.T) {
+	assert.Equal(t, O200KBase, EncodingName("gpt-4o-mini"))
+	assert.Equal(t, O200KBase, EncodingName("o3-mini"))
+	assert.Equal(t, CL100KBase, EncodingName("gpt-4-turbo"))
+	assert.Equal(t, CL100KBase, EncodingName("text-embedding-3-small"))
+	assert.Equal(t, "", EncodingName("claude-3-5-haiku-latest"))
+	assert.Nil(t, ForModel("claude-3-5-haiku-latest"))
+}
+
+func TestCountEmbeddedVocab(t *testing.T) {
+	// token counts from the tiktoken reference implementation
+	testCases := []struct {
+		text   string
+		cl100k int
+		o200k  int
+	}{
+		{text: "hello world", cl100k: 2, o200k: 2},
+		{text: "tiktoken is great!", cl100k: 6, o200k: 6},
+		{text: "antidisestablishmentarianism", cl100k: 6, o200k: 6},
+		{text: "2 + 2 = 4", cl100k: 7, o200k: 7},
+		{text: "お誕生日おめでとう", cl100k: 9, o200k: 8},
+	}
+
+	cl100k := ForModel("gpt-4-turbo")
+	require.NotNil(t, cl100k, "the cl100k_base vocab is embedded")
+	assert.Equal(t, CL100KBase, cl100k.Name)
+	o200k := ForModel("gpt-4o-mini")
+	require.NotNil(t, o200k, "the o200k_base vocab is embedded")
+	assert.Equal(t, O200KBase, o200k.Name)
+
+	for _, tc := range testCases {
+		t.Run(tc.text, func(t *testing.T) {
+			assert.Equal(t, tc.cl100k, cl100k.Count(tc.text), CL100KBase)
+			assert.Equal(t, tc.o200k, o200k.Count(tc.text), O200KBase)
+		})
+	}
+}
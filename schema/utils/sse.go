@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"strings"
+)
+
+const (
+	sseDataPrefix  = "data:"
+	sseEventPrefix = "event:"
+
+	// SSEDone is the final data payload in an OpenAI stream
+	SSEDone = "[DONE]"
+)
+
+// SSEEvent is a single server-sent event from a streamed response body
+type SSEEvent struct {
+	Event string
+	Data  string
+}
+
+// IsSSE returns true if the Content-Type header value is for a server-sent event stream
+func IsSSE(contentType string) bool {
+	return strings.HasPrefix(strings.TrimSpace(strings.ToLower(contentType)), "text/event-stream")
+}
+
+// LooksLikeSSE returns true if the body starts with an SSE field, for bodies without a content type
+func LooksLikeSSE(body string) bool {
+	trimmed := strings.TrimLeft(body, " \r\n")
+	return strings.HasPrefix(trimmed, sseDataPrefix) || strings.HasPrefix(trimmed, sseEventPrefix)
+}
+
+// trimField removes the field name and the optional single space after the colon
+func trimField(line, prefix string) string {
+	value := strings.TrimPrefix(line, prefix)
+	return strings.TrimPrefix(value, " ")
+}
+
+// ParseSSE splits a fully buffered text/event-stream body into events. Multi-line data fields
+// are joined with a newline, as described in the SSE spec.
+func ParseSSE(body string) []SSEEvent {
+	events := make([]SSEEvent, 0)
+	current := SSEEvent{}
+	dataLines := make([]string, 0)
+
+	flush := func() {
+		if len(dataLines) > 0 || current.Event != "" {
+			current.Data = strings.Join(dataLines, "\n")
+			events = append(events, current)
+		}
+		current = SSEEvent{}
+		dataLines = dataLines[:0]
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, sseDataPrefix):
+			dataLines = append(dataLines, trimField(line, sseDataPrefix))
+		case strings.HasPrefix(line, sseEventPrefix):
+			current.Event = trimField(line, sseEventPrefix)
+		}
+	}
+	flush()
+	return events
+}
+
+// MapSSEData rewrites every data field in the body with fn, other lines are not changed
+func MapSSEData(body string, fn func(data string) string) string {
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		hasCR := strings.HasSuffix(line, "\r")
+		line = strings.TrimSuffix(line, "\r")
+		if !strings.HasPrefix(line, sseDataPrefix) {
+			continue
+		}
+
+		newLine := sseDataPrefix + " " + fn(trimField(line, sseDataPrefix))
+		if hasCR {
+			newLine += "\r"
+		}
+		lines[i] = newLine
+	}
+	return strings.Join(lines, "\n")
+}
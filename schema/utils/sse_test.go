@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSSEBody = `data: {"id":"1","choices":[{"delta":{"content":"Hel"}}]}
+
+data: {"id":"1","choices":[{"delta":{"content":"lo"}}]}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+data: [DONE]
+
+`
+
+func TestIsSSE(t *testing.T) {
+	assert.True(t, IsSSE("text/event-stream"))
+	assert.True(t, IsSSE("text/event-stream; charset=utf-8"))
+	assert.False(t, IsSSE("application/json"))
+	assert.False(t, IsSSE(""))
+}
+
+func TestLooksLikeSSE(t *testing.T) {
+	assert.True(t, LooksLikeSSE(testSSEBody))
+	assert.True(t, LooksLikeSSE("\nevent: ping\n"))
+	assert.False(t, LooksLikeSSE(`{"data": "json"}`))
+}
+
+func TestParseSSE(t *testing.T) {
+	events := ParseSSE(testSSEBody)
+	assert.Equal(t, []SSEEvent{
+		{Data: `{"id":"1","choices":[{"delta":{"content":"Hel"}}]}`},
+		{Data: `{"id":"1","choices":[{"delta":{"content":"lo"}}]}`},
+		{Event: "message_stop", Data: `{"type":"message_stop"}`},
+		{Data: SSEDone},
+	}, events)
+
+	t.Run("multi-line data and CRLF", func(t *testing.T) {
+		events := ParseSSE("data:line1\r\ndata: line2\r\n\r\n")
+		assert.Equal(t, []SSEEvent{{Data: "line1\nline2"}}, events)
+	})
+
+	t.Run("empty body", func(t *testing.T) {
+		assert.Empty(t, ParseSSE(""))
+	})
+}
+
+func TestMapSSEData(t *testing.T) {
+	out := MapSSEData(testSSEBody, func(data string) string {
+		return strings.ReplaceAll(data, "Hel", "Jel")
+	})
+	assert.Contains(t, out, `data: {"id":"1","choices":[{"delta":{"content":"Jel"}}]}`)
+	assert.Contains(t, out, "event: message_stop\n")
+	assert.Equal(t, len(testSSEBody), len(out))
+}